@@ -0,0 +1,650 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// adviseIndexName names the candidate index being tried in the scratch
+// database.
+const adviseIndexName = "vsqlite_advise"
+
+var (
+	// fullScanRe matches a plan line reading a whole table, or building
+	// an automatic index for it, which SQLite only does for a missing
+	// index. Older versions say SCAN TABLE t AS a.
+	fullScanRe = regexp.MustCompile(
+		`^(SCAN|SEARCH) (?:TABLE )?(\S+)(?: AS (\S+))?( USING AUTOMATIC )?`,
+	)
+
+	// candidateSearchRe matches a plan line looking rows up with the
+	// candidate index.
+	candidateSearchRe = regexp.MustCompile(
+		`^SEARCH .* USING (?:COVERING )?INDEX ` + adviseIndexName + `\b`,
+	)
+
+	// filterClauseRe splits a statement at the keywords starting the
+	// clauses that name columns: the ones that filter, join or order
+	// rows, and the ones after which columns are only read or written.
+	filterClauseRe = regexp.MustCompile(`(?i)\b(?:(WHERE|ON|USING|BY|` +
+		`HAVING)|SELECT|FROM|SET|LIMIT|VALUES|RETURNING)\b`)
+
+	// plannedStatementRe matches the statements the advisor explains.
+	plannedStatementRe = regexp.MustCompile(
+		`(?i)^\s*(?:SELECT|WITH|UPDATE|DELETE|INSERT|REPLACE)\b`,
+	)
+)
+
+// tableScans counts the workload queries reading a whole table, and the
+// columns they filter, join or sort it on.
+type tableScans struct {
+	table   string
+	queries int
+	columns map[string]int
+}
+
+// indexCandidate is an index that may help the workload, and the
+// statements the query planner would use it for, by their position in the
+// workload.
+type indexCandidate struct {
+	table   string
+	columns []string
+	helped  map[int]bool
+}
+
+func (c *indexCandidate) key() string {
+	return strings.ToLower(c.table + "\x00" + strings.Join(c.columns, "\x00"))
+}
+
+// createSQL returns the statement creating the index.
+func (c *indexCandidate) createSQL() string {
+	name := "idx_" + c.table + "_" + strings.Join(c.columns, "_")
+	cols := make([]string, len(c.columns))
+	for i, col := range c.columns {
+		cols[i] = quoteIdentIfNeeded(col)
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s);",
+		quoteIdentIfNeeded(name), quoteIdentIfNeeded(c.table),
+		strings.Join(cols, ", "))
+}
+
+// covers reports whether the index serves every statement other does, and
+// leads with its columns, which makes other redundant.
+func (c *indexCandidate) covers(other *indexCandidate) bool {
+	if c == other || c.table != other.table ||
+		len(c.columns) <= len(other.columns) {
+
+		return false
+	}
+	for i, col := range other.columns {
+		if !strings.EqualFold(c.columns[i], col) {
+			return false
+		}
+	}
+	for stmt := range other.helped {
+		if !c.helped[stmt] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexAdvice is what adviseIndexes found in a workload.
+type indexAdvice struct {
+	statements int
+	skipped    int
+	scans      []*tableScans
+	candidates []*indexCandidate
+}
+
+// workloadStatements returns the distinct statements of a workload the
+// advisor can explain, leaving out meta-commands and the like.
+func workloadStatements(entries []string) []string {
+	var stmts []string
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		scanner := newStatementScanner(strings.NewReader(entry))
+		for {
+			stmt, err := scanner.next()
+			if err != nil {
+				break
+			}
+			if !plannedStatementRe.MatchString(stmt) {
+				continue
+			}
+
+			key := strings.Join(strings.Fields(stmt), " ")
+			if !seen[key] {
+				seen[key] = true
+				stmts = append(stmts, stmt)
+			}
+		}
+	}
+	return stmts
+}
+
+// explainPlan returns the details of EXPLAIN QUERY PLAN for a statement,
+// with its parameters bound to NULL, which doesn't change the plan.
+func explainPlan(ctx context.Context, c *sql.Conn,
+	stmt string) ([]string, error) {
+
+	n := 0
+	for _, p := range statementParams(stmt) {
+		n = max(n, p.index)
+	}
+	rows, err := c.QueryContext(ctx, "EXPLAIN QUERY PLAN "+stmt,
+		make([]interface{}, n)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plan []string
+	for rows.Next() {
+		var id, parent, notUsed int64
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+		plan = append(plan, detail)
+	}
+	return plan, rows.Err()
+}
+
+// filterColumns returns the columns of a table a statement filters, joins
+// or sorts on, and which of them it compares for equality, which go first
+// in an index.
+func filterColumns(stmt string, cols []string) ([]string, map[string]bool) {
+	blanked := blankLiterals(stmt)
+
+	var filters strings.Builder
+	clauses := filterClauseRe.FindAllStringSubmatchIndex(blanked, -1)
+	for i, m := range clauses {
+		if m[2] < 0 {
+			continue
+		}
+		end := len(blanked)
+		if i+1 < len(clauses) {
+			end = clauses[i+1][0]
+		}
+		filters.WriteString(blanked[m[1]:end])
+		filters.WriteString("\n")
+	}
+
+	var used []string
+	equal := make(map[string]bool)
+	for _, col := range cols {
+		ref := `(?:\b` + regexp.QuoteMeta(col) + `\b|"` +
+			regexp.QuoteMeta(strings.ReplaceAll(col, `"`, `""`)) + `")`
+		if !regexp.MustCompile(`(?i)(?:^|[^\w$])` + ref +
+			`(?:[^\w$]|$)`).MatchString(filters.String()) {
+
+			continue
+		}
+		used = append(used, col)
+
+		eqRe := regexp.MustCompile(`(?i)(?:^|[^\w$])` + ref +
+			`\s*(?:==?|IN\b|IS\b(?:\s+NOT\b)?)|(?:[^<>!]=|==)\s*` +
+			`(?:[\w$]+\.|"(?:[^"]|"")*"\.)?` + ref)
+		if eqRe.MatchString(filters.String()) {
+			equal[col] = true
+		}
+	}
+	return used, equal
+}
+
+// scannedTables returns the tables a plan reads in full, by their names in
+// the schema.
+func scannedTables(stmt string, plan []string,
+	tables map[string]*schemaTable) []*schemaTable {
+
+	var scanned []*schemaTable
+	seen := make(map[*schemaTable]bool)
+	for _, line := range plan {
+		m := fullScanRe.FindStringSubmatch(line)
+		if m == nil || m[1] == "SEARCH" && m[4] == "" {
+			continue
+		}
+		name := m[2]
+		if m[3] != "" {
+			name = m[3]
+		}
+		t := tables[strings.ToLower(resolveTableAlias(stmt, name))]
+		if t != nil && !seen[t] {
+			seen[t] = true
+			scanned = append(scanned, t)
+		}
+	}
+	return scanned
+}
+
+// hasIndexOn reports whether an index of the table, or its rowid, already
+// leads with the columns.
+func hasIndexOn(t *schemaTable, cols []string) bool {
+	for _, col := range t.Columns {
+		if len(cols) == 1 && strings.EqualFold(col.Name, cols[0]) &&
+			isRowidAlias(t, col) {
+
+			return true
+		}
+	}
+
+	for _, idx := range t.Indexes {
+		if idx.Partial || len(idx.Columns) < len(cols) {
+			continue
+		}
+		prefix := true
+		for i, col := range cols {
+			prefix = prefix && strings.EqualFold(idx.Columns[i], col)
+		}
+		if prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// newScratchDatabase returns a connection to an in-memory database with the
+// schema of the objects and none of the rows, for trying out indexes
+// without building them. Objects that can't be created there, like virtual
+// tables of modules the driver lacks, are left out.
+func newScratchDatabase(ctx context.Context, objs []schemaObject) (*sql.DB,
+	*sql.Conn, error) {
+
+	scratch, err := activeDriver.open(":memory:")
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := scratch.Conn(ctx)
+	if err != nil {
+		scratch.Close()
+		return nil, nil, err
+	}
+
+	for _, o := range objs {
+		if o.typ == "trigger" || isShadowTable(o.name, objs) {
+			continue
+		}
+		c.ExecContext(ctx, o.sql)
+	}
+	return scratch, c, nil
+}
+
+// adviseIndexes explains the statements of a workload on c to find the
+// tables they read in full, then tries indexes on the columns those
+// statements filter, join and sort on in a scratch copy of the schema. An
+// index helps a statement if the query planner would look rows up with it
+// instead. Without rows and statistics in the scratch database, the
+// planner assumes tables are large, so the candidates are what would help
+// as tables grow.
+func adviseIndexes(ctx context.Context, c *sql.Conn,
+	stmts []string) (*indexAdvice, error) {
+
+	objs, err := readSchemaObjects(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	tables := make(map[string]*schemaTable)
+	for _, o := range objs {
+		if o.typ != "table" || isShadowTable(o.name, objs) ||
+			strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL") {
+
+			continue
+		}
+		t, err := readSchemaTable(ctx, c, o)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", o.name, err)
+		}
+		tables[strings.ToLower(o.name)] = &t
+	}
+
+	advice := &indexAdvice{statements: len(stmts)}
+	scans := make(map[*schemaTable]*tableScans)
+	candidates := make(map[string]int)
+	scanning := make(map[int][]string)
+
+	addCandidate := func(t *schemaTable, cols []string) {
+		cand := &indexCandidate{table: t.Name, columns: cols}
+		if _, ok := candidates[cand.key()]; ok || hasIndexOn(t, cols) {
+			return
+		}
+		candidates[cand.key()] = len(advice.candidates)
+		advice.candidates = append(advice.candidates, cand)
+	}
+
+	for i, stmt := range stmts {
+		plan, err := explainPlan(ctx, c, stmt)
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if err != nil {
+			advice.skipped++
+			continue
+		}
+
+		for _, t := range scannedTables(stmt, plan, tables) {
+			s := scans[t]
+			if s == nil {
+				s = &tableScans{table: t.Name,
+					columns: make(map[string]int)}
+				scans[t] = s
+				advice.scans = append(advice.scans, s)
+			}
+			s.queries++
+			scanning[i] = append(scanning[i], t.Name)
+
+			names := make([]string, len(t.Columns))
+			for i, col := range t.Columns {
+				names[i] = col.Name
+			}
+			used, equal := filterColumns(stmt, names)
+
+			// Each column on its own, and the ones compared for
+			// equality followed by one that is searched by range or
+			// sorted on.
+			var composite []string
+			for _, col := range used {
+				s.columns[col]++
+				addCandidate(t, []string{col})
+				if equal[col] {
+					composite = append(composite, col)
+				}
+			}
+			for _, col := range used {
+				if !equal[col] {
+					composite = append(composite, col)
+					break
+				}
+			}
+			if len(composite) > 1 {
+				addCandidate(t, composite)
+			}
+		}
+	}
+	if len(advice.candidates) == 0 {
+		return advice, nil
+	}
+
+	scratch, sc, err := newScratchDatabase(ctx, objs)
+	if err != nil {
+		return nil, err
+	}
+	defer scratch.Close()
+	defer sc.Close()
+
+	// Each candidate is tried on its own, as the only index added, on the
+	// statements reading its table in full.
+	for _, cand := range advice.candidates {
+		_, err := sc.ExecContext(ctx, fmt.Sprintf("CREATE INDEX %s "+
+			"ON %s (%s)", adviseIndexName, quoteIdent(cand.table),
+			quoteIdents(cand.columns)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cand.table, err)
+		}
+
+		cand.helped = make(map[int]bool)
+		for i, stmt := range stmts {
+			if !contains(scanning[i], cand.table) {
+				continue
+			}
+			plan, err := explainPlan(ctx, sc, stmt)
+			if errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			for _, line := range plan {
+				if candidateSearchRe.MatchString(line) {
+					cand.helped[i] = true
+				}
+			}
+		}
+
+		_, err = sc.ExecContext(ctx, "DROP INDEX "+adviseIndexName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var useful []*indexCandidate
+	for _, cand := range advice.candidates {
+		redundant := len(cand.helped) == 0
+		for _, other := range advice.candidates {
+			redundant = redundant || other.covers(cand)
+		}
+		if !redundant {
+			useful = append(useful, cand)
+		}
+	}
+	advice.candidates = useful
+
+	sort.SliceStable(advice.scans, func(i, j int) bool {
+		return advice.scans[i].queries > advice.scans[j].queries
+	})
+	sort.SliceStable(advice.candidates, func(i, j int) bool {
+		a, b := advice.candidates[i], advice.candidates[j]
+		if len(a.helped) != len(b.helped) {
+			return len(a.helped) > len(b.helped)
+		}
+		return len(a.columns) < len(b.columns)
+	})
+	return advice, nil
+}
+
+// printIndexAdvice prints the full scans of the workload and the indexes
+// suggested for them, most helpful first.
+func printIndexAdvice(advice *indexAdvice, source string) {
+	fmt.Printf("Analyzed %d statements from %s", advice.statements, source)
+	if advice.skipped > 0 {
+		fmt.Printf(", %d couldn't be explained", advice.skipped)
+	}
+	fmt.Println(".")
+
+	if len(advice.scans) == 0 {
+		fmt.Println("No full table scans found.")
+		return
+	}
+
+	fmt.Println("\nFull table scans:")
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Table", "Queries", "Filtered on"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 2, Align: text.AlignRight},
+	})
+	for _, s := range advice.scans {
+		cols := make([]string, 0, len(s.columns))
+		for col := range s.columns {
+			cols = append(cols, col)
+		}
+		sort.Slice(cols, func(i, j int) bool {
+			if s.columns[cols[i]] != s.columns[cols[j]] {
+				return s.columns[cols[i]] > s.columns[cols[j]]
+			}
+			return cols[i] < cols[j]
+		})
+		for i, col := range cols {
+			cols[i] = fmt.Sprintf("%s (%d)", col, s.columns[col])
+		}
+		t.AppendRow(table.Row{s.table, s.queries, strings.Join(cols, ", ")})
+	}
+	t.Render()
+
+	if len(advice.candidates) == 0 {
+		fmt.Println("\nNo index would help, the scans read most of " +
+			"their tables or filter on expressions.")
+		return
+	}
+
+	fmt.Println("\nSuggested indexes:")
+	t = table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Queries", "Index"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignRight},
+	})
+	for _, cand := range advice.candidates {
+		t.AppendRow(table.Row{len(cand.helped), cand.createSQL()})
+	}
+	t.Render()
+
+	fmt.Println("HINT: the planner's choice depends on the data, " +
+		"check the plans with EXPLAIN QUERY PLAN after creating " +
+		"an index and running ANALYZE.")
+}
+
+// readWorkloadFile returns the statements of a workload file, one or more
+// per line separated by semicolons like a script.
+func readWorkloadFile(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return workloadStatements([]string{string(data)}), nil
+}
+
+// databaseHistory returns the history of the database at path and the file
+// it is in, the shared one for databases without a history of their own.
+func databaseHistory(path string) ([]string, string, error) {
+	file := databaseHistoryFile(path)
+	entries, err := readHistoryFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		file = getHistoryFilePath()
+		entries, err = readHistoryFile(file)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return entries, file, err
+}
+
+// handleAdviseCommand suggests indexes for the statements in the history
+// of the session, or in a workload file.
+func handleAdviseCommand(args []string) error {
+	// Scripts and -c commands don't load the history.
+	source := "the history"
+	entries := historyLines
+	if historyFile == "" {
+		var err error
+		entries, source, err = databaseHistory(dbPath)
+		if err != nil {
+			fmt.Printf("Advise error: %v\n", err)
+			return err
+		}
+		entries = append(entries, historyLines...)
+	}
+
+	stmts := workloadStatements(entries)
+	if len(args) == 1 {
+		var err error
+		source = args[0]
+		stmts, err = readWorkloadFile(args[0])
+		if err != nil {
+			fmt.Printf("Advise error: %v\n", err)
+			return err
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	advice, err := adviseIndexes(ctx, conn, stmts)
+	if err != nil {
+		fmt.Printf("Advise error: %v\n", err)
+		return err
+	}
+	printIndexAdvice(advice, source)
+	return nil
+}
+
+// adviseFlags are the options of the advise subcommand.
+var adviseFlags struct {
+	workload string
+}
+
+// defineAdviseFlags defines the options of the advise subcommand.
+func defineAdviseFlags(fs *flag.FlagSet) {
+	fs.StringVar(&adviseFlags.workload, "f", "", "analyze the statements "+
+		"in this file (- for stdin) instead of the history")
+}
+
+// runAdviseCommand suggests indexes for the statements in the history of a
+// database, or in a workload file.
+func runAdviseCommand(args []string) int {
+	fs := newSubcommandFlags("advise")
+	fs.Parse(args)
+	workload := adviseFlags.workload
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+	path := fs.Arg(0)
+
+	var stmts []string
+	source := workload
+	if workload != "" {
+		var err error
+		stmts, err = readWorkloadFile(workload)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Advise error: %v\n", err)
+			return 1
+		}
+	} else {
+		var entries []string
+		var err error
+		entries, source, err = databaseHistory(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Advise error: %v\n", err)
+			return 1
+		}
+		stmts = workloadStatements(entries)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	db, err := openDatabase(path, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Advise error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Advise error: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	advice, err := adviseIndexes(ctx, c, stmts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Advise error: %v\n", err)
+		return 1
+	}
+	printIndexAdvice(advice, source)
+	return 0
+}
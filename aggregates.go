@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// aggregator accumulates the rows of one aggregate or window function call.
+type aggregator interface {
+	// step adds a row.
+	step(args []driver.Value) error
+
+	// inverse removes a row added before, as the window moves on.
+	inverse(args []driver.Value) error
+
+	// result returns the value for the rows added so far.
+	result() (driver.Value, error)
+}
+
+// aggregateFunc is an aggregate function implemented in Go, registered on
+// every connection of the local drivers like the collations.
+type aggregateFunc struct {
+	name  string
+	nargs int
+	usage string
+	desc  string
+	new   func() aggregator
+}
+
+var aggregates = []aggregateFunc{
+	{
+		name:  "percentile",
+		nargs: 2,
+		usage: "percentile(x, p)",
+		desc:  "the p-th percentile, 0 to 100, interpolated",
+		new: func() aggregator {
+			return &percentileAgg{name: "percentile"}
+		},
+	},
+	{
+		name:  "median",
+		nargs: 1,
+		usage: "median(x)",
+		desc:  "the middle value, the 50th percentile",
+		new: func() aggregator {
+			return &percentileAgg{name: "median", p: 50, fixed: true}
+		},
+	},
+	{
+		name:  "stddev",
+		nargs: 1,
+		usage: "stddev(x)",
+		desc:  "the sample standard deviation",
+		new: func() aggregator {
+			return &stddevAgg{}
+		},
+	},
+}
+
+// numericArg converts an argument to a number. NULLs are skipped, like
+// the built-in aggregates do.
+func numericArg(fn string, v driver.Value) (float64, bool, error) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false, nil
+	case int64:
+		return float64(v), true, nil
+	case float64:
+		return v, true, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err == nil {
+			return f, true, nil
+		}
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		if err == nil {
+			return f, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%s: non-numeric value %s", fn,
+		formatValue(v))
+}
+
+// percentileAgg keeps the values to pick the percentile from.
+type percentileAgg struct {
+	name string
+	vals []float64
+
+	// p is the percentile, fixed for median and taken from the first
+	// row for percentile.
+	p     float64
+	fixed bool
+	pSet  bool
+}
+
+func (a *percentileAgg) percentile(args []driver.Value) error {
+	if a.fixed {
+		return nil
+	}
+
+	p, ok, err := numericArg(a.name, args[1])
+	if err != nil || !ok || p < 0 || p > 100 {
+		return fmt.Errorf("%s: the percentile must be a number from 0 "+
+			"to 100", a.name)
+	}
+	if a.pSet && p != a.p {
+		return fmt.Errorf("%s: the percentile must be the same for all "+
+			"rows", a.name)
+	}
+	a.p, a.pSet = p, true
+
+	return nil
+}
+
+func (a *percentileAgg) step(args []driver.Value) error {
+	if err := a.percentile(args); err != nil {
+		return err
+	}
+
+	v, ok, err := numericArg(a.name, args[0])
+	if ok {
+		a.vals = append(a.vals, v)
+	}
+	return err
+}
+
+func (a *percentileAgg) inverse(args []driver.Value) error {
+	v, ok, err := numericArg(a.name, args[0])
+	if err != nil || !ok {
+		return err
+	}
+
+	for i, x := range a.vals {
+		if x == v {
+			a.vals = append(a.vals[:i], a.vals[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// result interpolates between the two values closest to the percentile,
+// as SQLite's percentile extension does.
+func (a *percentileAgg) result() (driver.Value, error) {
+	if len(a.vals) == 0 {
+		return nil, nil
+	}
+
+	// Window functions ask for results in between steps, so sort a copy.
+	vals := append([]float64(nil), a.vals...)
+	sort.Float64s(vals)
+
+	idx := a.p / 100 * float64(len(vals)-1)
+	lo := int(math.Floor(idx))
+	if lo == len(vals)-1 {
+		return vals[lo], nil
+	}
+	frac := idx - float64(lo)
+	return vals[lo] + frac*(vals[lo+1]-vals[lo]), nil
+}
+
+// stddevAgg keeps the running mean and sum of squared differences, using
+// Welford's method, which doesn't lose precision like summing squares.
+type stddevAgg struct {
+	n    int64
+	mean float64
+	m2   float64
+}
+
+func (a *stddevAgg) step(args []driver.Value) error {
+	v, ok, err := numericArg("stddev", args[0])
+	if !ok {
+		return err
+	}
+
+	a.n++
+	delta := v - a.mean
+	a.mean += delta / float64(a.n)
+	a.m2 += delta * (v - a.mean)
+	return nil
+}
+
+func (a *stddevAgg) inverse(args []driver.Value) error {
+	v, ok, err := numericArg("stddev", args[0])
+	if !ok {
+		return err
+	}
+
+	if a.n == 1 {
+		*a = stddevAgg{}
+		return nil
+	}
+	a.n--
+	delta := v - a.mean
+	a.mean -= delta / float64(a.n)
+	a.m2 -= delta * (v - a.mean)
+	return nil
+}
+
+func (a *stddevAgg) result() (driver.Value, error) {
+	if a.n < 2 {
+		return nil, nil
+	}
+	return math.Sqrt(math.Max(a.m2, 0) / float64(a.n-1)), nil
+}
+
+// printFunctionList lists the functions vsqlite adds, or with a pattern
+// all functions of the connection whose name matches it, like \df in psql.
+func printFunctionList(pattern string) error {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+
+	if pattern == "" {
+		t.AppendHeader(table.Row{"Function", "Type", "Description"})
+		for _, a := range aggregates {
+			t.AppendRow(table.Row{a.usage, "aggregate", a.desc})
+		}
+		t.Render()
+		return nil
+	}
+
+	rows, err := conn.QueryContext(context.Background(), `
+		SELECT name, type, narg, builtin
+		FROM pragma_function_list
+		WHERE name LIKE ? ESCAPE '\'
+		ORDER BY name, narg`, likePattern(pattern))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ours := make(map[string]bool, len(aggregates))
+	for _, a := range aggregates {
+		ours[a.name] = true
+	}
+
+	kinds := map[string]string{"s": "scalar", "a": "aggregate",
+		"w": "window"}
+	t.AppendHeader(table.Row{"Function", "Type", "Args", "Source"})
+	for rows.Next() {
+		var (
+			name, kind string
+			narg       int
+			builtin    bool
+		)
+		if err := rows.Scan(&name, &kind, &narg, &builtin); err != nil {
+			return err
+		}
+
+		args := strconv.Itoa(narg)
+		if narg < 0 {
+			args = "any"
+		}
+		source := "extension"
+		switch {
+		case ours[name]:
+			source = "vsqlite"
+		case builtin:
+			source = "built-in"
+		}
+		if kinds[kind] != "" {
+			kind = kinds[kind]
+		}
+		t.AppendRow(table.Row{name, kind, args, source})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	t.Render()
+	return nil
+}
+
+// likePattern turns a psql style pattern, with * and ? wildcards, into a
+// LIKE pattern escaped with a backslash.
+func likePattern(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	"golang.org/x/term"
+)
+
+// alterPlan is the rewrite of a table into a new definition, following the
+// twelve steps the SQLite documentation gives for schema changes ALTER
+// TABLE can't make.
+type alterPlan struct {
+	table string
+
+	// notes are shown as comments at the top of the script.
+	notes []string
+
+	// drop holds the views and triggers of other tables that refer to
+	// the table, which would break the rename.
+	drop []string
+
+	// rebuild creates the new table, copies the data over and swaps it
+	// in for the old one.
+	rebuild []string
+
+	// recreate holds the indexes and triggers of the table and the
+	// dropped dependents.
+	recreate []string
+}
+
+// script renders the plan. Foreign keys are turned off around it, which
+// doesn't work inside a transaction, and checked before committing. They
+// are turned back on only if the session had them on.
+func (p *alterPlan) script() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Rewrite of %s.\n", p.table)
+	for _, note := range p.notes {
+		fmt.Fprintf(&b, "-- %s\n", note)
+	}
+
+	b.WriteString("PRAGMA foreign_keys = OFF;\nBEGIN;\n\n")
+	for _, group := range [][]string{p.drop, p.rebuild, p.recreate} {
+		for _, stmt := range group {
+			fmt.Fprintf(&b, "%s;\n", stmt)
+		}
+		if len(group) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("PRAGMA foreign_key_check;\nCOMMIT;\n")
+	if fkEnabled {
+		b.WriteString("PRAGMA foreign_keys = ON;\n")
+	}
+
+	return b.String()
+}
+
+// refersTo reports whether an SQL statement mentions the table by name.
+// Matching text rather than parsing errs on the side of including objects.
+func refersTo(sqlText, table string) bool {
+	re := regexp.MustCompile(`(?i)(^|[^\w$])["'\x60\[]?` +
+		regexp.QuoteMeta(table) + `["'\x60\]]?($|[^\w$])`)
+	return re.MatchString(sqlText)
+}
+
+// planAlter works out the rewrite of a table into the new definition and
+// tries it on a copy of the schema in memory. Indexes and triggers that no
+// longer fit the new definition are left out with a note.
+func planAlter(ctx context.Context, objs []schemaObject, table,
+	newSQL string) (*alterPlan, error) {
+
+	var old *schemaObject
+	for i := range objs {
+		o := &objs[i]
+		if o.typ == "table" && strings.EqualFold(o.name, table) {
+			old = o
+		}
+	}
+	if old == nil {
+		return nil, fmt.Errorf("no such table: %s", table)
+	}
+	if isVirtualTable(old) {
+		return nil, fmt.Errorf("%s is a virtual table", old.name)
+	}
+	table = old.name
+
+	newCols, err := createTableColumns(ctx, table, newSQL)
+	if err != nil {
+		return nil, fmt.Errorf("new definition: %w", err)
+	}
+	if len(newCols) == 0 {
+		return nil, fmt.Errorf("the new definition must create table %s",
+			table)
+	}
+	oldCols, err := createTableColumns(ctx, table, old.sql)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &alterPlan{table: table}
+	if p.rebuild, err = rebuildTable(ctx, table, old.sql, newSQL); err != nil {
+		return nil, err
+	}
+
+	inOld := make(map[string]bool, len(oldCols))
+	for _, col := range oldCols {
+		inOld[strings.ToLower(col)] = true
+	}
+	inNew := make(map[string]bool, len(newCols))
+	for _, col := range newCols {
+		inNew[strings.ToLower(col)] = true
+	}
+	var dropped, added []string
+	for _, col := range oldCols {
+		if !inNew[strings.ToLower(col)] {
+			dropped = append(dropped, col)
+		}
+	}
+	for _, col := range newCols {
+		if !inOld[strings.ToLower(col)] {
+			added = append(added, col)
+		}
+	}
+	if len(dropped) > 0 {
+		p.notes = append(p.notes, "Dropped columns, their data is lost: "+
+			strings.Join(dropped, ", "))
+	}
+	if len(added) > 0 {
+		p.notes = append(p.notes, "New columns, filled with their "+
+			"defaults: "+strings.Join(added, ", "))
+	}
+
+	// The table's own indexes and triggers go away with it, dependents
+	// elsewhere are dropped first. Views depending on it through other
+	// views break too, so all of them are dropped, each before what it
+	// selects from, and created again the other way round.
+	g := buildViewGraph(objs)
+	views := planViewRebuild(g, g.dependents(table))
+	p.drop = append(p.drop, views.drop...)
+
+	inViews := make(map[string]bool)
+	for _, name := range views.views {
+		inViews[strings.ToLower(name)] = true
+	}
+	var triggers []string
+	for _, o := range objs {
+		switch {
+		case o.typ == "table" || o.typ == "view" ||
+			inViews[strings.ToLower(o.tblName)]:
+
+			continue
+
+		case strings.EqualFold(o.tblName, table):
+			p.recreate = append(p.recreate, o.sql)
+
+		case refersTo(o.sql, table):
+			p.drop = append(p.drop, fmt.Sprintf("DROP %s IF EXISTS %s",
+				strings.ToUpper(o.typ), quoteIdent(o.name)))
+			triggers = append(triggers, o.sql)
+		}
+	}
+	p.recreate = append(p.recreate, views.recreate...)
+	p.recreate = append(p.recreate, triggers...)
+
+	mem, err := newMemorySchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	for _, o := range objs {
+		if _, err := mem.conn.ExecContext(ctx, o.sql); err != nil {
+			return nil, fmt.Errorf("copying the schema: %w", err)
+		}
+	}
+	for _, stmt := range append(p.drop, p.rebuild...) {
+		if _, err := mem.conn.ExecContext(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+
+	var recreate []string
+	for _, stmt := range p.recreate {
+		if _, err := mem.conn.ExecContext(ctx, stmt); err != nil {
+			p.notes = append(p.notes, fmt.Sprintf(
+				"Left out, it doesn't fit the new definition (%v): %s",
+				err, normalizeSQL(stmt)))
+			continue
+		}
+		recreate = append(recreate, stmt)
+	}
+	p.recreate = recreate
+
+	return p, nil
+}
+
+// runAlterPlan runs the rewrite on the session connection, rolling it back
+// if any statement fails or foreign keys end up violated.
+func runAlterPlan(ctx context.Context, p *alterPlan) error {
+	fkWasOn := fkEnabled
+	if fkWasOn {
+		if err := setForeignKeys(false); err != nil {
+			return err
+		}
+		defer setForeignKeys(true)
+	}
+
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return err
+	}
+	rollback := func(err error) error {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+
+	for _, group := range [][]string{p.drop, p.rebuild, p.recreate} {
+		for _, stmt := range group {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return rollback(fmt.Errorf("%s: %w",
+					normalizeSQL(stmt), err))
+			}
+		}
+	}
+
+	var violator string
+	err := conn.QueryRowContext(ctx, "PRAGMA foreign_key_check").Scan(
+		&violator, new(interface{}), new(interface{}), new(interface{}),
+	)
+	if err == nil {
+		return rollback(fmt.Errorf("foreign key violations in table "+
+			"%s, see \\fkcheck", violator))
+	}
+
+	_, err = conn.ExecContext(ctx, "COMMIT")
+	if err != nil {
+		return rollback(err)
+	}
+	return nil
+}
+
+// editText opens the text in $VISUAL or $EDITOR and returns the result.
+func editText(text, pattern string) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The editor setting may carry arguments, e.g. "code --wait".
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	return string(edited), err
+}
+
+// confirm asks a yes or no question, defaulting to no.
+func confirm(question string) bool {
+	answer := prompt.Input(question+" [y/N] ",
+		func(prompt.Document) []prompt.Suggest { return nil })
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// handleAlterCommand rewrites a table into a new definition, given after
+// the table name or edited in $EDITOR. The script is printed, or written to
+// a file with -o, and run after confirmation or right away with --run.
+func handleAlterCommand(args string) error {
+	usage := "Usage: \\alter [--run] [-o file] <table> [CREATE TABLE ...]"
+
+	run, output := false, ""
+	field, rest := nextField(args)
+	for ; strings.HasPrefix(field, "-"); field, rest = nextField(rest) {
+		switch field {
+		case "--run":
+			run = true
+		case "-o":
+			output, rest = nextField(rest)
+		default:
+			fmt.Println(usage)
+			return errUsage
+		}
+	}
+	table, newSQL := field, strings.TrimSuffix(strings.TrimSpace(rest), ";")
+	if table == "" || output == "" && strings.HasPrefix(args, "-o") {
+		fmt.Println(usage)
+		return errUsage
+	}
+	if strings.HasPrefix(table, `"`) && strings.HasSuffix(table, `"`) {
+		table = strings.ReplaceAll(table[1:len(table)-1], `""`, `"`)
+	}
+
+	// The schema cache is read apart from the session, which sees its own
+	// uncommitted DDL.
+	ctx := context.Background()
+	var (
+		objs []schemaObject
+		err  error
+	)
+	if transactionOpen() {
+		objs, err = userSchemaObjects(ctx, conn)
+	} else {
+		objs, err = dbSchema.userObjects(ctx)
+	}
+	if err != nil {
+		fmt.Printf("Alter error: %v\n", err)
+		return err
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	if newSQL == "" {
+		var current string
+		for _, o := range objs {
+			if o.typ == "table" && strings.EqualFold(o.name, table) {
+				current = o.sql + ";\n"
+			}
+		}
+		if current == "" {
+			err := fmt.Errorf("no such table: %s", table)
+			fmt.Printf("Alter error: %v\n", err)
+			return err
+		}
+		if !interactive {
+			fmt.Println(usage)
+			return errUsage
+		}
+
+		edited, err := editText(current, "vsqlite-alter-*.sql")
+		if err != nil {
+			fmt.Printf("Alter error: %v\n", err)
+			return err
+		}
+		if normalizeSQL(edited) == normalizeSQL(current) {
+			fmt.Println("No changes.")
+			return nil
+		}
+		newSQL = strings.TrimSuffix(strings.TrimSpace(edited), ";")
+	}
+
+	plan, err := planAlter(ctx, objs, table, newSQL)
+	if err != nil {
+		fmt.Printf("Alter error: %v\n", err)
+		return err
+	}
+
+	if output != "" {
+		err := os.WriteFile(output, []byte(plan.script()), 0o644)
+		if err != nil {
+			fmt.Printf("Alter error: %v\n", err)
+			return err
+		}
+		fmt.Printf("Wrote the rewrite of %s to %s\n", plan.table, output)
+	} else {
+		fmt.Print(plan.script())
+	}
+
+	if !run && !(interactive && output == "" &&
+		confirm("Run the rewrite now?")) {
+
+		return nil
+	}
+
+	if err := runAlterPlan(ctx, plan); err != nil {
+		fmt.Printf("Alter error: %v\n", err)
+		return err
+	}
+	fmt.Printf("Rewrote %s.\n", plan.table)
+	return nil
+}
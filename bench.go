@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const benchUsage = "Usage: \\bench [-warmup N] [-fresh] <iterations> <query>"
+
+// benchOptions holds the parsed arguments of a \bench command.
+type benchOptions struct {
+	iterations int
+	warmup     int
+
+	// fresh runs every iteration on a newly opened connection so that
+	// SQLite's page cache starts out cold.
+	fresh bool
+
+	query string
+}
+
+// nextField splits off the first whitespace separated field of s, returning
+// it along with the remainder with its original spacing intact.
+func nextField(s string) (string, string) {
+	s = strings.TrimLeft(s, " \t\n")
+	end := strings.IndexAny(s, " \t\n")
+	if end < 0 {
+		return s, ""
+	}
+	return s[:end], strings.TrimLeft(s[end:], " \t\n")
+}
+
+func parseBenchArgs(args string) (*benchOptions, error) {
+	opts := &benchOptions{}
+	for {
+		field, rest := nextField(args)
+		switch field {
+		case "-fresh":
+			opts.fresh = true
+			args = rest
+			continue
+
+		case "-warmup":
+			var n string
+			n, args = nextField(rest)
+			w, err := strconv.Atoi(n)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("invalid warm-up count %q", n)
+			}
+			opts.warmup = w
+			continue
+		}
+		break
+	}
+
+	n, query := nextField(args)
+	iterations, err := strconv.Atoi(n)
+	if err != nil || iterations <= 0 {
+		return nil, fmt.Errorf("invalid iteration count %q", n)
+	}
+	if query == "" {
+		return nil, fmt.Errorf("missing query")
+	}
+
+	opts.iterations = iterations
+	opts.query = query
+
+	return opts, nil
+}
+
+// benchOnce runs the query to completion, discarding the results, and
+// returns the number of rows it produced.
+func benchOnce(ctx context.Context, c *sql.Conn, query string) (int, error) {
+	rows, err := c.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, rows.Err()
+}
+
+// benchIteration runs a single timed iteration, either on the session
+// connection or on a connection opened just for this run.
+func benchIteration(opts *benchOptions) (time.Duration, int, error) {
+	ctx := context.Background()
+
+	c := conn
+	if opts.fresh {
+		freshDB, err := openDatabase(dbPath, readOnly)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer freshDB.Close()
+
+		c, err = freshDB.Conn(ctx)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer c.Close()
+	}
+
+	start := time.Now()
+	n, err := benchOnce(ctx, c, opts.query)
+
+	return time.Since(start), n, err
+}
+
+// percentile returns the p-th percentile of the sorted durations using the
+// nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func handleBenchCommand(args string) error {
+	opts, err := parseBenchArgs(strings.TrimSuffix(args, ";"))
+	if err != nil {
+		fmt.Printf("Bench error: %v\n%s\n", err, benchUsage)
+		return err
+	}
+
+	for i := 0; i < opts.warmup; i++ {
+		if _, _, err := benchIteration(opts); err != nil {
+			fmt.Printf("Bench error: %v\n", err)
+			return err
+		}
+	}
+
+	timings := make([]time.Duration, 0, opts.iterations)
+	minRows, maxRows := math.MaxInt, 0
+	var total time.Duration
+	for i := 0; i < opts.iterations; i++ {
+		d, n, err := benchIteration(opts)
+		if err != nil {
+			fmt.Printf("Bench error in iteration %d: %v\n", i+1, err)
+			return err
+		}
+
+		timings = append(timings, d)
+		total += d
+		minRows = min(minRows, n)
+		maxRows = max(maxRows, n)
+	}
+
+	sort.Slice(timings, func(i, j int) bool {
+		return timings[i] < timings[j]
+	})
+
+	rowsDesc := strconv.Itoa(minRows)
+	if minRows != maxRows {
+		rowsDesc = fmt.Sprintf("%d-%d", minRows, maxRows)
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{
+		"Runs", "Rows", "Min", "Avg", "P95", "Max",
+	})
+	t.AppendRow(table.Row{
+		opts.iterations, rowsDesc, timings[0],
+		total / time.Duration(opts.iterations),
+		percentile(timings, 95), timings[len(timings)-1],
+	})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignRight},
+		{Number: 2, Align: text.AlignRight},
+		{Number: 3, Align: text.AlignRight},
+		{Number: 4, Align: text.AlignRight},
+		{Number: 5, Align: text.AlignRight},
+		{Number: 6, Align: text.AlignRight},
+	})
+	t.Render()
+
+	if opts.warmup > 0 || opts.fresh {
+		fmt.Printf("(warm-up runs: %d, fresh connection per run: %s)\n",
+			opts.warmup, onOff(opts.fresh))
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// bigCellLimit is the size in bytes above which BLOB and TEXT values in
+// query results are shown as a placeholder like <BLOB 12.3 MiB> rather than
+// fetched, 0 to fetch them whatever their size. See \pset bigcell.
+var bigCellLimit int64 = 1 << 20
+
+var (
+	// byteSizeRe matches a size like 512, 64K, 1.5MB or 2GiB.
+	byteSizeRe = regexp.MustCompile(`(?i)^([0-9.]+)\s*([KMG]?)(?:I?B)?$`)
+
+	// bigCellRe matches the placeholder of a value over bigCellLimit.
+	bigCellRe = regexp.MustCompile(
+		`^<(?:BLOB|TEXT) [0-9.]+ (?:B|[KMG]iB)>$`,
+	)
+)
+
+// parseByteSize parses a size in bytes, with an optional K, M or G suffix
+// for KiB, MiB and GiB.
+func parseByteSize(s string) (int64, error) {
+	m := byteSizeRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	shift := strings.Index("KMG", strings.ToUpper(m[2]))*10 + 10
+	if m[2] == "" {
+		shift = 0
+	}
+	return int64(f * float64(int64(1)<<shift)), nil
+}
+
+func bigCellSetting() string {
+	if bigCellLimit == 0 {
+		return "off"
+	}
+	return formatByteSize(bigCellLimit)
+}
+
+func setBigCellOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a size, e.g. 1MB, or off")
+	}
+	if strings.EqualFold(args[0], "off") {
+		bigCellLimit = 0
+		return nil
+	}
+
+	n, err := parseByteSize(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("the size must be positive, or off")
+	}
+	bigCellLimit = n
+	return nil
+}
+
+// showBigCells reports whether results are shown as a table on the
+// terminal, the only place values over bigCellLimit are left out. Output
+// read by programs or written to files, like JSON, inserts and tuples, gets
+// the values.
+func showBigCells() bool {
+	if bigCellLimit == 0 || !atPrompt ||
+		!term.IsTerminal(int(os.Stdout.Fd())) {
+
+		return false
+	}
+	return expandedMode || outputFormat == formatAligned && !tuplesOnly
+}
+
+// sqlByteSize is an SQL expression formatting the size in bytes expr
+// evaluates to like formatByteSize.
+func sqlByteSize(expr string) string {
+	return fmt.Sprintf(`CASE
+		WHEN %[1]s >= 1073741824
+			THEN printf('%%.1f GiB', %[1]s / 1073741824.0)
+		WHEN %[1]s >= 1048576 THEN printf('%%.1f MiB', %[1]s / 1048576.0)
+		WHEN %[1]s >= 1024 THEN printf('%%.1f KiB', %[1]s / 1024.0)
+		ELSE %[1]s || ' B' END`, expr)
+}
+
+// bigCellQuery rewrites a read query so that BLOB and TEXT values over
+// bigCellLimit come back as a placeholder with their size. SQLite gets the
+// size of a column's value from the row header with octet_length(), so the
+// values themselves aren't read, let alone copied into the result.
+//
+// The columns of the query are found by preparing it as a subquery with
+// LIMIT 0, which doesn't run it. The rewrite loses the declared types of
+// the TEXT and BLOB columns, so those are returned too. The query is
+// returned as is if results aren't shown as a table on the terminal, see
+// showBigCells, or the query isn't a plain read, has no such columns, or
+// can't be wrapped, e.g. on SQLite before 3.43.
+func bigCellQuery(ctx context.Context, query string,
+	args []interface{}) (string, []string) {
+
+	keyword, _ := nextField(query)
+	if !showBigCells() || !isReadQuery(query) ||
+		strings.EqualFold(keyword, "EXPLAIN") {
+
+		return query, nil
+	}
+
+	// The newline ends a trailing line comment.
+	body := strings.TrimSuffix(strings.TrimSpace(query), ";")
+	rows, err := conn.QueryContext(ctx, "SELECT *, octet_length(NULL) "+
+		"FROM (\n"+body+"\n) LIMIT 0", args...)
+	if err != nil {
+		return query, nil
+	}
+	cols, err := rows.Columns()
+	types, typesErr := rows.ColumnTypes()
+	rows.Close()
+	if err != nil || typesErr != nil || len(cols) < 2 {
+		return query, nil
+	}
+	cols = subqueryColumnNames(cols[:len(cols)-1])
+
+	declTypes := make([]string, len(cols))
+	aliases := make([]string, len(cols))
+	exprs := make([]string, len(cols))
+	wrapped := false
+	for i, col := range cols {
+		declTypes[i] = types[i].DatabaseTypeName()
+		aliases[i] = fmt.Sprintf("c%d", i+1)
+
+		// Columns of numeric types, which include DATETIME and BOOLEAN,
+		// keep their declared type for the driver to convert values by.
+		switch typeAffinity(declTypes[i]) {
+		case affinityInteger, affinityReal, affinityNumeric:
+			exprs[i] = fmt.Sprintf("c%d AS %s", i+1, quoteIdent(col))
+			continue
+		}
+		wrapped = true
+
+		size := fmt.Sprintf("octet_length(c%d)", i+1)
+		exprs[i] = fmt.Sprintf("CASE WHEN typeof(c%[1]d) IN "+
+			"('blob', 'text') AND %[2]s > %[3]d THEN '<' || "+
+			"upper(typeof(c%[1]d)) || ' ' || %[4]s || '>' "+
+			"ELSE c%[1]d END AS %[5]s", i+1, size, bigCellLimit,
+			sqlByteSize(size), quoteIdent(col))
+	}
+
+	if !wrapped {
+		return query, nil
+	}
+	rewritten := fmt.Sprintf("WITH vsqlite_result(%s) AS (\n%s\n)\n"+
+		"SELECT %s FROM vsqlite_result", strings.Join(aliases, ", "),
+		body, strings.Join(exprs, ",\n"))
+
+	// The statement that runs is the rewrite, time that.
+	countStmtStats(rewritten)
+	return rewritten, declTypes
+}
+
+// subqueryColumnNames undoes the renaming of duplicate column names in a
+// subquery, where the second a becomes a:1.
+func subqueryColumnNames(cols []string) []string {
+	seen := make(map[string]bool)
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = col
+		if j := strings.LastIndex(col, ":"); j > 0 && seen[col[:j]] {
+			if _, err := strconv.Atoi(col[j+1:]); err == nil {
+				names[i] = col[:j]
+			}
+		}
+		seen[names[i]] = true
+	}
+	return names
+}
+
+// hasBigCells reports whether a result holds placeholders for values over
+// bigCellLimit.
+func hasBigCells(set *resultSet) bool {
+	for _, row := range set.rows {
+		for _, val := range row {
+			s, ok := val.(string)
+			if ok && strings.HasPrefix(s, "<") && bigCellRe.MatchString(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
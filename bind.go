@@ -0,0 +1,394 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"golang.org/x/term"
+)
+
+// boundParams holds the values preset with \bind, keyed by parameter name
+// without its prefix, or by number for ? and ?NNN. The values are kept as
+// typed and converted when bound, by the type of the column they're
+// compared to or stored in.
+var boundParams = make(map[string]string)
+
+// sqlParam is a parameter of a statement.
+type sqlParam struct {
+	// name is the parameter as written, e.g. :id or ?3, and "?" for
+	// anonymous ones.
+	name string
+
+	// index is the number SQLite gives the parameter.
+	index int
+
+	// pos is the offset of the first use of the parameter in the
+	// statement.
+	pos int
+}
+
+// key is the name the parameter's value is bound under.
+func (p sqlParam) key() string {
+	if p.name[0] == '?' {
+		return strconv.Itoa(p.index)
+	}
+	return p.name[1:]
+}
+
+// isParamNameChar reports whether r may be part of a parameter name.
+func isParamNameChar(r byte) bool {
+	return r == '_' || r >= 0x80 || unicode.IsLetter(rune(r)) ||
+		unicode.IsDigit(rune(r))
+}
+
+// statementParams returns the parameters of a statement in the order SQLite
+// numbers them: ? takes the next number, ?NNN the number NNN and a named
+// parameter the next number on its first use. Strings, quoted identifiers
+// and comments are skipped.
+func statementParams(query string) []sqlParam {
+	var (
+		params []sqlParam
+		seen   = make(map[string]bool)
+		last   int
+	)
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// A doubled quote is an escaped one.
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] != c {
+					continue
+				}
+				if j+1 < len(query) && query[j+1] == c {
+					j++
+					continue
+				}
+				break
+			}
+			if j >= len(query) {
+				return params
+			}
+			i = j
+
+		case c == '[':
+			end := strings.IndexByte(query[i:], ']')
+			if end < 0 {
+				return params
+			}
+			i += end
+
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return params
+			}
+			i += end
+
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return params
+			}
+			i += end + 3
+
+		case c == '?':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			name, index := "?", last+1
+			if j > i+1 {
+				name = query[i:j]
+				index, _ = strconv.Atoi(query[i+1 : j])
+				if seen[name] {
+					i = j - 1
+					continue
+				}
+				seen[name] = true
+			}
+			last = max(last, index)
+			params = append(params, sqlParam{name, index, i})
+			i = j - 1
+
+		case c == ':' || c == '@' || c == '$':
+			// A $ may be part of an identifier.
+			if i > 0 && (isParamNameChar(query[i-1]) ||
+				query[i-1] == '$') {
+
+				continue
+			}
+			j := i + 1
+			for j < len(query) && isParamNameChar(query[j]) {
+				j++
+			}
+			if j == i+1 {
+				continue
+			}
+			name := query[i:j]
+			if !seen[name] {
+				seen[name] = true
+				last++
+				params = append(params, sqlParam{name, last, i})
+			}
+			i = j - 1
+		}
+	}
+
+	return params
+}
+
+var (
+	// comparedColumnRe finds the column a parameter is compared to.
+	comparedColumnRe = regexp.MustCompile(
+		`(?i)(?:^|[^\w."])(?:[\w]+\.)?("[^"]+"|\w+)\s*` +
+			`(?:==?|!=|<>|<=|>=|<|>|\bLIKE|\bGLOB|\bIS(?:\s+NOT)?|` +
+			`\bIN\s*\((?:[^()]*,)?)\s*$`,
+	)
+
+	// limitRe matches a parameter giving a LIMIT or OFFSET.
+	limitRe = regexp.MustCompile(`(?i)\b(?:LIMIT|OFFSET)\s*$`)
+
+	// insertColumnsRe finds the column list, if any, and the start of the
+	// values of an INSERT.
+	insertColumnsRe = regexp.MustCompile(
+		`(?is)\bINTO\s+(?:(?:"[^"]+"|\w+)\.)?(?:"[^"]+"|\w+)\s*` +
+			`(?:\(([^)]*)\)\s*)?VALUES\s*\(`,
+	)
+
+	// setColumnRe finds the column a parameter is assigned to in an
+	// UPDATE.
+	setColumnRe = regexp.MustCompile(
+		`(?i)(?:\bSET\s+|,\s*)("[^"]+"|\w+)\s*=\s*$`,
+	)
+)
+
+// paramColumn guesses the column of the table a statement reads or writes
+// whose value a parameter stands for, from the text around it.
+func paramColumn(query string, p sqlParam) string {
+	before := query[:p.pos]
+
+	if m := setColumnRe.FindStringSubmatch(before); m != nil {
+		return unquoteName(m[1])
+	}
+	if m := comparedColumnRe.FindStringSubmatch(before); m != nil {
+		return unquoteName(m[1])
+	}
+
+	// The n-th value of an INSERT goes to the n-th column, of the list or
+	// of the table.
+	m := insertColumnsRe.FindStringSubmatchIndex(before)
+	if m == nil {
+		return ""
+	}
+	depth, n := 0, 0
+	for _, r := range before[m[1]:] {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				n++
+			}
+		}
+	}
+	var cols []string
+	if m[2] >= 0 {
+		cols = strings.Split(before[m[2]:m[3]], ",")
+	} else if tbl := dmlTarget(query); tbl != "" {
+		cols, _ = tableColumns(context.Background(), metadata(), tbl)
+	}
+	if depth != 0 || n >= len(cols) {
+		return ""
+	}
+	return unquoteName(strings.TrimSpace(cols[n]))
+}
+
+// paramType returns the declared type of the column a parameter stands for,
+// "" if it can't tell.
+func paramType(query string, p sqlParam) string {
+	if limitRe.MatchString(query[:p.pos]) {
+		return "INTEGER"
+	}
+
+	col := paramColumn(query, p)
+	tbl := dmlTarget(query)
+	if tbl == "" {
+		tbl = queryTable(query)
+	}
+	if col == "" || tbl == "" {
+		return ""
+	}
+
+	var declType string
+	metadata().QueryRowContext(context.Background(), `
+		SELECT type FROM pragma_table_info(?)
+		WHERE name = ? COLLATE NOCASE`, tbl, col).Scan(&declType)
+	return declType
+}
+
+// numberRe matches the numbers a bound value is converted to.
+var numberRe = regexp.MustCompile(
+	`^[-+]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?$`,
+)
+
+// parseBindValue converts a value as typed to the value bound. NULL, a
+// quoted string and a blob literal like X'00ff' are taken as they are in
+// SQL. Anything else is text, or a number unless the column is a text one,
+// so that codes like 007 keep their leading zeros.
+func parseBindValue(s, declType string) (interface{}, error) {
+	switch {
+	case strings.EqualFold(s, "NULL"):
+		return nil, nil
+
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+
+	case len(s) >= 3 && (s[0] == 'x' || s[0] == 'X') && s[1] == '\'' &&
+		s[len(s)-1] == '\'':
+
+		b, err := hex.DecodeString(s[2 : len(s)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob literal %s", s)
+		}
+		return b, nil
+	}
+
+	if typeAffinity(declType) == affinityText || !numberRe.MatchString(s) {
+		return s, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// statementArgs returns the values to bind to the parameters of a
+// statement: the ones preset with \bind, and asked for the others at the
+// prompt. It returns false if asking was canceled with an empty answer.
+func statementArgs(query string) ([]interface{}, bool, error) {
+	params := statementParams(query)
+	if len(params) == 0 {
+		return nil, true, nil
+	}
+
+	n := 0
+	for _, p := range params {
+		n = max(n, p.index)
+	}
+	// Gaps left by ?NNN stay NULL, as SQLite leaves them.
+	args := make([]interface{}, n)
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd())) && atPrompt
+	for _, p := range params {
+		declType := paramType(query, p)
+
+		raw, ok := boundParams[p.key()]
+		if !ok {
+			if !interactive {
+				return nil, false, fmt.Errorf("no value for %s, "+
+					"set one with \\bind %s <value>", paramLabel(p),
+					p.key())
+			}
+
+			label := paramLabel(p)
+			if declType != "" {
+				label += " (" + declType + ")"
+			}
+			raw = strings.TrimSpace(prompt.Input(label+": ",
+				func(prompt.Document) []prompt.Suggest { return nil }))
+			if raw == "" {
+				return nil, false, nil
+			}
+		}
+
+		v, err := parseBindValue(raw, declType)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", paramLabel(p), err)
+		}
+
+		// Named values are matched by name, the others by position.
+		if p.name[0] == '?' {
+			args[p.index-1] = v
+		} else {
+			args[p.index-1] = sql.Named(p.name[1:], v)
+		}
+	}
+
+	return args, true, nil
+}
+
+// paramLabel names a parameter for the user, numbering anonymous ones.
+func paramLabel(p sqlParam) string {
+	if p.name == "?" {
+		return "?" + strconv.Itoa(p.index)
+	}
+	return p.name
+}
+
+// handleBindCommand presets the values of parameters, for the statements
+// that use them not to ask.
+func handleBindCommand(args string) error {
+	name, value := nextField(strings.TrimSuffix(strings.TrimSpace(args),
+		";"))
+	value = strings.TrimSpace(value)
+
+	switch {
+	case name == "":
+		printBoundParams()
+
+	case name == "--clear" && value == "":
+		boundParams = make(map[string]string)
+
+	case name == "--clear":
+		delete(boundParams, strings.TrimLeft(value, ":@$?"))
+
+	case value == "":
+		fmt.Println("Usage: \\bind [name value | --clear [name]]")
+		return errUsage
+
+	default:
+		boundParams[strings.TrimLeft(name, ":@$?")] = value
+	}
+	return nil
+}
+
+func printBoundParams() {
+	if len(boundParams) == 0 {
+		fmt.Println("No values bound, statements ask for their " +
+			"parameters.")
+		return
+	}
+
+	names := make([]string, 0, len(boundParams))
+	for name := range boundParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Parameter", "Value"})
+	for _, name := range names {
+		t.AppendRow(table.Row{name, boundParams[name]})
+	}
+	t.Render()
+}
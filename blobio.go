@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+const (
+	// blobChunkSize is how much of a value \blobout reads at a time.
+	blobChunkSize = 64 << 10
+
+	// hexdumpLength is how many bytes \hexdump shows by default.
+	hexdumpLength = 256
+)
+
+// blobRef locates a value for incremental reading.
+type blobRef struct {
+	schema, table, column string
+	rowid                 int64
+}
+
+// parseBlobRef reads the <table> <column> <rowid> arguments of \blobout
+// and \hexdump. Unqualified tables are looked up in temp first, like
+// SQLite does.
+func parseBlobRef(ctx context.Context, args []string) (blobRef, error) {
+	schema, table := splitSchemaName(args[0])
+	ref := blobRef{schema: schema, table: table, column: args[1]}
+
+	rowid, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return ref, fmt.Errorf("invalid rowid %q", args[2])
+	}
+	ref.rowid = rowid
+
+	if ref.schema == "" {
+		ref.schema = "main"
+		if hasTempSchema() {
+			var n int
+			err := conn.QueryRowContext(ctx, `
+				SELECT count(*) FROM temp.sqlite_master
+				WHERE type = 'table' AND name = ? COLLATE NOCASE`,
+				table).Scan(&n)
+			if err != nil {
+				return ref, err
+			}
+			if n > 0 {
+				ref.schema = "temp"
+			}
+		}
+	}
+	return ref, nil
+}
+
+// sqlBlobReader reads a value a piece at a time with substr(), for drivers
+// without incremental BLOB I/O. SQLite reads the whole value for each
+// piece, so this is slower, but only the piece reaches vsqlite.
+type sqlBlobReader struct {
+	ctx context.Context
+	ref blobRef
+}
+
+func (r *sqlBlobReader) query(expr string) string {
+	return fmt.Sprintf("SELECT %s FROM %s.%s WHERE rowid = ?",
+		strings.ReplaceAll(expr, "$col", quoteIdent(r.ref.column)),
+		quoteIdent(r.ref.schema), quoteIdent(r.ref.table))
+}
+
+func (r *sqlBlobReader) ReadAt(p []byte, off int64) (int, error) {
+	var piece []byte
+	err := conn.QueryRowContext(r.ctx,
+		r.query("substr(CAST($col AS BLOB), ?, ?)"), off+1, len(p),
+		r.ref.rowid).Scan(&piece)
+	if err != nil {
+		return 0, err
+	}
+
+	n := copy(p, piece)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// readBlob runs f with a reader over a value, using incremental BLOB I/O if
+// the driver has it.
+func readBlob(ctx context.Context, ref blobRef,
+	f func(r io.ReaderAt, size int64) error) error {
+
+	if d, ok := driverFor(dbPath).(blobDriver); ok {
+		return d.readBlob(conn, ref, f)
+	}
+
+	r := &sqlBlobReader{ctx: ctx, ref: ref}
+	var size sql.NullInt64
+	err := conn.QueryRowContext(ctx,
+		r.query("CASE WHEN typeof($col) IN ('blob', 'text') "+
+			"THEN length(CAST($col AS BLOB)) END"), ref.rowid).Scan(&size)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("no row with rowid %d in %s", ref.rowid,
+			ref.table)
+	}
+	if err != nil {
+		return err
+	}
+	if !size.Valid {
+		return fmt.Errorf("%s is not a BLOB or TEXT value", ref.column)
+	}
+	return f(r, size.Int64)
+}
+
+// handleBlobOutCommand writes a value to a file a piece at a time, so that
+// values too large to display, see \pset bigcell, can be saved without
+// loading them. ^C stops it and removes the partial file.
+func handleBlobOutCommand(args []string) error {
+	if len(args) != 4 {
+		fmt.Println("Usage: \\blobout <table> <column> <rowid> <file>")
+		return errUsage
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	ref, err := parseBlobRef(ctx, args)
+	if err != nil {
+		fmt.Printf("Blob error: %v\n", err)
+		return err
+	}
+
+	f, err := os.Create(args[3])
+	if err != nil {
+		fmt.Printf("Blob error: %v\n", err)
+		return err
+	}
+
+	var written int64
+	err = readBlob(ctx, ref, func(r io.ReaderAt, size int64) error {
+		buf := make([]byte, blobChunkSize)
+		for written < size {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n, err := r.ReadAt(buf[:min(size-written, blobChunkSize)],
+				written)
+			if _, werr := f.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			written += int64(n)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(args[3])
+		fmt.Printf("Blob error: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Wrote %s to %s\n", formatByteSize(written), args[3])
+	return nil
+}
+
+// formatHexdump formats data read at offset like hexdump -C: the offset,
+// 16 bytes in hex and the printable ones as text.
+func formatHexdump(data []byte, offset int64) string {
+	var b strings.Builder
+	for i := 0; i < len(data); i += 16 {
+		line := data[i:min(i+16, len(data))]
+		fmt.Fprintf(&b, "%08x ", offset+int64(i))
+		for j := 0; j < 16; j++ {
+			if j == 8 {
+				b.WriteByte(' ')
+			}
+			if j < len(line) {
+				fmt.Fprintf(&b, " %02x", line[j])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+
+		b.WriteString("  |")
+		for _, c := range line {
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString("|\n")
+	}
+	return b.String()
+}
+
+// handleHexdumpCommand shows part of a value in hex, reading only that
+// part.
+func handleHexdumpCommand(args []string) error {
+	if len(args) < 3 || len(args) > 5 {
+		fmt.Println("Usage: \\hexdump <table> <column> <rowid> " +
+			"[offset [length]]")
+		return errUsage
+	}
+
+	offset, length := int64(0), int64(hexdumpLength)
+	for i, arg := range args[3:] {
+		n, err := strconv.ParseInt(arg, 0, 64)
+		if err != nil || n < 0 {
+			err := fmt.Errorf("invalid %s %q",
+				[]string{"offset", "length"}[i], arg)
+			fmt.Printf("Blob error: %v\n", err)
+			return err
+		}
+		if i == 0 {
+			offset = n
+		} else {
+			length = n
+		}
+	}
+
+	ctx := context.Background()
+	ref, err := parseBlobRef(ctx, args)
+	if err != nil {
+		fmt.Printf("Blob error: %v\n", err)
+		return err
+	}
+
+	var data []byte
+	var total int64
+	err = readBlob(ctx, ref, func(r io.ReaderAt, size int64) error {
+		total = size
+		if offset >= size {
+			return nil
+		}
+		data = make([]byte, min(length, size-offset))
+		n, err := r.ReadAt(data, offset)
+		data = data[:n]
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Printf("Blob error: %v\n", err)
+		return err
+	}
+
+	printPaged(formatHexdump(data, offset))
+	fmt.Printf("(%d of %d bytes from offset %d)\n", len(data), total,
+		offset)
+	return nil
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/uniseg"
+	"golang.org/x/term"
+)
+
+const (
+	// browseMaxColWidth caps the width of a column in the browser so a
+	// single long value can't push everything else off screen.
+	browseMaxColWidth = 60
+
+	browseColSep = " │ "
+)
+
+// autoBrowse opens the browser automatically for results that are too wide
+// for the terminal.
+var autoBrowse bool
+
+// resultBrowser is a full-screen, scrollable view of a result set.
+type resultBrowser struct {
+	screen tcell.Screen
+
+	cols   []string
+	rows   [][]string
+	widths []int
+
+	// top is the first visible row, cursor the highlighted one.
+	top    int
+	cursor int
+
+	// frozen leading columns stay in place while scrolling sideways,
+	// left is the first scrollable column shown.
+	frozen int
+	left   int
+
+	searching bool
+	search    string
+	status    string
+}
+
+func newResultBrowser(screen tcell.Screen, cols []string,
+	rows [][]string) *resultBrowser {
+
+	widths := make([]int, len(cols))
+	for i, col := range cols {
+		widths[i] = displayWidth(col)
+	}
+	for _, row := range rows {
+		for i, val := range row {
+			widths[i] = max(widths[i], displayWidth(val))
+		}
+	}
+	for i := range widths {
+		widths[i] = min(widths[i], browseMaxColWidth)
+	}
+
+	return &resultBrowser{
+		screen: screen,
+		cols:   cols,
+		rows:   rows,
+		widths: widths,
+	}
+}
+
+// pageSize is the number of data rows that fit on screen, leaving room for
+// the header, its separator and the status line.
+func (b *resultBrowser) pageSize() int {
+	_, h := b.screen.Size()
+	return max(h-3, 1)
+}
+
+// drawText draws s at (x, y), clipped to width cells, and returns the x
+// position after it.
+func (b *resultBrowser) drawText(x, y, width int, s string,
+	style tcell.Style) int {
+
+	sw, _ := b.screen.Size()
+	if displayWidth(s) > width {
+		s = truncateWidth(s, width)
+	}
+
+	// Draw whole grapheme clusters so that combining marks, emoji
+	// modifiers and flags take up as many cells as measured.
+	end := x + width
+	g := uniseg.NewGraphemes(s)
+	for g.Next() && x < sw {
+		runes := g.Runes()
+
+		// Control characters would garble the screen.
+		if runes[0] < ' ' {
+			runes = []rune{' '}
+		}
+		b.screen.SetContent(x, y, runes[0], runes[1:], style)
+		x += max(displayWidth(string(runes)), 1)
+	}
+	for ; x < end && x < sw; x++ {
+		b.screen.SetContent(x, y, ' ', nil, style)
+	}
+
+	return x
+}
+
+// visibleCols returns the frozen columns followed by as many scrollable
+// columns as fit the screen, starting at left.
+func (b *resultBrowser) visibleCols() []int {
+	sw, _ := b.screen.Size()
+
+	var visible []int
+	used := 0
+	add := func(i int) bool {
+		if used >= sw {
+			return false
+		}
+		visible = append(visible, i)
+		used += b.widths[i] + displayWidth(browseColSep)
+		return true
+	}
+
+	for i := 0; i < b.frozen; i++ {
+		add(i)
+	}
+	for i := b.frozen + b.left; i < len(b.cols); i++ {
+		if !add(i) {
+			break
+		}
+	}
+
+	return visible
+}
+
+func (b *resultBrowser) drawRow(y int, vals []string, visible []int,
+	style tcell.Style) {
+
+	x := 0
+	for n, i := range visible {
+		if n > 0 {
+			sepStyle := style
+			if n == b.frozen {
+				sepStyle = sepStyle.Bold(true)
+			}
+			x = b.drawText(x, y, displayWidth(browseColSep), browseColSep, sepStyle)
+		}
+		x = b.drawText(x, y, b.widths[i], vals[i], style)
+	}
+
+	sw, _ := b.screen.Size()
+	for ; x < sw; x++ {
+		b.screen.SetContent(x, y, ' ', nil, style)
+	}
+}
+
+func (b *resultBrowser) draw() {
+	b.screen.Clear()
+	sw, sh := b.screen.Size()
+
+	visible := b.visibleCols()
+	header := tcell.StyleDefault.Bold(true)
+	b.drawRow(0, b.cols, visible, header)
+	b.drawText(0, 1, sw, strings.Repeat("─", sw), tcell.StyleDefault)
+
+	for y := 0; y < b.pageSize() && b.top+y < len(b.rows); y++ {
+		style := tcell.StyleDefault
+		if b.top+y == b.cursor {
+			style = style.Reverse(true)
+		}
+		b.drawRow(y+2, b.rows[b.top+y], visible, style)
+	}
+
+	status := b.status
+	switch {
+	case b.searching:
+		status = "/" + b.search
+
+	case status == "":
+		status = fmt.Sprintf(
+			"row %d/%d  col %d/%d  frozen %d  "+
+				"│ arrows scroll, f/F freeze, / search, n/N next, q quit",
+			min(b.cursor+1, len(b.rows)), len(b.rows),
+			b.frozen+b.left+1, len(b.cols), b.frozen,
+		)
+	}
+	b.drawText(0, sh-1, sw, status, tcell.StyleDefault.Reverse(true))
+
+	b.screen.Show()
+}
+
+// moveCursor moves the highlighted row, scrolling to keep it in view.
+func (b *resultBrowser) moveCursor(delta int) {
+	b.cursor = max(min(b.cursor+delta, len(b.rows)-1), 0)
+
+	if b.cursor < b.top {
+		b.top = b.cursor
+	}
+	if b.cursor >= b.top+b.pageSize() {
+		b.top = b.cursor - b.pageSize() + 1
+	}
+}
+
+func (b *resultBrowser) scrollCols(delta int) {
+	b.left = max(min(b.left+delta, len(b.cols)-b.frozen-1), 0)
+}
+
+// findNext moves the cursor to the next (or previous) row containing the
+// search text, case-insensitively.
+func (b *resultBrowser) findNext(forward bool) {
+	if b.search == "" || len(b.rows) == 0 {
+		return
+	}
+	needle := strings.ToLower(b.search)
+
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for n := 1; n <= len(b.rows); n++ {
+		i := (b.cursor + n*step + len(b.rows)) % len(b.rows)
+		for _, val := range b.rows[i] {
+			if strings.Contains(strings.ToLower(val), needle) {
+				b.moveCursor(i - b.cursor)
+				return
+			}
+		}
+	}
+
+	b.status = fmt.Sprintf("Pattern not found: %s", b.search)
+}
+
+// handleSearchKey processes a key while the search prompt is open.
+func (b *resultBrowser) handleSearchKey(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		b.searching = false
+		b.findNext(true)
+
+	case tcell.KeyEscape:
+		b.searching = false
+		b.search = ""
+
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if len(b.search) > 0 {
+			r := []rune(b.search)
+			b.search = string(r[:len(r)-1])
+		}
+
+	case tcell.KeyRune:
+		b.search += string(ev.Rune())
+	}
+}
+
+// handleKey processes a key and reports whether the browser should close.
+func (b *resultBrowser) handleKey(ev *tcell.EventKey) bool {
+	b.status = ""
+
+	if b.searching {
+		b.handleSearchKey(ev)
+		return false
+	}
+
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		return true
+	case tcell.KeyUp:
+		b.moveCursor(-1)
+	case tcell.KeyDown:
+		b.moveCursor(1)
+	case tcell.KeyPgUp:
+		b.moveCursor(-b.pageSize())
+	case tcell.KeyPgDn:
+		b.moveCursor(b.pageSize())
+	case tcell.KeyHome:
+		b.moveCursor(-len(b.rows))
+	case tcell.KeyEnd:
+		b.moveCursor(len(b.rows))
+	case tcell.KeyLeft:
+		b.scrollCols(-1)
+	case tcell.KeyRight:
+		b.scrollCols(1)
+
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return true
+		case 'k':
+			b.moveCursor(-1)
+		case 'j':
+			b.moveCursor(1)
+		case 'h':
+			b.scrollCols(-1)
+		case 'l':
+			b.scrollCols(1)
+		case 'g':
+			b.moveCursor(-len(b.rows))
+		case 'G':
+			b.moveCursor(len(b.rows))
+		case 'f':
+			if b.frozen < len(b.cols)-1 {
+				b.frozen++
+				b.scrollCols(0)
+			}
+		case 'F':
+			if b.frozen > 0 {
+				b.frozen--
+			}
+		case '/':
+			b.searching = true
+			b.search = ""
+		case 'n':
+			b.findNext(true)
+		case 'N':
+			b.findNext(false)
+		}
+	}
+
+	return false
+}
+
+// run shows the browser until the user quits.
+func (b *resultBrowser) run() {
+	for {
+		b.draw()
+
+		switch ev := b.screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			b.moveCursor(0)
+			b.screen.Sync()
+
+		case *tcell.EventKey:
+			if b.handleKey(ev) {
+				return
+			}
+
+		case nil:
+			return
+		}
+	}
+}
+
+// browseResult opens the full-screen browser on an already formatted result.
+func browseResult(cols []string, rows [][]string) error {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err := screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	newResultBrowser(screen, cols, rows).run()
+
+	return nil
+}
+
+// fetchFormatted runs the query on the session connection and returns the
+// displayed columns of the result with every value formatted.
+func fetchFormatted(query string) ([]string, [][]string, error) {
+	rows, err := conn.QueryContext(context.Background(), query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	return formatResult(newLiveRows(rows, query), query)
+}
+
+// formatResult reads the displayed columns of a result, formatting every
+// value.
+func formatResult(rows resultRows, query string) ([]string, [][]string,
+	error) {
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	idx := displayColumns(cols)
+	formats := resultFormats(rows, query)
+	defer formats.close()
+
+	var data [][]string
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(idx))
+		for j, i := range idx {
+			row[j] = formats.format(i, vals[i])
+		}
+		data = append(data, row)
+	}
+
+	return pickStrings(cols, idx), data, rows.Err()
+}
+
+// terminalWidth returns the width set with \pset columns, else the width of
+// the terminal on stdout, or 0 if stdout isn't a terminal. The terminal is
+// asked every time so that resizes are picked up.
+func terminalWidth() int {
+	if columnsOverride > 0 {
+		return columnsOverride
+	}
+
+	w, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return w
+}
+
+func handleBrowseCommand(args string) error {
+	args = strings.TrimSpace(args)
+
+	switch {
+	case args == "auto":
+		fmt.Printf("Automatic browsing is %s\n", onOff(autoBrowse))
+		return nil
+
+	case args == "auto on" || args == "auto off":
+		autoBrowse = args == "auto on"
+		fmt.Printf("Automatic browsing is now %s\n", onOff(autoBrowse))
+		return nil
+	}
+
+	query := args
+	if query == "" {
+		query = lastQuery
+	}
+	if query == "" {
+		fmt.Println("Usage: \\browse [query | auto [on|off]]")
+		return errUsage
+	}
+
+	cols, data, err := fetchFormatted(query)
+	if err != nil {
+		fmt.Printf("Query failed: %v\n", err)
+		return err
+	}
+	if len(cols) == 0 {
+		fmt.Println("Query returned no columns.")
+		return errors.New("the query returned no columns")
+	}
+
+	if err := browseResult(cols, data); err != nil {
+		fmt.Printf("Browse error: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// isReadQuery reports whether the statement only reads data, so that it is
+// safe to run again.
+func isReadQuery(query string) bool {
+	keyword, _ := nextField(query)
+	switch strings.ToUpper(keyword) {
+	case "SELECT", "VALUES", "EXPLAIN":
+		return true
+
+	case "WITH":
+		return dmlTarget(query) == ""
+
+	default:
+		return false
+	}
+}
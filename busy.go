@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultBusyTimeout is how long statements wait for a lock held by
+	// another connection before failing, in milliseconds.
+	defaultBusyTimeout = 5000
+
+	// busyRetryDelay is the wait before the first retry of a statement
+	// that failed on a lock, doubled for each retry after it up to
+	// maxBusyRetryDelay.
+	busyRetryDelay    = 250 * time.Millisecond
+	maxBusyRetryDelay = 8 * time.Second
+)
+
+var (
+	// busyTimeout is applied to every connection as it is opened.
+	busyTimeout = defaultBusyTimeout
+
+	// busyRetries is how many times a statement that failed on a lock is
+	// run again, see retryBusy.
+	busyRetries = 3
+)
+
+func setBusyTimeoutOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected milliseconds")
+	}
+
+	ms, err := strconv.Atoi(args[0])
+	if err != nil || ms < 0 {
+		return fmt.Errorf("invalid timeout %q", args[0])
+	}
+
+	return setBusyTimeout(ms)
+}
+
+// setBusyTimeout changes the busy timeout of the session connection and of
+// connections opened from now on.
+func setBusyTimeout(ms int) error {
+	busyTimeout = ms
+	if conn == nil {
+		return nil
+	}
+
+	// Idle pooled connections still have the old timeout, so let them
+	// go and have the pool open fresh ones.
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(2)
+
+	_, err := conn.ExecContext(context.Background(),
+		fmt.Sprintf("PRAGMA busy_timeout = %d", ms))
+	return err
+}
+
+func setBusyRetriesOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a number of retries")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid number of retries %q", args[0])
+	}
+	busyRetries = n
+	return nil
+}
+
+// retryBusy runs a statement, and runs it again while it fails with
+// SQLITE_BUSY or SQLITE_LOCKED, up to busyRetries times with a doubling wait
+// in between, so that a writer holding the database for longer than the
+// busy timeout doesn't fail a script. run returns the number of rows it
+// printed, and whether it wrote any output. A statement is only retried if
+// it wrote nothing and no transaction is open: one failed on a lock has no
+// effect outside of a transaction, while inside one the lock may be held
+// against the transaction's own, which waiting doesn't resolve. ^C stops
+// waiting.
+func retryBusy(run func() (int, bool, error)) (int, error) {
+	delay := busyRetryDelay
+	for retry := 1; ; retry++ {
+		n, printed, err := run()
+		if err == nil || printed || retry > busyRetries {
+			return n, err
+		}
+		code, ok := sqliteErrorCode(err)
+		if !ok || code != sqliteBusy && code != sqliteLocked ||
+			inTransaction() {
+
+			return n, err
+		}
+
+		fmt.Printf("NOTE: the database is locked, retrying in %s "+
+			"(%d of %d)...\n", delay, retry, busyRetries)
+		if !waitInterruptibly(delay) {
+			return n, err
+		}
+		delay = min(delay*2, maxBusyRetryDelay)
+	}
+}
+
+// waitInterruptibly waits for d, and reports whether it wasn't cut short by
+// ^C.
+func waitInterruptibly(d time.Duration) bool {
+	defer watchOutputInterrupt()()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-outputCtx.Done():
+		return false
+	}
+}
+
+// explainLockError prints what is known about the lock behind a
+// SQLITE_BUSY or SQLITE_LOCKED error, and how to get past it.
+func explainLockError(err error) {
+	code, ok := sqliteErrorCode(err)
+	if !ok || quietMode {
+		return
+	}
+
+	switch code {
+	case sqliteBusy:
+		fmt.Printf("HINT: another connection holds a conflicting lock, "+
+			"waited %d ms per try (\\set busy_timeout to wait longer, "+
+			"busy_retries to retry more).\n", busyTimeout)
+
+		holders := lockHolders(databaseFile(dbPath))
+		if len(holders) > 0 {
+			fmt.Printf("HINT: locks on the database are held by: %s\n",
+				strings.Join(holders, ", "))
+		}
+
+		var journalMode string
+		conn.QueryRowContext(context.Background(),
+			"PRAGMA journal_mode").Scan(&journalMode)
+
+		if strings.EqualFold(journalMode, "wal") {
+			fmt.Println("HINT: in WAL mode only one writer may be " +
+				"active, and checkpoints wait for readers; " +
+				"finish long transactions in other processes, " +
+				"then PRAGMA wal_checkpoint(TRUNCATE).")
+		} else {
+			fmt.Println("HINT: close the other writer or commit its " +
+				"transaction; PRAGMA journal_mode=WAL lets " +
+				"readers and a writer work concurrently.")
+		}
+
+		fmt.Println("HINT: in your own transactions, BEGIN IMMEDIATE " +
+			"takes the write lock up front instead of failing " +
+			"when upgrading a read lock.")
+
+	case sqliteLocked:
+		fmt.Println("HINT: the table is locked within this connection " +
+			"(e.g. by an unfinished statement reading it) or by " +
+			"another connection sharing its cache (cache=shared).")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// versionString returns the version of the binary, falling back to the
+// module version for builds made with go install.
+func versionString() string {
+	if version != "dev" {
+		return version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return version
+}
+
+// subcommand is a non-interactive mode selected by the first argument, as
+// in "vsqlite dump app.db".
+type subcommand struct {
+	usage string
+	desc  string
+
+	// flags defines the options of the subcommand, if it has any.
+	flags func(fs *flag.FlagSet)
+
+	run func(args []string) int
+}
+
+var subcommands map[string]subcommand
+
+func init() {
+	subcommands = map[string]subcommand{
+		"dump": {
+			usage: "dump [options] <database-file>",
+			desc:  "print the database as SQL statements",
+			flags: defineDumpFlags,
+			run:   runDumpCommand,
+		},
+		"export": {
+			usage: "export [options] <database-file>",
+			desc:  "write each table to a file of its own, e.g. a CSV file",
+			flags: defineExportFlags,
+			run:   runExportCommand,
+		},
+		"diff": {
+			usage: "diff <database-file> <database-file>",
+			desc:  "compare the schemas of two databases",
+			run:   runDiffCommand,
+		},
+		"import": {
+			usage: "import [options] <database-file> <file> [table]",
+			desc:  "load a CSV, TSV or JSON file into a table",
+			flags: defineImportFlags,
+			run:   runImportCommand,
+		},
+		"completion": {
+			usage: "completion bash|zsh|fish",
+			desc:  "print a shell completion script",
+			run:   runCompletionCommand,
+		},
+		"advise": {
+			usage: "advise [options] <database-file>",
+			desc:  "suggest indexes for the statements in the history",
+			flags: defineAdviseFlags,
+			run:   runAdviseCommand,
+		},
+		"replay": {
+			usage: "replay [options] <database-file> <workload-file>",
+			desc:  "run a recorded workload and compare its latency",
+			flags: defineReplayFlags,
+			run:   runReplayCommand,
+		},
+		"migrate": {
+			usage: "migrate [options] <database-file> <dir>",
+			desc:  "apply the pending numbered .sql migrations in a directory",
+			flags: defineMigrateFlags,
+			run:   runMigrateCommand,
+		},
+	}
+}
+
+// newSubcommandFlags returns a flag set with the options and usage text of
+// a subcommand.
+func newSubcommandFlags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		cmd := subcommands[name]
+		fmt.Fprintf(fs.Output(), "Usage: vsqlite %s\n\n%s.\n",
+			cmd.usage, cmd.desc)
+
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nOptions:")
+			fs.PrintDefaults()
+		}
+	}
+	if define := subcommands[name].flags; define != nil {
+		define(fs)
+	}
+
+	return fs
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage:")
+	fmt.Fprintln(out, "  vsqlite [options] <database-file>")
+	fmt.Fprintln(out, "  vsqlite [options] <libsql://host | https://host>")
+	fmt.Fprintln(out, "  vsqlite [options] --rqlite http://host:4001")
+	fmt.Fprintln(out, "  vsqlite [options] ssh://[user@]host[:port]/path")
+	fmt.Fprintln(out, "  vsqlite <command> [arguments]")
+
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(out, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-10s %s\n", name, subcommands[name].desc)
+	}
+
+	fmt.Fprintln(out, "\nOptions:")
+	flag.PrintDefaults()
+}
+
+// runSubcommand runs the subcommand named by the first argument, if any.
+func runSubcommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+
+	// A database file may be named like a subcommand.
+	if _, err := os.Stat(args[0]); err == nil {
+		return 0, false
+	}
+
+	return cmd.run(args[1:]), true
+}
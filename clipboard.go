@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// clipboardCommands are tried in order to copy text to the clipboard.
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// copyToClipboard puts text on the system clipboard. Without a clipboard
+// tool the terminal is asked to do it with an OSC 52 escape sequence,
+// which also works over ssh in most terminals.
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			continue
+		}
+
+		cmd := exec.Command(path, args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err == nil {
+			return nil
+		}
+	}
+
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return fmt.Errorf("no clipboard tool found")
+	}
+	fmt.Printf("\x1b]52;c;%s\a",
+		base64.StdEncoding.EncodeToString([]byte(text)))
+
+	return nil
+}
+
+// tabSeparated renders a result as tab separated lines with a header, the
+// way spreadsheets paste it. NULL is left empty.
+func tabSeparated(set *resultSet) string {
+	idx := displayColumns(set.cols)
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ")
+
+	var b strings.Builder
+	b.WriteString(strings.Join(pickStrings(set.cols, idx), "\t"))
+	b.WriteString("\n")
+
+	formats := resultFormats(set.cursor(), set.query)
+	defer formats.close()
+	for _, row := range set.rows {
+		for j, i := range idx {
+			if j > 0 {
+				b.WriteString("\t")
+			}
+			if row[i] != nil {
+				b.WriteString(clean.Replace(formats.format(i, row[i])))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func handleCopyLastCommand(args []string) error {
+	if len(args) > 0 {
+		fmt.Println("Usage: \\copylast")
+		return errUsage
+	}
+
+	set, ok := lastResult()
+	if !ok {
+		return nil
+	}
+
+	if err := copyToClipboard(tabSeparated(set)); err != nil {
+		fmt.Printf("Copy failed: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Copied %d rows to the clipboard\n", len(set.rows))
+	return nil
+}
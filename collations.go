@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"golang.org/x/text/cases"
+)
+
+// collation is a collating sequence implemented in Go, registered on every
+// connection of the local drivers.
+type collation struct {
+	name string
+	desc string
+
+	// compare returns a negative number, zero or a positive number as a
+	// sorts before, the same as or after b.
+	compare func(a, b string) int
+}
+
+// collations are registered by the drivers that run SQLite in process.
+// NATURAL is a keyword, so natural ordering goes by NATURAL_SORT.
+var collations = []collation{
+	{
+		name: "NATURAL_SORT",
+		desc: "numbers by value, file2 before file10, " +
+			"case-insensitive",
+		compare: naturalCompare,
+	},
+	{
+		name:    "NOCASE_UTF8",
+		desc:    "case-insensitive with Unicode case folding",
+		compare: foldCompare,
+	},
+}
+
+// builtinCollations describes the collating sequences of SQLite itself.
+var builtinCollations = map[string]string{
+	"BINARY": "byte by byte, the default",
+	"NOCASE": "case-insensitive for ASCII letters only",
+	"RTRIM":  "byte by byte, ignoring trailing spaces",
+}
+
+// foldCompare compares the case folded strings, so that e.g. Ä and ä and
+// ß and ss sort together. SQLite's NOCASE only folds ASCII letters.
+func foldCompare(a, b string) int {
+	return strings.Compare(cases.Fold().String(a), cases.Fold().String(b))
+}
+
+// naturalCompare orders runs of digits by their value and the text around
+// them case-insensitively. Strings equal that way, like file01 and file1,
+// are ordered byte by byte so that only identical strings compare equal,
+// which UNIQUE indexes rely on.
+func naturalCompare(a, b string) int {
+	x, y := a, b
+	for x != "" && y != "" {
+		xd, yd := isDigit(x[0]), isDigit(y[0])
+		switch {
+		case xd && yd:
+			var xn, yn string
+			xn, x = splitDigits(x)
+			yn, y = splitDigits(y)
+			xv, yv := strings.TrimLeft(xn, "0"), strings.TrimLeft(yn, "0")
+			if len(xv) != len(yv) {
+				return len(xv) - len(yv)
+			}
+			if c := strings.Compare(xv, yv); c != 0 {
+				return c
+			}
+
+		case xd != yd:
+			// Numbers sort before text.
+			if xd {
+				return -1
+			}
+			return 1
+
+		default:
+			var xt, yt string
+			xt, x = splitText(x)
+			yt, y = splitText(y)
+			if c := foldCompare(xt, yt); c != 0 {
+				return c
+			}
+		}
+	}
+	if x != "" || y != "" {
+		return len(x) - len(y)
+	}
+
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// splitDigits splits off the leading digits of s.
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// splitText splits off s up to its first digit.
+func splitText(s string) (string, string) {
+	i := 0
+	for i < len(s) && !isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// printCollationList lists the collating sequences the session connection
+// knows, like \dO in psql.
+func printCollationList() error {
+	names, err := queryStrings(context.Background(), conn,
+		"SELECT name FROM pragma_collation_list ORDER BY name")
+	if err != nil {
+		return err
+	}
+
+	descs := make(map[string]string, len(collations))
+	for _, c := range collations {
+		descs[c.name] = c.desc
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Name", "Source", "Description"})
+	for _, name := range names {
+		switch {
+		case descs[name] != "":
+			t.AppendRow(table.Row{name, "vsqlite", descs[name]})
+		case builtinCollations[name] != "":
+			t.AppendRow(table.Row{name, "built-in",
+				builtinCollations[name]})
+		default:
+			t.AppendRow(table.Row{name, "extension", ""})
+		}
+	}
+	t.Render()
+
+	return nil
+}
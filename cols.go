@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+var (
+	// columnFilter holds the lowercased names of the columns picked with
+	// \cols. When empty, all columns are shown.
+	columnFilter map[string]bool
+
+	// lastColumns are the columns of the last result, offered by the
+	// \cols picker.
+	lastColumns []string
+)
+
+// displayColumns returns the indexes of the result columns to display. If a
+// filter is set but matches none of the columns, the result is unrelated to
+// the picked columns and is shown in full.
+func displayColumns(cols []string) []int {
+	var idx []int
+	for i, col := range cols {
+		if columnFilter[strings.ToLower(col)] {
+			idx = append(idx, i)
+		}
+	}
+
+	if len(idx) == 0 {
+		idx = allColumns(len(cols))
+	}
+
+	return idx
+}
+
+// allColumns returns the indexes of all n columns of a result.
+func allColumns(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// pickStrings returns the elements of vals at the given indexes.
+func pickStrings(vals []string, idx []int) []string {
+	picked := make([]string, len(idx))
+	for i, j := range idx {
+		picked[i] = vals[j]
+	}
+	return picked
+}
+
+// printColumnFilterNote reminds the user that some columns are hidden.
+func printColumnFilterNote(shown, total int) {
+	if shown < total && !quietMode && !tuplesOnly {
+		fmt.Printf("(showing %d of %d columns, \\cols reset to show all)\n",
+			shown, total)
+	}
+}
+
+func setColumnFilter(names []string) {
+	if len(names) == 0 {
+		columnFilter = nil
+		return
+	}
+
+	columnFilter = make(map[string]bool, len(names))
+	for _, name := range names {
+		columnFilter[strings.ToLower(name)] = true
+	}
+}
+
+// pickColumns lets the user choose among the columns of the last result with
+// the fuzzy finder. Tab marks multiple columns.
+func pickColumns() ([]string, bool) {
+	if len(lastColumns) == 0 {
+		fmt.Println("No result to pick columns from, run a query first.")
+		return nil, false
+	}
+
+	idx, err := fuzzyfinder.FindMulti(
+		lastColumns,
+		func(i int) string {
+			return lastColumns[i]
+		},
+		fuzzyfinder.WithPromptString("columns (tab to mark)> "),
+	)
+	if err != nil {
+		return nil, false
+	}
+
+	// Keep the original column order regardless of marking order.
+	selected := make(map[int]bool, len(idx))
+	for _, i := range idx {
+		selected[i] = true
+	}
+
+	var names []string
+	for i, col := range lastColumns {
+		if selected[i] {
+			names = append(names, col)
+		}
+	}
+
+	return names, true
+}
+
+func handleColsCommand(args []string) error {
+	switch {
+	case len(args) == 1 && args[0] == "reset":
+		setColumnFilter(nil)
+		fmt.Println("Showing all columns")
+		return nil
+
+	case len(args) == 1 && args[0] == "show":
+		if len(columnFilter) == 0 {
+			fmt.Println("Showing all columns")
+			return nil
+		}
+
+		var names []string
+		for name := range columnFilter {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("Showing columns: %s\n", strings.Join(names, ", "))
+		return nil
+
+	case len(args) > 0:
+		var names []string
+		for _, arg := range args {
+			for _, name := range strings.Split(arg, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		setColumnFilter(names)
+
+	default:
+		names, ok := pickColumns()
+		if !ok {
+			return nil
+		}
+		setColumnFilter(names)
+	}
+
+	// Redisplay the current result with the new selection, without
+	// running the query again if it is still cached.
+	if set, ok := cachedResult(lastQuery); ok {
+		printResult(set)
+	} else if lastQuery != "" {
+		_, err := runQuery(lastQuery)
+		return err
+	}
+	return nil
+}
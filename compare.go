@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"golang.org/x/term"
+)
+
+// rowChange is a difference between two results, a row only in the first
+// one, only in the second one, or in both with other values.
+type rowChange struct {
+	a, b []interface{}
+}
+
+// resultDiff is the row-level difference between two results.
+type resultDiff struct {
+	changes []rowChange
+
+	// reordered is set if the results hold the same rows in another
+	// order.
+	reordered bool
+}
+
+// fetchResult runs a query and reads all of its result.
+func fetchResult(ctx context.Context, query string) (*resultSet, error) {
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	set := &resultSet{query: query, cols: cols,
+		types: make([]string, len(cols))}
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range types {
+			set.types[i] = ct.DatabaseTypeName()
+		}
+	}
+
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		set.rows = append(set.rows, vals)
+	}
+
+	return set, rows.Err()
+}
+
+// rowKey renders values so that values of different types, like 1 and '1',
+// don't compare equal.
+func rowKey(vals []interface{}) string {
+	keys := make([]string, len(vals))
+	for i, v := range vals {
+		keys[i] = sqlLiteral(v)
+	}
+	return strings.Join(keys, "\x00")
+}
+
+// diffResults compares two results row by row, pairing the rows by their
+// first column. Rows sharing a key are paired in the order they come in.
+func diffResults(a, b *resultSet) resultDiff {
+	occurrence := func(rows [][]interface{}) []string {
+		seen := make(map[string]int)
+		keys := make([]string, len(rows))
+		for i, row := range rows {
+			k := sqlLiteral(row[0])
+			keys[i] = fmt.Sprintf("%s#%d", k, seen[k])
+			seen[k]++
+		}
+		return keys
+	}
+
+	aKeys, bKeys := occurrence(a.rows), occurrence(b.rows)
+	bByKey := make(map[string]int, len(bKeys))
+	for i, k := range bKeys {
+		bByKey[k] = i
+	}
+
+	var diff resultDiff
+	paired := make(map[string]bool, len(aKeys))
+	for i, k := range aKeys {
+		j, ok := bByKey[k]
+		switch {
+		case !ok:
+			diff.changes = append(diff.changes, rowChange{a: a.rows[i]})
+
+		case rowKey(a.rows[i]) != rowKey(b.rows[j]):
+			diff.changes = append(diff.changes,
+				rowChange{a: a.rows[i], b: b.rows[j]})
+		}
+		paired[k] = ok
+	}
+	for j, k := range bKeys {
+		if !paired[k] {
+			diff.changes = append(diff.changes, rowChange{b: b.rows[j]})
+		}
+	}
+
+	if len(diff.changes) == 0 {
+		diff.reordered = !slices.Equal(aKeys, bKeys)
+	}
+
+	return diff
+}
+
+// printResultDiff renders the differences as a table: rows only in A are
+// marked with -, rows only in B with + and changed rows with < and >, in
+// red, green and yellow on a terminal.
+func printResultDiff(cols []string, diff resultDiff) {
+	colors := map[string]text.Colors{
+		"-": {text.FgRed},
+		"+": {text.FgGreen},
+		"<": {text.FgYellow},
+		">": {text.FgYellow},
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+
+	header := table.Row{""}
+	for _, col := range cols {
+		header = append(header, col)
+	}
+	t.AppendHeader(header)
+
+	addRow := func(mark string, vals []interface{}) {
+		row := table.Row{mark}
+		for _, v := range vals {
+			row = append(row, formatValue(v))
+		}
+		t.AppendRow(row)
+	}
+	for _, c := range diff.changes {
+		switch {
+		case c.b == nil:
+			addRow("-", c.a)
+		case c.a == nil:
+			addRow("+", c.b)
+		default:
+			addRow("<", c.a)
+			addRow(">", c.b)
+		}
+	}
+
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		t.SetRowPainter(func(row table.Row) text.Colors {
+			mark, _ := row[0].(string)
+			return colors[mark]
+		})
+	}
+	t.Render()
+}
+
+// compareResults reports how result B differs from result A.
+func compareResults(a, b *resultSet) {
+	label := func(name string, set *resultSet) {
+		query := strings.Join(strings.Fields(set.query), " ")
+		if displayWidth(query) > 60 {
+			query = truncateWidth(query, 60)
+		}
+		fmt.Printf("%s: %s (%d rows)\n", name, query, len(set.rows))
+	}
+	label("A", a)
+	label("B", b)
+
+	if len(a.cols) != len(b.cols) {
+		fmt.Printf("The results have different columns: %s vs %s\n",
+			strings.Join(a.cols, ", "), strings.Join(b.cols, ", "))
+		return
+	}
+	if len(a.cols) == 0 {
+		fmt.Println("The queries return no columns to compare.")
+		return
+	}
+	for i := range a.cols {
+		if !strings.EqualFold(a.cols[i], b.cols[i]) {
+			fmt.Println("NOTE: the column names differ, comparing the " +
+				"columns by position.")
+			break
+		}
+	}
+
+	diff := diffResults(a, b)
+	switch {
+	case diff.reordered:
+		fmt.Println("The results hold the same rows in a different order.")
+		return
+
+	case len(diff.changes) == 0:
+		fmt.Println("The results are identical.")
+		return
+	}
+
+	var onlyA, onlyB, changed int
+	for _, c := range diff.changes {
+		switch {
+		case c.b == nil:
+			onlyA++
+		case c.a == nil:
+			onlyB++
+		default:
+			changed++
+		}
+	}
+	fmt.Printf("%d rows only in A, %d only in B, %d changed, matched on %s\n",
+		onlyA, onlyB, changed, a.cols[0])
+
+	printResultDiff(a.cols, diff)
+}
+
+// handleCompareCommand compares the results of two queries separated by
+// ;;, or the last two results.
+func handleCompareCommand(args string) error {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		if len(resultCache) < 2 {
+			err := errors.New("need two results, run two queries first " +
+				"or give them as <query A> ;; <query B>")
+			fmt.Printf("Compare error: %v\n", err)
+			return err
+		}
+		compareResults(resultCache[len(resultCache)-2],
+			resultCache[len(resultCache)-1])
+		return nil
+	}
+
+	queryA, queryB, ok := strings.Cut(args, ";;")
+	queryA = strings.TrimSpace(queryA)
+	queryB = strings.TrimSuffix(strings.TrimSpace(queryB), ";")
+	if !ok || queryA == "" || queryB == "" {
+		fmt.Println("Usage: \\compare [<query A> ;; <query B>]")
+		return errUsage
+	}
+
+	ctx := context.Background()
+	a, err := fetchResult(ctx, queryA)
+	if err != nil {
+		fmt.Printf("Compare error: query A: %v\n", err)
+		return err
+	}
+	b, err := fetchResult(ctx, queryB)
+	if err != nil {
+		fmt.Printf("Compare error: query B: %v\n", err)
+		return err
+	}
+
+	compareResults(a, b)
+	return nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// databaseExtensions are the file extensions offered when completing a
+// database file.
+var databaseExtensions = []string{"db", "sqlite", "sqlite3", "db3"}
+
+// completionFlag is an option as the completion scripts see it.
+type completionFlag struct {
+	name  string
+	usage string
+
+	// takesValue is false for boolean options.
+	takesValue bool
+
+	// values are the accepted values, if there is a fixed set. Otherwise
+	// files are completed for string options.
+	values []string
+	files  bool
+}
+
+// spelling returns the option as it is usually typed: single letter
+// options with one dash, others with two.
+func (f completionFlag) spelling() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// completionCommand is the top level or a subcommand with its options.
+type completionCommand struct {
+	name  string
+	desc  string
+	flags []completionFlag
+}
+
+// flagValues lists the accepted values of options that have a fixed set.
+func flagValues(name string) []string {
+	switch name {
+	case "driver":
+		return driverNames()
+
+	case "format":
+		var names []string
+		for _, name := range resultFormatNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+
+	case "json-blob":
+		return []string{"auto", "base64", "hex", "raw"}
+
+	case "on-conflict":
+		return []string{"fail", "ignore", "replace"}
+	}
+
+	return nil
+}
+
+// completionFlags describes the options of a flag set.
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var flags []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{
+			name:       f.Name,
+			usage:      f.Usage,
+			takesValue: true,
+			values:     flagValues(f.Name),
+		}
+
+		// Numbers and SQL commands can't be completed, strings are
+		// mostly file names.
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch g.Get().(type) {
+			case bool:
+				cf.takesValue = false
+			case string:
+				cf.files = cf.values == nil
+			}
+		}
+
+		flags = append(flags, cf)
+	})
+
+	return flags
+}
+
+// completionSpec collects the top level options and the subcommands.
+func completionSpec() (completionCommand, []completionCommand) {
+	fs := flag.NewFlagSet("vsqlite", flag.ContinueOnError)
+	defineFlags(fs)
+	top := completionCommand{name: "vsqlite", flags: completionFlags(fs)}
+
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cmds := make([]completionCommand, len(names))
+	for i, name := range names {
+		cmds[i] = completionCommand{
+			name:  name,
+			desc:  subcommands[name].desc,
+			flags: completionFlags(newSubcommandFlags(name)),
+		}
+	}
+
+	return top, cmds
+}
+
+// bashCompletionFlags returns the bash case branches completing the values
+// of the options, and the words completing the options themselves.
+func bashCompletionFlags(flags []completionFlag) (string, string) {
+	var cases strings.Builder
+	words := make([]string, len(flags))
+	for i, f := range flags {
+		words[i] = f.spelling()
+
+		pattern := fmt.Sprintf("-%s|--%s", f.name, f.name)
+		switch {
+		case !f.takesValue:
+			continue
+
+		case f.values != nil:
+			fmt.Fprintf(&cases, "\t\t\t%s) COMPREPLY=($(compgen -W %q "+
+				"-- \"$cur\")); return ;;\n", pattern,
+				strings.Join(f.values, " "))
+
+		case f.files:
+			fmt.Fprintf(&cases, "\t\t\t%s) COMPREPLY=($(compgen -f "+
+				"-- \"$cur\")); return ;;\n", pattern)
+
+		default:
+			fmt.Fprintf(&cases, "\t\t\t%s) return ;;\n", pattern)
+		}
+	}
+
+	return cases.String(), strings.Join(words, " ")
+}
+
+func writeBashCompletion(w io.Writer) {
+	top, cmds := completionSpec()
+
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.name
+	}
+
+	fmt.Fprint(w, `# bash completion for vsqlite, load with
+#   source <(vsqlite completion bash)
+
+_vsqlite_databases() {
+	local ext
+	for ext in `+strings.Join(databaseExtensions, " ")+`; do
+		COMPREPLY+=($(compgen -f -X "!*.$ext" -- "$cur"))
+	done
+	COMPREPLY+=($(compgen -d -- "$cur"))
+}
+
+_vsqlite() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local prev="${COMP_WORDS[COMP_CWORD-1]}"
+	COMPREPLY=()
+
+	case "${COMP_WORDS[1]}" in
+`)
+
+	for _, cmd := range cmds {
+		cases, words := bashCompletionFlags(cmd.flags)
+		fmt.Fprintf(w, "\t%s)\n", cmd.name)
+		if cmd.name == "completion" {
+			fmt.Fprintf(w, "\t\tif [[ $COMP_CWORD -eq 2 ]]; then\n"+
+				"\t\t\tCOMPREPLY=($(compgen -W \"bash zsh fish\" "+
+				"-- \"$cur\"))\n\t\tfi\n\t\treturn ;;\n")
+			continue
+		}
+		if cases != "" {
+			fmt.Fprintf(w, "\t\tcase \"$prev\" in\n%s\t\tesac\n", cases)
+		}
+		fmt.Fprintf(w, "\t\tif [[ $cur == -* ]]; then\n"+
+			"\t\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n"+
+			"\t\telse\n"+
+			"\t\t\tCOMPREPLY=($(compgen -f -- \"$cur\"))\n"+
+			"\t\tfi\n\t\treturn ;;\n", words)
+	}
+
+	cases, words := bashCompletionFlags(top.flags)
+	fmt.Fprintf(w, `	esac
+
+	case "$prev" in
+%s	esac
+
+	if [[ $cur == -* ]]; then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+		return
+	fi
+	if [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W %q -- "$cur"))
+	fi
+	_vsqlite_databases
+}
+
+complete -o filenames -F _vsqlite vsqlite
+`, strings.ReplaceAll(cases, "\t\t\t", "\t\t"), words,
+		strings.Join(names, " "))
+}
+
+// zshQuote quotes text for a single quoted zsh word.
+func zshQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshArgumentSpecs returns the _arguments specs of the options.
+func zshArgumentSpecs(flags []completionFlag) []string {
+	specs := make([]string, len(flags))
+	for i, f := range flags {
+		desc := strings.NewReplacer(
+			"[", `\[`, "]", `\]`, ":", `\:`,
+		).Replace(f.usage)
+		spec := f.spelling() + "[" + desc + "]"
+
+		switch {
+		case !f.takesValue:
+
+		case f.values != nil:
+			spec += ":" + f.name + ":(" + strings.Join(f.values, " ") + ")"
+
+		case f.files:
+			spec += ":" + f.name + ":_files"
+
+		default:
+			spec += ":" + f.name + ": "
+		}
+
+		specs[i] = zshQuote(spec)
+	}
+
+	return specs
+}
+
+func writeZshCompletion(w io.Writer) {
+	top, cmds := completionSpec()
+
+	fmt.Fprint(w, `#compdef vsqlite
+# zsh completion for vsqlite, load with
+#   source <(vsqlite completion zsh)
+# or save it as _vsqlite in a directory of $fpath.
+
+_vsqlite_databases() {
+	_files -g '*.(`+strings.Join(databaseExtensions, "|")+`)(-.)'
+}
+
+_vsqlite_first() {
+	local -a commands
+	commands=(
+`)
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "\t\t%s\n", zshQuote(cmd.name+":"+cmd.desc))
+	}
+	fmt.Fprint(w, `	)
+	_describe -t commands command commands
+	_vsqlite_databases
+}
+
+_vsqlite() {
+	case ${words[2]} in
+`)
+
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "\t%s)\n", cmd.name)
+		if cmd.name == "completion" {
+			fmt.Fprint(w, "\t\t_arguments '2:shell:(bash zsh fish)'\n"+
+				"\t\treturn ;;\n")
+			continue
+		}
+
+		fmt.Fprint(w, "\t\t_arguments -s \\\n")
+		for _, spec := range zshArgumentSpecs(cmd.flags) {
+			fmt.Fprintf(w, "\t\t\t%s \\\n", spec)
+		}
+		fmt.Fprint(w, "\t\t\t'*:file:_files'\n\t\treturn ;;\n")
+	}
+
+	fmt.Fprint(w, "\tesac\n\n\t_arguments -s \\\n")
+	for _, spec := range zshArgumentSpecs(top.flags) {
+		fmt.Fprintf(w, "\t\t%s \\\n", spec)
+	}
+	fmt.Fprint(w, `		'1: :_vsqlite_first' \
+		'*:database file:_vsqlite_databases'
+}
+
+if [ "$funcstack[1]" = "_vsqlite" ]; then
+	_vsqlite "$@"
+else
+	compdef _vsqlite vsqlite
+fi
+`)
+}
+
+// fishCompletionFlags writes the complete commands of the options, offered
+// when the condition holds.
+func fishCompletionFlags(w io.Writer, flags []completionFlag, cond string) {
+	for _, f := range flags {
+		opt := "-l " + f.name
+		if len(f.name) == 1 {
+			opt = "-s " + f.name
+		}
+
+		switch {
+		case !f.takesValue:
+
+		case f.values != nil:
+			opt += " -x -a " + fishQuote(strings.Join(f.values, " "))
+
+		case f.files:
+			opt += " -r -F"
+
+		default:
+			opt += " -x"
+		}
+
+		fmt.Fprintf(w, "complete -c vsqlite -n %s %s -d %s\n",
+			fishQuote(cond), opt, fishQuote(f.usage))
+	}
+}
+
+// fishQuote quotes text for a single quoted fish word.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer) {
+	top, cmds := completionSpec()
+
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.name
+	}
+	noCommand := "not __fish_seen_subcommand_from " +
+		strings.Join(names, " ")
+
+	fmt.Fprint(w, "# fish completion for vsqlite, load with\n"+
+		"#   vsqlite completion fish | source\n\n"+
+		"complete -c vsqlite -f\n")
+
+	for _, cmd := range cmds {
+		fmt.Fprintf(w, "complete -c vsqlite -n __fish_use_subcommand "+
+			"-a %s -d %s\n", cmd.name, fishQuote(cmd.desc))
+	}
+
+	exts := make([]string, len(databaseExtensions))
+	for i, ext := range databaseExtensions {
+		exts[i] = "(__fish_complete_suffix ." + ext + ")"
+	}
+	fmt.Fprintf(w, "complete -c vsqlite -n %s -a %s\n",
+		fishQuote(noCommand), fishQuote(strings.Join(exts, " ")))
+	fishCompletionFlags(w, top.flags, noCommand)
+
+	for _, cmd := range cmds {
+		cond := "__fish_seen_subcommand_from " + cmd.name
+		if cmd.name == "completion" {
+			fmt.Fprintf(w, "complete -c vsqlite -n %s -x "+
+				"-a 'bash zsh fish'\n", fishQuote(cond))
+			continue
+		}
+
+		fmt.Fprintf(w, "complete -c vsqlite -n %s -F\n", fishQuote(cond))
+		fishCompletionFlags(w, cmd.flags, cond)
+	}
+}
+
+// runCompletionCommand prints the completion script for a shell.
+func runCompletionCommand(args []string) int {
+	fs := newSubcommandFlags("completion")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	switch fs.Arg(0) {
+	case "bash":
+		writeBashCompletion(os.Stdout)
+	case "zsh":
+		writeZshCompletion(os.Stdout)
+	case "fish":
+		writeFishCompletion(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Completion error: unknown shell %q, "+
+			"expected bash, zsh or fish\n", fs.Arg(0))
+		return 1
+	}
+
+	return 0
+}
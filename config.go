@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// config is the user configuration read from the config file at startup.
+type config struct {
+	// Formatters maps a column selector to a value formatter, see
+	// setFormatters for the accepted forms.
+	Formatters map[string]string `json:"formatters"`
+
+	// BusyTimeout is the default busy timeout in milliseconds.
+	BusyTimeout *int `json:"busy_timeout"`
+
+	// BusyRetries is how many times statements failed on a lock are
+	// retried, see retryBusy.
+	BusyRetries *int `json:"busy_retries"`
+
+	// LogMinDuration is the slow query threshold in milliseconds, see
+	// recordSlowQuery.
+	LogMinDuration *int `json:"log_min_duration"`
+
+	// Templates maps names to queries for \template, see queryTemplate
+	// for the placeholder syntax.
+	Templates map[string]string `json:"templates"`
+
+	// KeyBindings maps keys to prompt actions, see keyActions.
+	KeyBindings map[string]string `json:"keybindings"`
+
+	// Masking lists the masking rules applied to exports and dumps, see
+	// maskRule for the patterns.
+	Masking []maskRuleConfig `json:"masking"`
+
+	// MaskingSalt is mixed into values masked with the hash action.
+	MaskingSalt string `json:"masking_salt"`
+
+	// Greeting replaces the banner of interactive sessions, "none" to
+	// print nothing. See greetingFields for the placeholders.
+	Greeting *string `json:"greeting"`
+
+	// Lint turns on the notices about suspicious statements, see
+	// lintChecks.
+	Lint *bool `json:"lint"`
+}
+
+// getConfigFilePath returns the config file, $VSQLITE_CONFIG or
+// config.json in the config directory.
+func getConfigFilePath() string {
+	if path := os.Getenv("VSQLITE_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(configDir(), "config.json")
+}
+
+// loadConfig reads and applies the config file. A missing file is not an
+// error.
+func loadConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := setFormatters(cfg.Formatters); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	setTemplates(cfg.Templates)
+
+	if err := setKeyBindings(cfg.KeyBindings); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := setMaskRules(cfg.Masking, cfg.MaskingSalt); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if cfg.Greeting != nil {
+		if err := setGreeting(*cfg.Greeting); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if cfg.Lint != nil {
+		lintEnabled = *cfg.Lint
+	}
+
+	if cfg.BusyTimeout != nil {
+		if err := setBusyTimeout(*cfg.BusyTimeout); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if cfg.BusyRetries != nil {
+		if *cfg.BusyRetries < 0 {
+			return fmt.Errorf("%s: invalid busy_retries %d", path,
+				*cfg.BusyRetries)
+		}
+		busyRetries = *cfg.BusyRetries
+	}
+
+	if cfg.LogMinDuration != nil {
+		if err := setLogMinDuration(*cfg.LogMinDuration); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+func printConnInfo() {
+	ctx := context.Background()
+
+	var version, journalMode, file, timeout string
+	for _, q := range []struct {
+		query string
+		dest  *string
+	}{
+		{"SELECT sqlite_version()", &version},
+		{"PRAGMA journal_mode", &journalMode},
+		{"PRAGMA busy_timeout", &timeout},
+		{"SELECT file FROM pragma_database_list WHERE name = 'main'",
+			&file},
+	} {
+		// A setting that can't be read is shown with the reason rather
+		// than left blank.
+		err := conn.QueryRowContext(ctx, q.query).Scan(q.dest)
+		if err != nil {
+			*q.dest = "error: " + err.Error()
+		}
+	}
+
+	// Show the parameters SQLite was actually given, including the ones
+	// added by command line options.
+	var params []string
+	if !isRemoteDatabase(dbPath) && !isSSHDatabase(dbPath) {
+		params = databaseURIParams(databaseDSN(dbPath, readOnly))
+	}
+	if len(params) == 0 {
+		params = []string{"none"}
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Setting", "Value"})
+	t.AppendRows([]table.Row{
+		{"Database", redactDatabaseName(dbPath)},
+		{"File", file},
+		{"URI parameters", strings.Join(params, ", ")},
+		{"Driver", driverFor(dbPath).name()},
+		{"SQLite version", version},
+		{"Journal mode", journalMode},
+		{"Busy timeout", timeout + " ms"},
+		{"Foreign keys", onOff(fkEnabled)},
+	})
+	t.Render()
+}
+
+// databaseLabel is the short name of a database shown in the prompt: the
+// file name, or the host of a remote database without one.
+func databaseLabel(name string) string {
+	if hasPrivateDatabase(name) {
+		return "sqlite"
+	}
+
+	if isRemoteDatabase(name) || isSSHDatabase(name) {
+		u, err := url.Parse(name)
+		if err != nil {
+			return "sqlite"
+		}
+		if base := path.Base(u.Path); base != "." && base != "/" {
+			return base
+		}
+		return u.Hostname()
+	}
+
+	return filepath.Base(databaseFile(name))
+}
+
+// promptPrefix is shown in front of every input line. It names the database,
+// which \open may switch, and flags unenforced foreign keys, since SQLite
+// silently accepts violations in that case, an open snapshot, whose queries
+// don't see the latest data, and uncommitted statements of undo mode.
+func promptPrefix() (string, bool) {
+	if prefix, ok := reverseSearchPrefix(); ok {
+		return prefix, true
+	}
+	var flags []string
+	if !fkEnabled {
+		flags = append(flags, "fk:off")
+	}
+	if activeSnapshot != nil {
+		flags = append(flags, "snapshot")
+	}
+	if len(undoStack) > 0 {
+		flags = append(flags, fmt.Sprintf("undo:%d", len(undoStack)))
+	}
+	label := databaseLabel(dbPath)
+	if len(flags) > 0 {
+		return label + "[" + strings.Join(flags, ",") + "]> ", true
+	}
+	return label + "> ", true
+}
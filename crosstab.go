@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// crosstab pivots a result: the distinct values of column v become the
+// rows, those of column h the columns, and the values of column d fill the
+// cells. Headers keep the order in which values first appear.
+func crosstab(set *resultSet, v, h, d int) (*resultSet, error) {
+	pivot := &resultSet{
+		query: set.query,
+		cols:  []string{set.cols[v]},
+		types: []string{set.types[v]},
+	}
+
+	rowIndex := make(map[string]int)
+	colIndex := make(map[string]int)
+	for _, row := range set.rows {
+		hKey := formatValue(row[h])
+		if _, ok := colIndex[hKey]; !ok {
+			colIndex[hKey] = len(pivot.cols)
+			pivot.cols = append(pivot.cols, hKey)
+			pivot.types = append(pivot.types, set.types[d])
+		}
+	}
+
+	for _, row := range set.rows {
+		vKey := formatValue(row[v])
+		i, ok := rowIndex[vKey]
+		if !ok {
+			i = len(pivot.rows)
+			rowIndex[vKey] = i
+
+			cells := make([]interface{}, len(pivot.cols))
+			cells[0] = row[v]
+			pivot.rows = append(pivot.rows, cells)
+		}
+
+		j := colIndex[formatValue(row[h])]
+		if pivot.rows[i][j] != nil {
+			return nil, fmt.Errorf("multiple values for row %q, "+
+				"column %q", vKey, pivot.cols[j])
+		}
+		pivot.rows[i][j] = row[d]
+	}
+
+	return pivot, nil
+}
+
+// handleCrosstabCommand shows the last result as a crosstab, like psql's
+// \crosstabview. Columns are given by name or position; the headers default
+// to the first and second column and the data to the remaining one.
+func handleCrosstabCommand(args []string) error {
+	if len(args) > 3 {
+		fmt.Println("Usage: \\crosstabview [colV [colH [colD]]]")
+		return errUsage
+	}
+
+	set, ok := lastResult()
+	if !ok {
+		return nil
+	}
+	if len(set.cols) < 3 {
+		err := errors.New("the result needs at least 3 columns")
+		fmt.Printf("Crosstab error: %v\n", err)
+		return err
+	}
+
+	// With more than three columns the data column must be named.
+	if len(set.cols) > 3 && len(args) < 3 {
+		err := errors.New("name the data column when the result has " +
+			"more than 3 columns")
+		fmt.Printf("Crosstab error: %v\n", err)
+		return err
+	}
+
+	names := []string{"1", "2"}
+	copy(names, args)
+	if len(args) == 3 {
+		names = args
+	}
+
+	idx := make([]int, len(names))
+	for i, name := range names {
+		var err error
+		if idx[i], err = set.columnIndex(name); err != nil {
+			fmt.Printf("Crosstab error: %v\n", err)
+			return err
+		}
+	}
+	if idx[0] == idx[1] {
+		err := errors.New("the vertical and horizontal header columns " +
+			"must differ")
+		fmt.Printf("Crosstab error: %v\n", err)
+		return err
+	}
+
+	// The data column defaults to the one left over.
+	if len(idx) == 2 {
+		idx = append(idx, 3-idx[0]-idx[1])
+	}
+
+	pivot, err := crosstab(set, idx[0], idx[1], idx[2])
+	if err != nil {
+		fmt.Printf("Crosstab error: %v\n", err)
+		return err
+	}
+
+	printResult(pivot)
+	return nil
+}
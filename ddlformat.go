@@ -0,0 +1,423 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// sqlTokenKind tells what an SQL token is, for formatting and coloring.
+type sqlTokenKind int
+
+const (
+	tokenSpace sqlTokenKind = iota
+	tokenWord
+	tokenQuoted
+	tokenString
+	tokenNumber
+	tokenComment
+	tokenPunct
+)
+
+// sqlToken is a piece of an SQL statement. The texts of the tokens of a
+// statement add up to the statement.
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+}
+
+// sqlKeywords are the keywords of SQLite, which are highlighted.
+var sqlKeywords = make(map[string]bool)
+
+func init() {
+	for _, k := range strings.Fields(`ABORT ACTION ADD AFTER ALL ALTER
+		ALWAYS ANALYZE AND AS ASC ATTACH AUTOINCREMENT BEFORE BEGIN
+		BETWEEN BY CASCADE CASE CAST CHECK COLLATE COLUMN COMMIT CONFLICT
+		CONSTRAINT CREATE CROSS CURRENT CURRENT_DATE CURRENT_TIME
+		CURRENT_TIMESTAMP DATABASE DEFAULT DEFERRABLE DEFERRED DELETE DESC
+		DETACH DISTINCT DO DROP EACH ELSE END ESCAPE EXCEPT EXCLUDE
+		EXCLUSIVE EXISTS EXPLAIN FAIL FILTER FIRST FOLLOWING FOR FOREIGN
+		FROM FULL GENERATED GLOB GROUP GROUPS HAVING IF IGNORE IMMEDIATE IN
+		INDEX INDEXED INITIALLY INNER INSERT INSTEAD INTERSECT INTO IS
+		ISNULL JOIN KEY LAST LEFT LIKE LIMIT MATCH MATERIALIZED NATURAL NO
+		NOT NOTHING NOTNULL NULL NULLS OF OFFSET ON OR ORDER OTHERS OUTER
+		OVER PARTITION PLAN PRAGMA PRECEDING PRIMARY QUERY RAISE RANGE
+		RECURSIVE REFERENCES REGEXP REINDEX RELEASE RENAME REPLACE RESTRICT
+		RETURNING RIGHT ROLLBACK ROW ROWID ROWS SAVEPOINT SELECT SET STORED
+		STRICT TABLE TEMP TEMPORARY THEN TIES TO TRANSACTION TRIGGER
+		UNBOUNDED UNION UNIQUE UPDATE USING VACUUM VALUES VIEW VIRTUAL WHEN
+		WHERE WINDOW WITH WITHOUT`) {
+
+		sqlKeywords[k] = true
+	}
+}
+
+// sqlClauseKeywords start a new line in a formatted SELECT.
+var sqlClauseKeywords = map[string]bool{
+	"FROM": true, "WHERE": true, "GROUP": true, "HAVING": true,
+	"WINDOW": true, "ORDER": true, "LIMIT": true, "UNION": true,
+	"INTERSECT": true, "EXCEPT": true, "VALUES": true, "RETURNING": true,
+}
+
+// sqlJoinKeywords may come before JOIN, the line breaks before the first.
+var sqlJoinKeywords = map[string]bool{
+	"NATURAL": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"INNER": true, "CROSS": true, "OUTER": true,
+}
+
+// tokenizeSQL splits a statement into tokens, keeping all of its text.
+func tokenizeSQL(s string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		kind, end := tokenPunct, i+1
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			kind = tokenSpace
+			for end < len(s) && strings.IndexByte(" \t\n\r", s[end]) >= 0 {
+				end++
+			}
+
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			kind, end = tokenComment, len(s)
+			if n := strings.IndexByte(s[i:], '\n'); n >= 0 {
+				end = i + n
+			}
+
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			kind, end = tokenComment, len(s)
+			if n := strings.Index(s[i+2:], "*/"); n >= 0 {
+				end = i + 2 + n + 2
+			}
+
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			kind = tokenQuoted
+			if c == '\'' {
+				kind = tokenString
+			}
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end = len(s)
+			for j := i + 1; j < len(s); j++ {
+				if s[j] != closing {
+					continue
+				}
+				// Quotes are escaped by doubling them.
+				if closing != ']' && j+1 < len(s) && s[j+1] == closing {
+					j++
+					continue
+				}
+				end = j + 1
+				break
+			}
+
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(s) &&
+			s[i+1] >= '0' && s[i+1] <= '9':
+
+			kind = tokenNumber
+			for end < len(s) && (isWordByte(s[end]) || s[end] == '.' ||
+				(s[end] == '+' || s[end] == '-') &&
+					(s[end-1] == 'e' || s[end-1] == 'E')) {
+
+				end++
+			}
+
+		case isWordByte(c):
+			kind = tokenWord
+			for end < len(s) && isWordByte(s[end]) {
+				end++
+			}
+		}
+
+		tokens = append(tokens, sqlToken{kind: kind, text: s[i:end]})
+		i = end
+	}
+	return tokens
+}
+
+// isWordByte reports whether c may be part of an unquoted identifier or
+// keyword. Bytes of multi-byte characters are.
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// isKeyword reports whether a token is the given keyword.
+func (t sqlToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// ddlLine is a statement being formatted: its tokens without whitespace,
+// each noting whether whitespace came before it.
+type ddlLine struct {
+	tokens []sqlToken
+	spaced []bool
+}
+
+func newDDLLine(stmt string) ddlLine {
+	var l ddlLine
+	space := false
+	for _, t := range tokenizeSQL(stmt) {
+		if t.kind == tokenSpace {
+			space = true
+			continue
+		}
+		l.tokens = append(l.tokens, t)
+		l.spaced = append(l.spaced, space && len(l.tokens) > 1)
+		space = false
+	}
+	return l
+}
+
+// text joins the tokens from i to j, with a single space wherever the
+// statement had whitespace. A line comment ends the line.
+func (l ddlLine) text(i, j int) string {
+	var b strings.Builder
+	for k := i; k < j; k++ {
+		switch {
+		case k == i:
+		case strings.HasPrefix(l.tokens[k-1].text, "--"):
+			b.WriteString("\n")
+		case l.spaced[k]:
+			b.WriteString(" ")
+		}
+		b.WriteString(l.tokens[k].text)
+	}
+	return b.String()
+}
+
+// depths returns the parenthesis depth before each token.
+func (l ddlLine) depths() []int {
+	depths := make([]int, len(l.tokens))
+	depth := 0
+	for i, t := range l.tokens {
+		if t.kind == tokenPunct && t.text == ")" {
+			depth--
+		}
+		depths[i] = depth
+		if t.kind == tokenPunct && t.text == "(" {
+			depth++
+		}
+	}
+	return depths
+}
+
+// find returns the index of the first token at depth 0 from i on that is
+// the keyword, or -1.
+func (l ddlLine) find(i int, keyword string) int {
+	depths := l.depths()
+	for ; i < len(l.tokens); i++ {
+		if depths[i] == 0 && l.tokens[i].isKeyword(keyword) {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectText formats the tokens from i to j as a query, with its clauses
+// on lines of their own.
+func (l ddlLine) selectText(i, j int, indent string) string {
+	depths := l.depths()
+
+	// Lines break before the clauses at the top level, and before the
+	// first of the keywords making up a join.
+	breaks := make(map[int]bool)
+	for k := i + 1; k < j; k++ {
+		t := l.tokens[k]
+		if depths[k] != 0 || t.kind != tokenWord {
+			continue
+		}
+		upper := strings.ToUpper(t.text)
+		switch {
+		case upper == "FROM" && l.tokens[k-1].isKeyword("DELETE"):
+
+		case sqlClauseKeywords[upper]:
+			breaks[k] = true
+
+		case upper == "SELECT":
+			prev := strings.ToUpper(l.tokens[k-1].text)
+			if prev == "ALL" || sqlClauseKeywords[prev] {
+				breaks[k] = true
+			}
+
+		case upper == "JOIN":
+			start := k
+			for start > i+1 && l.tokens[start-1].kind == tokenWord &&
+				sqlJoinKeywords[strings.ToUpper(l.tokens[start-1].text)] {
+
+				start--
+			}
+			breaks[start] = true
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(indent)
+	start := i
+	for k := i + 1; k <= j; k++ {
+		if k < j && !breaks[k] {
+			continue
+		}
+		if start > i {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString(l.text(start, k))
+		start = k
+	}
+	return b.String()
+}
+
+// formatDDL re-indents a CREATE statement: the columns and constraints of
+// a table and the statements of a trigger go on lines of their own, and
+// the clauses of a view's query. Other statements are put on one line.
+func formatDDL(stmt string) string {
+	l := newDDLLine(strings.TrimSpace(stmt))
+	n := len(l.tokens)
+	if n == 0 {
+		return ""
+	}
+
+	// The kind of object follows CREATE and its modifiers.
+	kind := -1
+	for k := 1; k < n && kind < 0; k++ {
+		for _, word := range []string{"TABLE", "VIEW", "TRIGGER"} {
+			if l.tokens[k].isKeyword(word) {
+				kind = k
+			}
+		}
+	}
+	if !l.tokens[0].isKeyword("CREATE") || kind < 0 {
+		return l.text(0, n)
+	}
+
+	switch strings.ToUpper(l.tokens[kind].text) {
+	case "TABLE":
+		if l.tokens[kind-1].isKeyword("VIRTUAL") {
+			break
+		}
+		if as := l.find(kind, "AS"); as >= 0 {
+			return l.text(0, as+1) + "\n" + l.selectText(as+1, n, "")
+		}
+		return l.tableText(kind)
+
+	case "VIEW":
+		if as := l.find(kind, "AS"); as >= 0 {
+			return l.text(0, as+1) + "\n" + l.selectText(as+1, n, "")
+		}
+
+	case "TRIGGER":
+		if begin := l.find(kind, "BEGIN"); begin >= 0 {
+			return l.triggerText(begin)
+		}
+	}
+	return l.text(0, n)
+}
+
+// tableText formats a CREATE TABLE with one column or constraint per line.
+func (l ddlLine) tableText(kind int) string {
+	depths := l.depths()
+	open := -1
+	for k := kind; k < len(l.tokens); k++ {
+		if l.tokens[k].kind == tokenPunct && l.tokens[k].text == "(" {
+			open = k
+			break
+		}
+	}
+	if open < 0 {
+		return l.text(0, len(l.tokens))
+	}
+
+	var b strings.Builder
+	b.WriteString(l.text(0, open) + " (")
+	start := open + 1
+	for k := start; k < len(l.tokens); k++ {
+		t := l.tokens[k]
+		if t.kind != tokenPunct || !(t.text == "," && depths[k] == 1 ||
+			t.text == ")" && depths[k] == 0) {
+
+			continue
+		}
+
+		if t.text == "," {
+			// The comma can't follow a line comment ending the item.
+			end := k
+			if l.tokens[k-1].kind == tokenComment &&
+				strings.HasPrefix(l.tokens[k-1].text, "--") {
+
+				end--
+			}
+			b.WriteString("\n    " + l.text(start, end) + ",")
+			if end < k {
+				b.WriteString(" " + l.tokens[end].text)
+			}
+			start = k + 1
+			continue
+		}
+
+		b.WriteString("\n    " + l.text(start, k))
+
+		b.WriteString("\n)")
+		if k+1 < len(l.tokens) {
+			b.WriteString(" " + l.text(k+1, len(l.tokens)))
+		}
+		return b.String()
+	}
+	return l.text(0, len(l.tokens))
+}
+
+// triggerText formats a CREATE TRIGGER with one statement of its body per
+// line.
+func (l ddlLine) triggerText(begin int) string {
+	depths := l.depths()
+
+	var b strings.Builder
+	b.WriteString(l.text(0, begin+1))
+	start := begin + 1
+	for k := start; k < len(l.tokens); k++ {
+		t := l.tokens[k]
+		switch {
+		case depths[k] != 0:
+			continue
+
+		case t.kind == tokenPunct && t.text == ";":
+			b.WriteString("\n" + l.selectText(start, k, "    ") + ";")
+			start = k + 1
+
+		case t.isKeyword("END") && k == len(l.tokens)-1:
+			if start < k {
+				b.WriteString("\n" + l.selectText(start, k, "    "))
+			}
+			b.WriteString("\n" + t.text)
+			return b.String()
+		}
+	}
+	return l.text(0, len(l.tokens))
+}
+
+// highlightSQL colors the keywords, strings, numbers and comments of SQL
+// text when stdout is a terminal.
+func highlightSQL(s string) string {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return s
+	}
+
+	var b strings.Builder
+	for _, t := range tokenizeSQL(s) {
+		switch {
+		case t.kind == tokenWord && sqlKeywords[strings.ToUpper(t.text)]:
+			b.WriteString(colorize(t.text, "1;34"))
+		case t.kind == tokenString:
+			b.WriteString(colorize(t.text, "32"))
+		case t.kind == tokenNumber:
+			b.WriteString(colorize(t.text, "36"))
+		case t.kind == tokenComment:
+			b.WriteString(colorize(t.text, "90"))
+		default:
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
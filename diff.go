@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// schemaChange is a difference between two schemas. Either side is nil if
+// the object only exists in the other schema.
+type schemaChange struct {
+	old, new *schemaObject
+}
+
+// normalizeSQL collapses whitespace so that formatting differences don't
+// count as changes.
+func normalizeSQL(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// diffSchemas compares two schemas object by object, in the order of the
+// new schema followed by objects that were dropped.
+func diffSchemas(oldObjs, newObjs []schemaObject) []schemaChange {
+	key := func(o schemaObject) string {
+		return o.typ + "\x00" + strings.ToLower(o.name)
+	}
+
+	oldByKey := make(map[string]*schemaObject, len(oldObjs))
+	for i := range oldObjs {
+		oldByKey[key(oldObjs[i])] = &oldObjs[i]
+	}
+
+	var changes []schemaChange
+	seen := make(map[string]bool, len(newObjs))
+	for i := range newObjs {
+		n := &newObjs[i]
+		seen[key(*n)] = true
+
+		o, ok := oldByKey[key(*n)]
+		switch {
+		case !ok:
+			changes = append(changes, schemaChange{new: n})
+
+		case normalizeSQL(o.sql) != normalizeSQL(n.sql):
+			changes = append(changes, schemaChange{old: o, new: n})
+		}
+	}
+
+	for i := range oldObjs {
+		if !seen[key(oldObjs[i])] {
+			changes = append(changes, schemaChange{old: &oldObjs[i]})
+		}
+	}
+
+	return changes
+}
+
+// readSchemaFile reads the schema of the database file at path.
+func readSchemaFile(ctx context.Context, path string) ([]schemaObject,
+	error) {
+
+	fileDB, err := openDatabase(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer fileDB.Close()
+
+	c, err := fileDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return readSchemaObjects(ctx, c)
+}
+
+func printSchemaChanges(changes []schemaChange) {
+	for _, c := range changes {
+		switch {
+		case c.old == nil:
+			fmt.Printf("+ %s %s\n  %s;\n", c.new.typ, c.new.name,
+				c.new.sql)
+
+		case c.new == nil:
+			fmt.Printf("- %s %s\n  %s;\n", c.old.typ, c.old.name,
+				c.old.sql)
+
+		default:
+			fmt.Printf("~ %s %s\n  - %s;\n  + %s;\n", c.new.typ,
+				c.new.name, c.old.sql, c.new.sql)
+		}
+	}
+}
+
+func runDiffCommand(args []string) int {
+	fs := newSubcommandFlags("diff")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	ctx := context.Background()
+
+	oldObjs, err := readSchemaFile(ctx, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff error: %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	newObjs, err := readSchemaFile(ctx, fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff error: %s: %v\n", fs.Arg(1), err)
+		return 1
+	}
+
+	changes := diffSchemas(oldObjs, newObjs)
+	if len(changes) == 0 {
+		fmt.Println("Schemas are identical.")
+		return 0
+	}
+	printSchemaChanges(changes)
+
+	// Like diff(1), report differences through the exit status.
+	return 1
+}
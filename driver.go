@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SQLite primary result codes that get special treatment.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// sqliteDriver hides the differences between the database/sql drivers
+// vsqlite can be built with.
+type sqliteDriver interface {
+	// name identifies the driver in --driver and \conninfo.
+	name() string
+
+	// module is the import path of the Go module implementing the
+	// driver, empty if it is part of vsqlite.
+	module() string
+
+	// open opens a database. Every connection the pool opens must have
+	// the session's busy timeout applied.
+	open(dsn string) (*sql.DB, error)
+
+	// errorCode extracts the extended SQLite result code from an error
+	// returned by the driver. Its low byte is the primary result code.
+	errorCode(err error) (int, bool)
+}
+
+// changesetDriver is implemented by drivers exposing SQLite's session
+// extension, see \session.
+type changesetDriver interface {
+	// startSession starts recording the changes made on the connection
+	// to the tables, or to all tables if none are given.
+	startSession(c *sql.Conn, tables []string) (changeSession, error)
+
+	// applyChangeset applies a changeset on the connection, skipping
+	// conflicting changes or, with replace, overwriting the rows they
+	// conflict with.
+	applyChangeset(c *sql.Conn, changeset []byte,
+		replace bool) (changesetConflicts, error)
+}
+
+// blobDriver is implemented by drivers exposing SQLite's incremental BLOB
+// I/O, see \blobout.
+type blobDriver interface {
+	// readBlob runs f with a reader over a BLOB or TEXT value, which
+	// reads it in pieces rather than loading all of it, and its size in
+	// bytes. The connection is locked until f returns.
+	readBlob(c *sql.Conn, ref blobRef,
+		f func(r io.ReaderAt, size int64) error) error
+}
+
+var (
+	// drivers are the drivers compiled into the binary, registered by
+	// the driver_*.go files.
+	drivers = make(map[string]sqliteDriver)
+
+	// preferredDriver is the default when several are compiled in.
+	preferredDriver string
+
+	// activeDriver is the driver used to open databases.
+	activeDriver sqliteDriver
+)
+
+// registerDriver makes a driver available. A preferred driver becomes the
+// default.
+func registerDriver(d sqliteDriver, preferred bool) {
+	drivers[d.name()] = d
+	if preferred || activeDriver == nil {
+		activeDriver = d
+		preferredDriver = d.name()
+	}
+}
+
+// driverNames returns the names of the compiled in drivers.
+func driverNames() []string {
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func selectDriver(name string) error {
+	d, ok := drivers[name]
+	if !ok {
+		return fmt.Errorf("unknown driver %q, available: %s", name,
+			strings.Join(driverNames(), ", "))
+	}
+
+	activeDriver = d
+	return nil
+}
+
+// sqliteErrorCode returns the primary result code of an SQLite error from
+// the session database.
+func sqliteErrorCode(err error) (int, bool) {
+	code, ok := sqliteExtendedErrorCode(err)
+	return code & 0xff, ok
+}
+
+// sqliteExtendedErrorCode returns the extended result code of an SQLite
+// error from the session database, e.g. SQLITE_CONSTRAINT_UNIQUE rather
+// than SQLITE_CONSTRAINT.
+func sqliteExtendedErrorCode(err error) (int, bool) {
+	return driverFor(dbPath).errorCode(err)
+}
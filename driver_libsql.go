@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"strings"
+
+	_ "github.com/tursodatabase/libsql-client-go/libsql"
+)
+
+// remoteSchemes are the URL schemes of libsql/Turso remote databases.
+var remoteSchemes = []string{"libsql://", "https://", "http://", "wss://",
+	"ws://"}
+
+// libsqlAuthParams are the query parameters that carry credentials.
+var libsqlAuthParams = []string{"authToken", "auth_token", "jwt"}
+
+// internalTablesFilter is appended to sqlite_master queries to hide the
+// bookkeeping tables libsql-server and Turso keep in every database.
+const internalTablesFilter = `
+		  AND tbl_name NOT LIKE 'libsql\_%' ESCAPE '\'
+		  AND tbl_name NOT LIKE '\_litestream\_%' ESCAPE '\'`
+
+// libsqlDriver talks to libsql-server and Turso over the network. It is
+// picked by the database URL rather than with --driver.
+type libsqlDriver struct{}
+
+func (libsqlDriver) name() string {
+	return "libsql"
+}
+
+func (libsqlDriver) module() string {
+	return "github.com/tursodatabase/libsql-client-go"
+}
+
+func (libsqlDriver) open(dsn string) (*sql.DB, error) {
+	return sql.Open("libsql", libsqlDSN(dsn))
+}
+
+// errorCode can't tell SQLite result codes from the server's error
+// messages.
+func (libsqlDriver) errorCode(err error) (int, bool) {
+	return 0, false
+}
+
+// isRemoteDatabase reports whether the database name is a libsql or rqlite
+// URL.
+func isRemoteDatabase(name string) bool {
+	if isRqliteDatabase(name) {
+		return true
+	}
+	for _, scheme := range remoteSchemes {
+		if strings.HasPrefix(name, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// libsqlDSN adds the auth token from LIBSQL_AUTH_TOKEN or TURSO_AUTH_TOKEN
+// if the URL doesn't carry one, so that tokens don't have to be typed on
+// the command line.
+func libsqlDSN(name string) string {
+	u, err := url.Parse(name)
+	if err != nil {
+		return name
+	}
+
+	query := u.Query()
+	for _, p := range libsqlAuthParams {
+		if query.Has(p) {
+			return name
+		}
+	}
+
+	token := os.Getenv("LIBSQL_AUTH_TOKEN")
+	if token == "" {
+		token = os.Getenv("TURSO_AUTH_TOKEN")
+	}
+	if token == "" {
+		return name
+	}
+
+	query.Set("authToken", token)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// redactDatabaseName hides credentials in a database name before it is
+// shown or stored.
+func redactDatabaseName(name string) string {
+	if !isRemoteDatabase(name) {
+		return name
+	}
+
+	u, err := url.Parse(name)
+	if err != nil {
+		return name
+	}
+
+	query := u.Query()
+	for _, p := range libsqlAuthParams {
+		query.Del(p)
+	}
+	u.RawQuery = query.Encode()
+	u.User = nil
+
+	return u.String()
+}
@@ -0,0 +1,100 @@
+//go:build mattn
+
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// mattnDriver is the CGO driver. It is markedly faster on large scans and
+// supports loadable extensions. Build with -tags mattn to include it.
+type mattnDriver struct{}
+
+func init() {
+	sql.Register("vsqlite-sqlite3", &sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			_, err := c.Exec(fmt.Sprintf(
+				"PRAGMA busy_timeout = %d", busyTimeout,
+			), nil)
+			if err != nil {
+				return err
+			}
+
+			for _, coll := range collations {
+				err := c.RegisterCollation(coll.name, coll.compare)
+				if err != nil {
+					return err
+				}
+			}
+			for _, a := range aggregates {
+				if err := registerMattnAggregate(c, a); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+
+	registerDriver(mattnDriver{}, true)
+}
+
+func (mattnDriver) name() string {
+	return "mattn"
+}
+
+func (mattnDriver) module() string {
+	return "github.com/mattn/go-sqlite3"
+}
+
+func (mattnDriver) open(dsn string) (*sql.DB, error) {
+	return sql.Open("vsqlite-sqlite3", dsn)
+}
+
+func (mattnDriver) errorCode(err error) (int, bool) {
+	var serr sqlite3.Error
+	if !errors.As(err, &serr) {
+		return 0, false
+	}
+	return int(serr.ExtendedCode), true
+}
+
+// mattnAggregate1 and mattnAggregate2 adapt aggregators to the driver,
+// which takes the arguments from the signature of Step.
+type mattnAggregate1 struct{ a aggregator }
+
+func (m *mattnAggregate1) Step(x any) error {
+	return m.a.step([]driver.Value{x})
+}
+
+func (m *mattnAggregate1) Done() (any, error) {
+	return m.a.result()
+}
+
+type mattnAggregate2 struct{ a aggregator }
+
+func (m *mattnAggregate2) Step(x, y any) error {
+	return m.a.step([]driver.Value{x, y})
+}
+
+func (m *mattnAggregate2) Done() (any, error) {
+	return m.a.result()
+}
+
+func registerMattnAggregate(c *sqlite3.SQLiteConn, a aggregateFunc) error {
+	switch a.nargs {
+	case 1:
+		return c.RegisterAggregator(a.name, func() *mattnAggregate1 {
+			return &mattnAggregate1{a: a.new()}
+		}, true)
+	case 2:
+		return c.RegisterAggregator(a.name, func() *mattnAggregate2 {
+			return &mattnAggregate2{a: a.new()}
+		}, true)
+	}
+	return fmt.Errorf("%s: unsupported number of arguments", a.name)
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"unsafe"
+
+	"modernc.org/libc"
+	"modernc.org/libc/sys/types"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// modernDriver is the pure Go driver, which needs no C toolchain.
+type modernDriver struct{}
+
+func init() {
+	sqlite.RegisterConnectionHook(func(c sqlite.ExecQuerierContext,
+		_ string) error {
+
+		_, err := c.ExecContext(context.Background(),
+			fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout), nil)
+		if err != nil {
+			return err
+		}
+
+		traceStatements(c)
+		return nil
+	})
+
+	// Collations and functions apply to the connections opened from now
+	// on.
+	for _, c := range collations {
+		sqlite.MustRegisterCollationUtf8(c.name, c.compare)
+	}
+	for _, a := range aggregates {
+		sqlite.MustRegisterFunction(a.name, &sqlite.FunctionImpl{
+			NArgs:         int32(a.nargs),
+			Deterministic: true,
+			MakeAggregate: func(sqlite.FunctionContext) (
+				sqlite.AggregateFunction, error) {
+
+				return &modernAggregate{a: a.new()}, nil
+			},
+		})
+	}
+
+	registerDriver(modernDriver{}, false)
+}
+
+func (modernDriver) name() string {
+	return "modernc"
+}
+
+func (modernDriver) module() string {
+	return "modernc.org/sqlite"
+}
+
+func (modernDriver) open(dsn string) (*sql.DB, error) {
+	return sql.Open("sqlite", dsn)
+}
+
+func (modernDriver) errorCode(err error) (int, bool) {
+	var serr *sqlite.Error
+	if !errors.As(err, &serr) {
+		return 0, false
+	}
+	return serr.Code(), true
+}
+
+// modernAggregate adapts an aggregator to the driver.
+type modernAggregate struct {
+	a aggregator
+}
+
+func (m *modernAggregate) Step(_ *sqlite.FunctionContext,
+	args []driver.Value) error {
+
+	return m.a.step(args)
+}
+
+func (m *modernAggregate) WindowInverse(_ *sqlite.FunctionContext,
+	args []driver.Value) error {
+
+	return m.a.inverse(args)
+}
+
+func (m *modernAggregate) WindowValue(*sqlite.FunctionContext) (driver.Value,
+	error) {
+
+	return m.a.result()
+}
+
+func (m *modernAggregate) Final(*sqlite.FunctionContext) {}
+
+// traceStatements installs a profile callback on the connection, which
+// reports the status counters of every statement as it finishes. Nothing is
+// traced if the connection's handles can't be found.
+func traceStatements(c sqlite.ExecQuerierContext) {
+	tls, db, ok := connHandles(c)
+	if !ok {
+		return
+	}
+
+	sqlite3.Xsqlite3_trace_v2(tls, db, sqlite3.SQLITE_TRACE_PROFILE,
+		cFuncPointer(profileCallback), 0)
+}
+
+// profileCallback is the SQLite trace callback, called with the statement
+// when it finishes.
+func profileCallback(tls *libc.TLS, _ uint32, _, stmt, _ uintptr) int32 {
+	status := func(op int32) int64 {
+		return int64(sqlite3.Xsqlite3_stmt_status(tls, stmt, op, 0))
+	}
+
+	recordStmtStats(libc.GoString(sqlite3.Xsqlite3_sql(tls, stmt)),
+		stmtStats{
+			fullScanSteps: status(
+				sqlite3.SQLITE_STMTSTATUS_FULLSCAN_STEP,
+			),
+			sorts:       status(sqlite3.SQLITE_STMTSTATUS_SORT),
+			autoIndexes: status(sqlite3.SQLITE_STMTSTATUS_AUTOINDEX),
+			vmSteps:     status(sqlite3.SQLITE_STMTSTATUS_VM_STEP),
+		})
+
+	return 0
+}
+
+// cFuncPointer converts a function declaration to a C function pointer the
+// way the driver does for its own callbacks, relying on the representation
+// of Go function values described in https://golang.org/s/go11func.
+func cFuncPointer[T any](f T) uintptr {
+	return *(*uintptr)(unsafe.Pointer(&struct{ f T }{f}))
+}
+
+// connHandles returns the TLS and database handle of a driver connection.
+// The driver doesn't expose them, so they are read from its fields.
+func connHandles(c any) (*libc.TLS, uintptr, bool) {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil, 0, false
+	}
+
+	db, tls := v.Elem().FieldByName("db"), v.Elem().FieldByName("tls")
+	if db.Kind() != reflect.Uintptr || tls.Kind() != reflect.Pointer ||
+		tls.Type().Elem() != reflect.TypeOf(libc.TLS{}) {
+
+		return nil, 0, false
+	}
+
+	return (*libc.TLS)(unsafe.Pointer(tls.Pointer())), uintptr(db.Uint()),
+		true
+}
+
+// rawHandles runs f with the handles of a connection, which is locked
+// meanwhile.
+func rawHandles(c *sql.Conn, f func(tls *libc.TLS, db uintptr) error) error {
+	return c.Raw(func(dc any) error {
+		tls, db, ok := connHandles(dc)
+		if !ok {
+			return errors.New("the modernc driver's connection " +
+				"handle could not be found")
+		}
+		return f(tls, db)
+	})
+}
+
+// sqliteError describes a result code, with the connection's message if
+// it has one for it.
+func sqliteError(tls *libc.TLS, db uintptr, rc int32) error {
+	if db != 0 && sqlite3.Xsqlite3_errcode(tls, db) == rc {
+		return errors.New(libc.GoString(sqlite3.Xsqlite3_errmsg(tls, db)))
+	}
+	return errors.New(libc.GoString(sqlite3.Xsqlite3_errstr(tls, rc)))
+}
+
+// modernSession is a session object of the session extension, used on
+// the connection it was created on.
+type modernSession struct {
+	c *sql.Conn
+	p uintptr
+}
+
+func (modernDriver) startSession(c *sql.Conn,
+	tables []string) (changeSession, error) {
+
+	s := &modernSession{c: c}
+	err := rawHandles(c, func(tls *libc.TLS, db uintptr) error {
+		pp := libc.Xmalloc(tls, 8)
+		defer libc.Xfree(tls, pp)
+
+		zDb, err := libc.CString("main")
+		if err != nil {
+			return err
+		}
+		defer libc.Xfree(tls, zDb)
+
+		rc := sqlite3.Xsqlite3session_create(tls, db, zDb, pp)
+		if rc != sqlite3.SQLITE_OK {
+			return sqliteError(tls, db, rc)
+		}
+		s.p = libc.AtomicLoadPUintptr(pp)
+
+		// A NULL table name attaches all tables.
+		if len(tables) == 0 {
+			rc = sqlite3.Xsqlite3session_attach(tls, s.p, 0)
+		}
+		for _, t := range tables {
+			zTab, err := libc.CString(t)
+			if err != nil {
+				sqlite3.Xsqlite3session_delete(tls, s.p)
+				return err
+			}
+			rc = sqlite3.Xsqlite3session_attach(tls, s.p, zTab)
+			libc.Xfree(tls, zTab)
+			if rc != sqlite3.SQLITE_OK {
+				break
+			}
+		}
+		if rc != sqlite3.SQLITE_OK {
+			sqlite3.Xsqlite3session_delete(tls, s.p)
+			return sqliteError(tls, 0, rc)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *modernSession) changeset() ([]byte, error) {
+	var data []byte
+	err := rawHandles(s.c, func(tls *libc.TLS, db uintptr) error {
+		pn, pp := libc.Xmalloc(tls, 4), libc.Xmalloc(tls, 8)
+		defer libc.Xfree(tls, pn)
+		defer libc.Xfree(tls, pp)
+
+		rc := sqlite3.Xsqlite3session_changeset(tls, s.p, pn, pp)
+		if rc != sqlite3.SQLITE_OK {
+			return sqliteError(tls, db, rc)
+		}
+
+		n := libc.AtomicLoadPInt32(pn)
+		p := libc.AtomicLoadPUintptr(pp)
+		data = append([]byte{}, libc.GoBytes(p, int(n))...)
+		sqlite3.Xsqlite3_free(tls, p)
+
+		return nil
+	})
+
+	return data, err
+}
+
+func (s *modernSession) close() error {
+	return rawHandles(s.c, func(tls *libc.TLS, _ uintptr) error {
+		sqlite3.Xsqlite3session_delete(tls, s.p)
+		return nil
+	})
+}
+
+// changesetApply holds the state of the changeset being applied for the
+// conflict callback. Connections are locked while applying, so there is
+// one at a time.
+var changesetApply struct {
+	replace   bool
+	conflicts changesetConflicts
+}
+
+// conflictNames names the conflict types of the session extension.
+var conflictNames = map[int32]string{
+	sqlite3.SQLITE_CHANGESET_DATA:        "DATA",
+	sqlite3.SQLITE_CHANGESET_NOTFOUND:    "NOTFOUND",
+	sqlite3.SQLITE_CHANGESET_CONFLICT:    "CONFLICT",
+	sqlite3.SQLITE_CHANGESET_CONSTRAINT:  "CONSTRAINT",
+	sqlite3.SQLITE_CHANGESET_FOREIGN_KEY: "FOREIGN_KEY",
+}
+
+// conflictCallback decides what to do with a change that doesn't fit the
+// database. Rows changed since, DATA, or already there, CONFLICT, may be
+// overwritten, everything else is skipped.
+func conflictCallback(_ *libc.TLS, _ uintptr, kind int32, _ uintptr) int32 {
+	changesetApply.conflicts[conflictNames[kind]]++
+
+	if changesetApply.replace && (kind == sqlite3.SQLITE_CHANGESET_DATA ||
+		kind == sqlite3.SQLITE_CHANGESET_CONFLICT) {
+
+		return sqlite3.SQLITE_CHANGESET_REPLACE
+	}
+	return sqlite3.SQLITE_CHANGESET_OMIT
+}
+
+func (modernDriver) applyChangeset(c *sql.Conn, changeset []byte,
+	replace bool) (changesetConflicts, error) {
+
+	changesetApply.replace = replace
+	changesetApply.conflicts = make(changesetConflicts)
+
+	err := rawHandles(c, func(tls *libc.TLS, db uintptr) error {
+		buf := libc.Xmalloc(tls, types.Size_t(max(len(changeset), 1)))
+		if buf == 0 {
+			return errors.New("out of memory")
+		}
+		defer libc.Xfree(tls, buf)
+		copy(libc.GoBytes(buf, len(changeset)), changeset)
+
+		rc := sqlite3.Xsqlite3changeset_apply(tls, db,
+			int32(len(changeset)), buf, 0,
+			cFuncPointer(conflictCallback), 0)
+		if rc != sqlite3.SQLITE_OK {
+			return sqliteError(tls, db, rc)
+		}
+		return nil
+	})
+
+	return changesetApply.conflicts, err
+}
+
+// modernBlob reads an open BLOB handle.
+type modernBlob struct {
+	tls  *libc.TLS
+	db   uintptr
+	p    uintptr
+	size int64
+}
+
+func (b *modernBlob) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), b.size-off))
+
+	buf := libc.Xmalloc(b.tls, types.Size_t(max(n, 1)))
+	if buf == 0 {
+		return 0, errors.New("out of memory")
+	}
+	defer libc.Xfree(b.tls, buf)
+
+	rc := sqlite3.Xsqlite3_blob_read(b.tls, b.p, buf, int32(n), int32(off))
+	if rc != sqlite3.SQLITE_OK {
+		return 0, sqliteError(b.tls, b.db, rc)
+	}
+	copy(p, libc.GoBytes(buf, n))
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (modernDriver) readBlob(c *sql.Conn, ref blobRef,
+	f func(r io.ReaderAt, size int64) error) error {
+
+	return rawHandles(c, func(tls *libc.TLS, db uintptr) error {
+		pp := libc.Xmalloc(tls, 8)
+		defer libc.Xfree(tls, pp)
+
+		var names [3]uintptr
+		for i, name := range []string{ref.schema, ref.table, ref.column} {
+			z, err := libc.CString(name)
+			if err != nil {
+				return err
+			}
+			defer libc.Xfree(tls, z)
+			names[i] = z
+		}
+
+		rc := sqlite3.Xsqlite3_blob_open(tls, db, names[0], names[1],
+			names[2], ref.rowid, 0, pp)
+		if rc != sqlite3.SQLITE_OK {
+			return sqliteError(tls, db, rc)
+		}
+		b := &modernBlob{tls: tls, db: db, p: libc.AtomicLoadPUintptr(pp)}
+		defer sqlite3.Xsqlite3_blob_close(tls, b.p)
+
+		b.size = int64(sqlite3.Xsqlite3_blob_bytes(tls, b.p))
+		return f(b, b.size)
+	})
+}
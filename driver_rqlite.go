@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// rqliteScheme marks database names that refer to an rqlite node,
+	// e.g. rqlite+http://localhost:4001.
+	rqliteScheme = "rqlite+"
+
+	// rqliteTimeout bounds a single HTTP request to the node.
+	rqliteTimeout = 60 * time.Second
+)
+
+func init() {
+	sql.Register("vsqlite-rqlite", rqliteSQLDriver{})
+}
+
+// rqliteDriver sends statements to an rqlite node over its HTTP API. Like
+// libsql it is picked by the database name rather than with --driver.
+type rqliteDriver struct{}
+
+func (rqliteDriver) name() string {
+	return "rqlite"
+}
+
+// module is empty, the rqlite HTTP API is spoken by vsqlite itself.
+func (rqliteDriver) module() string {
+	return ""
+}
+
+func (rqliteDriver) open(dsn string) (*sql.DB, error) {
+	return sql.Open("vsqlite-rqlite", strings.TrimPrefix(dsn, rqliteScheme))
+}
+
+// errorCode can't tell SQLite result codes from the node's error messages.
+func (rqliteDriver) errorCode(err error) (int, bool) {
+	return 0, false
+}
+
+// isRqliteDatabase reports whether the database name refers to an rqlite
+// node.
+func isRqliteDatabase(name string) bool {
+	return strings.HasPrefix(name, rqliteScheme+"http://") ||
+		strings.HasPrefix(name, rqliteScheme+"https://")
+}
+
+// rqliteDatabaseName turns the node URL given with --rqlite into a database
+// name.
+func rqliteDatabaseName(nodeURL string) (string, error) {
+	u, err := url.Parse(nodeURL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("expected http://host:port, got %q",
+			nodeURL)
+	}
+
+	return rqliteScheme + nodeURL, nil
+}
+
+// rqliteSQLDriver is the database/sql driver behind rqliteDriver. Every
+// statement is a request to the unified /db/request endpoint, which takes
+// reads and writes alike, so the session works as with a local database.
+type rqliteSQLDriver struct{}
+
+func (rqliteSQLDriver) Open(name string) (driver.Conn, error) {
+	base, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rqliteConn{
+		base:   base,
+		client: &http.Client{Timeout: rqliteTimeout},
+	}, nil
+}
+
+type rqliteConn struct {
+	base   *url.URL
+	client *http.Client
+}
+
+// rqliteResult is one element of the results of a request.
+type rqliteResult struct {
+	Columns      []string        `json:"columns"`
+	Types        []string        `json:"types"`
+	Values       [][]interface{} `json:"values"`
+	LastInsertID int64           `json:"last_insert_id"`
+	RowsAffected int64           `json:"rows_affected"`
+	Error        string          `json:"error"`
+}
+
+// request runs a single statement on the node.
+func (c *rqliteConn) request(ctx context.Context, query string,
+	args []driver.NamedValue) (*rqliteResult, error) {
+
+	stmt := []interface{}{query}
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("rqlite: named parameter %q "+
+				"is not supported", arg.Name)
+		}
+
+		switch v := arg.Value.(type) {
+		case []byte:
+			// Blobs are sent as arrays of byte values.
+			vals := make([]int, len(v))
+			for i, b := range v {
+				vals[i] = int(b)
+			}
+			stmt = append(stmt, vals)
+
+		case time.Time:
+			stmt = append(stmt, v.Format(time.RFC3339Nano))
+
+		default:
+			stmt = append(stmt, v)
+		}
+	}
+
+	body, err := json.Marshal([][]interface{}{stmt})
+	if err != nil {
+		return nil, err
+	}
+
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/db/request"
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, u.String(), bytes.NewReader(body),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("rqlite: %s: %s", resp.Status,
+			strings.TrimSpace(string(msg)))
+	}
+
+	// Keep numbers as they were sent so that large integers don't lose
+	// precision as floats.
+	var out struct {
+		Results []rqliteResult `json:"results"`
+		Error   string         `json:"error"`
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return nil, fmt.Errorf("rqlite: invalid response: %w", err)
+	}
+
+	switch {
+	case out.Error != "":
+		return nil, errors.New(out.Error)
+
+	case len(out.Results) == 0:
+		return nil, errors.New("rqlite: empty response")
+
+	case out.Results[0].Error != "":
+		return nil, errors.New(out.Results[0].Error)
+	}
+
+	return &out.Results[0], nil
+}
+
+func (c *rqliteConn) QueryContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Rows, error) {
+
+	res, err := c.request(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rqliteRows{res: res}, nil
+}
+
+func (c *rqliteConn) ExecContext(ctx context.Context, query string,
+	args []driver.NamedValue) (driver.Result, error) {
+
+	res, err := c.request(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+func (c *rqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return &rqliteStmt{conn: c, query: query}, nil
+}
+
+func (c *rqliteConn) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// Begin fails since every request is a transaction of its own.
+func (c *rqliteConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("rqlite: transactions spanning requests " +
+		"are not supported")
+}
+
+type rqliteStmt struct {
+	conn  *rqliteConn
+	query string
+}
+
+func (s *rqliteStmt) Close() error {
+	return nil
+}
+
+func (s *rqliteStmt) NumInput() int {
+	return -1
+}
+
+func (s *rqliteStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query,
+		namedValues(args))
+}
+
+func (s *rqliteStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query,
+		namedValues(args))
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+// rqliteRows iterates over a result that has already been received in
+// full.
+type rqliteRows struct {
+	res *rqliteResult
+	row int
+}
+
+func (r *rqliteRows) Columns() []string {
+	return r.res.Columns
+}
+
+func (r *rqliteRows) Close() error {
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the declared type of the column.
+func (r *rqliteRows) ColumnTypeDatabaseTypeName(i int) string {
+	if i < len(r.res.Types) {
+		return strings.ToUpper(r.res.Types[i])
+	}
+	return ""
+}
+
+func (r *rqliteRows) Next(dest []driver.Value) error {
+	if r.row >= len(r.res.Values) {
+		return io.EOF
+	}
+
+	for i, val := range r.res.Values[r.row] {
+		dest[i] = rqliteValue(val, r.ColumnTypeDatabaseTypeName(i))
+	}
+	r.row++
+
+	return nil
+}
+
+// rqliteValue converts a decoded JSON value back to the Go type the local
+// drivers would return.
+func rqliteValue(val interface{}, declType string) driver.Value {
+	switch v := val.(type) {
+	case json.Number:
+		// Whole REAL values are sent without a fraction.
+		isReal := strings.Contains(declType, "REAL") ||
+			strings.Contains(declType, "FLOA") ||
+			strings.Contains(declType, "DOUB")
+		if n, err := v.Int64(); err == nil && !isReal {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+
+	case string:
+		// rqlite sends blobs base64 encoded.
+		if declType == "BLOB" {
+			if b, err := base64.StdEncoding.DecodeString(v); err == nil {
+				return b
+			}
+		}
+		return v
+
+	case bool:
+		return v
+
+	case nil:
+		return nil
+
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// analyzeStat is a row of sqlite_stat1 with the number of sqlite_stat4
+// samples of the index.
+type analyzeStat struct {
+	table, index string
+	numbers      []float64
+	samples      int
+}
+
+// hasStatTable reports whether ANALYZE created a sqlite_stat table.
+func hasStatTable(ctx context.Context, c *sql.Conn, name string) (bool,
+	error) {
+
+	var n int
+	err := c.QueryRowContext(ctx, `
+		SELECT count(*) FROM sqlite_master
+		WHERE type = 'table' AND name = ?`, name).Scan(&n)
+	return n > 0, err
+}
+
+// readAnalyzeStats returns the statistics of the tables, or of one table,
+// or nil if ANALYZE was never run.
+func readAnalyzeStats(ctx context.Context, c *sql.Conn,
+	tableName string) ([]analyzeStat, error) {
+
+	ok, err := hasStatTable(ctx, c, "sqlite_stat1")
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT tbl, coalesce(idx, ''), stat FROM sqlite_stat1
+		WHERE ? = '' OR tbl = ? COLLATE NOCASE`, tableName, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []analyzeStat{}
+	for rows.Next() {
+		var s analyzeStat
+		var stat string
+		if err := rows.Scan(&s.table, &s.index, &stat); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.numbers = parseStat1(stat)
+		stats = append(stats, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// SQLite built with SQLITE_ENABLE_STAT4 also samples key values.
+	ok, err = hasStatTable(ctx, c, "sqlite_stat4")
+	if err != nil || !ok {
+		return stats, err
+	}
+	rows, err = c.QueryContext(ctx, `
+		SELECT idx, count(*) FROM sqlite_stat4 GROUP BY idx`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := make(map[string]int)
+	for rows.Next() {
+		var idx string
+		var n int
+		if err := rows.Scan(&idx, &n); err != nil {
+			return nil, err
+		}
+		samples[idx] = n
+	}
+	for i := range stats {
+		stats[i].samples = samples[stats[i].index]
+	}
+	return stats, rows.Err()
+}
+
+// formatStatNumber prints a sqlite_stat1 number without a fraction unless
+// it has one.
+func formatStatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// handleDStatsCommand shows what ANALYZE collected for the query planner:
+// the rows of each table and index, how many rows share a key of the first
+// one, two and so on index columns, and about how many distinct keys that
+// makes. Tables ANALYZE hasn't seen are pointed out, as the planner guesses
+// for them.
+func handleDStatsCommand(args []string) error {
+	var tableName string
+	if len(args) == 1 {
+		tableName = args[0]
+	}
+
+	ctx := context.Background()
+	c := metadata()
+	stats, err := readAnalyzeStats(ctx, c, tableName)
+	if err != nil {
+		fmt.Printf("Statistics error: %v\n", err)
+		return err
+	}
+	if stats == nil {
+		fmt.Println("WARNING: ANALYZE has never been run on this " +
+			"database, the query planner guesses how many rows match.")
+		fmt.Println("HINT: run ANALYZE, or PRAGMA optimize, to " +
+			"collect statistics.")
+		return nil
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].table != stats[j].table {
+			return stats[i].table < stats[j].table
+		}
+		return stats[i].index < stats[j].index
+	})
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Table", "Index", "Rows", "Rows per key",
+		"Distinct keys", "Samples"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 3, Align: text.AlignRight},
+		{Number: 5, Align: text.AlignRight},
+		{Number: 6, Align: text.AlignRight},
+	})
+
+	for _, s := range stats {
+		var rows, distinct string
+		var perKey []string
+		if len(s.numbers) > 0 {
+			rows = formatStatNumber(s.numbers[0])
+		}
+		for _, n := range s.numbers[min(1, len(s.numbers)):] {
+			perKey = append(perKey, formatStatNumber(n))
+		}
+		if len(s.numbers) > 1 && s.numbers[len(s.numbers)-1] > 0 {
+			distinct = fmt.Sprintf("%.0f",
+				s.numbers[0]/s.numbers[len(s.numbers)-1])
+		}
+
+		samples := ""
+		if s.samples > 0 {
+			samples = strconv.Itoa(s.samples)
+		}
+		t.AppendRow(table.Row{s.table, s.index, rows,
+			strings.Join(perKey, " "), distinct, samples})
+	}
+	t.Render()
+
+	// Tables without a row weren't there, or were empty, when ANALYZE
+	// last ran.
+	objs, err := dbSchema.userObjects(ctx)
+	if err != nil {
+		fmt.Printf("Statistics error: %v\n", err)
+		return err
+	}
+	analyzed := make(map[string]bool)
+	for _, s := range stats {
+		analyzed[strings.ToLower(s.table)] = true
+	}
+	var missing []string
+	for _, o := range objs {
+		if o.typ != "table" ||
+			strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL") ||
+			analyzed[strings.ToLower(o.name)] ||
+			tableName != "" && !strings.EqualFold(o.name, tableName) {
+
+			continue
+		}
+		missing = append(missing, o.name)
+	}
+	if len(missing) > 0 {
+		fmt.Printf("WARNING: no statistics for %s, run ANALYZE after "+
+			"loading data.\n", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dumpOptions select what a dump contains.
+type dumpOptions struct {
+	// schemaOnly leaves out the rows, dataOnly the CREATE statements.
+	schemaOnly, dataOnly bool
+
+	// tables are patterns of the tables to dump, see namePatternRegexp,
+	// all of them if empty. Their indexes and triggers come with them.
+	tables []string
+
+	// where is an SQL expression the dumped rows must match.
+	where string
+
+	// dialect is "sqlite", or "postgres" for a script PostgreSQL runs,
+	// see dumpPostgres.
+	dialect string
+
+	// jobs is how many tables are read at once, on connections of db of
+	// their own, see startDumpPrefetch.
+	jobs int
+	db   *sql.DB
+}
+
+// includes reports whether the object of a table is dumped.
+func (o *dumpOptions) includes(table string) bool {
+	if len(o.tables) == 0 {
+		return true
+	}
+	for _, pattern := range o.tables {
+		if namePatternRegexp(pattern).MatchString(table) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpTable writes the rows of a table matching where, all of them if it is
+// empty, as INSERT statements. Values are rendered by SQLite's quote() so
+// they read back exactly, which the driver's own conversions (such as
+// parsing datetimes) wouldn't guarantee. Columns matching a masking rule are
+// masked. If convert is set, it rewrites the values of a column for another
+// database.
+func dumpTable(ctx context.Context, c *sql.Conn, w io.Writer, tbl,
+	where string, convert func(col, literal string) string) error {
+
+	cols, err := tableColumns(ctx, c, tbl)
+	if err != nil {
+		return err
+	}
+
+	quoted := make([]string, len(cols))
+	exprs := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+		exprs[i] = "quote(" + quoteIdent(col) + ")"
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(exprs, ", "),
+		quoteIdent(tbl))
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := c.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (",
+		quoteIdent(tbl), strings.Join(quoted, ", "))
+
+	// The AUTOINCREMENT counters are keyed by table name, which must not
+	// be masked.
+	var masks []maskAction
+	if tbl != "sqlite_sequence" {
+		masks = columnMasks(tbl, cols)
+	}
+
+	vals := make([]string, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return err
+		}
+		for i, mask := range masks {
+			vals[i] = maskLiteral(mask, vals[i])
+		}
+		if convert != nil {
+			for i, col := range cols {
+				vals[i] = convert(col, vals[i])
+			}
+		}
+
+		_, err := fmt.Fprintf(w, "%s%s);\n", prefix,
+			strings.Join(vals, ", "))
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// dumpDatabase writes the schema and contents of the database, or the part
+// opts selects, as a script that recreates it, similar to the sqlite3
+// shell's .dump.
+func dumpDatabase(ctx context.Context, c *sql.Conn, w io.Writer,
+	opts dumpOptions) error {
+
+	objs, err := readSchemaObjects(ctx, c)
+	if err != nil {
+		return err
+	}
+	if opts.dialect == "postgres" {
+		return dumpPostgres(ctx, c, w, objs, opts)
+	}
+
+	var prefetch *dumpPrefetch
+	if opts.jobs > 1 && !opts.schemaOnly {
+		var tables []string
+		for _, o := range objs {
+			if o.typ == "table" && !isShadowTable(o.name, objs) &&
+				opts.includes(o.tblName) &&
+				!strings.HasPrefix(strings.ToUpper(o.sql),
+					"CREATE VIRTUAL") {
+
+				tables = append(tables, o.name)
+			}
+		}
+		prefetch = startDumpPrefetch(ctx, opts, tables, nil)
+		defer prefetch.close()
+	}
+
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+
+	var sequences []string
+	for _, o := range objs {
+		// Virtual tables fill their shadow tables themselves.
+		if isShadowTable(o.name, objs) || !opts.includes(o.tblName) {
+			continue
+		}
+
+		if !opts.dataOnly {
+			if _, err := fmt.Fprintf(w, "%s;\n", o.sql); err != nil {
+				return err
+			}
+		}
+
+		if o.typ != "table" || opts.schemaOnly {
+			continue
+		}
+		if strings.Contains(strings.ToUpper(o.sql), "AUTOINCREMENT") {
+			sequences = append(sequences, quoteString(o.name))
+		}
+		if strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL") {
+			continue
+		}
+
+		err := prefetch.writeRows(ctx, c, w, o.name, opts.where, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Restore the AUTOINCREMENT counters of the dumped tables, which live
+	// in a table the schema doesn't list.
+	if len(sequences) > 0 {
+		where := "name IN (" + strings.Join(sequences, ", ") + ")"
+		fmt.Fprintf(w, "DELETE FROM sqlite_sequence WHERE %s;\n", where)
+		err := dumpTable(ctx, c, w, "sqlite_sequence", where, nil)
+		if err != nil {
+			return fmt.Errorf("sqlite_sequence: %w", err)
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "COMMIT;")
+	return err
+}
+
+// dumpFlags are the options of the dump subcommand.
+var dumpFlags struct {
+	output string
+	noMask bool
+	opts   dumpOptions
+}
+
+// defineDumpFlags defines the options of the dump subcommand.
+func defineDumpFlags(fs *flag.FlagSet) {
+	opts := &dumpFlags.opts
+	fs.StringVar(&dumpFlags.output, "o", "", "write the dump to this "+
+		"file instead of stdout")
+	fs.BoolVar(&dumpFlags.noMask, "no-mask", false, "don't apply the "+
+		"masking rules from the config file")
+	fs.BoolVar(&opts.schemaOnly, "schema-only", false, "dump only the "+
+		"CREATE statements")
+	fs.BoolVar(&opts.dataOnly, "data-only", false, "dump only the rows, "+
+		"as INSERT statements")
+	fs.Var((*stringList)(&opts.tables), "table", "dump only the tables "+
+		"matching this pattern, e.g. 'log_*', may be repeated")
+	fs.StringVar(&opts.where, "where", "", "dump only the rows matching "+
+		"this SQL expression, e.g. \"ts > date('now', '-7 days')\"")
+	fs.StringVar(&opts.dialect, "dialect", "sqlite", "write the dump for "+
+		"`sqlite` or postgres")
+	fs.IntVar(&opts.jobs, "jobs", 1, "read this many tables at once, "+
+		"each in a transaction of its own, so the dump is only "+
+		"consistent if nothing writes to the database meanwhile")
+}
+
+func runDumpCommand(args []string) int {
+	fs := newSubcommandFlags("dump")
+	fs.Parse(args)
+	opts := dumpFlags.opts
+
+	maskingEnabled = !dumpFlags.noMask
+
+	if fs.NArg() != 1 || opts.jobs < 1 {
+		fs.Usage()
+		return 1
+	}
+	if opts.dialect != "sqlite" && opts.dialect != "postgres" {
+		fmt.Fprintf(os.Stderr, "Dump error: unknown dialect %q, "+
+			"expected sqlite or postgres\n", opts.dialect)
+		return 1
+	}
+	if opts.schemaOnly && (opts.dataOnly || opts.where != "") {
+		fmt.Fprintln(os.Stderr, "Dump error: -schema-only can't be "+
+			"combined with -data-only or -where")
+		return 1
+	}
+
+	ctx := context.Background()
+
+	srcDB, err := openDatabase(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Dump error: %v\n", err)
+		return 1
+	}
+	defer srcDB.Close()
+
+	// Every connection to a private database sees a different one.
+	opts.db = srcDB
+	if hasPrivateDatabase(fs.Arg(0)) {
+		opts.jobs = 1
+	}
+
+	c, err := srcDB.Conn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Dump error: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	// Read everything in one transaction for a consistent dump.
+	if _, err := c.ExecContext(ctx, "BEGIN"); err != nil {
+		fmt.Fprintf(os.Stderr, "Dump error: %v\n", err)
+		return 1
+	}
+	defer c.ExecContext(ctx, "ROLLBACK")
+
+	w := io.Writer(os.Stdout)
+	if dumpFlags.output != "" {
+		f, err := os.Create(dumpFlags.output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Dump error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := dumpDatabase(ctx, c, w, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Dump error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
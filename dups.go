@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	// dupsExampleRows is the number of example rowids shown per group of
+	// duplicates.
+	dupsExampleRows = 5
+)
+
+// columnInfo is a row of PRAGMA table_info.
+type columnInfo struct {
+	name    string
+	ctype   string
+	notNull bool
+	dflt    sql.NullString
+	pk      int
+}
+
+func tableInfo(ctx context.Context, tableName string) ([]columnInfo, error) {
+	rows, err := conn.QueryContext(ctx, `
+		SELECT cid, name, type, "notnull", dflt_value, pk
+		FROM pragma_table_info(?)`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []columnInfo
+	for rows.Next() {
+		var cid, notnull int
+		var c columnInfo
+		err := rows.Scan(&cid, &c.name, &c.ctype, &notnull, &c.dflt, &c.pk)
+		if err != nil {
+			return nil, err
+		}
+		c.notNull = notnull != 0
+		cols = append(cols, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("no such table: %s", tableName)
+	}
+
+	return cols, nil
+}
+
+// dupsColumns resolves the columns to compare: the requested ones, which must
+// exist, or otherwise all columns that aren't part of the primary key.
+func dupsColumns(tableName string, requested []string) ([]string, error) {
+	cols, err := tableInfo(context.Background(), tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requested) == 0 {
+		var nonPK []string
+		for _, c := range cols {
+			if c.pk == 0 {
+				nonPK = append(nonPK, c.name)
+			}
+		}
+		if len(nonPK) == 0 {
+			return nil, fmt.Errorf("%s has no non-primary-key columns",
+				tableName)
+		}
+		return nonPK, nil
+	}
+
+	var resolved []string
+	for _, req := range requested {
+		found := false
+		for _, c := range cols {
+			if strings.EqualFold(c.name, req) {
+				resolved = append(resolved, c.name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no such column: %s", req)
+		}
+	}
+
+	return resolved, nil
+}
+
+// dupsQuery builds a query returning one row per group of duplicates with the
+// group size and the first few rowids of the group.
+func dupsQuery(tableName string, cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+	}
+	colList := strings.Join(quoted, ", ")
+
+	return fmt.Sprintf(`
+		WITH grouped AS (
+			SELECT rowid AS _dups_rowid, %[1]s,
+			       count(*) OVER (PARTITION BY %[1]s) AS _dups_count,
+			       row_number() OVER (
+				       PARTITION BY %[1]s ORDER BY rowid
+			       ) AS _dups_rn
+			FROM %[2]s
+		)
+		SELECT %[1]s, _dups_count AS count,
+		       group_concat(_dups_rowid, ', ') AS example_rowids
+		FROM grouped
+		WHERE _dups_count > 1 AND _dups_rn <= %[3]d
+		GROUP BY %[1]s
+		ORDER BY _dups_count DESC, min(_dups_rowid)`,
+		colList, quoteIdent(tableName), dupsExampleRows,
+	)
+}
+
+func handleDupsCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: \\dups <table> [col[,col...]]")
+		return errUsage
+	}
+
+	// Accept both "a,b" and "a b" column lists.
+	var requested []string
+	for _, arg := range args[1:] {
+		for _, col := range strings.Split(arg, ",") {
+			if col = strings.TrimSpace(col); col != "" {
+				requested = append(requested, col)
+			}
+		}
+	}
+
+	cols, err := dupsColumns(args[0], requested)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return err
+	}
+
+	// The groups are read first, so that an empty result isn't shown as
+	// a table with only a header.
+	set, err := fetchResult(context.Background(),
+		dupsQuery(args[0], cols))
+	if err != nil {
+		fmt.Printf("Dups error: %v\n", err)
+		return err
+	}
+
+	if len(set.rows) == 0 {
+		fmt.Printf("No duplicates on (%s)\n", strings.Join(cols, ", "))
+		return nil
+	}
+	printResult(set)
+	fmt.Printf("%d group(s) of duplicates on (%s)\n", len(set.rows),
+		strings.Join(cols, ", "))
+	return nil
+}
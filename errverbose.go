@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lastFailure is the last SQL statement or meta-command that failed, and
+// why, kept for \errverbose until another one fails.
+var lastFailure struct {
+	statement string
+	err       error
+}
+
+// sqliteResultCodes names SQLite's primary result codes and describes them
+// the way sqlite3_errstr() does.
+var sqliteResultCodes = map[int]struct{ name, desc string }{
+	1:  {"SQLITE_ERROR", "SQL logic error"},
+	2:  {"SQLITE_INTERNAL", "internal malfunction"},
+	3:  {"SQLITE_PERM", "access permission denied"},
+	4:  {"SQLITE_ABORT", "query aborted"},
+	5:  {"SQLITE_BUSY", "database is locked"},
+	6:  {"SQLITE_LOCKED", "database table is locked"},
+	7:  {"SQLITE_NOMEM", "out of memory"},
+	8:  {"SQLITE_READONLY", "attempt to write a readonly database"},
+	9:  {"SQLITE_INTERRUPT", "interrupted"},
+	10: {"SQLITE_IOERR", "disk I/O error"},
+	11: {"SQLITE_CORRUPT", "database disk image is malformed"},
+	12: {"SQLITE_NOTFOUND", "unknown operation"},
+	13: {"SQLITE_FULL", "database or disk is full"},
+	14: {"SQLITE_CANTOPEN", "unable to open database file"},
+	15: {"SQLITE_PROTOCOL", "locking protocol"},
+	16: {"SQLITE_EMPTY", "internal use only"},
+	17: {"SQLITE_SCHEMA", "database schema has changed"},
+	18: {"SQLITE_TOOBIG", "string or blob too big"},
+	19: {"SQLITE_CONSTRAINT", "constraint failed"},
+	20: {"SQLITE_MISMATCH", "datatype mismatch"},
+	21: {"SQLITE_MISUSE", "bad parameter or other API misuse"},
+	22: {"SQLITE_NOLFS", "large file support is disabled"},
+	23: {"SQLITE_AUTH", "authorization denied"},
+	24: {"SQLITE_FORMAT", "not used"},
+	25: {"SQLITE_RANGE", "column index out of range"},
+	26: {"SQLITE_NOTADB", "file is not a database"},
+	27: {"SQLITE_NOTICE", "notification message"},
+	28: {"SQLITE_WARNING", "warning message"},
+}
+
+// sqliteExtendedCodes names the extended result codes, which refine a
+// primary code in their second byte.
+var sqliteExtendedCodes = map[int]string{
+	257:  "SQLITE_ERROR_MISSING_COLLSEQ",
+	513:  "SQLITE_ERROR_RETRY",
+	769:  "SQLITE_ERROR_SNAPSHOT",
+	261:  "SQLITE_BUSY_RECOVERY",
+	517:  "SQLITE_BUSY_SNAPSHOT",
+	773:  "SQLITE_BUSY_TIMEOUT",
+	262:  "SQLITE_LOCKED_SHAREDCACHE",
+	518:  "SQLITE_LOCKED_VTAB",
+	264:  "SQLITE_READONLY_RECOVERY",
+	520:  "SQLITE_READONLY_CANTLOCK",
+	776:  "SQLITE_READONLY_ROLLBACK",
+	1032: "SQLITE_READONLY_DBMOVED",
+	1288: "SQLITE_READONLY_CANTINIT",
+	1544: "SQLITE_READONLY_DIRECTORY",
+	266:  "SQLITE_IOERR_READ",
+	522:  "SQLITE_IOERR_SHORT_READ",
+	778:  "SQLITE_IOERR_WRITE",
+	1034: "SQLITE_IOERR_FSYNC",
+	1290: "SQLITE_IOERR_DIR_FSYNC",
+	1546: "SQLITE_IOERR_TRUNCATE",
+	1802: "SQLITE_IOERR_FSTAT",
+	2058: "SQLITE_IOERR_UNLOCK",
+	2314: "SQLITE_IOERR_RDLOCK",
+	2570: "SQLITE_IOERR_DELETE",
+	3082: "SQLITE_IOERR_NOMEM",
+	3338: "SQLITE_IOERR_ACCESS",
+	3850: "SQLITE_IOERR_LOCK",
+	4106: "SQLITE_IOERR_CLOSE",
+	4618: "SQLITE_IOERR_SHMOPEN",
+	4874: "SQLITE_IOERR_SHMSIZE",
+	5386: "SQLITE_IOERR_SHMMAP",
+	5642: "SQLITE_IOERR_SEEK",
+	6154: "SQLITE_IOERR_MMAP",
+	267:  "SQLITE_CORRUPT_VTAB",
+	523:  "SQLITE_CORRUPT_SEQUENCE",
+	779:  "SQLITE_CORRUPT_INDEX",
+	270:  "SQLITE_CANTOPEN_NOTEMPDIR",
+	526:  "SQLITE_CANTOPEN_ISDIR",
+	782:  "SQLITE_CANTOPEN_FULLPATH",
+	1038: "SQLITE_CANTOPEN_CONVPATH",
+	1550: "SQLITE_CANTOPEN_SYMLINK",
+	516:  "SQLITE_ABORT_ROLLBACK",
+	275:  "SQLITE_CONSTRAINT_CHECK",
+	531:  "SQLITE_CONSTRAINT_COMMITHOOK",
+	787:  "SQLITE_CONSTRAINT_FOREIGNKEY",
+	1043: "SQLITE_CONSTRAINT_FUNCTION",
+	1299: "SQLITE_CONSTRAINT_NOTNULL",
+	1555: "SQLITE_CONSTRAINT_PRIMARYKEY",
+	1811: "SQLITE_CONSTRAINT_TRIGGER",
+	2067: "SQLITE_CONSTRAINT_UNIQUE",
+	2323: "SQLITE_CONSTRAINT_VTAB",
+	2579: "SQLITE_CONSTRAINT_ROWID",
+	2835: "SQLITE_CONSTRAINT_PINNED",
+	3091: "SQLITE_CONSTRAINT_DATATYPE",
+	279:  "SQLITE_AUTH_USER",
+}
+
+// recordFailure keeps a failed statement for \errverbose.
+func recordFailure(statement string, err error) {
+	lastFailure.statement = statement
+	lastFailure.err = err
+}
+
+// resultCodeName returns the name of a primary or extended result code.
+func resultCodeName(code int) string {
+	if name, ok := sqliteExtendedCodes[code]; ok {
+		return name
+	}
+	if rc, ok := sqliteResultCodes[code]; ok {
+		return rc.name
+	}
+	return "unknown"
+}
+
+// handleErrVerboseCommand shows the last failed statement with the SQLite
+// result code of its error.
+func handleErrVerboseCommand([]string) error {
+	if lastFailure.err == nil {
+		fmt.Println("There is no previous error.")
+		return nil
+	}
+
+	fmt.Printf("ERROR:  %v\n", lastFailure.err)
+
+	code, ok := sqliteExtendedErrorCode(lastFailure.err)
+	switch {
+	case !ok:
+		fmt.Println("Result code: none, the error didn't come from " +
+			"SQLite or the driver doesn't report it")
+
+	case code > 0xff:
+		primary := sqliteResultCodes[code&0xff]
+		fmt.Printf("Result code: %d (%s)\n", code, resultCodeName(code))
+		fmt.Printf("Primary code: %d (%s), %s\n", code&0xff,
+			resultCodeName(code&0xff), primary.desc)
+
+	default:
+		fmt.Printf("Result code: %d (%s), %s\n", code,
+			resultCodeName(code), sqliteResultCodes[code].desc)
+	}
+
+	fmt.Printf("Statement: %s\n", strings.TrimSpace(lastFailure.statement))
+	return nil
+}
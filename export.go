@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exporter writes all rows of a result to w in a specific file format and
+// returns the number of rows written. The query is the one the result came
+// from.
+type exporter func(w io.Writer, rows resultRows, query string) (int, error)
+
+// exporters maps the formats accepted by \export to their implementation.
+var exporters = map[string]exporter{
+	"csv":  exportCSV,
+	"json": exportJSON,
+	"sql":  exportSQL,
+	"xlsx": exportXLSX,
+}
+
+// exportCompressions maps the compressions accepted by \export --compress
+// to their file name extension.
+var exportCompressions = map[string]string{
+	"gzip": ".gz",
+	"zstd": ".zst",
+}
+
+func exportFormats() string {
+	formats := make([]string, 0, len(exporters))
+	for f := range exporters {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+
+	return strings.Join(formats, "|")
+}
+
+// csvValue renders a value for CSV, with NULL as an empty field.
+func csvValue(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+
+	case []byte:
+		return `\x` + hex.EncodeToString(v)
+
+	case float64:
+		return sqlLiteral(v)
+
+	case time.Time:
+		return formatTimePadded(v)
+
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func exportCSV(w io.Writer, rows resultRows, _ string) (int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(cols); err != nil {
+		return 0, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	n := 0
+	record := make([]string, len(cols))
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return n, err
+		}
+		for i, val := range vals {
+			record[i] = csvValue(val)
+		}
+		if err := cw.Write(record); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	cw.Flush()
+	return n, cw.Error()
+}
+
+func exportJSON(w io.Writer, rows resultRows, _ string) (int, error) {
+	return writeJSON(w, rows, nil, nil)
+}
+
+func exportSQL(w io.Writer, rows resultRows, query string) (int, error) {
+	return writeInserts(w, rows, insertsTableName(query), nil)
+}
+
+// exportPostgresSQL writes INSERT statements with values PostgreSQL reads,
+// see pgValueLiteral.
+func exportPostgresSQL(w io.Writer, rows resultRows, query string) (int,
+	error) {
+
+	return writeInsertsWith(w, rows, insertsTableName(query), nil,
+		pgValueLiteral)
+}
+
+func exportXLSX(w io.Writer, rows resultRows, _ string) (int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	x, err := newXLSXWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	if err := x.writeHeader(cols); err != nil {
+		return 0, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return n, err
+		}
+		if err := x.writeRow(vals, xlsxStyleDefault); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	return n, x.Close()
+}
+
+// exportOptions are the options of \export.
+type exportOptions struct {
+	// splitRows starts a new part file after this many rows, zero
+	// writes a single file.
+	splitRows int
+
+	// compression is a key of exportCompressions, or "" for none.
+	compression string
+
+	// dialect is "postgres" to write sql exports for PostgreSQL, or ""
+	// for SQLite.
+	dialect string
+}
+
+// parseExportOptions reads the leading options of \export and returns the
+// remaining arguments.
+func parseExportOptions(args string) (exportOptions, string, error) {
+	var opts exportOptions
+	for {
+		field, rest := nextField(args)
+		switch field {
+		case "--split-rows":
+			var n string
+			n, args = nextField(rest)
+			rows, err := strconv.Atoi(n)
+			if err != nil || rows < 1 {
+				return opts, "", fmt.Errorf("invalid --split-rows "+
+					"%q, expected a positive number", n)
+			}
+			opts.splitRows = rows
+
+		case "--compress":
+			var c string
+			c, args = nextField(rest)
+			if _, ok := exportCompressions[c]; !ok {
+				return opts, "", fmt.Errorf("invalid --compress %q, "+
+					"expected gzip or zstd", c)
+			}
+			opts.compression = c
+
+		case "--dialect":
+			var d string
+			d, args = nextField(rest)
+			if d != "sqlite" && d != "postgres" {
+				return opts, "", fmt.Errorf("invalid --dialect %q, "+
+					"expected sqlite or postgres", d)
+			}
+			if d == "postgres" {
+				opts.dialect = d
+			}
+
+		default:
+			return opts, args, nil
+		}
+	}
+}
+
+// exportedFile describes a file written by an export, as listed in its
+// manifest.
+type exportedFile struct {
+	Name   string `json:"name"`
+	Rows   int    `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// exportManifest is written next to split or compressed exports, so that
+// they can be checked after being copied around.
+type exportManifest struct {
+	Format      string         `json:"format"`
+	Compression string         `json:"compression,omitempty"`
+	Query       string         `json:"query,omitempty"`
+	CreatedAt   string         `json:"created_at"`
+	Rows        int            `json:"rows"`
+	Files       []exportedFile `json:"files"`
+}
+
+// byteCounter counts the bytes written to it.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// exportFile is an export file being written. What the exporter writes is
+// compressed on the fly, and the file contents are checksummed on their way
+// to disk.
+type exportFile struct {
+	f     *os.File
+	sum   hash.Hash
+	size  byteCounter
+	buf   *bufio.Writer
+	w     io.Writer
+	close func() error
+}
+
+func createExportFile(path, compression string) (*exportFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &exportFile{f: f, sum: sha256.New()}
+	out := io.MultiWriter(f, e.sum, &e.size)
+
+	switch compression {
+	case "gzip":
+		zw := gzip.NewWriter(out)
+		e.w, e.close = zw, zw.Close
+
+	case "zstd":
+		// The standard library has no zstd encoder, so the stream is
+		// piped through the zstd command.
+		cmd := exec.Command("zstd", "-q", "-c")
+		cmd.Stdout = out
+		cmd.Stderr = os.Stderr
+		stdin, err := cmd.StdinPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(path)
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		e.w = stdin
+		e.close = func() error {
+			err := stdin.Close()
+			if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+				err = fmt.Errorf("zstd: %w", waitErr)
+			}
+			return err
+		}
+
+	default:
+		e.w, e.close = out, func() error { return nil }
+	}
+
+	e.buf = bufio.NewWriterSize(e.w, 64<<10)
+	return e, nil
+}
+
+func (e *exportFile) Write(p []byte) (int, error) {
+	return e.buf.Write(p)
+}
+
+// Close flushes the compressor and closes the file.
+func (e *exportFile) Close() error {
+	err := e.buf.Flush()
+	if closeErr := e.close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := e.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// partRows reads up to limit rows of a result at a time, so that it can be
+// exported in parts.
+type partRows struct {
+	resultRows
+	limit int
+	n     int
+
+	// pending is set when the next row was read ahead by more.
+	pending bool
+	done    bool
+}
+
+func (p *partRows) Next() bool {
+	if p.n >= p.limit {
+		return false
+	}
+
+	switch {
+	case p.pending:
+		p.pending = false
+	case p.done || !p.resultRows.Next():
+		p.done = true
+		return false
+	}
+
+	p.n++
+	return true
+}
+
+// more reports whether rows are left for another part, and starts it.
+func (p *partRows) more() bool {
+	p.n = 0
+	if !p.done && !p.pending {
+		p.pending = p.resultRows.Next()
+		p.done = !p.pending
+	}
+	return p.pending
+}
+
+// exportPaths returns the file name of part n of an export to path, and
+// the name of the manifest. Parts are numbered before the extension, as in
+// orders.0001.csv.gz, next to orders.csv.manifest.json.
+func exportPaths(path string, opts exportOptions, n int) (string, string) {
+	ext := exportCompressions[opts.compression]
+	base := strings.TrimSuffix(path, ext)
+	formatExt := filepath.Ext(base)
+	base = strings.TrimSuffix(base, formatExt)
+
+	part := base + formatExt + ext
+	if opts.splitRows > 0 {
+		part = fmt.Sprintf("%s.%04d%s%s", base, n, formatExt, ext)
+	}
+
+	return part, base + formatExt + ".manifest.json"
+}
+
+// exportQuery runs the query with the arguments bound and writes its
+// result to path in the given format.
+func exportQuery(format, path, query string, args []interface{},
+	opts exportOptions) ([]exportedFile, error) {
+
+	if _, ok := exporters[format]; !ok {
+		return nil, fmt.Errorf("unknown format %q, expected %s", format,
+			exportFormats())
+	}
+
+	rows, err := conn.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	masked, err := maskResult(newLiveRows(rows, query), query)
+	if err != nil {
+		return nil, err
+	}
+
+	return exportRows(format, path, masked, query, opts)
+}
+
+// exportRows writes a result to path in the given format, split into parts
+// and compressed as the options ask, and returns the files written. Split
+// or compressed exports get a manifest. Partially written files are removed
+// on failure.
+func exportRows(format, path string, rows resultRows, query string,
+	opts exportOptions) ([]exportedFile, error) {
+
+	export, ok := exporters[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, expected %s", format,
+			exportFormats())
+	}
+	if format == "xlsx" && opts.compression != "" {
+		return nil, fmt.Errorf("xlsx files are compressed already")
+	}
+	if opts.dialect == "postgres" {
+		if format != "sql" {
+			return nil, fmt.Errorf("--dialect only applies to sql")
+		}
+		export = exportPostgresSQL
+	}
+
+	var (
+		files   []exportedFile
+		written []string
+	)
+	fail := func(err error) ([]exportedFile, error) {
+		for _, name := range written {
+			os.Remove(name)
+		}
+		return nil, err
+	}
+
+	src := &partRows{resultRows: rows, limit: opts.splitRows}
+	if opts.splitRows == 0 {
+		src.limit = int(^uint(0) >> 1)
+	}
+
+	for n := 1; n == 1 || src.more(); n++ {
+		name, _ := exportPaths(path, opts, n)
+		f, err := createExportFile(name, opts.compression)
+		if err != nil {
+			return fail(err)
+		}
+		written = append(written, name)
+
+		count, err := export(f, src, query)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		files = append(files, exportedFile{
+			Name:   filepath.Base(name),
+			Rows:   count,
+			Bytes:  int64(f.size),
+			SHA256: hex.EncodeToString(f.sum.Sum(nil)),
+		})
+	}
+
+	if opts.splitRows == 0 && opts.compression == "" {
+		return files, nil
+	}
+
+	manifest := exportManifest{
+		Format:      format,
+		Compression: opts.compression,
+		Query:       query,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Files:       files,
+	}
+	for _, f := range files {
+		manifest.Rows += f.Rows
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fail(err)
+	}
+	_, manifestPath := exportPaths(path, opts, 0)
+	err = os.WriteFile(manifestPath, append(data, '\n'), 0o644)
+	if err != nil {
+		return fail(err)
+	}
+
+	return files, nil
+}
+
+func handleExportCommand(args string) error {
+	opts, args, err := parseExportOptions(args)
+	if err != nil {
+		fmt.Printf("Export failed: %v\n", err)
+		return err
+	}
+
+	format, rest := nextField(args)
+	path, query := nextField(rest)
+	query = strings.TrimSpace(query)
+	format = strings.ToLower(format)
+
+	if format == "" || path == "" {
+		fmt.Printf("Usage: \\export [--split-rows N] [--compress "+
+			"gzip|zstd] [--dialect sqlite|postgres] <%s> <file> "+
+			"[query]\n", exportFormats())
+		return errUsage
+	}
+
+	// Without a query, export the last result as it was fetched.
+	var files []exportedFile
+	switch {
+	case query != "":
+		files, err = exportQuery(format, path, query, nil, opts)
+
+	// Values left out of the result for their size are fetched again.
+	case len(resultCache) > 0 && resultCache[len(resultCache)-1].bigCells:
+		set := resultCache[len(resultCache)-1]
+		files, err = exportQuery(format, path, set.query, set.args, opts)
+
+	case len(resultCache) > 0:
+		set := resultCache[len(resultCache)-1]
+		var rows resultRows
+		rows, err = maskResult(set.cursor(), set.query)
+		if err == nil {
+			files, err = exportRows(format, path, rows, set.query,
+				opts)
+		}
+
+	case lastQuery != "":
+		files, err = exportQuery(format, path, lastQuery, lastQueryArgs,
+			opts)
+
+	default:
+		fmt.Println("Nothing to export, run a query first or pass one.")
+		return errors.New("nothing to export")
+	}
+	if err != nil {
+		fmt.Printf("Export failed: %v\n", err)
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if len(files) == 1 {
+		fmt.Printf("Exported %d rows to %s\n", files[0].Rows,
+			filepath.Join(dir, files[0].Name))
+		return nil
+	}
+
+	total := 0
+	for _, f := range files {
+		total += f.Rows
+	}
+	fmt.Printf("Exported %d rows to %d files, %s to %s\n", total,
+		len(files), filepath.Join(dir, files[0].Name),
+		files[len(files)-1].Name)
+	return nil
+}
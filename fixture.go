@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// fixtureBatchSize is the number of row lookups combined into one query
+// while following foreign keys.
+const fixtureBatchSize = 200
+
+// fixtureArgsRe parses the arguments of \fixture.
+var fixtureArgsRe = regexp.MustCompile(
+	`(?is)^(?:-o\s+(\S+)\s+)?("(?:[^"]|"")+"|[^\s"]+)(?:\s+WHERE\s+(.+))?$`,
+)
+
+// fixtureForeignKey is a foreign key followed when collecting a fixture.
+type fixtureForeignKey struct {
+	parent string
+	from   []string
+	to     []string
+}
+
+// fixtureTable holds the rows collected from one table.
+type fixtureTable struct {
+	name string
+	cols []string
+	fks  []fixtureForeignKey
+
+	// key identifies a row: the rowid, or the primary key of WITHOUT
+	// ROWID tables.
+	key string
+
+	// keys lists the collected rows in the order they were found, and
+	// rows maps them to their values as SQL literals.
+	keys []string
+	rows map[string][]string
+
+	// lookups holds the conditions already queried, so that a row
+	// referenced many times is looked up once.
+	lookups map[string]bool
+}
+
+// fixture collects rows and, transitively, the rows they reference.
+type fixture struct {
+	ctx    context.Context
+	c      *sql.Conn
+	tables map[string]*fixtureTable
+}
+
+// queryStrings runs a query returning one text column.
+func queryStrings(ctx context.Context, c *sql.Conn, query string,
+	args ...interface{}) ([]string, error) {
+
+	rows, err := c.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vals []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+
+	return vals, rows.Err()
+}
+
+// primaryKeyColumns returns the primary key columns of a table in key order.
+func primaryKeyColumns(ctx context.Context, c *sql.Conn, tbl string) (
+	[]string, error) {
+
+	return queryStrings(ctx, c, `SELECT name FROM pragma_table_info(?)
+		WHERE pk > 0 ORDER BY pk`, tbl)
+}
+
+// table returns the table with the given name, reading its columns and
+// foreign keys the first time.
+func (f *fixture) table(name string) (*fixtureTable, error) {
+	if t, ok := f.tables[strings.ToLower(name)]; ok {
+		return t, nil
+	}
+
+	// Foreign keys may name their parent in any case.
+	names, err := queryStrings(f.ctx, f.c, `SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name = ? COLLATE NOCASE`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no such table: %s", name)
+	}
+
+	t := &fixtureTable{
+		name:    names[0],
+		key:     "quote(rowid)",
+		rows:    make(map[string][]string),
+		lookups: make(map[string]bool),
+	}
+	if t.cols, err = tableColumns(f.ctx, f.c, t.name); err != nil {
+		return nil, err
+	}
+
+	_, err = f.c.ExecContext(f.ctx, fmt.Sprintf(
+		"SELECT rowid FROM %s LIMIT 0", quoteIdent(t.name),
+	))
+	if err != nil {
+		pk, err := primaryKeyColumns(f.ctx, f.c, t.name)
+		if err != nil {
+			return nil, err
+		}
+		exprs := make([]string, len(pk))
+		for i, col := range pk {
+			exprs[i] = "quote(" + quoteIdent(col) + ")"
+		}
+		t.key = strings.Join(exprs, " || ',' || ")
+	}
+
+	if t.fks, err = f.foreignKeys(t.name); err != nil {
+		return nil, err
+	}
+
+	f.tables[strings.ToLower(name)] = t
+	return t, nil
+}
+
+// foreignKeys reads the foreign keys of a table.
+func (f *fixture) foreignKeys(tbl string) ([]fixtureForeignKey, error) {
+	rows, err := f.c.QueryContext(f.ctx, `SELECT id, "table", "from", "to"
+		FROM pragma_foreign_key_list(?) ORDER BY id, seq`, tbl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []fixtureForeignKey
+	lastID := -1
+	for rows.Next() {
+		var (
+			id           int
+			parent, from string
+			to           sql.NullString
+		)
+		if err := rows.Scan(&id, &parent, &from, &to); err != nil {
+			return nil, err
+		}
+		if id != lastID {
+			fks = append(fks, fixtureForeignKey{parent: parent})
+			lastID = id
+		}
+		fk := &fks[len(fks)-1]
+		fk.from = append(fk.from, from)
+		fk.to = append(fk.to, to.String)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Without parent columns the key references the parent's primary
+	// key.
+	for i := range fks {
+		if fks[i].to[0] != "" {
+			continue
+		}
+		pk, err := primaryKeyColumns(f.ctx, f.c, fks[i].parent)
+		if err != nil {
+			return nil, err
+		}
+		if len(pk) == len(fks[i].from) {
+			fks[i].to = pk
+		}
+	}
+
+	return fks, nil
+}
+
+// collect adds the rows of the table matching any of the conditions, and
+// returns the lookups of the rows they reference.
+func (f *fixture) collect(t *fixtureTable, conds []string) (
+	map[string][]string, error) {
+
+	exprs := make([]string, len(t.cols)+1)
+	exprs[0] = t.key
+	for i, col := range t.cols {
+		exprs[i+1] = "quote(" + quoteIdent(col) + ")"
+	}
+
+	rows, err := f.c.QueryContext(f.ctx, fmt.Sprintf(
+		"SELECT %s FROM %s WHERE (%s)", strings.Join(exprs, ", "),
+		quoteIdent(t.name), strings.Join(conds, ") OR ("),
+	))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	colIndex := make(map[string]int, len(t.cols))
+	for i, col := range t.cols {
+		colIndex[strings.ToLower(col)] = i
+	}
+
+	refs := make(map[string][]string)
+	vals := make([]string, len(exprs))
+	valPtrs := make([]interface{}, len(exprs))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return nil, err
+		}
+
+		key := vals[0]
+		if _, ok := t.rows[key]; ok {
+			continue
+		}
+		t.keys = append(t.keys, key)
+		t.rows[key] = append([]string(nil), vals[1:]...)
+
+	fks:
+		for _, fk := range t.fks {
+			terms := make([]string, len(fk.from))
+			for i, from := range fk.from {
+				j, ok := colIndex[strings.ToLower(from)]
+				if !ok || fk.to[i] == "" || vals[j+1] == "NULL" {
+					continue fks
+				}
+				terms[i] = quoteIdent(fk.to[i]) + " = " + vals[j+1]
+			}
+			parent := strings.ToLower(fk.parent)
+			refs[parent] = append(refs[parent],
+				strings.Join(terms, " AND "))
+		}
+	}
+
+	return refs, rows.Err()
+}
+
+// run collects the rows of the table matching the condition and follows
+// their foreign keys until no new rows turn up.
+func (f *fixture) run(tbl, cond string) error {
+	pending := map[string][]string{tbl: {cond}}
+	for len(pending) > 0 {
+		next := make(map[string][]string)
+		for name, conds := range pending {
+			t, err := f.table(name)
+			if err != nil {
+				return err
+			}
+
+			var todo []string
+			for _, cond := range conds {
+				if !t.lookups[cond] {
+					t.lookups[cond] = true
+					todo = append(todo, cond)
+				}
+			}
+
+			for len(todo) > 0 {
+				n := min(len(todo), fixtureBatchSize)
+				refs, err := f.collect(t, todo[:n])
+				if err != nil {
+					return fmt.Errorf("%s: %w", t.name, err)
+				}
+				todo = todo[n:]
+
+				for parent, conds := range refs {
+					next[parent] = append(next[parent],
+						conds...)
+				}
+			}
+		}
+		pending = next
+	}
+
+	return nil
+}
+
+// order returns the tables with rows, referenced tables before the ones
+// referencing them where the foreign keys allow it.
+func (f *fixture) order() []*fixtureTable {
+	names := make([]string, 0, len(f.tables))
+	for name := range f.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var ordered []*fixtureTable
+	visited := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		t, ok := f.tables[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, fk := range t.fks {
+			visit(strings.ToLower(fk.parent))
+		}
+		if len(t.keys) > 0 {
+			ordered = append(ordered, t)
+		}
+	}
+	for _, name := range names {
+		visit(name)
+	}
+
+	return ordered
+}
+
+// write writes the collected rows as an INSERT script and returns the
+// number of rows. Columns matching a masking rule are masked, consistently
+// on both sides of a foreign key if both match a hash rule.
+func (f *fixture) write(w io.Writer, header string) (int, error) {
+	tables := f.order()
+
+	n := 0
+	for _, t := range tables {
+		n += len(t.keys)
+	}
+
+	fmt.Fprintf(w, "-- %s\n-- %d rows from %d tables.\n", header, n,
+		len(tables))
+	fmt.Fprintln(w, "PRAGMA foreign_keys=OFF;")
+	fmt.Fprintln(w, "BEGIN TRANSACTION;")
+
+	for _, t := range tables {
+		quoted := make([]string, len(t.cols))
+		for i, col := range t.cols {
+			quoted[i] = quoteIdent(col)
+		}
+		prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (",
+			quoteIdent(t.name), strings.Join(quoted, ", "))
+		masks := columnMasks(t.name, t.cols)
+
+		for _, key := range t.keys {
+			vals := append([]string(nil), t.rows[key]...)
+			for i, mask := range masks {
+				vals[i] = maskLiteral(mask, vals[i])
+			}
+
+			_, err := fmt.Fprintf(w, "%s%s);\n", prefix,
+				strings.Join(vals, ", "))
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "COMMIT;")
+	return n, err
+}
+
+// handleFixtureCommand exports rows of a table together with every row they
+// reference through foreign keys, as an INSERT script that loads into an
+// empty copy of the schema.
+func handleFixtureCommand(args string) error {
+	m := fixtureArgsRe.FindStringSubmatch(strings.TrimSpace(args))
+	if m == nil {
+		fmt.Println("Usage: \\fixture [-o file] <table> [WHERE <condition>]")
+		return errUsage
+	}
+
+	output, tbl, cond := m[1], m[2], m[3]
+	if strings.HasPrefix(tbl, `"`) {
+		tbl = strings.ReplaceAll(tbl[1:len(tbl)-1], `""`, `"`)
+	}
+	header := "Fixture of " + tbl
+	if cond == "" {
+		cond = "1"
+	} else {
+		header += " WHERE " + cond
+	}
+
+	f := &fixture{
+		ctx:    context.Background(),
+		c:      conn,
+		tables: make(map[string]*fixtureTable),
+	}
+	if err := f.run(tbl, cond); err != nil {
+		fmt.Printf("Fixture error: %v\n", err)
+		return err
+	}
+
+	if output == "" {
+		_, err := f.write(os.Stdout, header)
+		if err != nil {
+			fmt.Printf("Fixture error: %v\n", err)
+		}
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		fmt.Printf("Fixture error: %v\n", err)
+		return err
+	}
+	n, err := f.write(file, header)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Fixture error: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Wrote %d rows to %s\n", n, output)
+	return nil
+}
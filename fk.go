@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// fkEnabled caches PRAGMA foreign_keys of the session connection. It
+	// is refreshed after every input, since the pragma may also be
+	// changed directly with SQL.
+	fkEnabled bool
+
+	// dmlTargetRe extracts the target table of INSERT, REPLACE, UPDATE
+	// and DELETE statements, optionally preceded by a WITH clause.
+	dmlTargetRe = regexp.MustCompile(
+		`(?is)^(?:WITH\b.*?\)\s*)?(?:` +
+			`(?:INSERT(?:\s+OR\s+\w+)?|REPLACE)\s+INTO|` +
+			`UPDATE(?:\s+OR\s+\w+)?|` +
+			`DELETE\s+FROM)\s+` +
+			`(?:(?:"[^"]+"|\w+)\.)?("[^"]+"|\w+)`,
+	)
+)
+
+func refreshFKState() {
+	var on int
+	err := conn.QueryRowContext(
+		context.Background(), "PRAGMA foreign_keys",
+	).Scan(&on)
+	if err == nil {
+		fkEnabled = on != 0
+	}
+}
+
+func setForeignKeys(on bool) error {
+	_, err := conn.ExecContext(
+		context.Background(),
+		fmt.Sprintf("PRAGMA foreign_keys = %s", onOff(on)),
+	)
+	if err != nil {
+		return err
+	}
+
+	refreshFKState()
+
+	// The pragma is a no-op inside a transaction.
+	if fkEnabled != on {
+		return fmt.Errorf("cannot change foreign_keys inside a " +
+			"transaction")
+	}
+
+	return nil
+}
+
+func handleFKCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("Foreign key enforcement is %s\n", onOff(fkEnabled))
+		return nil
+	}
+
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		fmt.Println("Usage: \\fk [on|off]")
+		return errUsage
+	}
+
+	if err := setForeignKeys(args[0] == "on"); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return err
+	}
+	fmt.Printf("Foreign key enforcement is now %s\n", onOff(fkEnabled))
+	return nil
+}
+
+// dmlTarget returns the table a DML statement writes to, or "" if the
+// statement isn't DML.
+func dmlTarget(query string) string {
+	m := dmlTargetRe.FindStringSubmatch(strings.TrimSpace(query))
+	if m == nil {
+		return ""
+	}
+
+	return unquoteName(m[1])
+}
+
+// foreignKeyRoles reports whether the table references another table and
+// whether it is referenced by one, i.e. whether writing to it may violate a
+// foreign key constraint.
+func foreignKeyRoles(tableName string) (child, parent bool) {
+	err := conn.QueryRowContext(context.Background(), `
+		SELECT
+		  EXISTS (SELECT 1 FROM pragma_foreign_key_list(?1)),
+		  EXISTS (
+		    SELECT 1
+		    FROM sqlite_master m, pragma_foreign_key_list(m.name) f
+		    WHERE m.type = 'table' AND f."table" = ?1 COLLATE NOCASE
+		  )
+	`, tableName).Scan(&child, &parent)
+	if err != nil {
+		return false, false
+	}
+	return child, parent
+}
+
+// warnUnenforcedFKs prints a warning if the query writes to a table involved
+// in foreign keys while enforcement is off.
+func warnUnenforcedFKs(query string) {
+	if fkEnabled || quietMode {
+		return
+	}
+
+	target := dmlTarget(query)
+	if target == "" {
+		return
+	}
+
+	child, parent := foreignKeyRoles(target)
+	switch {
+	case child:
+		fmt.Printf("WARNING: %s has foreign keys but enforcement is off "+
+			"(\\fk on to enable)\n", quoteIdent(target))
+
+	case parent:
+		fmt.Printf("WARNING: %s is referenced by foreign keys but "+
+			"enforcement is off (\\fk on to enable)\n", quoteIdent(target))
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// formatterTimeout bounds how long an external formatter command may take
+// to answer a value, and to exit at the end of a result.
+const formatterTimeout = 5 * time.Second
+
+// valueFormatter renders a single column value for display.
+type valueFormatter func(val interface{}) string
+
+// builtinFormatters are the formatters that can be referred to by name in
+// the config file.
+var builtinFormatters = map[string]valueFormatter{
+	"hex": func(val interface{}) string {
+		switch v := val.(type) {
+		case []byte:
+			return hex.EncodeToString(v)
+		case int64:
+			// Show negative values as their two's complement bits,
+			// not as -0x1.
+			return fmt.Sprintf("0x%x", uint64(v))
+		}
+		return formatValue(val)
+	},
+
+	"base64": func(val interface{}) string {
+		if v, ok := val.([]byte); ok {
+			return base64.StdEncoding.EncodeToString(v)
+		}
+		return formatValue(val)
+	},
+
+	// text shows blobs holding valid UTF-8 as plain text.
+	"text": func(val interface{}) string {
+		if v, ok := val.([]byte); ok && utf8.Valid(v) {
+			return string(v)
+		}
+		return formatValue(val)
+	},
+
+	"msat_btc": func(val interface{}) string {
+		return formatScaled(val, 100_000_000_000, 11, "BTC")
+	},
+
+	"sat_btc": func(val interface{}) string {
+		return formatScaled(val, 100_000_000, 8, "BTC")
+	},
+
+	"unixtime": func(val interface{}) string {
+		if v, ok := val.(int64); ok {
+			return formatTime(time.Unix(v, 0).UTC())
+		}
+		return formatValue(val)
+	},
+}
+
+// formatScaled renders an integer amount of a sub-unit as a decimal amount
+// of the larger unit, without going through floating point.
+func formatScaled(val interface{}, scale int64, digits int,
+	unit string) string {
+
+	v, ok := val.(int64)
+	if !ok {
+		return formatValue(val)
+	}
+
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+	whole, frac := v/scale, v%scale
+	if whole < 0 {
+		whole = -whole
+	}
+	if frac < 0 {
+		frac = -frac
+	}
+
+	return fmt.Sprintf("%s%d.%0*d %s", sign, whole, digits, frac, unit)
+}
+
+// commandFormatter runs an external command for the values of a result
+// column, e.g. to decode protobuf blobs. The command starts on the first
+// value and runs for the rest of the result: it reads a value per line on
+// stdin and answers each with a line on stdout, flushed right away, as
+// sed -u or jq --unbuffered do. Blobs are written in hex, and backslashes,
+// newlines and carriage returns in text as \\, \n and \r.
+type commandFormatter struct {
+	command string
+
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stderr bytes.Buffer
+
+	// lines receives the output of the command, and is closed at its end.
+	// done stops the reader of the output.
+	lines chan string
+	done  chan struct{}
+
+	// err is why the command can't format any more values.
+	err error
+}
+
+// formatterEscaper keeps text values on a line of their own.
+var formatterEscaper = strings.NewReplacer(
+	`\`, `\\`, "\n", `\n`, "\r", `\r`,
+)
+
+// start runs the command and the reader of its output.
+func (f *commandFormatter) start() error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	cmd := exec.Command("sh", "-c", f.command)
+	cmd.Stdin = r
+	cmd.Stderr = &f.stderr
+	cmd.WaitDelay = formatterTimeout
+	stdout, err := cmd.StdoutPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		w.Close()
+		return err
+	}
+	f.cmd, f.stdin = cmd, w
+
+	f.lines, f.done = make(chan string), make(chan struct{})
+	go func() {
+		defer close(f.lines)
+
+		out := bufio.NewReader(stdout)
+		for {
+			line, err := out.ReadString('\n')
+			if err != nil {
+				return
+			}
+			select {
+			case f.lines <- strings.TrimRight(line, "\r\n"):
+			case <-f.done:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// format sends a value to the command and returns its answer.
+func (f *commandFormatter) format(val interface{}) string {
+	if val == nil {
+		return formatValue(val)
+	}
+	if f.cmd == nil && f.err == nil {
+		f.err = f.start()
+	}
+	if f.err != nil {
+		return fmt.Sprintf("<formatter error: %v>", f.err)
+	}
+
+	input := formatterEscaper.Replace(formatValue(val))
+	if v, ok := val.([]byte); ok {
+		input = hex.EncodeToString(v)
+	}
+
+	f.stdin.SetWriteDeadline(time.Now().Add(formatterTimeout))
+	if _, err := io.WriteString(f.stdin, input+"\n"); err != nil {
+		return f.fail(err)
+	}
+
+	timer := time.NewTimer(formatterTimeout)
+	defer timer.Stop()
+
+	select {
+	case line, ok := <-f.lines:
+		if !ok {
+			return f.fail(errors.New("the command exited"))
+		}
+		return line
+	case <-timer.C:
+		return f.fail(fmt.Errorf("no answer within %s", formatterTimeout))
+	}
+}
+
+// fail stops the command, and returns the error shown for this value and
+// the ones after it. The last line the command wrote to stderr tells more
+// than err, if there is one.
+func (f *commandFormatter) fail(err error) string {
+	f.cmd.Process.Kill()
+	f.close()
+
+	stderr := strings.Split(strings.TrimSpace(f.stderr.String()), "\n")
+	if msg := stderr[len(stderr)-1]; msg != "" {
+		err = errors.New(msg)
+	}
+	f.err = err
+	return fmt.Sprintf("<formatter error: %v>", err)
+}
+
+// close ends the input of the command and waits for it to exit, killing it
+// if it takes longer than formatterTimeout.
+func (f *commandFormatter) close() {
+	if f.cmd == nil {
+		return
+	}
+	f.stdin.Close()
+
+	timer := time.NewTimer(formatterTimeout)
+	defer timer.Stop()
+
+	for draining := true; draining; {
+		select {
+		case _, ok := <-f.lines:
+			draining = ok
+		case <-timer.C:
+			f.cmd.Process.Kill()
+			draining = false
+		}
+	}
+	close(f.done)
+
+	f.cmd.Wait()
+	f.cmd = nil
+}
+
+// booleanSpec is the formatter spec that shows a column as a boolean, see
+// columnFormat.
+const booleanSpec = "bool"
+
+// parseFormatter turns a formatter spec from the config file into a
+// formatter. A spec is either a builtin name, "bool" or "exec:<command>".
+func parseFormatter(spec string) (columnFormat, error) {
+	if spec == booleanSpec {
+		return columnFormat{boolean: true}, nil
+	}
+
+	if command, ok := strings.CutPrefix(spec, "exec:"); ok {
+		if strings.TrimSpace(command) == "" {
+			return columnFormat{}, fmt.Errorf("empty formatter command")
+		}
+		return columnFormat{command: command}, nil
+	}
+
+	f, ok := builtinFormatters[spec]
+	if !ok {
+		return columnFormat{}, fmt.Errorf("unknown formatter %q", spec)
+	}
+
+	return columnFormat{fn: f}, nil
+}
+
+// formatterRules holds the configured formatters keyed by lowercased
+// selector.
+var formatterRules map[string]columnFormat
+
+// setFormatters replaces the configured formatters. Selectors are one of:
+//
+//	table.column  a column of a result read from a single table
+//	*.column      a column with that name in any result
+//	type:DECL     columns with the declared type DECL, e.g. type:BLOB
+func setFormatters(specs map[string]string) error {
+	rules := make(map[string]columnFormat, len(specs))
+	for selector, spec := range specs {
+		if !strings.HasPrefix(selector, "type:") &&
+			!strings.Contains(selector, ".") {
+
+			return fmt.Errorf("invalid formatter selector %q, "+
+				"expected table.column, *.column or type:DECL",
+				selector)
+		}
+
+		f, err := parseFormatter(spec)
+		if err != nil {
+			return fmt.Errorf("formatter for %s: %w", selector, err)
+		}
+		rules[strings.ToLower(selector)] = f
+	}
+
+	formatterRules = rules
+	return nil
+}
+
+// columnFormat is how the values of a result column are shown.
+type columnFormat struct {
+	// fn renders the values, nil for the default formatting.
+	fn valueFormatter
+
+	// command is the formatter command of an exec: spec, and formatter
+	// the instance of it running for a result, see resultFormats.
+	command   string
+	formatter *commandFormatter
+
+	// boolean shows 0 and 1 as false and true, and as JSON booleans.
+	// Columns declared BOOLEAN are shown so unless configured otherwise.
+	boolean bool
+}
+
+// columnFormats holds the format of each result column. A nil slice means
+// all columns use the default formatting.
+type columnFormats []columnFormat
+
+// format renders the value of column i.
+func (c columnFormats) format(i int, val interface{}) string {
+	if i < len(c) && c[i].fn != nil {
+		return c[i].fn(val)
+	}
+	if i < len(c) && c[i].boolean {
+		if b, ok := booleanValue(val); ok {
+			return strconv.FormatBool(b)
+		}
+	}
+	return formatValue(val)
+}
+
+// close stops the formatter commands started for the result.
+func (c columnFormats) close() {
+	for _, f := range c {
+		if f.formatter != nil {
+			f.formatter.close()
+		}
+	}
+}
+
+// custom reports whether column i has a configured formatter.
+func (c columnFormats) custom(i int) bool {
+	return i < len(c) && c[i].fn != nil
+}
+
+// boolean reports whether column i is shown as a boolean.
+func (c columnFormats) boolean(i int) bool {
+	return i < len(c) && c[i].fn == nil && c[i].boolean
+}
+
+// booleanValue reads 0 and 1 as false and true. Other values, like NULL,
+// are shown as they are.
+func booleanValue(val interface{}) (bool, bool) {
+	switch v := val.(type) {
+	case int64:
+		return v == 1, v == 0 || v == 1
+	case float64:
+		return v == 1, v == 0 || v == 1
+	}
+	return false, false
+}
+
+// isBooleanType reports whether a declared type is a boolean one, which
+// SQLite stores as the integers 0 and 1.
+func isBooleanType(declType string) bool {
+	return strings.Contains(strings.ToUpper(declType), "BOOL")
+}
+
+// resultFormats looks up the configured formatters for the columns of a
+// result. The source table is only known for simple single-table queries,
+// so table.column selectors don't apply to joins. Each column with an
+// exec: formatter gets a command of its own, which close stops.
+func resultFormats(rows resultRows, query string) columnFormats {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil
+	}
+	types := rows.declTypes()
+
+	tableName := strings.ToLower(queryTable(query))
+	formats := make(columnFormats, len(cols))
+	for i, name := range cols {
+		col := strings.ToLower(name)
+		declType := strings.ToLower(types[i])
+		formats[i].boolean = isBooleanType(declType)
+
+		var candidates []string
+		if tableName != "" {
+			candidates = append(candidates, tableName+"."+col)
+		}
+		candidates = append(candidates, "*."+col)
+		if declType != "" {
+			candidates = append(candidates, "type:"+declType)
+		}
+
+		for _, key := range candidates {
+			if f, ok := formatterRules[key]; ok {
+				formats[i] = f
+				if f.command != "" {
+					formats[i].formatter = &commandFormatter{
+						command: f.command,
+					}
+					formats[i].fn = formats[i].formatter.format
+				}
+				break
+			}
+		}
+	}
+
+	return formats
+}
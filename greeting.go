@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// greeting replaces the banner printed when an interactive session starts,
+// "none" prints nothing. Placeholders like {tables} are filled in, see
+// greetingFields.
+var greeting string
+
+// greetingFieldRe matches a placeholder of the greeting.
+var greetingFieldRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// greetingFields compute the values of the greeting placeholders.
+var greetingFields = map[string]func(ctx context.Context) string{
+	"database": func(context.Context) string {
+		return databaseLabel(dbPath)
+	},
+	"path": func(context.Context) string {
+		return dbPath
+	},
+	"size": func(ctx context.Context) string {
+		var size int64
+		metadata().QueryRowContext(ctx, `
+			SELECT page_count * page_size
+			FROM pragma_page_count(), pragma_page_size()`).Scan(&size)
+		return formatByteSize(size)
+	},
+	"tables": func(ctx context.Context) string {
+		return countSchemaObjects(ctx, "table")
+	},
+	"views": func(ctx context.Context) string {
+		return countSchemaObjects(ctx, "view")
+	},
+	"sqlite_version": func(ctx context.Context) string {
+		var version string
+		metadata().QueryRowContext(ctx, "SELECT sqlite_version()").
+			Scan(&version)
+		return version
+	},
+}
+
+// countSchemaObjects counts the user's tables or views.
+func countSchemaObjects(ctx context.Context, typ string) string {
+	objs, _ := dbSchema.schemaObjects(ctx, typ)
+	return fmt.Sprint(len(objs))
+}
+
+// setGreeting sets the greeting, rejecting unknown placeholders.
+func setGreeting(text string) error {
+	for _, m := range greetingFieldRe.FindAllStringSubmatch(text, -1) {
+		if _, ok := greetingFields[m[1]]; !ok {
+			names := make([]string, 0, len(greetingFields))
+			for name := range greetingFields {
+				names = append(names, "{"+name+"}")
+			}
+			sort.Strings(names)
+			return fmt.Errorf("unknown greeting placeholder %s, "+
+				"expected one of %s", m[0], strings.Join(names, ", "))
+		}
+	}
+
+	greeting = text
+	return nil
+}
+
+// expandGreeting fills in the placeholders of the greeting.
+func expandGreeting(text string) string {
+	ctx := context.Background()
+	return greetingFieldRe.ReplaceAllStringFunc(text, func(m string) string {
+		return greetingFields[m[1:len(m)-1]](ctx)
+	})
+}
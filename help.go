@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// metaCommand describes a meta-command for \?.
+type metaCommand struct {
+	usage string
+	desc  string
+}
+
+// metaCommandGroups lists every meta-command by topic, in the order \?
+// prints them.
+var metaCommandGroups = []struct {
+	title    string
+	commands []metaCommand
+}{
+	{"General", []metaCommand{
+		{`\?`, "list the meta-commands"},
+		{`\h [statement]`, "show the syntax of an SQL statement"},
+		{`\version`, "show versions and SQLite compile options"},
+		{`\conninfo`, "show connection details"},
+		{`\errverbose`, "show the last error with its SQLite result code"},
+		{`\open [path]`, "switch to another database"},
+		{`exit, CTRL+D`, "quit"},
+	}},
+	{"Schema", []metaCommand{
+		{`\d`, "list all tables and views"},
+		{`\d <table>`, "show a table's schema"},
+		{`\d <pattern>`, "list tables and views like pay% or v_*"},
+		{`\d --json [table]`, "print the schema as JSON"},
+		{`\d+ [--by-size] [pattern]`, "list with row counts and sizes"},
+		{`\dt [pattern]`, "list tables, temp.* for the temp ones"},
+		{`\dt+ [--by-size] [pattern]`, "list tables with sizes"},
+		{`\dv [pattern]`, "list views"},
+		{`\di [pattern]`, "list indexes"},
+		{`\di+ <index>`, "show an index's columns and selectivity"},
+		{`\dO`, "list collations"},
+		{`\df [pattern]`, "list functions"},
+		{`.schema [--raw] [table]`, "print the formatted CREATE statements"},
+		{`\schema snapshot <file>`, "save the schema for a later diff"},
+		{`\schema diff <file>`, "DDL from a snapshot to the live schema"},
+		{`\schema export [file]`, "write the schema as JSON"},
+		{`\views deps [name]`, "show which views depend on what"},
+		{`\views rebuild [name]`, "recreate dependent views in order"},
+		{`\alter <table> [def]`, "rewrite a table into a new definition"},
+		{`\migrate [--dry-run] <dir>`, "apply pending migrations in a dir"},
+	}},
+	{"Data", []metaCommand{
+		{`\sample <table> [N]`, "show N random rows"},
+		{`\row <table> <key>`, "show a row and follow its foreign keys"},
+		{`\dups <table> [cols]`, "find duplicate rows"},
+		{`\checksum <table> [cols]`, "hash the rows to compare copies"},
+		{`\blobout <t> <col> <rowid> <f>`, "stream a large value to a file"},
+		{`\hexdump <t> <col> <rowid> [o n]`, "show n bytes of a value in hex"},
+		{`\bind [name value]`, "preset a :name or ? parameter"},
+		{`\template [name]`, "run a canned query"},
+		{`\jsontable <file> [name]`, "load JSON/NDJSON as a temp table"},
+		{`\import <file> [table]`, "load a CSV or JSON file, resumable"},
+		{`\fixture <t> WHERE <c>`,
+			"export rows with the rows they reference"},
+		{`\undo [N]`, "roll back statements run with \\set undo on"},
+	}},
+	{"Results", []metaCommand{
+		{`\g [file]`, "print the last result again"},
+		{`\results [n]`, "list or show the cached results"},
+		{`\sort <col> [desc]`, "sort the last result"},
+		{`\cols [names|reset]`, "pick the columns to display"},
+		{`\browse [query|auto]`, "scroll through a result full-screen"},
+		{`\compare [a ;; b]`, "diff two queries or the last two results"},
+		{`\crosstabview [v h d]`, "pivot the last result"},
+		{`\export <fmt> <file> [q]`, "export the last result or a query"},
+		{`\copylast`, "copy the last result to the clipboard"},
+	}},
+	{"Output", []metaCommand{
+		{`\x [on|off|auto]`, "toggle expanded display"},
+		{`\j`, "toggle JSON output"},
+		{`\pset [option [value]]`, "show or change output options"},
+		{`\set [name [value]]`, "show or change settings"},
+		{`\timing [on|off]`, "show query times and statement stats"},
+	}},
+	{"Performance", []metaCommand{
+		{`\bench <N> <query>`, "time a query over N runs"},
+		{`\log [on [file]|off]`, "toggle the query log"},
+		{`\workload record <file>|stop`, "record statements to replay"},
+		{`\slowlog [top] [N]`, "review captured slow queries"},
+		{`\slowlog clear`, "forget the captured slow queries"},
+		{`\planbaseline save <name> [q]`, "save the plan of a query"},
+		{`\planbaseline check [name]`, "report plans changed since saved"},
+		{`\planbaseline list|drop`, "list or forget saved plans"},
+		{`\dstats [table]`, "show what ANALYZE collected"},
+		{`\advise [file]`, "suggest indexes for the history"},
+	}},
+	{"Maintenance", []metaCommand{
+		{`\integrity [quick]`, "check database integrity"},
+		{`\fkcheck [table]`, "check foreign key violations"},
+		{`\fk [on|off]`, "toggle foreign key enforcement"},
+		{`\maintain [--step ...]`, "ANALYZE, optimize, vacuum, checkpoint"},
+		{`\recover <file>`, "salvage data into a new database"},
+		{`\pragmas [edit [name]]`, "browse and change pragmas"},
+	}},
+	{"Sessions and triggers", []metaCommand{
+		{`\session start [tables]`, "record changes for a changeset"},
+		{`\session changeset <file>`, "write the recorded changes"},
+		{`\session apply <file>`, "apply a changeset"},
+		{`\session stop`, "stop recording"},
+		{`\snapshot begin|end`, "pin one database state for reports"},
+		{`\notify [on|off]`, "report changes by other processes"},
+		{`\trigger [list]`, "list triggers, disabled ones included"},
+		{`\trigger disable <name>`, "drop a trigger until re-enabled"},
+		{`\trigger enable <name|all>`, "recreate disabled triggers"},
+	}},
+}
+
+// handleMetaHelpCommand lists the meta-commands, or only those whose usage
+// or description mentions the given word.
+func handleMetaHelpCommand(args []string) error {
+	filter := strings.ToLower(strings.Join(args, " "))
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Command", "Description"})
+
+	found := false
+	for _, group := range metaCommandGroups {
+		var matching []metaCommand
+		for _, c := range group.commands {
+			if strings.Contains(strings.ToLower(c.usage), filter) ||
+				strings.Contains(strings.ToLower(c.desc), filter) {
+
+				matching = append(matching, c)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+
+		if found {
+			t.AppendSeparator()
+		}
+		found = true
+		if filter == "" {
+			t.AppendRow(table.Row{group.title + ":", ""})
+		}
+		for _, c := range matching {
+			t.AppendRow(table.Row{c.usage, c.desc})
+		}
+	}
+	if !found {
+		fmt.Printf("No meta-command matches %q.\n", filter)
+		return nil
+	}
+	t.Render()
+
+	if filter == "" {
+		fmt.Println(`Use \h <statement> for help on SQL statements, ` +
+			`\? <word> to search.`)
+	}
+	return nil
+}
+
+// sqlStatementHelp is the syntax summary of an SQL statement for \h.
+type sqlStatementHelp struct {
+	name   string
+	desc   string
+	syntax string
+}
+
+// sqlStatements summarizes the statements SQLite understands, sorted by
+// name.
+var sqlStatements = []sqlStatementHelp{
+	{"ALTER TABLE", "change a table", `
+ALTER TABLE [schema.]table RENAME TO new_table
+ALTER TABLE [schema.]table RENAME [COLUMN] column TO new_column
+ALTER TABLE [schema.]table ADD [COLUMN] column_def
+ALTER TABLE [schema.]table DROP [COLUMN] column`},
+
+	{"ANALYZE", "gather statistics for the query planner", `
+ANALYZE [schema | [schema.]table_or_index]`},
+
+	{"ATTACH DATABASE", "add another database file to the connection", `
+ATTACH [DATABASE] expr AS schema`},
+
+	{"BEGIN", "start a transaction", `
+BEGIN [DEFERRED | IMMEDIATE | EXCLUSIVE] [TRANSACTION]`},
+
+	{"COMMIT", "commit the current transaction", `
+COMMIT [TRANSACTION]
+END [TRANSACTION]`},
+
+	{"CREATE INDEX", "define a new index", `
+CREATE [UNIQUE] INDEX [IF NOT EXISTS] [schema.]index
+    ON table ( indexed_column [COLLATE name] [ASC | DESC] [, ...] )
+    [WHERE expr]`},
+
+	{"CREATE TABLE", "define a new table", `
+CREATE [TEMP | TEMPORARY] TABLE [IF NOT EXISTS] [schema.]table (
+    column [type] [column_constraint ...] [, ...]
+    [, table_constraint [, ...]]
+) [WITHOUT ROWID] [, STRICT]
+CREATE [TEMP | TEMPORARY] TABLE [IF NOT EXISTS] [schema.]table
+    AS select_stmt
+
+where column_constraint is:
+    [CONSTRAINT name]
+    { PRIMARY KEY [ASC | DESC] [conflict_clause] [AUTOINCREMENT]
+    | NOT NULL [conflict_clause]
+    | UNIQUE [conflict_clause]
+    | CHECK ( expr )
+    | DEFAULT { literal | ( expr ) }
+    | COLLATE name
+    | REFERENCES foreign_table [( column [, ...] )] [fk_actions]
+    | [GENERATED ALWAYS] AS ( expr ) [STORED | VIRTUAL] }
+
+and table_constraint is:
+    [CONSTRAINT name]
+    { PRIMARY KEY ( indexed_column [, ...] ) [conflict_clause]
+    | UNIQUE ( indexed_column [, ...] ) [conflict_clause]
+    | CHECK ( expr )
+    | FOREIGN KEY ( column [, ...] )
+          REFERENCES foreign_table [( column [, ...] )] [fk_actions] }
+
+and conflict_clause is:
+    ON CONFLICT { ROLLBACK | ABORT | FAIL | IGNORE | REPLACE }`},
+
+	{"CREATE TRIGGER", "define a new trigger", `
+CREATE [TEMP | TEMPORARY] TRIGGER [IF NOT EXISTS] [schema.]trigger
+    [BEFORE | AFTER | INSTEAD OF]
+    { DELETE | INSERT | UPDATE [OF column [, ...]] } ON table
+    [FOR EACH ROW] [WHEN expr]
+BEGIN
+    { update_stmt | insert_stmt | delete_stmt | select_stmt } ;
+    [...]
+END`},
+
+	{"CREATE VIEW", "define a new view", `
+CREATE [TEMP | TEMPORARY] VIEW [IF NOT EXISTS] [schema.]view
+    [( column [, ...] )] AS select_stmt`},
+
+	{"CREATE VIRTUAL TABLE", "define a table implemented by a module", `
+CREATE VIRTUAL TABLE [IF NOT EXISTS] [schema.]table
+    USING module [( module_argument [, ...] )]`},
+
+	{"DELETE", "delete rows of a table", `
+[WITH [RECURSIVE] common_table_expression [, ...]]
+DELETE FROM [schema.]table [INDEXED BY index | NOT INDEXED]
+    [WHERE expr]
+    [RETURNING { * | expr [[AS] alias] } [, ...]]`},
+
+	{"DETACH DATABASE", "remove an attached database", `
+DETACH [DATABASE] schema`},
+
+	{"DROP INDEX", "remove an index", `
+DROP INDEX [IF EXISTS] [schema.]index`},
+
+	{"DROP TABLE", "remove a table", `
+DROP TABLE [IF EXISTS] [schema.]table`},
+
+	{"DROP TRIGGER", "remove a trigger", `
+DROP TRIGGER [IF EXISTS] [schema.]trigger`},
+
+	{"DROP VIEW", "remove a view", `
+DROP VIEW [IF EXISTS] [schema.]view`},
+
+	{"EXPLAIN", "show how a statement is executed", `
+EXPLAIN [QUERY PLAN] statement`},
+
+	{"INSERT", "create new rows in a table", `
+[WITH [RECURSIVE] common_table_expression [, ...]]
+{ INSERT [OR { ABORT | FAIL | IGNORE | REPLACE | ROLLBACK }] | REPLACE }
+    INTO [schema.]table [AS alias] [( column [, ...] )]
+    { VALUES ( expr [, ...] ) [, ...] | select_stmt | DEFAULT VALUES }
+    [ON CONFLICT [( indexed_column [, ...] ) [WHERE expr]]
+        DO { NOTHING | UPDATE SET column = expr [, ...] [WHERE expr] }]
+    [RETURNING { * | expr [[AS] alias] } [, ...]]`},
+
+	{"PRAGMA", "query or change a setting of the library", `
+PRAGMA [schema.]pragma_name
+PRAGMA [schema.]pragma_name = value
+PRAGMA [schema.]pragma_name(value)`},
+
+	{"REINDEX", "rebuild indexes", `
+REINDEX [collation | [schema.]table_or_index]`},
+
+	{"RELEASE SAVEPOINT", "commit the changes since a savepoint", `
+RELEASE [SAVEPOINT] name`},
+
+	{"ROLLBACK", "undo the current transaction or back to a savepoint", `
+ROLLBACK [TRANSACTION] [TO [SAVEPOINT] name]`},
+
+	{"SAVEPOINT", "start a named, nestable transaction", `
+SAVEPOINT name`},
+
+	{"SELECT", "retrieve rows from tables or views", `
+[WITH [RECURSIVE] cte_name [( column [, ...] )]
+    AS [[NOT] MATERIALIZED] ( select_stmt ) [, ...]]
+SELECT [DISTINCT | ALL] { * | table.* | expr [[AS] alias] } [, ...]
+    [FROM table_or_subquery [join_operator table_or_subquery
+        [ON expr | USING ( column [, ...] )]] [...]]
+    [WHERE expr]
+    [GROUP BY expr [, ...] [HAVING expr]]
+    [WINDOW name AS ( window_definition ) [, ...]]
+    [{ UNION [ALL] | INTERSECT | EXCEPT } select_stmt]
+    [ORDER BY expr [COLLATE name] [ASC | DESC] [NULLS { FIRST | LAST }]
+        [, ...]]
+    [LIMIT expr [{ OFFSET | , } expr]]
+VALUES ( expr [, ...] ) [, ...]`},
+
+	{"UPDATE", "change rows of a table", `
+[WITH [RECURSIVE] common_table_expression [, ...]]
+UPDATE [OR { ABORT | FAIL | IGNORE | REPLACE | ROLLBACK }]
+    [schema.]table [[AS] alias] [INDEXED BY index | NOT INDEXED]
+    SET { column | ( column [, ...] ) } = expr [, ...]
+    [FROM table_or_subquery [, ...]]
+    [WHERE expr]
+    [RETURNING { * | expr [[AS] alias] } [, ...]]`},
+
+	{"VACUUM", "rebuild the database file, reclaiming free space", `
+VACUUM [schema] [INTO filename]`},
+}
+
+// sqlStatementAliases maps statements documented under another name.
+var sqlStatementAliases = map[string]string{
+	"END":     "COMMIT",
+	"REPLACE": "INSERT",
+	"RELEASE": "RELEASE SAVEPOINT",
+	"WITH":    "SELECT",
+	"VALUES":  "SELECT",
+}
+
+// findStatementHelp returns the help for the statement that the words
+// start with, like CREATE TABLE for "create table t (...)", or else every
+// statement starting with them, like all CREATE statements for "create".
+func findStatementHelp(words []string) []sqlStatementHelp {
+	words = strings.Fields(strings.ToUpper(strings.Join(words, " ")))
+	if alias, ok := sqlStatementAliases[words[0]]; ok {
+		words = append(strings.Fields(alias), words[1:]...)
+	}
+
+	// CREATE TEMP TABLE and CREATE UNIQUE INDEX are helped with as
+	// CREATE TABLE and CREATE INDEX.
+	if len(words) > 2 && words[0] == "CREATE" {
+		switch words[1] {
+		case "TEMP", "TEMPORARY", "UNIQUE":
+			words = append([]string{"CREATE"}, words[2:]...)
+		}
+	}
+
+	var best *sqlStatementHelp
+	for i, s := range sqlStatements {
+		name := strings.Fields(s.name)
+		if len(name) > len(words) || (best != nil &&
+			len(name) <= len(strings.Fields(best.name))) {
+
+			continue
+		}
+		if strings.Join(words[:len(name)], " ") == s.name {
+			best = &sqlStatements[i]
+		}
+	}
+	if best != nil {
+		return []sqlStatementHelp{*best}
+	}
+
+	prefix := strings.Join(words, " ")
+	var matching []sqlStatementHelp
+	for _, s := range sqlStatements {
+		if strings.HasPrefix(s.name, prefix) {
+			matching = append(matching, s)
+		}
+	}
+	return matching
+}
+
+// handleSQLHelpCommand prints the syntax of SQL statements, or lists the
+// statements there is help on.
+func handleSQLHelpCommand(args []string) error {
+	if len(args) == 0 {
+		names := make([]string, len(sqlStatements))
+		for i, s := range sqlStatements {
+			names[i] = s.name
+		}
+		sort.Strings(names)
+
+		fmt.Println("Available help:")
+		printColumns(names)
+		fmt.Println(`Use \h <statement>, e.g. \h CREATE TABLE.`)
+		return nil
+	}
+
+	matching := findStatementHelp(args)
+	if len(matching) == 0 {
+		fmt.Printf("No help available for %q.\n", strings.Join(args, " "))
+		fmt.Println(`Use \h to list the statements there is help on.`)
+		return nil
+	}
+
+	for i, s := range matching {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("Command:     %s\n", s.name)
+		fmt.Printf("Description: %s\n", s.desc)
+		fmt.Printf("Syntax:%s\n", s.syntax)
+	}
+	fmt.Println()
+	fmt.Println("See https://www.sqlite.org/lang.html for the full " +
+		"grammar.")
+	return nil
+}
+
+// printColumns prints names in as many columns as fit the terminal, filled
+// top to bottom, or in 80 columns when not printing to one.
+func printColumns(names []string) {
+	width := 0
+	for _, name := range names {
+		width = max(width, displayWidth(name))
+	}
+	width += 2
+
+	lineWidth := terminalWidth()
+	if lineWidth == 0 {
+		lineWidth = 80
+	}
+	perLine := max(1, (lineWidth-2)/width)
+	lines := (len(names) + perLine - 1) / perLine
+	for line := 0; line < lines; line++ {
+		var b strings.Builder
+		for i := line; i < len(names); i += lines {
+			b.WriteString(padRight(names[i], width))
+		}
+		fmt.Println("  " + strings.TrimRight(b.String(), " "))
+	}
+}
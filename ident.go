@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Names of tables, columns and other schema objects are never put into SQL
+// as they are. Introspection goes through the table-valued pragma functions
+// with the name bound as a parameter, e.g.
+//
+//	SELECT name FROM pragma_table_info(?)
+//
+// and statements that need a name in their text quote it with quoteIdent.
+
+// plainIdentRe matches the identifiers that need no quoting.
+var plainIdentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdent quotes an SQL identifier, escaping embedded double quotes.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteIdentIfNeeded quotes an identifier only if it isn't a plain word or
+// is a keyword, for names shown to be typed back, like completions.
+func quoteIdentIfNeeded(name string) string {
+	if plainIdentRe.MatchString(name) &&
+		!sqlKeywords[strings.ToUpper(name)] {
+
+		return name
+	}
+	return quoteIdent(name)
+}
+
+// unquoteName removes the double quotes of a quoted identifier.
+func unquoteName(name string) string {
+	if len(name) >= 2 && strings.HasPrefix(name, `"`) &&
+		strings.HasSuffix(name, `"`) {
+
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+	return name
+}
+
+// quoteString quotes s as an SQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// hostileNames are table and column names that break SQL built by pasting
+// them in: embedded quotes, spaces, dots and keywords.
+var hostileNames = []string{
+	`my table`,
+	`a"b`,
+	`"quoted"`,
+	`it's`,
+	`main.t`,
+	`select`,
+	`order by`,
+	`x; DROP TABLE y; --`,
+}
+
+func TestQuoteIdent(t *testing.T) {
+	tests := []struct {
+		name   string
+		quoted string
+		ifNeed string
+	}{
+		{`t`, `"t"`, `t`},
+		{`my table`, `"my table"`, `"my table"`},
+		{`a"b`, `"a""b"`, `"a""b"`},
+		{`"quoted"`, `"""quoted"""`, `"""quoted"""`},
+		{`it's`, `"it's"`, `"it's"`},
+		{`main.t`, `"main.t"`, `"main.t"`},
+		{`1st`, `"1st"`, `"1st"`},
+		{`select`, `"select"`, `"select"`},
+		{`order`, `"order"`, `"order"`},
+		{`Group`, `"Group"`, `"Group"`},
+		{`orders`, `"orders"`, `orders`},
+		{``, `""`, `""`},
+	}
+	for _, tc := range tests {
+		if got := quoteIdent(tc.name); got != tc.quoted {
+			t.Errorf("quoteIdent(%q) = %q, want %q", tc.name, got,
+				tc.quoted)
+		}
+		if got := quoteIdentIfNeeded(tc.name); got != tc.ifNeed {
+			t.Errorf("quoteIdentIfNeeded(%q) = %q, want %q", tc.name,
+				got, tc.ifNeed)
+		}
+		if got := unquoteName(tc.quoted); got != tc.name {
+			t.Errorf("unquoteName(%q) = %q, want %q", tc.quoted, got,
+				tc.name)
+		}
+	}
+}
+
+func TestSplitMetaArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		args []string
+		err  bool
+	}{
+		{`t`, []string{`t`}, false},
+		{`  t   a,b `, []string{`t`, `a,b`}, false},
+		{`"my table" col`, []string{`my table`, `col`}, false},
+		{`'my table'`, []string{`my table`}, false},
+		{`"a""b"`, []string{`a"b`}, false},
+		{`"""quoted"""`, []string{`"quoted"`}, false},
+		{`'it''s'`, []string{`it's`}, false},
+		{`"it's"`, []string{`it's`}, false},
+		{`"main.t"`, []string{`main.t`}, false},
+		{`"select"`, []string{`select`}, false},
+		{"\"order by\"\tx", []string{`order by`, `x`}, false},
+		{`main."my table"`, []string{`main."my table"`}, false},
+		{`"my table`, nil, true},
+		{`'it`, nil, true},
+	}
+	for _, tc := range tests {
+		args, err := splitMetaArgs(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("splitMetaArgs(%q) = %q, want an error",
+					tc.in, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitMetaArgs(%q): %v", tc.in, err)
+			continue
+		}
+		if strings.Join(args, "|") != strings.Join(tc.args, "|") ||
+			len(args) != len(tc.args) {
+
+			t.Errorf("splitMetaArgs(%q) = %q, want %q", tc.in, args,
+				tc.args)
+		}
+	}
+}
+
+func TestUnquoteArg(t *testing.T) {
+	tests := []struct {
+		word, want string
+	}{
+		{`t`, `t`},
+		{`"t"`, `t`},
+		{`'t'`, `t`},
+		{`""`, ``},
+		{`"`, `"`},
+		{`"a""b"`, `a"b`},
+		{`'it''s'`, `it's`},
+		{`"a"b"`, `"a"b"`},
+		{`"a'`, `"a'`},
+		{`"a".b`, `"a".b`},
+	}
+	for _, tc := range tests {
+		if got := unquoteArg(tc.word); got != tc.want {
+			t.Errorf("unquoteArg(%q) = %q, want %q", tc.word, got,
+				tc.want)
+		}
+	}
+}
+
+// openTestDatabase makes a new database file the session database for the
+// length of the test.
+func openTestDatabase(t *testing.T) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	testDB, err := activeDriver.open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConn, err := testDB.Conn(context.Background())
+	if err != nil {
+		testDB.Close()
+		t.Fatal(err)
+	}
+
+	db, conn, dbPath = testDB, testConn, path
+	dbSchema.invalidate()
+	t.Cleanup(func() {
+		testConn.Close()
+		testDB.Close()
+		db, conn, dbPath = nil, nil, ""
+	})
+}
+
+// execTest runs statements on the session connection.
+func execTest(t *testing.T, stmts ...string) {
+	t.Helper()
+
+	for _, stmt := range stmts {
+		_, err := conn.ExecContext(context.Background(), stmt)
+		if err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	dbSchema.invalidate()
+}
+
+// captureStdout returns what f prints.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+
+	f()
+	os.Stdout = stdout
+	w.Close()
+	return <-out
+}
+
+// createHostileTable creates a table named name with two columns named
+// after it, holding a pair of duplicate rows and a row of its own.
+func createHostileTable(t *testing.T, name string) (string, string) {
+	t.Helper()
+
+	colA, colB := name+" a", name+" b"
+	execTest(t,
+		"CREATE TABLE "+quoteIdent(name)+" ("+quoteIdent(colA)+
+			" TEXT, "+quoteIdent(colB)+" TEXT)",
+		"CREATE INDEX "+quoteIdent(name+" idx")+" ON "+
+			quoteIdent(name)+" ("+quoteIdent(colB)+")",
+		"INSERT INTO "+quoteIdent(name)+" VALUES "+
+			"('x', 'it''s'), ('x', 'it''s'), ('y', '\"z\"')",
+	)
+	return colA, colB
+}
+
+func TestHostileNamesDescribe(t *testing.T) {
+	openTestDatabase(t)
+
+	for _, name := range hostileNames {
+		colA, colB := createHostileTable(t, name)
+
+		cols, err := tableInfo(context.Background(), name)
+		if err != nil {
+			t.Errorf("tableInfo(%q): %v", name, err)
+			continue
+		}
+		if len(cols) != 2 || cols[0].name != colA ||
+			cols[1].name != colB {
+
+			t.Errorf("tableInfo(%q) = %v, want columns %q and %q",
+				name, cols, colA, colB)
+		}
+
+		var perr error
+		out := captureStdout(t, func() {
+			perr = printSchemaPretty(name)
+		})
+		if perr != nil {
+			t.Errorf("printSchemaPretty(%q): %v", name, perr)
+			continue
+		}
+		for _, want := range []string{name, colA, colB, name + " idx"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("\\d %q doesn't show %q:\n%s", name, want,
+					out)
+			}
+		}
+
+		doc, err := readSchemaDocument(context.Background(), name)
+		if err != nil {
+			t.Errorf("readSchemaDocument(%q): %v", name, err)
+			continue
+		}
+		if len(doc.Tables) != 1 || doc.Tables[0].Name != name ||
+			len(doc.Tables[0].Columns) != 2 ||
+			len(doc.Tables[0].Indexes) != 1 {
+
+			t.Errorf("\\d --json %q = %+v", name, doc.Tables)
+		}
+	}
+}
+
+func TestHostileNamesDups(t *testing.T) {
+	openTestDatabase(t)
+
+	for _, name := range hostileNames {
+		colA, colB := createHostileTable(t, name)
+
+		for _, requested := range [][]string{nil, {colB, colA}} {
+			cols, err := dupsColumns(name, requested)
+			if err != nil {
+				t.Errorf("dupsColumns(%q, %q): %v", name, requested,
+					err)
+				continue
+			}
+
+			var a, b, rowids string
+			var count int
+			err = conn.QueryRowContext(context.Background(),
+				dupsQuery(name, cols)).Scan(&a, &b, &count, &rowids)
+			if err != nil {
+				t.Errorf("\\dups %q %q: %v", name, requested, err)
+				continue
+			}
+			if count != 2 || rowids != "1, 2" {
+				t.Errorf("\\dups %q %q found %d duplicates, rows %s, "+
+					"want 2, rows 1, 2", name, requested, count, rowids)
+			}
+		}
+	}
+}
+
+func TestHostileNamesDump(t *testing.T) {
+	openTestDatabase(t)
+	for _, name := range hostileNames {
+		createHostileTable(t, name)
+	}
+
+	var dump bytes.Buffer
+	err := dumpDatabase(context.Background(), conn, &dump, dumpOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The dump must recreate every table with its rows.
+	restored, err := activeDriver.open(filepath.Join(t.TempDir(),
+		"restored.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if _, err := restored.Exec(dump.String()); err != nil {
+		t.Fatalf("restoring the dump: %v\n%s", err, dump.String())
+	}
+
+	for _, name := range hostileNames {
+		var n int
+		err := restored.QueryRow("SELECT count(*) FROM " +
+			quoteIdent(name)).Scan(&n)
+		if err != nil {
+			t.Errorf("%q: %v", name, err)
+			continue
+		}
+		if n != 3 {
+			t.Errorf("%q has %d rows after restoring, want 3", name, n)
+		}
+	}
+}
@@ -0,0 +1,684 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// defaultImportBatch is the number of rows committed at a time.
+	defaultImportBatch = 10000
+
+	// importProgressInterval is how often the progress bar is redrawn.
+	importProgressInterval = 200 * time.Millisecond
+
+	// importProgressWidth is the width of the bar itself.
+	importProgressWidth = 24
+)
+
+// importStateTable records how far an import got, committed together with
+// every batch so that an interrupted import can pick up where it stopped.
+const importStateTable = `CREATE TABLE IF NOT EXISTS vsqlite_import_state (
+  source TEXT NOT NULL,
+  target TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  mtime INTEGER NOT NULL,
+  rows INTEGER NOT NULL,
+  PRIMARY KEY (source, target)
+)`
+
+// importConflicts maps the --on-conflict strategies to the INSERT they use.
+var importConflicts = map[string]string{
+	"fail":    "INSERT",
+	"ignore":  "INSERT OR IGNORE",
+	"replace": "INSERT OR REPLACE",
+}
+
+// importOptions are the options of \import and the import command.
+type importOptions struct {
+	batchSize  int
+	onConflict string
+
+	// restart discards the resume point of an earlier import.
+	restart bool
+}
+
+// countingReader counts the bytes read through it, for the progress bar.
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// importReader reads the records of a file to import.
+type importReader interface {
+	// columns returns the columns found in the file.
+	columns() []string
+
+	// next returns the values of the next record for the given columns,
+	// or io.EOF at the end of the file.
+	next(cols []string) ([]interface{}, error)
+}
+
+// csvImportReader reads CSV with a header line. Empty fields are NULL and
+// \x prefixed hex becomes a BLOB, matching what \export csv writes.
+type csvImportReader struct {
+	r      *csv.Reader
+	header []string
+	index  map[string]int
+}
+
+func newCSVImportReader(r io.Reader, comma rune) (*csvImportReader, error) {
+	cr := csv.NewReader(r)
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("empty file, expected a header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &csvImportReader{
+		r:      cr,
+		header: append([]string(nil), header...),
+		index:  make(map[string]int, len(header)),
+	}
+	for i, col := range c.header {
+		c.index[strings.ToLower(col)] = i
+	}
+
+	return c, nil
+}
+
+func (c *csvImportReader) columns() []string {
+	return c.header
+}
+
+func (c *csvImportReader) next(cols []string) ([]interface{}, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		j, ok := c.index[strings.ToLower(col)]
+		if !ok || j >= len(record) || record[j] == "" {
+			continue
+		}
+
+		field := record[j]
+		if strings.HasPrefix(field, `\x`) {
+			if b, err := hex.DecodeString(field[2:]); err == nil {
+				vals[i] = b
+				continue
+			}
+		}
+		vals[i] = field
+	}
+
+	return vals, nil
+}
+
+// jsonImportReader reads a JSON array of objects or NDJSON. The columns are
+// the keys of the first object.
+type jsonImportReader struct {
+	dec   *json.Decoder
+	first map[string]interface{}
+	keys  []string
+}
+
+func newJSONImportReader(r io.Reader) (*jsonImportReader, error) {
+	br := bufio.NewReader(r)
+
+	// Peek at the first token to tell an array from NDJSON.
+	var b byte
+	for {
+		var err error
+		if b, err = br.ReadByte(); err != nil {
+			return nil, fmt.Errorf("no JSON objects found")
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			br.UnreadByte()
+			break
+		}
+	}
+
+	j := &jsonImportReader{dec: json.NewDecoder(br)}
+	j.dec.UseNumber()
+	if b == '[' {
+		if _, err := j.dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	if !j.dec.More() {
+		return nil, fmt.Errorf("no JSON objects found")
+	}
+	if err := j.dec.Decode(&j.first); err != nil {
+		return nil, fmt.Errorf("record 1: %w", err)
+	}
+
+	for key := range j.first {
+		j.keys = append(j.keys, key)
+	}
+	sort.Strings(j.keys)
+
+	return j, nil
+}
+
+func (j *jsonImportReader) columns() []string {
+	return j.keys
+}
+
+func (j *jsonImportReader) next(cols []string) ([]interface{}, error) {
+	obj := j.first
+	j.first = nil
+	if obj == nil {
+		if !j.dec.More() {
+			return nil, io.EOF
+		}
+		if err := j.dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keys are matched without regard to case, like column names.
+	lower := make(map[string]interface{}, len(obj))
+	for key, val := range obj {
+		lower[strings.ToLower(key)] = val
+	}
+
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		val, _, err := jsonToSQL(lower[strings.ToLower(col)])
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", col, err)
+		}
+		vals[i] = val
+	}
+
+	return vals, nil
+}
+
+// newImportReader picks the reader by file extension: .csv, .tsv, or JSON
+// for .json, .ndjson and .jsonl.
+func newImportReader(path string, r io.Reader) (importReader, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return newCSVImportReader(r, ',')
+	case ".tsv":
+		return newCSVImportReader(r, '\t')
+	case ".json", ".ndjson", ".jsonl":
+		return newJSONImportReader(r)
+	default:
+		return nil, fmt.Errorf("unknown file type %q, expected .csv, "+
+			".tsv, .json, .ndjson or .jsonl", filepath.Ext(path))
+	}
+}
+
+// importColumns returns the columns to insert: those of the file, checked
+// against the table if it exists. Otherwise the table is created with the
+// columns of the file.
+func importColumns(ctx context.Context, c *sql.Conn, table string,
+	fileCols []string) ([]string, error) {
+
+	tableCols, err := tableColumns(ctx, c, table)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tableCols) == 0 {
+		defs := make([]string, len(fileCols))
+		for i, col := range fileCols {
+			defs[i] = quoteIdent(col)
+		}
+		_, err := c.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)",
+			quoteIdent(table), strings.Join(defs, ", ")))
+		if err != nil {
+			return nil, err
+		}
+		if !quietMode {
+			fmt.Printf("Created table %s with %d columns\n",
+				quoteIdent(table), len(fileCols))
+		}
+		return fileCols, nil
+	}
+
+	known := make(map[string]string, len(tableCols))
+	for _, col := range tableCols {
+		known[strings.ToLower(col)] = col
+	}
+
+	cols := make([]string, len(fileCols))
+	for i, col := range fileCols {
+		name, ok := known[strings.ToLower(col)]
+		if !ok {
+			return nil, fmt.Errorf("table %s has no column %q",
+				table, col)
+		}
+		cols[i] = name
+	}
+
+	return cols, nil
+}
+
+// importResumePoint returns the number of rows an earlier, interrupted
+// import of the file already committed.
+func importResumePoint(ctx context.Context, c *sql.Conn, source,
+	target string, info os.FileInfo, restart bool) (int64, error) {
+
+	if _, err := c.ExecContext(ctx, importStateTable); err != nil {
+		return 0, err
+	}
+
+	if restart {
+		_, err := c.ExecContext(ctx, `DELETE FROM vsqlite_import_state
+			WHERE source = ? AND target = ?`, source, target)
+		return 0, err
+	}
+
+	var size, mtime, rows int64
+	err := c.QueryRowContext(ctx, `SELECT size, mtime, rows
+		FROM vsqlite_import_state WHERE source = ? AND target = ?`,
+		source, target).Scan(&size, &mtime, &rows)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, nil
+
+	case err != nil:
+		return 0, err
+
+	case size != info.Size() || mtime != info.ModTime().UnixNano():
+		return 0, fmt.Errorf("%s changed since an import of it was "+
+			"interrupted after %d rows, pass --restart to import "+
+			"it from the start", source, rows)
+	}
+
+	return rows, nil
+}
+
+// startImportProgress draws a progress bar on stderr with the share of the
+// file read, the row rate and the time left. The returned function stops
+// it and clears the line.
+func startImportProgress(total int64, read, rows *atomic.Int64) func() {
+	if quietMode || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	start := time.Now()
+	startRows := rows.Load()
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(importProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+
+			n, pos := rows.Load(), read.Load()
+			elapsed := time.Since(start)
+
+			frac := 1.0
+			if total > 0 {
+				frac = min(float64(pos)/float64(total), 1)
+			}
+			filled := int(frac * importProgressWidth)
+			bar := strings.Repeat("█", filled) +
+				strings.Repeat("░", importProgressWidth-filled)
+
+			rate := float64(n-startRows) / elapsed.Seconds()
+			eta := "?"
+			if frac > 0 {
+				left := time.Duration(float64(elapsed) * (1 - frac) /
+					frac)
+				eta = left.Truncate(time.Second).String()
+			}
+
+			fmt.Fprintf(os.Stderr, "\r\033[K%s %3.0f%%  %d rows  "+
+				"%.0f rows/s  ETA %s", bar, frac*100, n, rate, eta)
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// importFile loads a CSV or JSON file into the table in batches, each
+// committed with the resume point, and returns the number of rows
+// inserted. It stops after the current batch when ctx is canceled.
+func importFile(ctx context.Context, c *sql.Conn, path, table string,
+	opts importOptions) (int64, error) {
+
+	insert, ok := importConflicts[opts.onConflict]
+	if !ok {
+		return 0, fmt.Errorf("invalid --on-conflict %q, expected fail, "+
+			"ignore or replace", opts.onConflict)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingReader{r: f}
+	r, err := newImportReader(path, bufio.NewReaderSize(counter, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+
+	// The session context is not the one to cancel the setup with.
+	setup := context.Background()
+	cols, err := importColumns(setup, c, table, r.columns())
+	if err != nil {
+		return 0, err
+	}
+	skip, err := importResumePoint(setup, c, source, table, info,
+		opts.restart)
+	if err != nil {
+		return 0, err
+	}
+	if skip > 0 && !quietMode {
+		fmt.Printf("Resuming after %d rows imported earlier\n", skip)
+	}
+
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+		placeholders[i] = "?"
+	}
+	stmt, err := c.PrepareContext(setup, fmt.Sprintf(
+		"%s INTO %s (%s) VALUES (%s)", insert, quoteIdent(table),
+		strings.Join(quoted, ", "), strings.Join(placeholders, ", "),
+	))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var rows atomic.Int64
+	rows.Store(skip)
+	stop := startImportProgress(info.Size(), &counter.n, &rows)
+	defer stop()
+
+	var (
+		tx       *sql.Tx
+		txStmt   *sql.Stmt
+		inserted int64
+		record   int64
+	)
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// commit records the resume point and commits the batch.
+	commit := func(finished bool) error {
+		var err error
+		if finished {
+			_, err = tx.ExecContext(setup, `DELETE FROM
+				vsqlite_import_state
+				WHERE source = ? AND target = ?`, source, table)
+
+			// Leave no trace once no import is pending.
+			var pending int
+			if err == nil {
+				err = tx.QueryRowContext(setup, `SELECT count(*)
+					FROM vsqlite_import_state`).Scan(&pending)
+			}
+			if err == nil && pending == 0 {
+				_, err = tx.ExecContext(setup,
+					"DROP TABLE vsqlite_import_state")
+			}
+		} else {
+			_, err = tx.ExecContext(setup, `INSERT OR REPLACE INTO
+				vsqlite_import_state VALUES (?, ?, ?, ?, ?)`,
+				source, table, info.Size(),
+				info.ModTime().UnixNano(), record)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		tx = nil
+		return err
+	}
+
+	for {
+		vals, err := r.next(cols)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return inserted, fmt.Errorf("record %d: %w", record+1, err)
+		}
+		record++
+		if record <= skip {
+			continue
+		}
+
+		if tx == nil {
+			if tx, err = c.BeginTx(setup, nil); err != nil {
+				return inserted, err
+			}
+			txStmt = tx.StmtContext(setup, stmt)
+		}
+		res, err := txStmt.ExecContext(setup, vals...)
+		if err != nil {
+			return inserted, fmt.Errorf("record %d: %w", record, err)
+		}
+
+		// Rows skipped by --on-conflict ignore don't count.
+		if n, err := res.RowsAffected(); err == nil {
+			inserted += n
+		}
+		rows.Store(record)
+
+		if (record-skip)%int64(opts.batchSize) != 0 {
+			continue
+		}
+		if err := commit(false); err != nil {
+			return inserted, err
+		}
+		if ctx.Err() != nil {
+			return inserted, fmt.Errorf("interrupted after %d rows, "+
+				"run the import again to resume", record)
+		}
+	}
+
+	if tx == nil {
+		if tx, err = c.BeginTx(setup, nil); err != nil {
+			return inserted, err
+		}
+	}
+	return inserted, commit(true)
+}
+
+// parseImportOptions reads the leading options of \import and returns the
+// remaining arguments.
+func parseImportOptions(args []string) (importOptions, []string, error) {
+	opts := importOptions{
+		batchSize:  defaultImportBatch,
+		onConflict: "fail",
+	}
+
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		switch {
+		case args[0] == "--restart":
+			opts.restart = true
+			args = args[1:]
+			continue
+
+		case len(args) < 2:
+			return opts, nil, fmt.Errorf("%s needs a value", args[0])
+		}
+
+		switch args[0] {
+		case "--batch":
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return opts, nil, fmt.Errorf("invalid --batch %q, "+
+					"expected a positive number", args[1])
+			}
+			opts.batchSize = n
+
+		case "--on-conflict":
+			opts.onConflict = strings.ToLower(args[1])
+
+		default:
+			return opts, nil, fmt.Errorf("unknown option %s", args[0])
+		}
+		args = args[2:]
+	}
+
+	return opts, args, nil
+}
+
+// runImport imports a file on the connection, stopping cleanly on ^C.
+func runImport(c *sql.Conn, path, table string, opts importOptions) error {
+	if table == "" {
+		table = jsonTableName(path)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	start := time.Now()
+	n, err := importFile(ctx, c, path, table, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %d rows into %s in %s\n", n, quoteIdent(table),
+		time.Since(start).Truncate(time.Millisecond))
+	return nil
+}
+
+// handleImportCommand imports a file into a table of the session database.
+func handleImportCommand(args []string) error {
+	opts, args, err := parseImportOptions(args)
+	if err != nil {
+		fmt.Printf("Import error: %v\n", err)
+		return err
+	}
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println("Usage: \\import [--batch N] [--on-conflict " +
+			"fail|ignore|replace] [--restart] <file> [table]")
+		return errUsage
+	}
+
+	table := ""
+	if len(args) == 2 {
+		table = args[1]
+	}
+	if err := runImport(conn, args[0], table, opts); err != nil {
+		fmt.Printf("Import error: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// importFlags are the options of the import subcommand.
+var importFlags struct {
+	batch      int
+	onConflict string
+	restart    bool
+}
+
+// defineImportFlags defines the options of the import subcommand.
+func defineImportFlags(fs *flag.FlagSet) {
+	fs.IntVar(&importFlags.batch, "batch", defaultImportBatch,
+		"rows to commit at a time")
+	fs.StringVar(&importFlags.onConflict, "on-conflict", "fail",
+		"what to do with rows that violate a constraint: fail, ignore "+
+			"or replace")
+	fs.BoolVar(&importFlags.restart, "restart", false, "import from the "+
+		"start, discarding the resume point of an interrupted import")
+}
+
+func runImportCommand(args []string) int {
+	fs := newSubcommandFlags("import")
+	fs.Parse(args)
+
+	if fs.NArg() < 2 || fs.NArg() > 3 || importFlags.batch < 1 {
+		fs.Usage()
+		return 1
+	}
+
+	importDB, err := openDatabase(fs.Arg(0), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import error: %v\n", err)
+		return 1
+	}
+	defer importDB.Close()
+
+	c, err := importDB.Conn(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import error: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	opts := importOptions{
+		batchSize:  importFlags.batch,
+		onConflict: strings.ToLower(importFlags.onConflict),
+		restart:    importFlags.restart,
+	}
+	if err := runImport(c, fs.Arg(1), fs.Arg(2), opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Import error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
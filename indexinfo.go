@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+var (
+	// indexTermSuffixRe matches the COLLATE and ASC or DESC after an
+	// indexed expression.
+	indexTermSuffixRe = regexp.MustCompile(
+		`(?is)(?:\s+COLLATE\s+\S+)?(?:\s+(?:ASC|DESC))?\s*$`,
+	)
+
+	// indexWhereRe matches the WHERE of a partial index.
+	indexWhereRe = regexp.MustCompile(`(?is)^\s*WHERE\s+`)
+)
+
+// indexColumn is a key column of an index as PRAGMA index_xinfo reports it.
+type indexColumn struct {
+	name      string
+	desc      bool
+	collation string
+}
+
+// findIndex looks up an index case-insensitively, in the schema it is
+// qualified with or in temp first, like SQLite.
+func findIndex(ctx context.Context, name string) (schemaObject, error) {
+	objs, err := dbSchema.schemaObjects(ctx, "index")
+	if err != nil {
+		return schemaObject{}, err
+	}
+
+	schema, bare := splitSchemaName(name)
+	for _, temp := range []bool{true, false} {
+		for _, o := range objs {
+			if o.temp == temp && (schema == "" || o.schema() == schema) &&
+				strings.EqualFold(o.name, bare) {
+
+				return o, nil
+			}
+		}
+	}
+
+	// The schema cache leaves out the indexes SQLite creates for UNIQUE
+	// and PRIMARY KEY constraints, which are named sqlite_autoindex_*.
+	for _, s := range []string{"temp", "main"} {
+		if schema != "" && schema != s || s == "temp" && !hasTempSchema() {
+			continue
+		}
+
+		c := metadata()
+		if s == "temp" {
+			c = conn
+		}
+		o := schemaObject{typ: "index", temp: s == "temp"}
+		err := c.QueryRowContext(ctx, `
+			SELECT name, tbl_name FROM `+s+`.sqlite_master
+			WHERE type = 'index' AND name = ? COLLATE NOCASE`, bare).
+			Scan(&o.name, &o.tblName)
+		if err == nil {
+			return o, nil
+		}
+		if err != sql.ErrNoRows {
+			return schemaObject{}, err
+		}
+	}
+
+	return schemaObject{}, fmt.Errorf("no such index: %s", name)
+}
+
+// readIndexColumns returns the key columns of an index in order. The
+// columns index_xinfo adds to point back at the row aren't keys.
+func readIndexColumns(ctx context.Context, c *sql.Conn,
+	idx schemaObject) ([]indexColumn, error) {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT cid, name, "desc", coll
+		FROM pragma_index_xinfo(?, ?)
+		WHERE key
+		ORDER BY seqno`, idx.name, idx.schema())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The SQL of the index tells what its expressions are.
+	var defs []string
+	if idx.sql != "" {
+		defs, _, _ = tableDefinition(idx.sql)
+	}
+
+	var cols []indexColumn
+	for rows.Next() {
+		var cid int
+		var name sql.NullString
+		var col indexColumn
+		err := rows.Scan(&cid, &name, &col.desc, &col.collation)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case name.Valid:
+			col.name = name.String
+		case cid == -2 && len(cols) < len(defs):
+			col.name = indexTermSuffixRe.ReplaceAllString(
+				defs[len(cols)], "",
+			)
+		case cid == -2:
+			col.name = "<expression>"
+		default:
+			col.name = "rowid"
+		}
+		cols = append(cols, col)
+	}
+	return cols, rows.Err()
+}
+
+// readIndexStat returns the sqlite_stat1 numbers of an index: the rows in
+// the index followed by the average number of rows sharing the values of
+// the first one, two and so on columns. It returns nil if the index wasn't
+// analyzed.
+func readIndexStat(ctx context.Context, c *sql.Conn,
+	idx schemaObject) ([]float64, error) {
+
+	var n int
+	err := c.QueryRowContext(ctx, `
+		SELECT count(*) FROM `+idx.schema()+`.sqlite_master
+		WHERE name = 'sqlite_stat1'`).Scan(&n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+
+	var stat string
+	err = c.QueryRowContext(ctx, `
+		SELECT stat FROM `+idx.schema()+`.sqlite_stat1
+		WHERE tbl = ? AND idx = ?`, idx.tblName, idx.name).Scan(&stat)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseStat1(stat), nil
+}
+
+// parseStat1 returns the numbers of a sqlite_stat1 stat column. Options
+// like unordered or sz=N may follow them.
+func parseStat1(stat string) []float64 {
+	var numbers []float64
+	for _, field := range strings.Fields(stat) {
+		f, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			break
+		}
+		numbers = append(numbers, f)
+	}
+	return numbers
+}
+
+// printIndexDetails shows the columns of an index with their sort order
+// and collation, whether it is unique or partial, and how selective its
+// columns are according to sqlite_stat1.
+func printIndexDetails(name string) error {
+	ctx := context.Background()
+	idx, err := findIndex(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// Only the session connection sees the temp schema.
+	c := metadata()
+	if idx.temp {
+		c = conn
+	}
+
+	cols, err := readIndexColumns(ctx, c, idx)
+	if err != nil {
+		return err
+	}
+	stat, err := readIndexStat(ctx, c, idx)
+	if err != nil {
+		return err
+	}
+
+	var unique, partial bool
+	var origin string
+	err = c.QueryRowContext(ctx, `
+		SELECT "unique", partial, origin
+		FROM pragma_index_list(?, ?)
+		WHERE name = ?`, idx.tblName, idx.schema(), idx.name).
+		Scan(&unique, &partial, &origin)
+	if err != nil {
+		return err
+	}
+
+	var props []string
+	if idx.temp {
+		props = append(props, "temp")
+	}
+	if unique {
+		props = append(props, "unique")
+	}
+	if partial {
+		props = append(props, "partial")
+	}
+	switch origin {
+	case "u":
+		props = append(props, "for a UNIQUE constraint")
+	case "pk":
+		props = append(props, "for the PRIMARY KEY")
+	}
+	fmt.Printf("Index \"%s\" on table \"%s\"", idx.name, idx.tblName)
+	if len(props) > 0 {
+		fmt.Printf(" (%s)", strings.Join(props, ", "))
+	}
+	fmt.Println()
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"#", "Column", "Order", "Collation",
+		"Rows per key", "Selectivity"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, Align: text.AlignRight},
+		{Number: 5, Align: text.AlignRight},
+		{Number: 6, Align: text.AlignRight},
+	})
+
+	for i, col := range cols {
+		order := "ASC"
+		if col.desc {
+			order = "DESC"
+		}
+
+		// The estimates are for the first i+1 columns together.
+		var perKey, selectivity string
+		if i+1 < len(stat) && stat[0] > 0 {
+			perKey = strconv.FormatFloat(stat[i+1], 'f', -1, 64)
+			selectivity = fmt.Sprintf("%.4f%%", 100*stat[i+1]/stat[0])
+		}
+		t.AppendRow(table.Row{i + 1, col.name, order, col.collation,
+			perKey, selectivity})
+	}
+	t.Render()
+
+	if partial {
+		_, tail, _ := tableDefinition(idx.sql)
+		fmt.Printf("Where: %s\n",
+			indexWhereRe.ReplaceAllString(strings.TrimSpace(tail), ""))
+	}
+
+	switch {
+	case stat == nil:
+		fmt.Println("Statistics: none, run ANALYZE to estimate " +
+			"selectivity")
+	case len(stat) > 0:
+		fmt.Printf("Statistics: %.0f rows in the index as of the last "+
+			"ANALYZE\n", stat[0])
+	}
+	return nil
+}
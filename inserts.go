@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// singleTableRe picks the table out of simple single-table queries.
+var singleTableRe = regexp.MustCompile(
+	`(?is)\bFROM\s+(?:(?:"[^"]+"|\w+)\.)?("[^"]+"|\w+)\s*` +
+		`(?:$|;|WHERE\b|ORDER\b|LIMIT\b|GROUP\b)`,
+)
+
+// queryTable returns the table a simple single-table query reads from, or
+// "" if it can't tell.
+func queryTable(query string) string {
+	m := singleTableRe.FindStringSubmatch(query)
+	if m == nil {
+		return ""
+	}
+
+	name := m[1]
+	if strings.HasPrefix(name, `"`) {
+		name = strings.ReplaceAll(name[1:len(name)-1], `""`, `"`)
+	}
+
+	return name
+}
+
+// insertsTableName returns the table to use in generated INSERT statements.
+func insertsTableName(query string) string {
+	if insertsTable != "" {
+		return insertsTable
+	}
+
+	if name := queryTable(query); name != "" {
+		return name
+	}
+
+	return "result"
+}
+
+// sqlLiteral renders a value as an SQLite literal that reads back as the
+// same value and storage class.
+func sqlLiteral(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "NULL"
+
+	case int64:
+		return strconv.FormatInt(v, 10)
+
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NULL"
+		case math.IsInf(v, 1):
+			return "1e999"
+		case math.IsInf(v, -1):
+			return "-1e999"
+		}
+
+		// Keep REAL values real even when they are whole numbers.
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+
+	case []byte:
+		return "X'" + strings.ToUpper(hex.EncodeToString(v)) + "'"
+
+	case time.Time:
+		return quoteString(formatTimePadded(v))
+
+	case string:
+		return quoteString(v)
+
+	default:
+		return quoteString(fmt.Sprint(v))
+	}
+}
+
+func printInserts(rows resultRows, tableName string) (int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	return writeInserts(os.Stdout, rows, tableName, displayColumns(cols))
+}
+
+// writeInserts writes the columns idx of the result, or all of them if idx
+// is nil, as INSERT statements into the table.
+func writeInserts(out io.Writer, rows resultRows, tableName string,
+	idx []int) (int, error) {
+
+	return writeInsertsWith(out, rows, tableName, idx, sqlLiteral)
+}
+
+// writeInsertsWith is writeInserts rendering values with literal.
+func writeInsertsWith(out io.Writer, rows resultRows, tableName string,
+	idx []int, literal func(interface{}) string) (int, error) {
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	if idx == nil {
+		idx = allColumns(len(cols))
+	}
+
+	w := bufio.NewWriter(out)
+	quoted := make([]string, len(idx))
+	for j, i := range idx {
+		quoted[j] = quoteIdent(cols[i])
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES (",
+		quoteIdent(tableName), strings.Join(quoted, ", "))
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	n := 0
+	literals := make([]string, len(idx))
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			// Keep the statements written so far.
+			w.Flush()
+			return n, err
+		}
+
+		for j, i := range idx {
+			literals[j] = literal(vals[i])
+		}
+		if _, err := fmt.Fprintf(w, "%s%s);\n", prefix,
+			strings.Join(literals, ", ")); err != nil {
+
+			return n, err
+		}
+		n++
+	}
+
+	if err := rows.Err(); err != nil {
+		w.Flush()
+		return n, err
+	}
+	return n, w.Flush()
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+var (
+	// Patterns to pick the affected object and page out of the free-form
+	// messages returned by PRAGMA integrity_check.
+	integrityTreeRe  = regexp.MustCompile(`(?i)^Tree (\d+) page (\d+)`)
+	integrityPageRe  = regexp.MustCompile(`(?i)\bpage (\d+)`)
+	integrityIndexRe = regexp.MustCompile(`(?i)\bindex (\S+)`)
+	integrityTableRe = regexp.MustCompile(
+		`(?i)(?:NULL value in|constraint failed in) ([^.\s]+)`,
+	)
+)
+
+// integrityProblem is one parsed line of integrity_check output.
+type integrityProblem struct {
+	object string
+	page   string
+	msg    string
+}
+
+// rootPageNames maps b-tree root pages to the table or index they belong
+// to. On a badly damaged database this may fail, in which case we simply
+// report raw page numbers.
+func rootPageNames() map[int]string {
+	names := make(map[int]string)
+
+	rows, err := conn.QueryContext(context.Background(), `
+		SELECT name, rootpage FROM sqlite_master WHERE rootpage > 0
+	`)
+	if err != nil {
+		return names
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var page int
+		if err := rows.Scan(&name, &page); err != nil {
+			break
+		}
+		names[page] = name
+	}
+
+	return names
+}
+
+func parseIntegrityLine(line string, roots map[int]string) integrityProblem {
+	p := integrityProblem{msg: line}
+
+	if m := integrityTreeRe.FindStringSubmatch(line); m != nil {
+		root, _ := strconv.Atoi(m[1])
+		p.object = roots[root]
+		if p.object == "" {
+			p.object = "tree " + m[1]
+		}
+		p.page = m[2]
+
+		return p
+	}
+
+	if m := integrityPageRe.FindStringSubmatch(line); m != nil {
+		p.page = m[1]
+	}
+	if m := integrityIndexRe.FindStringSubmatch(line); m != nil {
+		p.object = m[1]
+	} else if m := integrityTableRe.FindStringSubmatch(line); m != nil {
+		p.object = m[1]
+	}
+
+	return p
+}
+
+func handleIntegrityCommand(quick bool) error {
+	pragma, label := "integrity_check", "Integrity check"
+	if quick {
+		pragma, label = "quick_check", "Quick check"
+	}
+
+	stop := startSpinner(label + " running")
+	rows, err := conn.QueryContext(
+		context.Background(), "PRAGMA "+pragma,
+	)
+	if err != nil {
+		stop()
+		fmt.Printf("%s failed: %v\n", label, err)
+		return err
+	}
+
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			break
+		}
+		lines = append(lines, line)
+	}
+	err = rows.Err()
+	rows.Close()
+	stop()
+
+	if err != nil {
+		fmt.Printf("%s failed: %v\n", label, err)
+		return err
+	}
+
+	if len(lines) == 1 && lines[0] == "ok" {
+		fmt.Printf("%s: ok\n", label)
+		return nil
+	}
+
+	roots := rootPageNames()
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"#", "Object", "Page", "Problem"})
+
+	n := 0
+	var affected []string
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		// Multi-database output is split by schema headers.
+		if strings.HasPrefix(line, "***") {
+			continue
+		}
+
+		n++
+		p := parseIntegrityLine(line, roots)
+		t.AppendRow(table.Row{n, p.object, p.page, p.msg})
+
+		if p.object != "" && !seen[p.object] {
+			seen[p.object] = true
+			affected = append(affected, p.object)
+		}
+	}
+
+	fmt.Printf("%s found %d problem(s):\n", label, n)
+	t.Render()
+
+	if len(affected) > 0 {
+		fmt.Printf("Affected objects: %s\n", strings.Join(affected, ", "))
+	}
+	return fmt.Errorf("%s found %d problem(s)", strings.ToLower(label), n)
+}
+
+func handleFKCheckCommand(tableName string) error {
+	query := "PRAGMA foreign_key_check"
+	var args []interface{}
+	if tableName != "" {
+		query = `SELECT "table", rowid, parent, fkid
+			FROM pragma_foreign_key_check(?)`
+		args = append(args, tableName)
+	}
+
+	rows, err := conn.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("Foreign key check failed: %v\n", err)
+		return err
+	}
+	defer rows.Close()
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Table", "Rowid", "Parent", "FK Id"})
+
+	tables := make(map[string]int)
+	for rows.Next() {
+		var tbl, parent string
+		var rowid *int64
+		var fkid int
+		if err := rows.Scan(&tbl, &rowid, &parent, &fkid); err != nil {
+			fmt.Printf("Foreign key check failed: %v\n", err)
+			return err
+		}
+
+		rowidStr := "NULL"
+		if rowid != nil {
+			rowidStr = strconv.FormatInt(*rowid, 10)
+		}
+		t.AppendRow(table.Row{tbl, rowidStr, parent, fkid})
+		tables[tbl]++
+	}
+	if err := rows.Err(); err != nil {
+		fmt.Printf("Foreign key check failed: %v\n", err)
+		return err
+	}
+
+	if t.Length() == 0 {
+		fmt.Println("Foreign key check: ok")
+		return nil
+	}
+
+	fmt.Printf("Foreign key check found %d violation(s) in %d table(s):\n",
+		t.Length(), len(tables))
+	t.Render()
+	return fmt.Errorf("foreign key check found %d violation(s)", t.Length())
+}
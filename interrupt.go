@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// renderBatch is how many rows or lines are printed between checks for ^C.
+const renderBatch = 500
+
+// outputCtx is canceled by ^C while a result is printed, see
+// watchOutputInterrupt.
+var outputCtx = context.Background()
+
+// watchOutputInterrupt makes ^C stop printing the result instead of being
+// ignored, until the returned function is called.
+func watchOutputInterrupt() func() {
+	restore := enableInterruptKey()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	outputCtx = ctx
+
+	return func() {
+		stop()
+		restore()
+		outputCtx = context.Background()
+	}
+}
+
+// outputInterrupted reports whether ^C was pressed, checking once every
+// renderBatch rows. n is the number of rows handled so far.
+func outputInterrupted(n int) bool {
+	return n%renderBatch == 0 && outputCtx.Err() != nil
+}
+
+func printTruncatedNote() {
+	fmt.Println("... output truncated")
+}
+
+// printRendered prints rendered output a batch of lines at a time, so that
+// ^C stops it. It reports whether all of it was printed.
+func printRendered(out string) bool {
+	lines := strings.SplitAfter(out, "\n")
+	for start := 0; start < len(lines); start += renderBatch {
+		if outputInterrupted(start) {
+			return false
+		}
+
+		end := min(start+renderBatch, len(lines))
+		fmt.Print(strings.Join(lines[start:end], ""))
+	}
+	fmt.Println()
+
+	return true
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// blobFormat selects how BLOBs are written in JSON output.
+type blobFormat int
+
+const (
+	// blobAuto writes printable BLOBs as text and the rest as hex, which
+	// reads well but can't be told apart from text.
+	blobAuto blobFormat = iota
+
+	// blobBase64 writes {"type": "blob", "base64": "..."} objects, so
+	// that BLOBs survive a round trip.
+	blobBase64
+
+	// blobHex writes \x prefixed hex strings.
+	blobHex
+
+	// blobRaw writes the bytes as a string, replacing invalid UTF-8.
+	blobRaw
+)
+
+var blobFormatNames = map[blobFormat]string{
+	blobAuto:   "auto",
+	blobBase64: "base64",
+	blobHex:    "hex",
+	blobRaw:    "raw",
+}
+
+func (f blobFormat) String() string {
+	return blobFormatNames[f]
+}
+
+// jsonBlobFormat is set with --json-blob or \pset blobformat.
+var jsonBlobFormat = blobAuto
+
+func setBlobFormatOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected auto, base64, hex or raw")
+	}
+
+	for f, name := range blobFormatNames {
+		if strings.EqualFold(args[0], name) {
+			jsonBlobFormat = f
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown BLOB format %q, expected auto, base64, "+
+		"hex or raw", args[0])
+}
+
+// columnAffinity is the type affinity SQLite derives from a declared column
+// type.
+type columnAffinity int
+
+const (
+	affinityNone columnAffinity = iota
+	affinityInteger
+	affinityText
+	affinityReal
+	affinityNumeric
+)
+
+// typeAffinity applies SQLite's rules for determining column affinity, in
+// the same order SQLite does.
+func typeAffinity(declType string) columnAffinity {
+	t := strings.ToUpper(declType)
+	switch {
+	case strings.Contains(t, "INT"):
+		return affinityInteger
+
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"),
+		strings.Contains(t, "TEXT"):
+		return affinityText
+
+	case t == "" || strings.Contains(t, "BLOB"):
+		return affinityNone
+
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"),
+		strings.Contains(t, "DOUB"):
+		return affinityReal
+
+	default:
+		return affinityNumeric
+	}
+}
+
+// jsonBlob renders a BLOB as a JSON value.
+func jsonBlob(v []byte) interface{} {
+	switch jsonBlobFormat {
+	case blobBase64:
+		return map[string]string{
+			"type":   "blob",
+			"base64": base64.StdEncoding.EncodeToString(v),
+		}
+
+	case blobHex:
+		return `\x` + hex.EncodeToString(v)
+
+	case blobRaw:
+		return string(v)
+
+	default:
+		if str := string(v); isPrintable(str) {
+			return str
+		}
+		return `\x` + hex.EncodeToString(v)
+	}
+}
+
+// jsonValue converts a scanned value to the JSON value matching the
+// declared type of its column: integers are numbers without a fraction and
+// reals with one, BOOLEAN columns become true and false, and text read back
+// as bytes stays text.
+func jsonValue(val interface{}, declType string) interface{} {
+	isBool := isBooleanType(declType)
+	affinity := typeAffinity(declType)
+
+	switch v := val.(type) {
+	case int64:
+		if isBool && (v == 0 || v == 1) {
+			return v == 1
+		}
+		return v
+
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return nil
+
+		case isBool && (v == 0 || v == 1):
+			return v == 1
+
+		case affinity == affinityInteger && v == math.Trunc(v) &&
+			math.Abs(v) < 1<<63:
+			return int64(v)
+		}
+
+		// Written like SQL literals, REAL values keep their fraction
+		// and infinity becomes 1e999.
+		return json.Number(sqlLiteral(v))
+
+	case []byte:
+		if affinity == affinityText {
+			return string(v)
+		}
+		return jsonBlob(v)
+
+	default:
+		return v
+	}
+}
+
+// printJSON writes the displayed columns of the result as a JSON array of
+// objects.
+func printJSON(rows resultRows, formats columnFormats) (int, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	return writeJSON(os.Stdout, rows, displayColumns(cols), formats)
+}
+
+// writeJSON writes the columns idx of the result, or all of them if idx is
+// nil, as a JSON array of objects. Rows are encoded as they are scanned, so
+// memory use doesn't grow with the result size.
+func writeJSON(out io.Writer, rows resultRows, idx []int,
+	formats columnFormats) (int, error) {
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	types := rows.declTypes()
+
+	vals := make([]interface{}, len(cols))
+	valPtrs := make([]interface{}, len(cols))
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	if idx == nil {
+		idx = allColumns(len(cols))
+	}
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	// The array is closed even if scanning fails half way, so that what
+	// was written is still valid JSON.
+	count := 0
+	w.WriteString("[")
+	defer func() {
+		if count > 0 {
+			w.WriteString("\n")
+		}
+		w.WriteString("]\n")
+	}()
+
+	row := make(map[string]interface{}, len(idx))
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return count, err
+		}
+
+		for _, i := range idx {
+			col := cols[i]
+			if vals[i] != nil && formats.custom(i) {
+				row[col] = formats.format(i, vals[i])
+				continue
+			}
+
+			if b, ok := booleanValue(vals[i]); ok &&
+				formats.boolean(i) {
+
+				row[col] = b
+				continue
+			}
+
+			row[col] = jsonValue(vals[i], types[i])
+		}
+
+		data, err := json.MarshalIndent(row, "  ", "  ")
+		if err != nil {
+			return count, err
+		}
+
+		if count > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n  ")
+		if _, err := w.Write(data); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, rows.Err()
+}
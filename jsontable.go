@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// jsonColumnKind tracks the narrowest SQLite type that can hold every value
+// seen for a column.
+type jsonColumnKind int
+
+const (
+	jsonKindUnknown jsonColumnKind = iota
+	jsonKindInteger
+	jsonKindReal
+	jsonKindText
+)
+
+func (k jsonColumnKind) declType() string {
+	switch k {
+	case jsonKindInteger:
+		return "INTEGER"
+	case jsonKindReal:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// widen returns the kind able to hold values of both k and other.
+func (k jsonColumnKind) widen(other jsonColumnKind) jsonColumnKind {
+	switch {
+	case k == jsonKindUnknown:
+		return other
+	case other == jsonKindUnknown || k == other:
+		return k
+	case k != jsonKindText && other != jsonKindText:
+		return jsonKindReal
+	default:
+		return jsonKindText
+	}
+}
+
+var nonIdentChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// jsonTableName derives a table name from the file name when none is given.
+func jsonTableName(path string) string {
+	base := filepath.Base(path)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	name := strings.Trim(nonIdentChars.ReplaceAllString(base, "_"), "_")
+	if name == "" {
+		return "json_data"
+	}
+	return name
+}
+
+// jsonObjectKeys returns the keys of a JSON object in the order they appear
+// in its text, which decoding into a map loses.
+func jsonObjectKeys(raw []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, err
+	}
+
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		keys = append(keys, key)
+
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// forEachJSONObject calls fn for every object in the file, which may either
+// hold a single JSON array of objects or a stream of newline delimited
+// objects, along with the object's keys in the order they appear.
+func forEachJSONObject(path string,
+	fn func(map[string]interface{}, []string) error) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Anything other than an array is treated as NDJSON, in which case
+	// we need to start over so the first object is decoded as a whole.
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		dec = json.NewDecoder(f)
+		dec.UseNumber()
+	}
+
+	for n := 1; dec.More(); n++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+
+		var obj map[string]interface{}
+		objDec := json.NewDecoder(bytes.NewReader(raw))
+		objDec.UseNumber()
+		if err := objDec.Decode(&obj); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		keys, err := jsonObjectKeys(raw)
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+
+		if err := fn(obj, keys); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// jsonToSQL converts a decoded JSON value to something the driver can bind,
+// along with the column kind it implies. Nested objects and arrays are kept
+// as JSON text so they can be picked apart with the json1 functions.
+func jsonToSQL(v interface{}) (interface{}, jsonColumnKind, error) {
+	switch val := v.(type) {
+	case nil:
+		return nil, jsonKindUnknown, nil
+
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i, jsonKindInteger, nil
+		}
+		f, err := val.Float64()
+		if err != nil {
+			return nil, jsonKindUnknown, err
+		}
+		return f, jsonKindReal, nil
+
+	case bool:
+		if val {
+			return int64(1), jsonKindInteger, nil
+		}
+		return int64(0), jsonKindInteger, nil
+
+	case string:
+		return val, jsonKindText, nil
+
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return nil, jsonKindUnknown, err
+		}
+		return string(b), jsonKindText, nil
+	}
+}
+
+// loadJSONTable loads a JSON array or NDJSON file into a temp table on the
+// session connection. Columns are inferred from the union of all object keys
+// in order of first appearance.
+func loadJSONTable(path, table string) error {
+	if table == "" {
+		table = jsonTableName(path)
+	}
+
+	// First pass: discover the columns and their types.
+	var cols []string
+	kinds := make(map[string]jsonColumnKind)
+	err := forEachJSONObject(path, func(obj map[string]interface{},
+		keys []string) error {
+
+		for _, key := range keys {
+			_, kind, err := jsonToSQL(obj[key])
+			if err != nil {
+				return fmt.Errorf("key %q: %w", key, err)
+			}
+
+			prev, seen := kinds[key]
+			if !seen {
+				cols = append(cols, key)
+			}
+			kinds[key] = prev.widen(kind)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(cols) == 0 {
+		return fmt.Errorf("no JSON objects found in %s", path)
+	}
+
+	colDefs := make([]string, len(cols))
+	quoted := make([]string, len(cols))
+	placeholders := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+		colDefs[i] = quoted[i] + " " + kinds[col].declType()
+		placeholders[i] = "?"
+	}
+
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TEMP TABLE %s (%s)", quoteIdent(table),
+		strings.Join(colDefs, ", "),
+	))
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO temp.%s (%s) VALUES (%s)", quoteIdent(table),
+		strings.Join(quoted, ", "), strings.Join(placeholders, ", "),
+	))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	// Second pass: insert the rows.
+	count := 0
+	args := make([]interface{}, len(cols))
+	err = forEachJSONObject(path, func(obj map[string]interface{},
+		_ []string) error {
+
+		for i, col := range cols {
+			args[i], _, _ = jsonToSQL(obj[col])
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Loaded %d rows into temp table %s (%d columns)\n",
+		count, quoteIdent(table), len(cols))
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// keyAction is something a key can be bound to at the prompt.
+type keyAction struct {
+	desc string
+
+	// fn runs the action on the input buffer. It is nil for execute,
+	// which the prompt only does for Enter.
+	fn func(buf *prompt.Buffer)
+}
+
+// keyActions are the actions keys can be bound to in the config file.
+var keyActions = map[string]keyAction{
+	"history-search": {
+		desc: "pick statements from the history full-screen",
+		fn: func(buf *prompt.Buffer) {
+			var selected []string
+			suspendPrompt(func() {
+				selected = fuzzyHistoryPrompt()
+			})
+			if len(selected) > 0 {
+				replaceBuffer(buf, joinStatements(selected))
+			}
+		},
+	},
+	"history-edit": {
+		desc: "pick statements from the history and edit them in $EDITOR",
+		fn: func(buf *prompt.Buffer) {
+			var (
+				text string
+				err  error
+			)
+			suspendPrompt(func() {
+				selected := fuzzyHistoryPrompt()
+				if len(selected) > 0 {
+					text, err = editText(
+						joinStatements(selected)+"\n",
+						"vsqlite-history-*.sql",
+					)
+				}
+			})
+			if text == "" && err == nil {
+				return
+			}
+			if err != nil {
+				fmt.Printf("Editor error: %v\n", err)
+				return
+			}
+			replaceBuffer(buf, strings.TrimSpace(text))
+		},
+	},
+	"reverse-search": {
+		desc: "search the history incrementally on the input line",
+		fn:   startReverseSearch,
+	},
+	"clear-screen": {
+		desc: "clear the screen",
+		fn: func(*prompt.Buffer) {
+			fmt.Print("\033[2J\033[H")
+		},
+	},
+	"newline": {
+		desc: "insert a line break",
+		fn: func(buf *prompt.Buffer) {
+			buf.InsertText("\n", false, true)
+		},
+	},
+	"execute": {
+		desc: "run the input",
+	},
+	"none": {
+		desc: "do nothing, e.g. to free a key for the terminal",
+		fn:   func(*prompt.Buffer) {},
+	},
+}
+
+// keyBindings maps key names to action names. The config file adds to and
+// overrides the defaults.
+var keyBindings = map[string]string{
+	"ctrl-r": "history-search",
+	"alt-r":  "history-edit",
+}
+
+// replaceBuffer replaces the input with the text, leaving the cursor at its
+// end.
+func replaceBuffer(buf *prompt.Buffer, text string) {
+	d := buf.Document()
+	buf.DeleteBeforeCursor(len([]rune(d.TextBeforeCursor())))
+	buf.Delete(len([]rune(d.TextAfterCursor())))
+	buf.InsertText(text, false, true)
+}
+
+// keySequence returns the bytes a terminal sends for a key name such as
+// ctrl-r, alt-x, enter or alt-enter.
+func keySequence(name string) ([]byte, bool) {
+	name = strings.ToLower(name)
+	switch name {
+	case "enter":
+		return []byte{'\r'}, true
+	case "alt-enter":
+		return []byte{0x1b, '\r'}, true
+	case "tab":
+		return []byte{'\t'}, true
+	}
+
+	prefix, letter, ok := strings.Cut(name, "-")
+	if !ok || len(letter) != 1 || letter[0] < 'a' || letter[0] > 'z' {
+		return nil, false
+	}
+	switch prefix {
+	case "ctrl":
+		return []byte{letter[0] - 'a' + 1}, true
+	case "alt":
+		return []byte{0x1b, letter[0]}, true
+	}
+
+	return nil, false
+}
+
+// setKeyBindings validates the configured bindings and merges them into
+// the defaults.
+func setKeyBindings(bindings map[string]string) error {
+	for key, action := range bindings {
+		if _, ok := keySequence(key); !ok {
+			return fmt.Errorf("unknown key %q in keybindings, expected "+
+				"e.g. ctrl-r, alt-x, enter or alt-enter", key)
+		}
+		if _, ok := keyActions[action]; !ok {
+			names := make([]string, 0, len(keyActions))
+			for name := range keyActions {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			return fmt.Errorf("unknown action %q for %s, expected one "+
+				"of %s", action, key, strings.Join(names, ", "))
+		}
+	}
+
+	for key, action := range bindings {
+		keyBindings[strings.ToLower(key)] = action
+	}
+	return nil
+}
+
+// keymapParser reads the terminal input, replacing the sequences of bound
+// keys. go-prompt handles Enter and its emacs keys before custom bindings,
+// so bound keys are translated to private sequences bound to the actions,
+// or to Enter for execute. Queued notices are shown the same way, as if a
+// key had been pressed, so that the prompt is drawn again below them.
+type keymapParser struct {
+	prompt.ConsoleParser
+	remap map[string][]byte
+
+	// suspended stops reading while another program uses the terminal.
+	// The lock makes sure no read is in progress when it is set, since
+	// reads block once the terminal is handed back.
+	mu        sync.Mutex
+	suspended bool
+}
+
+// promptParser is the parser of the interactive prompt.
+var promptParser *keymapParser
+
+func (p *keymapParser) Read() ([]byte, error) {
+	p.mu.Lock()
+	if p.suspended {
+		p.mu.Unlock()
+		return nil, errPromptSuspended
+	}
+	if len(notices) > 0 {
+		p.mu.Unlock()
+		return actionSequence("notice"), nil
+	}
+	b, err := p.ConsoleParser.Read()
+	p.mu.Unlock()
+
+	if err != nil || len(b) == 0 {
+		return b, err
+	}
+
+	searchKey := string(p.remap[string(b)]) ==
+		string(actionSequence("reverse-search"))
+	if seq, ok := revSearch.feed(b, searchKey); ok {
+		return seq, nil
+	}
+
+	if seq, ok := p.remap[string(b)]; ok {
+		return seq, err
+	}
+	return b, err
+}
+
+// errPromptSuspended is returned by the parser while the prompt is
+// suspended, go-prompt ignores read errors.
+var errPromptSuspended = errors.New("prompt suspended")
+
+// suspendPrompt runs fn with the terminal handed back from the prompt, for
+// full-screen pickers and editors started from key bindings. go-prompt
+// keeps reading the terminal in the background otherwise, stealing their
+// keys.
+func suspendPrompt(fn func()) {
+	if promptParser == nil {
+		fn()
+		return
+	}
+
+	p := promptParser
+	p.mu.Lock()
+	p.suspended = true
+	p.mu.Unlock()
+
+	p.TearDown()
+	defer func() {
+		p.Setup()
+
+		p.mu.Lock()
+		p.suspended = false
+		p.mu.Unlock()
+	}()
+
+	fn()
+}
+
+// actionSequence is the private sequence standing for an action.
+func actionSequence(action string) []byte {
+	return []byte("\x1b[vsqlite:" + action + "~")
+}
+
+// keyBindingOptions returns the prompt options applying the key bindings.
+func keyBindingOptions() []prompt.Option {
+	parser := &keymapParser{
+		ConsoleParser: prompt.NewStandardInputParser(),
+		remap:         make(map[string][]byte),
+	}
+	promptParser = parser
+
+	for key, action := range keyBindings {
+		seq, _ := keySequence(key)
+		if action == "execute" {
+			parser.remap[string(seq)] = []byte{'\r'}
+		} else {
+			parser.remap[string(seq)] = actionSequence(action)
+		}
+	}
+
+	binds := []prompt.ASCIICodeBind{{
+		ASCIICode: actionSequence("search-update"),
+		Fn:        updateReverseSearch,
+	}, {
+		ASCIICode: actionSequence("notice"),
+		Fn:        func(*prompt.Buffer) { printNotices() },
+	}}
+	for name, action := range keyActions {
+		if action.fn != nil {
+			binds = append(binds, prompt.ASCIICodeBind{
+				ASCIICode: actionSequence(name),
+				Fn:        action.fn,
+			})
+		}
+	}
+
+	return []prompt.Option{
+		prompt.OptionParser(parser),
+		prompt.OptionAddASCIICodeBind(binds...),
+	}
+}
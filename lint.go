@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	// lintWideColumns is the number of columns above which SELECT * on a
+	// table is worth a notice.
+	lintWideColumns = 20
+)
+
+// lintEnabled turns on the warnings about suspicious statements printed
+// before they run, see lintChecks.
+var lintEnabled bool
+
+var (
+	// lintStarRe matches * or t.* in a select list.
+	lintStarRe = regexp.MustCompile(`(?i)(?:\bSELECT\s+(?:DISTINCT\s+|` +
+		`ALL\s+)?|,\s*)(?:(` + identPattern + `)\.)?\*`)
+
+	// lintCompareRe matches a column compared to a number.
+	lintCompareRe = regexp.MustCompile(`(?i)(?:(` + identPattern +
+		`)\.)?(` + identPattern + `)\s*(?:==?|<>|!=|<=?|>=?)\s*` +
+		`([-+]?\d+(?:\.\d+)?)\b`)
+
+	// lintLikeRe matches a column compared with LIKE to a string.
+	lintLikeRe = regexp.MustCompile(`(?i)(?:(` + identPattern + `)\.)?(` +
+		identPattern + `)\s+(?:NOT\s+)?LIKE\s+'`)
+
+	// lintJoinRe matches a join, lintJoinEndRe what ends its constraint.
+	lintJoinRe = regexp.MustCompile(`(?i)\b(?:(NATURAL|CROSS)\s+)?` +
+		`(?:(?:LEFT|RIGHT|FULL)\s+)?(?:OUTER\s+|INNER\s+)?JOIN\b\s*(` +
+		identPattern + `)?`)
+	lintJoinEndRe = regexp.MustCompile(`(?i)\b(?:(?:NATURAL|CROSS|LEFT|` +
+		`RIGHT|FULL|INNER)\s+)*(?:OUTER\s+)?JOIN\b|\b(?:WHERE|GROUP|ORDER|` +
+		`LIMIT|HAVING|WINDOW|UNION|INTERSECT|EXCEPT|RETURNING)\b`)
+	lintJoinOnRe = regexp.MustCompile(`(?i)\b(?:ON|USING)\b`)
+)
+
+// lintChecks look for patterns that are legal but usually a mistake or
+// slow. Each returns the notices for a statement, which is passed as typed
+// and with its strings and comments blanked out, see blankLiterals.
+var lintChecks = []func(ctx context.Context, query, stmt string) []string{
+	lintSelectStar,
+	lintTextComparedToNumber,
+	lintLeadingWildcard,
+	lintJoinWithoutOn,
+}
+
+func lintSetting() string {
+	return onOff(lintEnabled)
+}
+
+func setLintOption(args []string) error {
+	on, err := parseOnOff(args)
+	if err != nil {
+		return err
+	}
+	lintEnabled = on
+	return nil
+}
+
+// printNotice prints a notice about the statement about to run on stderr,
+// like psql does with the server's notices, so that it stays out of
+// redirected results.
+func printNotice(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "NOTICE:  "+format+"\n", args...)
+}
+
+// lintStatement prints the notices of the lint checks for a statement. The
+// statement runs regardless.
+func lintStatement(query string) {
+	if !lintEnabled || quietMode {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		completionTimeout)
+	defer cancel()
+
+	stmt := blankLiterals(query)
+	for _, check := range lintChecks {
+		for _, notice := range check(ctx, query, stmt) {
+			printNotice("%s", notice)
+		}
+	}
+}
+
+// blankLiterals replaces the contents of strings and comments with spaces,
+// so that patterns only match the SQL around them. Quotes are kept, as are
+// quoted identifiers.
+func blankLiterals(query string) string {
+	b := []byte(query)
+	for i := 0; i < len(b); i++ {
+		switch {
+		case b[i] == '\'':
+			j := i + 1
+			for ; j < len(b); j++ {
+				if b[j] != '\'' {
+					continue
+				}
+				if j+1 < len(b) && b[j+1] == '\'' {
+					j++
+					continue
+				}
+				break
+			}
+			for k := i + 1; k < j && k < len(b); k++ {
+				b[k] = ' '
+			}
+			i = j
+
+		case b[i] == '"':
+			for i++; i < len(b) && b[i] != '"'; i++ {
+			}
+
+		case b[i] == '-' && i+1 < len(b) && b[i+1] == '-':
+			for ; i < len(b) && b[i] != '\n'; i++ {
+				b[i] = ' '
+			}
+
+		case b[i] == '/' && i+1 < len(b) && b[i+1] == '*':
+			j := strings.Index(string(b[i+2:]), "*/")
+			end := len(b)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			for k := i; k < end; k++ {
+				b[k] = ' '
+			}
+			i = end - 1
+		}
+	}
+	return string(b)
+}
+
+// blankParens replaces what is inside parentheses with spaces, leaving the
+// top level of a statement.
+func blankParens(stmt string) string {
+	b := []byte(stmt)
+	depth := 0
+	for i, c := range b {
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth > 0:
+			b[i] = ' '
+		}
+	}
+	return string(b)
+}
+
+// lintColumn looks up a column of the tables in the statement, in the table
+// the qualifier names if there is one.
+func lintColumn(ctx context.Context, stmt, qualifier,
+	name string) (*schemaTable, *schemaColumn) {
+
+	tables := statementTables(stmt)
+	if qualifier != "" {
+		tables = []string{resolveTableAlias(stmt, unquoteName(qualifier))}
+	}
+
+	name = unquoteName(name)
+	for _, tbl := range tables {
+		t, err := dbSchema.table(ctx, tbl)
+		if err != nil {
+			continue
+		}
+		for i := range t.Columns {
+			if strings.EqualFold(t.Columns[i].Name, name) {
+				return t, &t.Columns[i]
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lintSelectStar warns about SELECT * on tables with many columns, which
+// reads and transfers all of them.
+func lintSelectStar(ctx context.Context, _, stmt string) []string {
+	var notices []string
+	seen := make(map[string]bool)
+	for _, m := range lintStarRe.FindAllStringSubmatch(stmt, -1) {
+		tables := statementTables(stmt)
+		if m[1] != "" {
+			tables = []string{resolveTableAlias(stmt, unquoteName(m[1]))}
+		}
+
+		for _, tbl := range tables {
+			t, err := dbSchema.table(ctx, tbl)
+			if err != nil || len(t.Columns) <= lintWideColumns ||
+				seen[t.Name] {
+
+				continue
+			}
+			seen[t.Name] = true
+			notices = append(notices, fmt.Sprintf("SELECT * reads all "+
+				"%d columns of %s, list the ones you need",
+				len(t.Columns), quoteIdentIfNeeded(t.Name)))
+		}
+	}
+	return notices
+}
+
+// lintTextComparedToNumber warns about TEXT columns compared to numbers.
+// The number is compared as text, so that '10' < '9' and '1.0' <> '1'.
+func lintTextComparedToNumber(ctx context.Context, _,
+	stmt string) []string {
+
+	var notices []string
+	for _, m := range lintCompareRe.FindAllStringSubmatch(stmt, -1) {
+		t, col := lintColumn(ctx, stmt, m[1], m[2])
+		if col == nil || typeAffinity(col.Type) != affinityText {
+			continue
+		}
+		notices = append(notices, fmt.Sprintf("%s.%s is %s and compared "+
+			"to the number %s, which is compared as text",
+			quoteIdentIfNeeded(t.Name), quoteIdentIfNeeded(col.Name),
+			col.Type, m[3]))
+	}
+	return notices
+}
+
+// lintLeadingWildcard warns about LIKE patterns starting with a wildcard
+// on indexed columns, which can't use the index.
+func lintLeadingWildcard(ctx context.Context, query,
+	stmt string) []string {
+
+	var notices []string
+	for _, loc := range lintLikeRe.FindAllStringSubmatchIndex(stmt, -1) {
+		if loc[1] >= len(query) ||
+			!strings.ContainsAny(query[loc[1]:loc[1]+1], "%_") {
+
+			continue
+		}
+
+		var qualifier string
+		if loc[2] >= 0 {
+			qualifier = stmt[loc[2]:loc[3]]
+		}
+		t, col := lintColumn(ctx, stmt, qualifier, stmt[loc[4]:loc[5]])
+		if col == nil {
+			continue
+		}
+		for _, idx := range t.Indexes {
+			if len(idx.Columns) == 0 ||
+				!strings.EqualFold(idx.Columns[0], col.Name) {
+
+				continue
+			}
+			notices = append(notices, fmt.Sprintf("LIKE with a leading "+
+				"wildcard on %s.%s can't use index %s and scans the "+
+				"table", quoteIdentIfNeeded(t.Name),
+				quoteIdentIfNeeded(col.Name), quoteIdentIfNeeded(idx.Name)))
+			break
+		}
+	}
+	return notices
+}
+
+// lintJoinWithoutOn warns about joins without ON or USING, which pair every
+// row with every row of the other side. CROSS and NATURAL joins are meant
+// that way. Joins in subqueries aren't checked.
+func lintJoinWithoutOn(_ context.Context, _, stmt string) []string {
+	stmt = blankParens(stmt)
+
+	var notices []string
+	for _, loc := range lintJoinRe.FindAllStringSubmatchIndex(stmt, -1) {
+		if loc[2] >= 0 {
+			continue
+		}
+
+		constraint := stmt[loc[1]:]
+		if end := lintJoinEndRe.FindStringIndex(constraint); end != nil {
+			constraint = constraint[:end[0]]
+		}
+		if lintJoinOnRe.MatchString(constraint) {
+			continue
+		}
+
+		name := "a subquery"
+		if loc[4] >= 0 {
+			name = stmt[loc[4]:loc[5]]
+		}
+		notices = append(notices, fmt.Sprintf("the join of %s has no ON "+
+			"or USING condition, every row is paired with every row of "+
+			"the other side, use CROSS JOIN if that is intended", name))
+	}
+	return notices
+}
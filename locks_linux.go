@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockHolders lists the other processes holding POSIX locks on the database
+// or its journal files, as reported by /proc/locks.
+func lockHolders(path string) []string {
+	type fileID struct {
+		dev   string
+		inode uint64
+	}
+
+	ids := make(map[fileID]bool)
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		var st unix.Stat_t
+		if err := unix.Stat(path+suffix, &st); err != nil {
+			continue
+		}
+
+		dev := fmt.Sprintf("%02x:%02x", unix.Major(uint64(st.Dev)),
+			unix.Minor(uint64(st.Dev)))
+		ids[fileID{dev, st.Ino}] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	f, err := os.Open("/proc/locks")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	seen := make(map[int]bool)
+	var holders []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 1: POSIX  ADVISORY  WRITE 1234 08:01:56789 0 EOF
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || fields[1] == "->" {
+			continue
+		}
+
+		pid, err := strconv.Atoi(fields[4])
+		if err != nil || pid == os.Getpid() || seen[pid] {
+			continue
+		}
+
+		id := strings.Split(fields[5], ":")
+		if len(id) != 3 {
+			continue
+		}
+		inode, err := strconv.ParseUint(id[2], 10, 64)
+		if err != nil || !ids[fileID{id[0] + ":" + id[1], inode}] {
+			continue
+		}
+
+		seen[pid] = true
+		comm, _ := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		holders = append(holders, fmt.Sprintf("pid %d (%s, %s)", pid,
+			strings.TrimSpace(string(comm)), fields[3]))
+	}
+
+	return holders
+}
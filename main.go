@@ -2,13 +2,15 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"os"
-	"os/user"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -20,7 +22,7 @@ import (
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/ktr0731/go-fuzzyfinder"
-	_ "modernc.org/sqlite"
+	"golang.org/x/term"
 )
 
 const (
@@ -62,63 +64,326 @@ var psqlStyle = table.Style{
 }
 
 var (
-	db           *sql.DB
+	db     *sql.DB
+	dbPath string
+
+	// conn is the connection pinned for the interactive session. User
+	// statements always run on it so that temp tables, transactions and
+	// per-connection pragmas behave as expected.
+	conn *sql.Conn
+
+	// lastQuery is the last read-only statement, which commands like
+	// \browse re-run when no query is given, and lastQueryArgs the
+	// values bound to its parameters.
+	lastQuery     string
+	lastQueryArgs []interface{}
+
 	expandedMode bool
-	jsonMode     bool
+
+	// expandedAuto switches to expanded display for results that are too
+	// wide for the terminal.
+	expandedAuto bool
+
+	// quietMode suppresses the banner and informational notices.
+	quietMode bool
+
+	// batchMode is set when the statements come from -c, -f or a pipe
+	// instead of the prompt.
+	batchMode bool
+
+	// lastError is the error of the last SQL statement or meta-command, if
+	// it failed.
+	lastError error
+
+	// lastArgs are the values bound to the parameters of the last SQL
+	// statement, see workloadRecorder.
+	lastArgs []interface{}
+
+	// exitRequested is set by exit, which ends the session once the
+	// input being run returns, so that it is closed down as at the end
+	// of the input.
+	exitRequested bool
+
 	historyFile  string
 	historyLines []string
+
+	// historySaved is the number of historyLines already in the file,
+	// so that switching databases doesn't write them twice.
+	historySaved int
 )
 
+// stringList is a flag that may be given multiple times.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, "; ")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// parseArgs parses the command line, allowing flags both before and after
+// the database file, and returns the positional arguments.
+func parseArgs() []string {
+	flag.Parse()
+
+	var positional []string
+	for args := flag.Args(); len(args) > 0; args = flag.Args() {
+		positional = append(positional, args[0])
+		flag.CommandLine.Parse(args[1:])
+	}
+
+	return positional
+}
+
+// cliOptions holds the command line options that only matter at startup.
+// The others set their globals directly.
+type cliOptions struct {
+	logFile     *string
+	commands    stringList
+	scriptFile  *string
+	driverName  *string
+	format      *string
+	jsonBlob    *string
+	initFile    *string
+	rqliteURL   *string
+	showVersion *bool
+}
+
+// defineFlags defines the command line options on the flag set.
+func defineFlags(fs *flag.FlagSet) *cliOptions {
+	opts := &cliOptions{}
+
+	opts.logFile = fs.String(
+		"log-file", "", "append executed statements to this JSONL file",
+	)
+	fs.BoolVar(&quietMode, "q", false,
+		"quiet, don't print the banner and notices")
+	fs.BoolVar(&tuplesOnly, "t", false,
+		"print rows only, without headers, footers or decorations")
+
+	fs.Var(&opts.commands, "c",
+		"run the command and exit, may be given multiple times")
+
+	opts.scriptFile = fs.String(
+		"f", "", "run the statements in the file (- for stdin) and exit",
+	)
+	fs.BoolVar(&echoQueries, "echo-queries", false,
+		"print each statement of a script before its results")
+	fs.BoolVar(&echoErrors, "echo-errors", false,
+		"print the statements of a script that fail")
+	fs.BoolVar(&readOnly, "readonly", false,
+		"open the database read-only")
+	opts.driverName = fs.String("driver", "", "SQLite driver to use: "+
+		strings.Join(driverNames(), ", "))
+	fs.IntVar(&busyTimeout, "busy-timeout", busyTimeout,
+		"milliseconds to wait for locks held by other connections")
+	fs.IntVar(&busyRetries, "busy-retries", busyRetries,
+		"times to retry a statement that failed on a lock")
+	opts.format = fs.String("format", "",
+		"output format: aligned, json or inserts")
+	opts.jsonBlob = fs.String("json-blob", "",
+		"BLOB encoding in JSON output: auto, base64, hex or raw")
+	opts.initFile = fs.String("init", "",
+		"run the statements in the file at startup")
+	opts.rqliteURL = fs.String("rqlite", "",
+		"connect to the rqlite node at this URL, e.g. http://host:4001")
+	opts.showVersion = fs.Bool("version", false,
+		"print the version and exit")
+
+	return opts
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: sqlite-client <database-file>")
-		os.Exit(1)
+	os.Exit(run())
+}
+
+func run() int {
+	migrateLegacyFiles()
+
+	// Load the config before parsing the command line so that options
+	// given there take precedence. Subcommands use it too, dump applies
+	// the masking rules for one.
+	if err := loadConfig(getConfigFilePath()); err != nil {
+		fmt.Printf("Failed to load config: %v\n", err)
+	}
+
+	if status, ok := runSubcommand(os.Args[1:]); ok {
+		return status
+	}
+
+	opts := defineFlags(flag.CommandLine)
+
+	flag.Usage = printUsage
+	args := parseArgs()
+
+	if *opts.showVersion {
+		fmt.Printf("vsqlite %s\n", versionString())
+		return 0
 	}
-	dbPath := os.Args[1]
+
+	if *opts.driverName != "" {
+		if err := selectDriver(*opts.driverName); err != nil {
+			fmt.Printf("Invalid --driver: %v\n", err)
+			return 1
+		}
+	}
+
+	if *opts.format != "" {
+		if err := setFormatOption([]string{*opts.format}); err != nil {
+			fmt.Printf("Invalid --format: %v\n", err)
+			return 1
+		}
+	}
+
+	if *opts.rqliteURL != "" {
+		name, err := rqliteDatabaseName(*opts.rqliteURL)
+		if err != nil {
+			fmt.Printf("Invalid --rqlite: %v\n", err)
+			return 1
+		}
+		args = append([]string{name}, args...)
+	}
+
+	if *opts.jsonBlob != "" {
+		if err := setBlobFormatOption([]string{*opts.jsonBlob}); err != nil {
+			fmt.Printf("Invalid --json-blob: %v\n", err)
+			return 1
+		}
+	}
+
+	// Offer the recently opened databases when started bare in a
+	// terminal.
+	interactive := len(opts.commands) == 0 && *opts.scriptFile == "" &&
+		term.IsTerminal(int(os.Stdin.Fd()))
+	batchMode = !interactive
+	if len(args) == 0 && interactive {
+		if path, ok := pickRecentDatabase(); ok {
+			args = []string{path}
+		}
+	}
+
+	if len(args) != 1 {
+		flag.Usage()
+		return 1
+	}
+	dbPath = args[0]
 
 	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	defer removeSSHSnapshots()
+
+	db, err = openDatabase(dbPath, readOnly)
 	if err != nil {
 		fmt.Printf("Failed to open database: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
-	defer db.Close()
+	defer func() {
+		db.Close()
+	}()
 
-	historyFile = getHistoryFilePath()
-	loadHistory()
+	conn, err = db.Conn(context.Background())
+	if err != nil {
+		fmt.Printf("Failed to open database: %v\n", err)
+		return 1
+	}
+	openMetaConn(context.Background())
+
+	// Close whichever database is open at exit, \open may switch it.
+	defer func() {
+		finishUndo()
+		closeMetaConn()
+		stopSession()
+		releaseSnapshot()
+		restoreTriggers()
+		conn.Close()
+	}()
+
+	refreshFKState()
+	recoverTriggers()
+	recordRecentDatabase(dbPath)
+	if interactive {
+		checkWALFiles()
+	}
 
-	fmt.Println(
-		`Enter SQL statements. Built-in commands:
-		    \x         → toggle expanded display
-		    \j         → toggle JSON output
-		    \d [table] → show table schema
-		    \d         → list all tables/views
-		    \di        → list all indexes
-		    CTRL+D     → quit`,
-	)
+	if *opts.logFile != "" {
+		if err := enableQueryLog(*opts.logFile); err != nil {
+			fmt.Printf("Failed to open query log: %v\n", err)
+			return 1
+		}
+		defer disableQueryLog()
+	}
 
-	p := prompt.New(
-		executor,
-		completer,
+	if *opts.initFile != "" {
+		runScriptFile(*opts.initFile)
+	}
+
+	// Commands given on the command line run without touching the
+	// history, and the first failing one sets the exit status.
+	if len(opts.commands) > 0 {
+		for _, command := range opts.commands {
+			executor(command)
+			if lastError != nil {
+				return 1
+			}
+			if exitRequested {
+				break
+			}
+		}
+		return 0
+	}
+
+	// Without a terminal, read the statements from stdin.
+	if *opts.scriptFile == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		*opts.scriptFile = "-"
+	}
+	if *opts.scriptFile != "" {
+		return runScriptFile(*opts.scriptFile)
+	}
+
+	loadDatabaseHistory(dbPath)
+
+	// Output going to a pipe or a file starts with the results only.
+	if !quietMode && term.IsTerminal(int(os.Stdout.Fd())) {
+		printBanner()
+	}
+	options := []prompt.Option{
 		prompt.OptionPrefix("sqlite> "),
+		prompt.OptionLivePrefix(promptPrefix),
 		prompt.OptionTitle("sqlite-client"),
-		prompt.OptionAddKeyBind(prompt.KeyBind{
-			Key: prompt.ControlR,
-			Fn: func(buf *prompt.Buffer) {
-				selected := fuzzyHistoryPrompt()
-				if selected != "" {
-					buf.DeleteBeforeCursor(
-						len(buf.Document().
-							TextBeforeCursor()),
-					)
-					buf.InsertText(selected, false, false)
-				}
+		prompt.OptionSetExitCheckerOnInput(
+			func(_ string, breakline bool) bool {
+				return breakline && exitRequested
 			},
-		}),
+		),
+	}
+	p := prompt.New(
+		promptExecutor,
+		completer,
+		append(options, keyBindingOptions()...)...,
 	)
 
 	p.Run()
 	saveHistory()
+
+	return 0
+}
+
+// printBanner greets an interactive session, with the configured greeting
+// if there is one.
+func printBanner() {
+	switch greeting {
+	case "":
+		fmt.Println(`Enter SQL statements, terminated with a semicolon.
+Type \? for the built-in commands, \h for help on SQL statements and
+CTRL+D to quit.`)
+
+	case "none":
+
+	default:
+		fmt.Println(expandGreeting(greeting))
+	}
 }
 
 func onOff(b bool) string {
@@ -136,101 +401,190 @@ func executor(input string) {
 	}
 
 	saveToHistory(query)
+	lastError, lastArgs = nil, nil
+
+	// Any input may change the schema, or switch to another database.
+	defer dbSchema.invalidate()
+
+	// Statements and commands may toggle foreign key enforcement, so keep
+	// the prompt in sync.
+	defer refreshFKState()
 
 	switch {
 	case query == "exit":
-		os.Exit(0)
-
-	case query == `\x`:
-		expandedMode = !expandedMode
-		if expandedMode {
-			jsonMode = false
-		}
-		fmt.Printf("Expanded display is now %s\n", onOff(expandedMode))
+		exitRequested = true
+		return
 
+	case isMetaCommand(query):
+		lastError = runMetaCommand(query)
 		return
+	}
 
-	case query == `\j`:
-		jsonMode = !jsonMode
-		if jsonMode {
-			expandedMode = false
-		}
-		fmt.Printf("JSON output is now %s\n", onOff(jsonMode))
+	warnUnenforcedFKs(query)
+	lintStatement(query)
 
-		return
+	if isReadQuery(query) {
+		lastQuery = query
+	}
 
-	case strings.HasPrefix(query, `\d `):
-		table := strings.TrimSuffix(
-			strings.TrimPrefix(query, `\d `), ";",
-		)
+	start := time.Now()
 
-		if table == "" {
-			fmt.Println("Usage: \\d <table>")
-			return
-		}
+	undo, undoing := beginUndo(query)
 
-		if err := printSchemaPretty(table); err != nil {
-			fmt.Printf("Schema error: %v\n", err)
-		}
+	var changesBefore int64
+	if queryLog != nil || undoing {
+		changesBefore = totalChanges()
+	}
 
-		return
+	if timingEnabled {
+		beginStmtStats(query)
+	}
 
-	case strings.TrimSpace(query) == `\d` || strings.TrimSpace(query) == `\d;`:
-		if err := printRelationList(); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
+	n, err := runQuery(query)
+	lastError = err
+	if isReadQuery(query) {
+		lastQueryArgs = lastArgs
+	}
 
-		return
+	var affected int64
+	if err == nil && (queryLog != nil || undoing) {
+		affected = changesSince(changesBefore)
+	}
+	if undoing {
+		endUndo(undo, affected, err)
+	}
+	syncUndoStack()
 
-	case strings.TrimSpace(query) == `\di` || strings.TrimSpace(query) == `\di;`:
-		if err := printIndexList(); err != nil {
-			fmt.Printf("Error: %v\n", err)
-		}
+	if timingEnabled {
+		stats, ok := endStmtStats()
+		printTiming(time.Since(start), stats, ok)
+	}
 
-		return
+	if err == nil {
+		recordSlowQuery(query, time.Since(start))
+	}
 
-	case strings.HasPrefix(query, ".schema"):
-		handleSchemaCommand(query)
-		return
+	if queryLog != nil {
+		queryLog.record(query, start, n, affected, err)
 	}
+	if workload != nil {
+		workload.record(query, lastArgs, start, n, err)
+	}
+}
 
-	rows, err := db.Query(query)
+// runQuery executes the query on the session connection and prints the
+// result in the current output mode. It returns the number of rows printed.
+func runQuery(query string) (int, error) {
+	n, err := printQuery(query)
+	if err != nil {
+		recordFailure(query, err)
+		explainLockError(err)
+	}
+	return n, err
+}
+
+// printQuery runs the query and prints its result in the current format.
+func printQuery(query string) (int, error) {
+	args, ok, err := statementArgs(query)
+	if err != nil {
+		fmt.Printf("Bind error: %v\n", err)
+		return 0, err
+	}
+	if !ok {
+		fmt.Println("Cancelled.")
+		return 0, nil
+	}
+	lastArgs = args
+
+	n, err := retryBusy(func() (int, bool, error) {
+		return runStatement(query, args)
+	})
 	if err != nil {
 		fmt.Printf("Query failed: %v\n", err)
-		return
+	}
+	return n, err
+}
+
+// runStatement runs the query with its arguments bound and prints the
+// result. It returns the number of rows printed, and whether any output
+// was written.
+func runStatement(query string, args []interface{}) (int, bool, error) {
+	ctx := context.Background()
+	wrapped, declTypes := bigCellQuery(ctx, query, args)
+	rows, err := conn.QueryContext(ctx, wrapped, args...)
+	if err != nil {
+		return 0, false, err
 	}
 	defer rows.Close()
 
-	if expandedMode {
-		hasRows, err := printExpanded(rows)
-		if err != nil {
-			fmt.Printf("Error printing expanded: %v\n", err)
-			return
-		}
+	if cols, err := rows.Columns(); err == nil && len(cols) > 0 {
+		lastColumns = cols
+	}
+
+	// Some drivers only run the statement on the first call to Next, so
+	// fetch the first row before printing, which a JSON result starts
+	// right away. Later errors come from the printers.
+	live := newLiveRows(rows, query)
+	if declTypes != nil {
+		live.setDeclTypes(declTypes)
+	}
+	if err := live.fetchFirst(); err != nil {
+		return 0, false, err
+	}
+	limited, ok := limitRows(live, query)
+	if !ok {
+		return 0, true, live.Err()
+	}
+	n, err := printRows(limited, query)
+	if err != nil {
+		return n, true, err
+	}
+	printLimitNote(limited)
+
+	if set, ok := live.result(); ok {
+		set.args = args
+		set.bigCells = declTypes != nil && hasBigCells(set)
+		cacheResult(set)
+	}
+	return n, true, nil
+}
+
+// printRows prints a result in the current format. ^C stops the output of
+// the table, expanded and tuples formats.
+func printRows(rows resultRows, query string) (int, error) {
+	defer watchOutputInterrupt()()
 
-		if !hasRows {
+	formats := resultFormats(rows, query)
+	defer formats.close()
+
+	if expandedMode {
+		n, err := printExpanded(rows, formats)
+		if err == nil && n == 0 && !quietMode && !tuplesOnly {
 			fmt.Println("No rows found.")
 		}
-	} else if jsonMode {
-		if err := printJSON(rows); err != nil {
-			fmt.Printf("JSON output error: %v\n", err)
-		}
-		return
-	} else {
-		err := printPrettyTable(rows)
-		if err != nil {
-			fmt.Printf("Error printing table: %v\n", err)
-			return
-		}
+		return n, err
+	}
+
+	switch {
+	case outputFormat == formatJSON:
+		return printJSON(rows, formats)
+
+	case outputFormat == formatInserts:
+		return printInserts(rows, insertsTableName(query))
+
+	case tuplesOnly:
+		return printTuples(rows, formats)
+
+	default:
+		return printPrettyTable(rows, formats)
 	}
 }
 
 func completer(d prompt.Document) []prompt.Suggest {
 	suggestTables := func(prefixIdx int) func([]string) []prompt.Suggest {
 		return func(m []string) []prompt.Suggest {
-			return prompt.FilterHasPrefix(
-				getTableSuggestions(), m[prefixIdx], true,
-			)
+			return suggestIdents(getTableSuggestions(), m[prefixIdx],
+				d.GetWordBeforeCursor())
 		}
 	}
 
@@ -238,11 +592,32 @@ func completer(d prompt.Document) []prompt.Suggest {
 		colPrefixIdx int) func([]string) []prompt.Suggest {
 
 		return func(m []string) []prompt.Suggest {
-			return prompt.FilterHasPrefix(
-				getColumnSuggestions(m[tableIdx]),
-				m[colPrefixIdx], true,
-			)
+			table := resolveTableAlias(currentStatement(d),
+				unquoteName(m[tableIdx]))
+			return suggestIdents(getColumnSuggestions(table),
+				m[colPrefixIdx], d.GetWordBeforeCursor())
+		}
+	}
 
+	// The columns of the tables the statement uses, for the clauses
+	// naming columns. A column in more than one of them is offered once.
+	suggestScopeColumns := func(prefixIdx int) func([]string) []prompt.Suggest {
+		return func(m []string) []prompt.Suggest {
+			var cols []prompt.Suggest
+			seen := make(map[string]bool)
+			for _, table := range statementTables(currentStatement(d)) {
+				for _, col := range getColumnSuggestions(table) {
+					if seen[strings.ToLower(col.Text)] {
+						continue
+					}
+					seen[strings.ToLower(col.Text)] = true
+					cols = append(cols, prompt.Suggest{
+						Text: col.Text, Description: table,
+					})
+				}
+			}
+			return suggestIdents(cols, m[prefixIdx],
+				d.GetWordBeforeCursor())
 		}
 	}
 
@@ -252,50 +627,86 @@ func completer(d prompt.Document) []prompt.Suggest {
 	}
 
 	rules := []rule{
+		// Commands taking a file or directory.
+		{
+			regexp.MustCompile(`^\\(?:open|g|jsontable|recover|` +
+				`log\s+on|schema\s+(?:snapshot|diff|export)|` +
+				`export\s+\S+|migrate(?:\s+--dry-run)?|` +
+				`import(?:\s+--\S+(?:\s+[^-\s]\S*)?)*)\s+(\S*)$`),
+			func(m []string) []prompt.Suggest {
+				return pathSuggestions(m[1], d.GetWordBeforeCursor())
+			},
+		},
+
+		// ATTACH [DATABASE] '<path>'
+		{
+			regexp.MustCompile(`(?i)\bATTACH\s+(?:DATABASE\s+)?'([^']*)$`),
+			func(m []string) []prompt.Suggest {
+				return pathSuggestions(m[1], d.GetWordBeforeCursor())
+			},
+		},
+
 		// .schema [table]
 		{
-			regexp.MustCompile(`(?i)^\.schema\s+(\w*)$`),
+			regexp.MustCompile(`(?i)^\.schema\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 		// \d [table]
 		{
-			regexp.MustCompile(`(?i)^\\d\s+(\w+)$`),
+			regexp.MustCompile(`(?i)^\\d\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 		// table.column
 		{
-			regexp.MustCompile(`(?i)(\w+)\.(\w*)$`),
+			regexp.MustCompile(`(?i)(` + identPattern + `)\.` +
+				partialIdentPattern + `$`),
 			suggestColumns(1, 2),
 		},
 
 		// SELECT ... FROM <table>
 		{
-			regexp.MustCompile(`(?i)\bSELECT\b.*\bFROM\s+(\w*)$`),
+			regexp.MustCompile(`(?i)\bSELECT\b.*\bFROM\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 
 		// INSERT INTO <table>
 		{
-			regexp.MustCompile(`(?i)\bINSERT\s+INTO\s+(\w*)$`),
+			regexp.MustCompile(`(?i)\bINSERT\s+INTO\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 
 		// UPDATE <table> SET ...
 		{
-
-			regexp.MustCompile(`(?i)^UPDATE(?:\s+OR\s+(?:ROLLBACK|ABORT|REPLACE|FAIL|IGNORE))?\s+(\w+)\s+SET\s+(?:[^=]+=\s*[^,]+,\s*)*(\w*)$`),
+			regexp.MustCompile(`(?i)^UPDATE(?:\s+OR\s+` +
+				`(?:ROLLBACK|ABORT|REPLACE|FAIL|IGNORE))?\s+(` +
+				identPattern + `)\s+SET\s+(?:[^=]+=\s*[^,]+,\s*)*` +
+				partialIdentPattern + `$`),
 			suggestColumns(1, 2),
 		},
 
 		// UPDATE <table>
 		{
-			regexp.MustCompile(`(?i)\bUPDATE\s+(\w*)$`),
+			regexp.MustCompile(`(?i)\bUPDATE\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 
+		// WHERE, AND, OR, ON, HAVING, ORDER BY and GROUP BY <column>
+		{
+			regexp.MustCompile(`(?i)\b(?:(?:WHERE|AND|OR|ON|HAVING)\s+|` +
+				`(?:ORDER|GROUP)\s+BY\s+(?:[^;]*,\s*)?)` +
+				partialIdentPattern + `$`),
+			suggestScopeColumns(1),
+		},
+
 		// FROM or JOIN <table>
 		{
-			regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+(\w*)$`),
+			regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+` +
+				partialIdentPattern + `$`),
 			suggestTables(1),
 		},
 	}
@@ -310,88 +721,272 @@ func completer(d prompt.Document) []prompt.Suggest {
 	return nil
 }
 
-func handleSchemaCommand(query string) {
-	args := strings.Fields(query)
-	if len(args) == 1 {
-		rows, err := db.Query(`SELECT sql FROM sqlite_master
-			               WHERE type='table'`)
+// handleSchemaCommand prints the CREATE statements of the tables, indexes,
+// views and triggers, or of one table or those matching a pattern, in the
+// order they can be run. They are re-indented and highlighted unless --raw
+// asks for them as stored.
+func handleSchemaCommand(args []string) error {
+	raw := false
+	var name string
+	for _, arg := range args {
+		if arg == "--raw" {
+			raw = true
+			continue
+		}
+		name = arg
+	}
+
+	ctx := context.Background()
+	objs, err := dbSchema.schemaObjects(ctx)
+	if err != nil {
+		fmt.Println("Schema query failed:", err)
+		return err
+	}
+
+	// A table comes with its indexes and triggers, a pattern matches the
+	// tables they are on.
+	var re *regexp.Regexp
+	if isNamePattern(name) {
+		re = namePatternRegexp(name)
+	}
+	var b strings.Builder
+	for _, o := range objs {
+		switch {
+		case o.typ == "table" && isShadowTable(o.name, objs):
+			continue
+		case re != nil && !re.MatchString(o.tblName):
+			continue
+		case re == nil && name != "" &&
+			!strings.EqualFold(o.tblName, name):
+
+			continue
+		}
+
+		if raw {
+			b.WriteString(o.sql + ";\n")
+		} else {
+			b.WriteString(highlightSQL(formatDDL(o.sql)) + ";\n")
+		}
+	}
+
+	if b.Len() == 0 && name != "" {
+		fmt.Println("No such table.")
+		return fmt.Errorf("%w: %s", errNoSuchTable, name)
+	}
+	printPaged(b.String())
+	return nil
+}
+
+// handleDescribeCommand lists the tables and views, or shows the schema of
+// one of them, as a table or as JSON with --json.
+func handleDescribeCommand(args []string) error {
+	switch {
+	case len(args) > 0 && args[0] == "--json":
+		name := ""
+		if len(args) == 2 {
+			name = args[1]
+		}
+		if err := writeSchemaJSON(
+			context.Background(), name, "",
+		); err != nil {
+			fmt.Printf("Schema error: %v\n", err)
+			return err
+		}
+
+	case len(args) == 0:
+		err := printRelationList("", false, false, "table", "view")
 		if err != nil {
-			fmt.Println("Schema query failed:", err)
-			return
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			var sqlStmt string
-			rows.Scan(&sqlStmt)
-			fmt.Println(sqlStmt)
-		}
-	} else {
-		table := args[1]
-		row := db.QueryRow(`SELECT sql FROM sqlite_master
-			            WHERE type='table' AND name=?`, table)
-		var sqlStmt string
-		err := row.Scan(&sqlStmt)
+			fmt.Printf("Error: %v\n", err)
+			return err
+		}
+
+	case len(args) == 1 && isNamePattern(args[0]):
+		err := printRelationList(args[0], false, false, "table", "view")
 		if err != nil {
-			fmt.Println("No such table.")
-			return
+			fmt.Printf("Error: %v\n", err)
+			return err
+		}
+
+	case len(args) == 1:
+		if err := printSchemaPretty(args[0]); err != nil {
+			fmt.Printf("Schema error: %v\n", err)
+			return err
 		}
 
-		fmt.Println(sqlStmt)
+	default:
+		fmt.Println("Usage: \\d [table|pattern] | \\d --json [table]")
+		return errUsage
 	}
+	return nil
 }
 
-func printRelationList() error {
-	rows, err := db.Query(`
-		SELECT name, type
-		FROM sqlite_master
-		WHERE type IN ('table', 'view')
-		  AND name NOT LIKE 'sqlite_%'
-		ORDER BY type DESC, name;
-	`)
+// printRelationList lists the objects of the given types matching pattern,
+// see filterSchemaObjects, through the pager when long. Objects of the temp
+// schema are marked as such. Verbose adds the row count and size of the
+// tables, see readRelationSizes, and bySize sorts the largest first.
+func printRelationList(pattern string, verbose, bySize bool,
+	types ...string) error {
+
+	ctx := context.Background()
+	objs, err := dbSchema.schemaObjects(ctx, types...)
 	if err != nil {
 		return fmt.Errorf("failed to list relations: %w", err)
 	}
-	defer rows.Close()
+	objs = filterSchemaObjects(objs, pattern)
+	if len(objs) == 0 && pattern != "" {
+		fmt.Printf("Did not find any relation named \"%s\".\n", pattern)
+		return nil
+	}
 
-	fmt.Println("        List of relations")
-	fmt.Printf(" %-32s | %-6s\n", "Name", "Type")
-	fmt.Println(strings.Repeat("-", 41))
+	var sizes map[string]relationSize
+	if verbose || bySize {
+		sizes, err = readRelationSizes(ctx)
+		if err != nil {
+			fmt.Printf("NOTE: sizes are unknown, %v\n", err)
+		}
+	}
+	sizeOf := func(o schemaObject) relationSize {
+		return sizes[o.schema()+"."+o.name]
+	}
 
-	for rows.Next() {
-		var name, typ string
-		if err := rows.Scan(&name, &typ); err != nil {
-			return err
+	sort.SliceStable(objs, func(i, j int) bool {
+		if bySize && sizeOf(objs[i]).bytes != sizeOf(objs[j]).bytes {
+			return sizeOf(objs[i]).bytes > sizeOf(objs[j]).bytes
+		}
+		if objs[i].typ != objs[j].typ {
+			return objs[i].typ > objs[j].typ
 		}
-		fmt.Printf(" %-32s | %-6s\n", name, typ)
+		return objs[i].name < objs[j].name
+	})
+
+	t := table.NewWriter()
+	t.SetStyle(psqlStyle)
+	header := table.Row{"Name", "Type"}
+	if verbose {
+		header = append(header, "Rows", "Size")
+		t.SetColumnConfigs([]table.ColumnConfig{
+			{Number: 3, Align: text.AlignRight},
+			{Number: 4, Align: text.AlignRight},
+		})
+	}
+	t.AppendHeader(header)
+
+	for _, o := range objs {
+		typ := o.typ
+		if o.temp {
+			typ = "temp " + typ
+		}
+		row := table.Row{o.name, typ}
+		if size, ok := sizes[o.schema()+"."+o.name]; verbose && ok {
+			row = append(row, size.rows, formatByteSize(size.bytes))
+		} else if verbose {
+			row = append(row, "", "")
+		}
+		t.AppendRow(row)
+	}
+
+	printPaged("List of relations\n" + t.Render() + "\n")
+	return nil
+}
+
+// handleDescribeVerboseCommand lists the tables and views, or those of the
+// given types, with their row counts and sizes.
+func handleDescribeVerboseCommand(args []string, types ...string) error {
+	var pattern string
+	bySize := false
+	for _, arg := range args {
+		if arg == "--by-size" {
+			bySize = true
+			continue
+		}
+		pattern = arg
+	}
+
+	if err := printRelationList(pattern, true, bySize, types...); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return err
 	}
 	return nil
 }
 
-func printIndexList() error {
-	rows, err := db.Query(`
-		SELECT name, tbl_name
-		FROM sqlite_master
-		WHERE type = 'index'
-		  AND name NOT LIKE 'sqlite_%'
-		ORDER BY tbl_name, name;
-	`)
+// isNamePattern reports whether a listing command's argument is a pattern
+// rather than a name, which is when it has a *, ? or % wildcard.
+func isNamePattern(arg string) bool {
+	return strings.ContainsAny(arg, "*?%")
+}
+
+// namePatternRegexp turns a name pattern into an anchored, case-insensitive
+// regexp. Both glob and LIKE wildcards work: * and % match any run of
+// characters and ? any one, as does _ in patterns using %, where it is the
+// LIKE wildcard. Otherwise _ is taken literally, as it is common in names.
+func namePatternRegexp(pattern string) *regexp.Regexp {
+	like := strings.Contains(pattern, "%")
+
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch {
+		case r == '*' || r == '%':
+			b.WriteString(".*")
+		case r == '?' || r == '_' && like:
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// filterSchemaObjects returns the objects whose name matches pattern, see
+// namePatternRegexp. A pattern qualified with main. or temp. only matches
+// the objects of that schema, and an empty one matches everything.
+func filterSchemaObjects(objs []schemaObject, pattern string) []schemaObject {
+	if pattern == "" {
+		return objs
+	}
+
+	schema, name := splitSchemaName(pattern)
+	if name == "" {
+		name = "*"
+	}
+	re := namePatternRegexp(name)
+
+	var matched []schemaObject
+	for _, o := range objs {
+		if (schema == "" || o.schema() == schema) && re.MatchString(o.name) {
+			matched = append(matched, o)
+		}
+	}
+	return matched
+}
+
+// printIndexList lists the indexes whose name matches pattern, see
+// filterSchemaObjects.
+func printIndexList(pattern string) error {
+	objs, err := dbSchema.schemaObjects(context.Background(), "index")
 	if err != nil {
 		return fmt.Errorf("failed to list indexes: %w", err)
 	}
-	defer rows.Close()
+	objs = filterSchemaObjects(objs, pattern)
+	if len(objs) == 0 && pattern != "" {
+		fmt.Printf("Did not find any index named \"%s\".\n", pattern)
+		return nil
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		if objs[i].tblName != objs[j].tblName {
+			return objs[i].tblName < objs[j].tblName
+		}
+		return objs[i].name < objs[j].name
+	})
 
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.SetStyle(psqlStyle)
 	t.AppendHeader(table.Row{"Index Name", "Table"})
 
-	for rows.Next() {
-		var name, tbl string
-		if err := rows.Scan(&name, &tbl); err != nil {
-			return err
-		}
-		t.AppendRow(table.Row{name, tbl})
+	for _, o := range objs {
+		t.AppendRow(table.Row{o.name, o.tblName})
 	}
 
 	t.Render()
@@ -399,17 +994,13 @@ func printIndexList() error {
 }
 
 func printSchemaPretty(tableName string) error {
-	fmt.Printf("\n📄 Table \"%s\"\n\n", tableName)
-
-	// Columns
-	colRows, err := db.Query(
-		fmt.Sprintf("PRAGMA table_info(%q)", tableName),
-	)
+	st, err := dbSchema.table(context.Background(), tableName)
 	if err != nil {
-		return fmt.Errorf("PRAGMA table_info: %w", err)
+		return err
 	}
-	defer colRows.Close()
+	fmt.Printf("\n📄 Table \"%s\"\n\n", st.Name)
 
+	// Columns
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.SetStyle(psqlStyle)
@@ -417,69 +1008,44 @@ func printSchemaPretty(tableName string) error {
 		table.Row{"Column", "Type", "Collation", "Nullable", "Default"},
 	)
 
-	for colRows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull, pk int
-		var dflt sql.NullString
-		colRows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+	for _, col := range st.Columns {
+		if col.Hidden {
+			continue
+		}
 
 		nullable := "yes"
-		if notnull != 0 {
+		if col.NotNull {
 			nullable = "no"
 		}
 		defaultVal := ""
-		if dflt.Valid {
-			defaultVal = dflt.String
+		switch {
+		case col.Generated != "":
+			defaultVal = fmt.Sprintf("generated always as (%s) %s",
+				col.Expression, col.Generated)
+		case col.Default != nil:
+			defaultVal = *col.Default
 		}
 
-		t.AppendRow(table.Row{name, ctype, "", nullable, defaultVal})
+		t.AppendRow(table.Row{col.Name, col.Type, col.Collation, nullable,
+			defaultVal})
 	}
 	t.Render()
 
 	// Indexes
-	idxRows, err := db.Query(fmt.Sprintf("PRAGMA index_list(%q)", tableName))
-	if err != nil {
-		return err
-	}
-	defer idxRows.Close()
-
 	idxTable := table.NewWriter()
 	idxTable.SetOutputMirror(os.Stdout)
 	idxTable.SetStyle(psqlStyle)
 	idxTable.AppendHeader(table.Row{"Index Name", "Details"})
 
-	for idxRows.Next() {
-		var seq int
-		var name string
-		var unique int
-		var origin, partial string
-		idxRows.Scan(&seq, &name, &unique, &origin, &partial)
-
-		cols := []string{}
-		colInfo, err := db.Query(
-			fmt.Sprintf("PRAGMA index_info(%q)", name),
-		)
-		if err != nil {
-			return err
-		}
-
-		for colInfo.Next() {
-			var seqno, cid int
-			var cname string
-			colInfo.Scan(&seqno, &cid, &cname)
-			cols = append(cols, cname)
-		}
-		colInfo.Close()
-
+	for _, idx := range st.Indexes {
 		desc := ""
-		if origin == "pk" {
+		if idx.Origin == "primary_key" {
 			desc += "PRIMARY KEY"
-		} else if origin == "u" {
+		} else if idx.Origin == "unique" {
 			desc += "UNIQUE CONSTRAINT"
 		}
-		desc += fmt.Sprintf(" (btree: %s)", strings.Join(cols, ", "))
-		idxTable.AppendRow(table.Row{name, desc})
+		desc += fmt.Sprintf(" (btree: %s)", strings.Join(idx.Columns, ", "))
+		idxTable.AppendRow(table.Row{idx.Name, desc})
 	}
 	if idxTable.Length() > 0 {
 		fmt.Println("\n🔖 Indexes")
@@ -487,77 +1053,117 @@ func printSchemaPretty(tableName string) error {
 	}
 
 	// Foreign keys
-	fkRows, err := db.Query(
-		fmt.Sprintf("PRAGMA foreign_key_list(%q)", tableName),
-	)
-	defer fkRows.Close()
-
-	if err != nil {
-		return err
-	}
-
 	fkTable := table.NewWriter()
 	fkTable.SetOutputMirror(os.Stdout)
 	fkTable.SetStyle(psqlStyle)
 	fkTable.AppendHeader(table.Row{"From", "To Table", "To Column"})
 
-	for fkRows.Next() {
-		var id, seq int
-		var refTable, from, to, onUpdate, onDelete, match string
-		fkRows.Scan(
-			&id, &seq, &refTable, &from, &to, &onUpdate,
-			&onDelete, &match,
-		)
-		fkTable.AppendRow(table.Row{from, refTable, to})
+	for _, fk := range st.ForeignKeys {
+		for i, from := range fk.Columns {
+			to := ""
+			if i < len(fk.References) {
+				to = fk.References[i]
+			}
+			fkTable.AppendRow(table.Row{from, fk.Table, to})
+		}
 	}
 	if fkTable.Length() > 0 {
 		fmt.Println("\n🔗 Foreign Keys")
 		fkTable.Render()
 	}
 
+	// Check constraints, only in the CREATE TABLE statement.
+	checkTable := table.NewWriter()
+	checkTable.SetOutputMirror(os.Stdout)
+	checkTable.SetStyle(psqlStyle)
+	checkTable.AppendHeader(table.Row{"Name", "Column", "Check"})
+
+	for _, c := range checkConstraints(st.SQL) {
+		checkTable.AppendRow(table.Row{c.Name, c.Column,
+			"CHECK (" + c.Expression + ")"})
+	}
+	if checkTable.Length() > 0 {
+		fmt.Println("\n✅ Check Constraints")
+		checkTable.Render()
+	}
+
 	fmt.Println()
 	return nil
 }
 
+// lastCompletionError is the schema read error last reported by the
+// completer, which runs on every key press.
+var lastCompletionError string
+
+// reportCompletionError queues a notice for an error reading the schema
+// while completing, unless it is the one reported last. Tables that don't
+// exist aren't errors here, the input may name them wrong.
+func reportCompletionError(err error) {
+	switch {
+	case err == nil:
+		lastCompletionError = ""
+		return
+
+	case errors.Is(err, errNoSuchTable) ||
+		err.Error() == lastCompletionError:
+
+		return
+	}
+
+	lastCompletionError = err.Error()
+	select {
+	case notices <- fmt.Sprintf("WARNING: completion failed to read the "+
+		"schema: %v", err):
+	default:
+	}
+}
+
+// getTableSuggestions returns the tables of the session database.
 func getTableSuggestions() []prompt.Suggest {
-	rows, err := db.Query(`SELECT name FROM sqlite_master
-		             WHERE type='table' AND name NOT LIKE 'sqlite_%'`)
+	ctx, cancel := context.WithTimeout(context.Background(),
+		completionTimeout)
+	defer cancel()
+
+	objs, err := dbSchema.schemaObjects(ctx, "table")
+	reportCompletionError(err)
 	if err != nil {
 		return nil
 	}
 
-	defer rows.Close()
-
 	var suggestions []prompt.Suggest
-	for rows.Next() {
-		var name string
-		rows.Scan(&name)
+	for _, o := range objs {
+		desc := "table"
+		if o.temp {
+			desc = "temp table"
+		}
 		suggestions = append(
 			suggestions,
-			prompt.Suggest{Text: name, Description: "table"},
+			prompt.Suggest{Text: o.name, Description: desc},
 		)
 	}
-
 	return suggestions
 }
 
+// getColumnSuggestions returns the columns of a table or view.
 func getColumnSuggestions(table string) []prompt.Suggest {
-	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	ctx, cancel := context.WithTimeout(context.Background(),
+		completionTimeout)
+	defer cancel()
+
+	t, err := dbSchema.table(ctx, table)
+	reportCompletionError(err)
 	if err != nil {
 		return nil
 	}
-	defer rows.Close()
 
 	var suggestions []prompt.Suggest
-	for rows.Next() {
-		var cid int
-		var name, ctype string
-		var notnull, pk int
-		var dfltValue sql.NullString
-		rows.Scan(&cid, &name, &ctype, &notnull, &dfltValue, &pk)
+	for _, col := range t.Columns {
+		if col.Hidden {
+			continue
+		}
 		suggestions = append(
 			suggestions,
-			prompt.Suggest{Text: name, Description: "column"},
+			prompt.Suggest{Text: col.Name, Description: "column"},
 		)
 	}
 	return suggestions
@@ -581,30 +1187,72 @@ func formatValue(val interface{}) string {
 		return `\x` + strings.ToUpper(hex.EncodeToString(v))
 
 	case time.Time:
-		return formatTimePadded(v)
+		return formatTime(v)
+
+	case string:
+		if ts, ok := formatTimestampText(v); ok {
+			return ts
+		}
+		return v
+
+	case float64:
+		if floatFormat != "" {
+			return fmt.Sprintf(floatFormat, v)
+		}
+
+		// Plain decimals read best, but exponents keep very large and
+		// very small values from sprawling across the column.
+		if a := math.Abs(v); a == 0 || (a >= 1e-6 && a < 1e15) {
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
 
 	default:
 		return fmt.Sprintf("%v", v)
 	}
 }
 
+// numericColumn reports whether a column is right-aligned: by its declared
+// type if it has one, otherwise by whether the values it holds are all
+// numbers. DATE, TIME and BOOLEAN columns get NUMERIC affinity but don't
+// line up like numbers.
+func numericColumn(declType string, numericValues bool) bool {
+	t := strings.ToUpper(declType)
+	switch typeAffinity(declType) {
+	case affinityInteger, affinityReal:
+		return true
+
+	case affinityNumeric:
+		return !strings.Contains(t, "DATE") &&
+			!strings.Contains(t, "TIME") && !strings.Contains(t, "BOOL")
+
+	case affinityNone:
+		return numericValues && !strings.Contains(t, "BLOB")
+
+	default:
+		return false
+	}
+}
+
 func isNumeric(s string) bool {
 	_, err := fmt.Sscanf(s, "%f", new(float64))
 	return err == nil
 }
 
-func printPrettyTable(rows *sql.Rows) error {
+func printPrettyTable(rows resultRows, formats columnFormats) (int, error) {
 	cols, err := rows.Columns()
 	if err != nil {
 		fmt.Printf("Failed to get columns: %v\n", err)
-		return err
+		return 0, err
 	}
 
+	idx := displayColumns(cols)
+	header := pickStrings(cols, idx)
+
 	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
 	t.SetStyle(psqlStyle)
 	t.Style().Format.Header = text.FormatLower
-	t.AppendHeader(toRow(cols))
+	t.AppendHeader(toRow(header))
 
 	vals := make([]interface{}, len(cols))
 	valPtrs := make([]interface{}, len(cols))
@@ -612,63 +1260,198 @@ func printPrettyTable(rows *sql.Rows) error {
 		valPtrs[i] = &vals[i]
 	}
 
-	var sampleRow []string
-	var columnConfigs []table.ColumnConfig
+	// Keep the formatted rows around in case the table turns out to be
+	// too wide and we hand it over to the browser instead. Rows past the
+	// memory budget go to disk.
+	data := newRowBuffer(header)
+	defer data.close()
+
+	// Columns without a declared type are aligned by the values they
+	// hold, and formatted ones by what the formatter made of them.
+	numeric := make([]bool, len(idx))
+	for j := range numeric {
+		numeric[j] = true
+	}
 
-	// Scan one row to guess column types.
-	if rows.Next() {
-		rows.Scan(valPtrs...)
-		row := make([]interface{}, len(cols))
-		sampleRow = make([]string, len(cols))
+	for rows.Next() {
+		if outputInterrupted(data.len()) {
+			printTruncatedNote()
+			return data.len(), nil
+		}
 
-		for i, val := range vals {
-			s := formatValue(val)
-			row[i] = s
-			sampleRow[i] = s
+		if err := rows.Scan(valPtrs...); err != nil {
+			return data.len(), err
+		}
+		formatted := make([]string, len(idx))
+		for j, i := range idx {
+			formatted[j] = formats.format(i, vals[i])
+
+			switch vals[i].(type) {
+			case nil:
+			case int64, float64:
+				if formats.custom(i) && !isNumeric(formatted[j]) {
+					numeric[j] = false
+				}
+			default:
+				numeric[j] = false
+			}
+		}
+		if err := data.add(formatted); err != nil {
+			return data.len(), err
 		}
-		t.AppendRow(row)
 	}
 
-	// Determine right-aligned columns (numeric heuristics).
-	for i, val := range sampleRow {
-		if isNumeric(val) {
+	var columnConfigs []table.ColumnConfig
+	types := rows.declTypes()
+	for j, i := range idx {
+		if formats.boolean(i) {
+			continue
+		}
+
+		declType := ""
+		if i < len(types) && !formats.custom(i) {
+			declType = types[i]
+		}
+		if numericColumn(declType, numeric[j] && data.len() > 0) {
 			columnConfigs = append(
 				columnConfigs, table.ColumnConfig{
-					Number: i + 1, Align: text.AlignRight,
+					Number: j + 1, Align: text.AlignRight,
 				},
 			)
 		}
 	}
 	t.SetColumnConfigs(columnConfigs)
 
-	// Continue with the rest of the rows.
-	for rows.Next() {
-		rows.Scan(valPtrs...)
-		row := make([]interface{}, len(cols))
-		for i, val := range vals {
-			row[i] = formatValue(val)
+	if err := rows.Err(); err != nil {
+		return data.len(), err
+	}
+
+	var widths []int
+	if wrapCells {
+		widths = wrapColumnWidths(header, data.widths, terminalWidth())
+	}
+	if data.spilled() {
+		err := printSpilledTable(t, header, data, columnConfigs, widths)
+		if err == nil {
+			printColumnFilterNote(len(idx), len(cols))
+		}
+		return data.len(), err
+	}
+
+	for _, formatted := range data.mem {
+		row := make(table.Row, len(formatted))
+		for j, s := range formatted {
+			if widths != nil {
+				s = wrapCell(s, widths[j])
+			}
+			row[j] = s
 		}
 		t.AppendRow(row)
 	}
 
-	t.Render()
+	out := t.Render()
+	if out == "" {
+		return data.len(), nil
+	}
 
-	return nil
+	width := terminalWidth()
+	tooWide := width > 0 && text.LongestLineLen(out) > width
+	if autoBrowse && tooWide {
+		err := browseResult(header, data.mem)
+		if err == nil {
+			return data.len(), nil
+		}
+		fmt.Printf("Browse error: %v\n", err)
+	}
+
+	if expandedAuto && tooWide {
+		err := printExpandedData(header, data)
+		if err == nil {
+			printColumnFilterNote(len(idx), len(cols))
+		}
+		return data.len(), err
+	}
+
+	if !printRendered(out) {
+		printTruncatedNote()
+		return data.len(), nil
+	}
+	printColumnFilterNote(len(idx), len(cols))
+
+	return data.len(), nil
 }
 
-func toRow(cols []string) table.Row {
-	row := make(table.Row, len(cols))
-	for i, col := range cols {
-		row[i] = col
+// printSpilledTable prints a table whose rows don't all fit in memory a
+// batch at a time. Every batch is laid out to the widths of the whole
+// table, so that they line up as one. The browser needs all rows in
+// memory, so \browse auto doesn't apply.
+func printSpilledTable(t table.Writer, cols []string, data *rowBuffer,
+	configs []table.ColumnConfig, wrapWidths []int) error {
+
+	widths := data.widths
+	if wrapWidths != nil {
+		widths = wrapWidths
 	}
-	return row
+	lineLen := -1
+	for _, w := range widths {
+		lineLen += w + 3
+	}
+	if width := terminalWidth(); expandedAuto && width > 0 &&
+		lineLen > width {
+
+		return printExpandedData(cols, data)
+	}
+
+	align := make(map[int]text.Align)
+	for _, c := range configs {
+		align[c.Number] = c.Align
+	}
+	configs = make([]table.ColumnConfig, len(cols))
+	for j, w := range widths {
+		configs[j] = table.ColumnConfig{
+			Number: j + 1, Align: align[j+1], WidthMin: w,
+		}
+	}
+	t.SetColumnConfigs(configs)
+
+	interrupted := false
+	err := data.each(func(i int, row []string) bool {
+		r := make(table.Row, len(row))
+		for j, s := range row {
+			if wrapWidths != nil {
+				s = wrapCell(s, wrapWidths[j])
+			}
+			r[j] = s
+		}
+		t.AppendRow(r)
+
+		if (i+1)%renderBatch != 0 && i+1 < data.len() {
+			return true
+		}
+		if outputCtx.Err() != nil {
+			interrupted = true
+			return false
+		}
+		fmt.Println(t.Render())
+
+		// The next batch continues the table without a header.
+		t = table.NewWriter()
+		t.SetStyle(psqlStyle)
+		t.SetColumnConfigs(configs)
+		return true
+	})
+	if interrupted {
+		printTruncatedNote()
+	}
+	return err
 }
 
-func printExpanded(rows *sql.Rows) (bool, error) {
+// printTuples prints bare rows with the values separated by "|", for
+// consumption by scripts.
+func printTuples(rows resultRows, formats columnFormats) (int, error) {
 	cols, err := rows.Columns()
 	if err != nil {
-		fmt.Printf("Failed to get columns: %v\n", err)
-		return false, err
+		return 0, err
 	}
 
 	vals := make([]interface{}, len(cols))
@@ -677,56 +1460,43 @@ func printExpanded(rows *sql.Rows) (bool, error) {
 		valPtrs[i] = &vals[i]
 	}
 
-	type rowData []string
-	var allData []rowData
-
-	maxKeyLen := 0
+	idx := displayColumns(cols)
+	formatted := make([]string, len(idx))
 
-	// Scan rows into memory to determine max key length.
+	n := 0
 	for rows.Next() {
-		if err := rows.Scan(valPtrs...); err != nil {
-			fmt.Printf("Failed to scan row: %v\n", err)
-			return false, err
+		if outputInterrupted(n) {
+			printTruncatedNote()
+			return n, nil
 		}
-		row := make(rowData, len(cols))
-		for i, val := range vals {
-			row[i] = formatValue(val)
-		}
-		allData = append(allData, row)
-	}
 
-	if len(allData) == 0 {
-		return false, nil
-	}
+		if err := rows.Scan(valPtrs...); err != nil {
+			return n, err
+		}
 
-	// Find max key width.
-	for _, col := range cols {
-		if len(col) > maxKeyLen {
-			maxKeyLen = len(col)
+		for j, i := range idx {
+			formatted[j] = formats.format(i, vals[i])
 		}
+		fmt.Println(strings.Join(formatted, "|"))
+		n++
 	}
 
-	// Calculate the max digits to use for the record number.
-	digitCount := int(math.Log10(float64(len(allData)))) + 1
-
-	// Print all rows.
-	for i, row := range allData {
-		fmt.Printf("-[ RECORD %*d ]%s\n", digitCount, i+1,
-			strings.Repeat("-", 24))
+	return n, rows.Err()
+}
 
-		for j, col := range cols {
-			fmt.Printf("%-*s | %s\n", maxKeyLen, col, row[j])
-		}
-		fmt.Println()
+func toRow(cols []string) table.Row {
+	row := make(table.Row, len(cols))
+	for i, col := range cols {
+		row[i] = col
 	}
-
-	return true, nil
+	return row
 }
 
-func printJSON(rows *sql.Rows) error {
+func printExpanded(rows resultRows, formats columnFormats) (int, error) {
 	cols, err := rows.Columns()
 	if err != nil {
-		return err
+		fmt.Printf("Failed to get columns: %v\n", err)
+		return 0, err
 	}
 
 	vals := make([]interface{}, len(cols))
@@ -735,38 +1505,92 @@ func printJSON(rows *sql.Rows) error {
 		valPtrs[i] = &vals[i]
 	}
 
-	var allRows []map[string]interface{}
+	idx := displayColumns(cols)
 
+	// Scan rows into memory to determine the record number width. Rows
+	// past the memory budget go to disk.
+	data := newRowBuffer(pickStrings(cols, idx))
+	defer data.close()
 	for rows.Next() {
-		if err := rows.Scan(valPtrs...); err != nil {
-			return err
+		if outputInterrupted(data.len()) {
+			printTruncatedNote()
+			return data.len(), nil
 		}
 
-		row := make(map[string]interface{})
-		for i, col := range cols {
-			raw := *(valPtrs[i].(*interface{}))
-			switch v := raw.(type) {
-			case []byte:
-				// Try to convert to string if printable,
-				// otherwise hex.
-				str := string(v)
-				if isPrintable(str) {
-					row[col] = str
-				} else {
-					row[col] = fmt.Sprintf(
-						"\\x%s", hex.EncodeToString(v),
-					)
-				}
-			default:
-				row[col] = raw
-			}
+		if err := rows.Scan(valPtrs...); err != nil {
+			fmt.Printf("Failed to scan row: %v\n", err)
+			return 0, err
+		}
+		row := make([]string, len(idx))
+		for j, i := range idx {
+			row[j] = formats.format(i, vals[i])
 		}
-		allRows = append(allRows, row)
+		if err := data.add(row); err != nil {
+			return data.len(), err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return data.len(), err
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-	return enc.Encode(allRows)
+	if err := printExpandedData(pickStrings(cols, idx), data); err != nil {
+		return data.len(), err
+	}
+	if data.len() > 0 {
+		printColumnFilterNote(len(idx), len(cols))
+	}
+
+	return data.len(), nil
+}
+
+// printExpandedData prints already formatted rows one record at a time,
+// until ^C is pressed.
+func printExpandedData(cols []string, data *rowBuffer) error {
+	if data.len() == 0 {
+		return nil
+	}
+
+	// Find max key width.
+	maxKeyLen := 0
+	for _, col := range cols {
+		maxKeyLen = max(maxKeyLen, displayWidth(col))
+	}
+
+	// Calculate the max digits to use for the record number.
+	digitCount := int(math.Log10(float64(data.len()))) + 1
+
+	// Values wrap at the terminal's edge.
+	valueWidth := 0
+	if width := terminalWidth(); wrapCells && width > 0 {
+		valueWidth = max(width-maxKeyLen-3, minWrapWidth)
+	}
+
+	// Print all rows.
+	return data.each(func(i int, row []string) bool {
+		if outputInterrupted(i) {
+			printTruncatedNote()
+			return false
+		}
+
+		if !tuplesOnly {
+			fmt.Printf("-[ RECORD %*d ]%s\n", digitCount, i+1,
+				strings.Repeat("-", 24))
+		}
+
+		for j, col := range cols {
+			value := row[j]
+			if valueWidth > 0 {
+				// Continuation lines keep to the value column.
+				value = strings.ReplaceAll(
+					wrapCell(value, valueWidth), "\n",
+					"\n"+strings.Repeat(" ", maxKeyLen)+" | ",
+				)
+			}
+			fmt.Printf("%s | %s\n", padRight(col, maxKeyLen), value)
+		}
+		fmt.Println()
+		return true
+	})
 }
 
 func isPrintable(s string) bool {
@@ -778,9 +1602,52 @@ func isPrintable(s string) bool {
 	return true
 }
 
+// getHistoryFilePath returns the history file, $VSQLITE_HISTORY or history
+// in the state directory.
 func getHistoryFilePath() string {
-	usr, _ := user.Current()
-	return filepath.Join(usr.HomeDir, ".vsqlite_history")
+	if path := os.Getenv("VSQLITE_HISTORY"); path != "" {
+		return path
+	}
+	return filepath.Join(stateDir(), "history")
+}
+
+// databaseHistoryFile returns the history file of a database, so that \open
+// brings back the statements run on it before. In-memory and remote
+// databases share the history file of getHistoryFilePath, as does every
+// database if $VSQLITE_HISTORY is set.
+func databaseHistoryFile(path string) string {
+	if os.Getenv("VSQLITE_HISTORY") != "" || hasPrivateDatabase(path) ||
+		isRemoteDatabase(path) || isSSHDatabase(path) {
+
+		return getHistoryFilePath()
+	}
+
+	abs, err := filepath.Abs(databaseFile(path))
+	if err != nil {
+		return getHistoryFilePath()
+	}
+	sum := sha256.Sum256([]byte(abs))
+	name := fmt.Sprintf("%s-%x", filepath.Base(abs), sum[:4])
+
+	return filepath.Join(stateDir(), "histories", name)
+}
+
+// loadDatabaseHistory loads the history of the database at path. A
+// database without a history of its own starts from the shared one, which
+// also holds the history of earlier versions.
+func loadDatabaseHistory(path string) {
+	historyFile = databaseHistoryFile(path)
+	if _, err := os.Stat(historyFile); err == nil {
+		loadHistory()
+		return
+	}
+
+	// The shared entries are written to the database's file with the
+	// new ones.
+	own := historyFile
+	historyFile = getHistoryFilePath()
+	loadHistory()
+	historyFile, historySaved = own, 0
 }
 
 func unescapeHistoryLines(lines []string) []string {
@@ -801,22 +1668,32 @@ func saveToHistory(cmd string) {
 }
 
 func loadHistory() {
-	file, err := os.Open(historyFile)
-	if err != nil {
+	// What was read before an error is kept.
+	entries, err := readHistoryFile(historyFile)
+	if err != nil && entries == nil {
 		return
 	}
+
+	historyLines = dedupHistory(append(historyLines, entries...))
+	historySaved = len(historyLines)
+}
+
+// readHistoryFile returns the entries of a history file, oldest first.
+func readHistoryFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
-	var block []string
+	var entries, block []string
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		if line == customHistoryDelimiter {
 			if len(block) > 0 {
-				historyLines = append(
-					historyLines, strings.Join(block, "\n"),
-				)
+				entries = append(entries, strings.Join(block, "\n"))
 				block = nil
 			}
 			continue
@@ -824,10 +1701,10 @@ func loadHistory() {
 		block = append(block, line)
 	}
 	if len(block) > 0 {
-		historyLines = append(historyLines, strings.Join(block, "\n"))
+		entries = append(entries, strings.Join(block, "\n"))
 	}
 
-	historyLines = dedupHistory(historyLines)
+	return entries, scanner.Err()
 }
 
 func dedupHistory(lines []string) []string {
@@ -859,7 +1736,10 @@ func dedupHistory(lines []string) []string {
 }
 
 func saveHistory() {
-	if len(historyLines) == 0 {
+	if len(historyLines) <= historySaved {
+		return
+	}
+	if err := ensureParentDir(historyFile); err != nil {
 		return
 	}
 	f, err := os.OpenFile(
@@ -870,7 +1750,7 @@ func saveHistory() {
 	}
 	defer f.Close()
 
-	for _, entry := range historyLines {
+	for _, entry := range historyLines[historySaved:] {
 		fmt.Fprintln(f, customHistoryDelimiter)
 		f.WriteString(entry)
 		if !strings.HasSuffix(entry, "\n") {
@@ -879,21 +1759,46 @@ func saveHistory() {
 	}
 }
 
-func fuzzyHistoryPrompt() string {
+// fuzzyHistoryPrompt lets the user pick history entries full-screen, several
+// of them by marking them with Tab, and returns them oldest first so that
+// a sequence of steps comes back in the order it was run.
+func fuzzyHistoryPrompt() []string {
 	if len(historyLines) == 0 {
-		return ""
+		return nil
 	}
 
-	idx, err := fuzzyfinder.Find(
+	idxs, err := fuzzyfinder.FindMulti(
 		historyLines,
 		func(i int) string {
 			return historyLines[i]
 		},
-		fuzzyfinder.WithPromptString("🔍 history> "),
+		fuzzyfinder.WithPromptString("🔍 history (tab to mark)> "),
 	)
 	if err != nil {
 		// User cancelled or no selection.
-		return ""
+		return nil
+	}
+
+	sort.Ints(idxs)
+	selected := make([]string, len(idxs))
+	for i, idx := range idxs {
+		selected[i] = historyLines[idx]
+	}
+	return selected
+}
+
+// joinStatements joins history entries into one input, one per line and
+// each terminated so that they stay separate statements.
+func joinStatements(entries []string) string {
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.HasSuffix(entry, ";") &&
+			!strings.HasPrefix(entry, `\`) {
+
+			entry += ";"
+		}
+		lines[i] = entry
 	}
-	return historyLines[idx]
+	return strings.Join(lines, "\n")
 }
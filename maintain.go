@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// maintenanceStep is one step of \maintain.
+type maintenanceStep struct {
+	name string
+	desc string
+
+	// run performs the step, returning a note on what it did, if any.
+	// It returns a skippedStep with the reason when the step doesn't apply.
+	run func(ctx context.Context) (string, error)
+}
+
+// skippedStep is returned by steps that don't apply to the database.
+type skippedStep string
+
+func (s skippedStep) Error() string {
+	return string(s)
+}
+
+var maintenanceSteps = []maintenanceStep{
+	{
+		name: "analyze",
+		desc: "ANALYZE, gather statistics for the query planner",
+		run: func(ctx context.Context) (string, error) {
+			_, err := conn.ExecContext(ctx, "ANALYZE")
+			return "", err
+		},
+	},
+	{
+		name: "optimize",
+		desc: "PRAGMA optimize",
+		run: func(ctx context.Context) (string, error) {
+			_, err := conn.ExecContext(ctx, "PRAGMA optimize")
+			return "", err
+		},
+	},
+	{
+		name: "vacuum",
+		desc: "PRAGMA incremental_vacuum, free unused pages",
+		run: func(ctx context.Context) (string, error) {
+			var mode int
+			err := conn.QueryRowContext(ctx, "PRAGMA auto_vacuum").
+				Scan(&mode)
+			if err != nil {
+				return "", err
+			}
+			if mode != 2 {
+				return "", skippedStep("auto_vacuum is not " +
+					"incremental, run VACUUM to shrink the file")
+			}
+
+			// Every step of the pragma frees one page, so it is read to
+			// the end rather than executed.
+			before := pragmaInt(ctx, "freelist_count")
+			rows, err := conn.QueryContext(ctx, "PRAGMA incremental_vacuum")
+			if err != nil {
+				return "", err
+			}
+			for rows.Next() {
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d pages freed",
+				before-pragmaInt(ctx, "freelist_count")), nil
+		},
+	},
+	{
+		name: "checkpoint",
+		desc: "PRAGMA wal_checkpoint(TRUNCATE)",
+		run: func(ctx context.Context) (string, error) {
+			var journalMode string
+			err := conn.QueryRowContext(ctx, "PRAGMA journal_mode").
+				Scan(&journalMode)
+			if err != nil {
+				return "", err
+			}
+			if !strings.EqualFold(journalMode, "wal") {
+				return "", skippedStep("not in WAL mode")
+			}
+
+			var busy, logFrames, checkpointed int
+			err = conn.QueryRowContext(
+				ctx, "PRAGMA wal_checkpoint(TRUNCATE)",
+			).Scan(&busy, &logFrames, &checkpointed)
+			if err != nil {
+				return "", err
+			}
+			if busy != 0 {
+				return fmt.Sprintf("incomplete, %d of %d frames "+
+					"copied, the database is in use",
+					checkpointed, logFrames), nil
+			}
+			return "log copied into the database and truncated", nil
+		},
+	},
+}
+
+// formatStepTime formats the time a step took the way \timing does.
+func formatStepTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f ms", float64(d.Microseconds())/1000)
+}
+
+// pragmaInt reads an integer pragma, 0 if it can't.
+func pragmaInt(ctx context.Context, name string) int64 {
+	var n int64
+	conn.QueryRowContext(ctx, "PRAGMA "+name).Scan(&n)
+	return n
+}
+
+// databaseSizes are the size metrics compared by \maintain.
+type databaseSizes struct {
+	file, wal int64
+	freePages int64
+	pageSize  int64
+	hasFile   bool
+}
+
+func readDatabaseSizes(ctx context.Context) databaseSizes {
+	s := databaseSizes{
+		freePages: pragmaInt(ctx, "freelist_count"),
+		pageSize:  pragmaInt(ctx, "page_size"),
+	}
+	if hasPrivateDatabase(dbPath) || isRemoteDatabase(dbPath) {
+		return s
+	}
+
+	file := databaseFile(dbPath)
+	if info, err := os.Stat(file); err == nil {
+		s.file, s.hasFile = info.Size(), true
+	}
+	if info, err := os.Stat(file + "-wal"); err == nil {
+		s.wal = info.Size()
+	}
+	return s
+}
+
+// printSizeChange prints the size metrics before and after maintenance.
+func printSizeChange(before, after databaseSizes) {
+	if before.hasFile {
+		fmt.Printf("Database file: %s → %s\n",
+			formatByteSize(before.file), formatByteSize(after.file))
+		if before.wal > 0 || after.wal > 0 {
+			fmt.Printf("Write-ahead log: %s → %s\n",
+				formatByteSize(before.wal), formatByteSize(after.wal))
+		}
+	}
+	fmt.Printf("Free pages: %d (%s) → %d (%s)\n",
+		before.freePages, formatByteSize(before.freePages*before.pageSize),
+		after.freePages, formatByteSize(after.freePages*after.pageSize))
+}
+
+// handleMaintainCommand runs routine housekeeping: by default every step,
+// or the ones given as flags, e.g. \maintain --analyze --checkpoint.
+func handleMaintainCommand(args []string) error {
+	selected := make(map[string]bool)
+	for _, arg := range args {
+		name, ok := strings.CutPrefix(arg, "--")
+		found := false
+		for _, step := range maintenanceSteps {
+			found = found || ok && step.name == name
+		}
+		if !found {
+			var flags []string
+			for _, step := range maintenanceSteps {
+				flags = append(flags, "--"+step.name)
+			}
+			fmt.Printf("Usage: \\maintain [%s]\n",
+				strings.Join(flags, "] ["))
+			return errUsage
+		}
+		selected[name] = true
+	}
+
+	if readOnly {
+		err := errors.New("the database is open read-only")
+		fmt.Printf("Maintain error: %v\n", err)
+		return err
+	}
+	if len(undoStack) > 0 || transactionOpen() {
+		err := errors.New("a transaction is open, COMMIT or ROLLBACK " +
+			"it first")
+		fmt.Printf("Maintain error: %v\n", err)
+		return err
+	}
+
+	ctx := context.Background()
+	before := readDatabaseSizes(ctx)
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Step", "Time", "Result"})
+
+	start := time.Now()
+	for _, step := range maintenanceSteps {
+		if len(selected) > 0 && !selected[step.name] {
+			continue
+		}
+
+		stop := startSpinner(step.desc)
+		stepStart := time.Now()
+		note, err := step.run(ctx)
+		elapsed := time.Since(stepStart)
+		stop()
+
+		var skipped skippedStep
+		switch {
+		case errors.As(err, &skipped):
+			t.AppendRow(table.Row{step.name, "",
+				"skipped, " + string(skipped)})
+
+		case err != nil:
+			t.AppendRow(table.Row{step.name, formatStepTime(elapsed),
+				"error: " + err.Error()})
+
+		default:
+			if note == "" {
+				note = "done"
+			}
+			t.AppendRow(table.Row{step.name, formatStepTime(elapsed),
+				note})
+		}
+	}
+	t.AppendFooter(table.Row{"total", formatStepTime(time.Since(start)),
+		""})
+	t.Render()
+
+	printSizeChange(before, readDatabaseSizes(ctx))
+	return nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maskAction is what a masking rule does to the values of a column.
+type maskAction int
+
+const (
+	// maskKeep leaves the values as they are. It exempts columns from
+	// broader rules listed after it.
+	maskKeep maskAction = iota
+
+	// maskHash replaces values with a salted SHA-256 of them, which
+	// keeps equal values equal so that joins still work.
+	maskHash
+
+	// maskRedact replaces values with a fixed one of the same type.
+	maskRedact
+
+	// maskRandomize replaces values with random ones of the same type
+	// and length.
+	maskRandomize
+)
+
+var maskActionNames = map[maskAction]string{
+	maskKeep:      "keep",
+	maskHash:      "hash",
+	maskRedact:    "redact",
+	maskRandomize: "randomize",
+}
+
+func (a maskAction) String() string {
+	return maskActionNames[a]
+}
+
+// maskRuleConfig is a masking rule as written in the config file.
+type maskRuleConfig struct {
+	Column string `json:"column"`
+	Action string `json:"action"`
+}
+
+// maskRule applies an action to the columns matching a glob pattern.
+// Patterns containing a dot match table.column, others the column name.
+type maskRule struct {
+	pattern string
+	action  maskAction
+}
+
+var (
+	// maskRules are applied by \export, \fixture and the dump command.
+	// The first matching rule wins.
+	maskRules []maskRule
+
+	// maskSalt is mixed into hashed values, so that values with little
+	// entropy can't be recovered by hashing candidates.
+	maskSalt string
+
+	// maskingEnabled is toggled with \set masking.
+	maskingEnabled = true
+)
+
+// setMaskRules replaces the masking rules with the configured ones.
+func setMaskRules(configs []maskRuleConfig, salt string) error {
+	rules := make([]maskRule, 0, len(configs))
+	for _, c := range configs {
+		pattern := strings.ToLower(c.Column)
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid masking pattern %q", c.Column)
+		}
+
+		action, ok := maskKeep, false
+		for a, name := range maskActionNames {
+			if strings.EqualFold(c.Action, name) {
+				action, ok = a, true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown masking action %q for %s, "+
+				"expected hash, redact, randomize or keep",
+				c.Action, c.Column)
+		}
+
+		rules = append(rules, maskRule{pattern: pattern, action: action})
+	}
+
+	maskRules = rules
+	maskSalt = salt
+	return nil
+}
+
+// columnMask returns the masking action for a column. The table is "" when
+// it isn't known, in which case only column name patterns apply.
+func columnMask(table, column string) maskAction {
+	if !maskingEnabled {
+		return maskKeep
+	}
+
+	table, column = strings.ToLower(table), strings.ToLower(column)
+	for _, r := range maskRules {
+		name := column
+		if strings.Contains(r.pattern, ".") {
+			if table == "" {
+				continue
+			}
+			name = table + "." + column
+		}
+
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r.action
+		}
+	}
+
+	return maskKeep
+}
+
+// columnMasks returns the masking actions for the columns of a table, or
+// nil if none of them is masked.
+func columnMasks(table string, cols []string) []maskAction {
+	var masks []maskAction
+	for i, col := range cols {
+		if a := columnMask(table, col); a != maskKeep {
+			if masks == nil {
+				masks = make([]maskAction, len(cols))
+			}
+			masks[i] = a
+		}
+	}
+	return masks
+}
+
+// maskDigest hashes a value with the salt.
+func maskDigest(b []byte) [sha256.Size]byte {
+	return sha256.Sum256(append([]byte(maskSalt), b...))
+}
+
+// randomText returns random text as long as the original, keeping to hex
+// digits if the original was hex so that it still looks like a key or hash.
+func randomText(orig string) string {
+	chars := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	if _, err := hex.DecodeString(orig); err == nil && orig != "" {
+		chars = "0123456789abcdef"
+	}
+
+	b := make([]byte, len([]rune(orig)))
+	for i := range b {
+		b[i] = chars[rand.IntN(len(chars))]
+	}
+	return string(b)
+}
+
+// maskValue applies the action to a scanned value. NULLs stay NULL and the
+// storage class doesn't change.
+func maskValue(action maskAction, val interface{}) interface{} {
+	if val == nil || action == maskKeep {
+		return val
+	}
+
+	switch v := val.(type) {
+	case int64:
+		switch action {
+		case maskHash:
+			sum := maskDigest([]byte(strconv.FormatInt(v, 10)))
+			return int64(binary.BigEndian.Uint64(sum[:8]) >> 1)
+
+		case maskRandomize:
+			digits := len(strconv.FormatInt(v, 10))
+			return rand.Int64N(int64(math.Pow10(min(digits, 18))))
+		}
+		return int64(0)
+
+	case float64:
+		switch action {
+		case maskHash:
+			sum := maskDigest([]byte(sqlLiteral(v)))
+			return float64(binary.BigEndian.Uint64(sum[:8])>>11) /
+				(1 << 53)
+
+		case maskRandomize:
+			return rand.Float64() * math.Max(math.Abs(v), 1)
+		}
+		return 0.0
+
+	case bool:
+		if v {
+			return maskValue(action, int64(1))
+		}
+		return maskValue(action, int64(0))
+
+	case []byte:
+		switch action {
+		case maskHash:
+			sum := maskDigest(v)
+			return sum[:]
+
+		case maskRandomize:
+			b := make([]byte, len(v))
+			for i := range b {
+				b[i] = byte(rand.IntN(256))
+			}
+			return b
+		}
+		return []byte{}
+
+	case time.Time:
+		return maskValue(action, formatTimePadded(v))
+
+	default:
+		s := fmt.Sprint(v)
+		switch action {
+		case maskHash:
+			sum := maskDigest([]byte(s))
+			return hex.EncodeToString(sum[:])
+
+		case maskRandomize:
+			return randomText(s)
+		}
+		return "REDACTED"
+	}
+}
+
+// literalValue parses a literal as written by SQLite's quote().
+func literalValue(lit string) (interface{}, error) {
+	switch {
+	case lit == "NULL":
+		return nil, nil
+
+	case strings.HasPrefix(lit, "'"):
+		s := strings.TrimSuffix(strings.TrimPrefix(lit, "'"), "'")
+		return strings.ReplaceAll(s, "''", "'"), nil
+
+	case strings.HasPrefix(lit, "X'"):
+		return hex.DecodeString(lit[2 : len(lit)-1])
+
+	case strings.ContainsAny(lit, ".eEIN"):
+		return strconv.ParseFloat(lit, 64)
+
+	default:
+		return strconv.ParseInt(lit, 10, 64)
+	}
+}
+
+// maskLiteral applies the action to a value in quote() form.
+func maskLiteral(action maskAction, lit string) string {
+	if action == maskKeep {
+		return lit
+	}
+
+	val, err := literalValue(lit)
+	if err != nil {
+		// Never let a value through unmasked.
+		return "NULL"
+	}
+	return sqlLiteral(maskValue(action, val))
+}
+
+// maskedRows masks the values of a result as they are scanned.
+type maskedRows struct {
+	resultRows
+	masks []maskAction
+}
+
+func (m *maskedRows) Scan(dest ...interface{}) error {
+	if err := m.resultRows.Scan(dest...); err != nil {
+		return err
+	}
+
+	for i, d := range dest {
+		if p, ok := d.(*interface{}); ok && i < len(m.masks) {
+			*p = maskValue(m.masks[i], *p)
+		}
+	}
+	return nil
+}
+
+// maskResult wraps a result to be exported so that its values are masked.
+// The source table is only known for simple single-table queries, so
+// table.column patterns don't apply to joins.
+func maskResult(rows resultRows, query string) (resultRows, error) {
+	if len(maskRules) == 0 {
+		return rows, nil
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	masks := columnMasks(queryTable(query), cols)
+	if masks == nil {
+		return rows, nil
+	}
+
+	return &maskedRows{resultRows: rows, masks: masks}, nil
+}
+
+func setMaskingOption(args []string) error {
+	on, err := parseOnOff(args)
+	if err != nil {
+		return err
+	}
+	maskingEnabled = on
+	return nil
+}
+
+// maskingSetting describes the masking state.
+func maskingSetting() string {
+	if len(maskRules) == 0 {
+		return onOff(maskingEnabled) + " (no rules configured)"
+	}
+	return fmt.Sprintf("%s (%d rules)", onOff(maskingEnabled),
+		len(maskRules))
+}
@@ -0,0 +1,564 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// metaCommandSpec describes how a meta-command takes its arguments.
+type metaCommandSpec struct {
+	// usage is printed when the arguments don't fit.
+	usage string
+
+	// minArgs and maxArgs bound the number of arguments, maxArgs is -1
+	// for no limit. Commands taking their arguments verbatim aren't
+	// checked.
+	minArgs, maxArgs int
+
+	// flags are the options the command accepts, anything else starting
+	// with - is rejected. Commands without flags parse their own.
+	flags []string
+
+	// run takes the arguments split into words, see splitMetaArgs. The
+	// error it returns when the command fails, which it reported already,
+	// stops a script and shows in \errverbose.
+	run func(args []string) error
+
+	// runRaw takes the text after the command as typed, for commands
+	// whose arguments are SQL or values that keep their quotes.
+	runRaw func(rest string) error
+}
+
+// errUsage is returned by commands given arguments they don't take, after
+// printing their usage.
+var errUsage = errors.New("invalid arguments")
+
+// metaCommands maps the meta-commands to their specs.
+var metaCommands map[string]metaCommandSpec
+
+func init() {
+	metaCommands = map[string]metaCommandSpec{
+		`\?`: {
+			usage:   `\? [word]`,
+			maxArgs: -1,
+			run:     handleMetaHelpCommand,
+		},
+		`\h`: {
+			usage:   `\h [statement]`,
+			maxArgs: -1,
+			run:     handleSQLHelpCommand,
+		},
+		`\x`: {
+			usage:   `\x [on|off|auto]`,
+			maxArgs: 1,
+			run:     handleExpandedCommand,
+		},
+		`\j`: {
+			usage: `\j`,
+			run:   handleJSONCommand,
+		},
+		`\d`: {
+			usage:   `\d [table|pattern] | \d --json [table]`,
+			maxArgs: 2,
+			flags:   []string{"--json"},
+			run:     handleDescribeCommand,
+		},
+		`\d+`: {
+			usage:   `\d+ [--by-size] [pattern]`,
+			maxArgs: 2,
+			flags:   []string{"--by-size"},
+			run: func(args []string) error {
+				return handleDescribeVerboseCommand(args, "table",
+					"view")
+			},
+		},
+		`\dt+`: {
+			usage:   `\dt+ [--by-size] [pattern]`,
+			maxArgs: 2,
+			flags:   []string{"--by-size"},
+			run: func(args []string) error {
+				return handleDescribeVerboseCommand(args, "table")
+			},
+		},
+		`\dt`: {
+			usage:   `\dt [pattern]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				pattern := strings.Join(args, "")
+				err := printRelationList(pattern, false, false, "table")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`\di+`: {
+			usage:   `\di+ <index>`,
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(args []string) error {
+				err := printIndexDetails(args[0])
+				if err != nil {
+					fmt.Printf("Index error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`\advise`: {
+			usage:   `\advise [workload-file]`,
+			maxArgs: 1,
+			run:     handleAdviseCommand,
+		},
+		`\dstats`: {
+			usage:   `\dstats [table]`,
+			maxArgs: 1,
+			run:     handleDStatsCommand,
+		},
+		`\dv`: {
+			usage:   `\dv [pattern]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				pattern := strings.Join(args, "")
+				err := printRelationList(pattern, false, false, "view")
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`\di`: {
+			usage:   `\di [pattern]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				err := printIndexList(strings.Join(args, ""))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`\df`: {
+			usage:   `\df [pattern]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				err := printFunctionList(strings.Join(args, ""))
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`\dO`: {
+			usage: `\dO`,
+			run: func([]string) error {
+				err := printCollationList()
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+				}
+				return err
+			},
+		},
+		`.schema`: {
+			usage:   `.schema [--raw] [table|pattern]`,
+			maxArgs: 2,
+			flags:   []string{"--raw"},
+			run:     handleSchemaCommand,
+		},
+		`\schema`: {
+			usage:   `\schema [--raw] [table] | \schema snapshot|diff|export ...`,
+			maxArgs: -1,
+			run: func(args []string) error {
+				if len(args) > 0 && (args[0] == "snapshot" ||
+					args[0] == "diff" || args[0] == "export") {
+
+					return handleSchemaSnapshotCommand(args)
+				}
+				if len(args) > 2 {
+					fmt.Println("Usage: \\schema [--raw] [table]")
+					return errUsage
+				}
+				return handleSchemaCommand(args)
+			},
+		},
+		`\log`: {
+			usage:   `\log [on [file]|off]`,
+			maxArgs: 2,
+			run:     handleLogCommand,
+		},
+		`\workload`: {
+			usage:   `\workload [record <file>|stop]`,
+			maxArgs: 2,
+			run:     handleWorkloadCommand,
+		},
+		`\slowlog`: {
+			usage:   `\slowlog [top] [N] | \slowlog clear`,
+			maxArgs: 2,
+			run:     handleSlowLogCommand,
+		},
+		`\timing`: {
+			usage:   `\timing [on|off]`,
+			maxArgs: 1,
+			run:     handleTimingCommand,
+		},
+		`\bench`: {
+			usage:  benchUsage,
+			runRaw: handleBenchCommand,
+		},
+		`\integrity`: {
+			usage:   `\integrity [quick]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				if len(args) == 1 && args[0] != "quick" {
+					fmt.Println("Usage: \\integrity [quick]")
+					return errUsage
+				}
+				return handleIntegrityCommand(len(args) == 1)
+			},
+		},
+		`\maintain`: {
+			usage: `\maintain [--analyze] [--optimize] [--vacuum] ` +
+				`[--checkpoint]`,
+			flags: []string{"--analyze", "--optimize", "--vacuum",
+				"--checkpoint"},
+			maxArgs: -1,
+			run:     handleMaintainCommand,
+		},
+		`\planbaseline`: {
+			usage:  planBaselineUsage,
+			runRaw: handlePlanBaselineCommand,
+		},
+		`\fkcheck`: {
+			usage:   `\fkcheck [table]`,
+			maxArgs: 1,
+			run: func(args []string) error {
+				return handleFKCheckCommand(strings.Join(args, ""))
+			},
+		},
+		`\recover`: {
+			usage:   `\recover <file>`,
+			minArgs: 1,
+			maxArgs: 1,
+			run: func(args []string) error {
+				return handleRecoverCommand(args[0])
+			},
+		},
+		`\pragmas`: {
+			usage:   `\pragmas [edit [name]]`,
+			maxArgs: 2,
+			run:     handlePragmasCommand,
+		},
+		`\fk`: {
+			usage:   `\fk [on|off]`,
+			maxArgs: 1,
+			run:     handleFKCommand,
+		},
+		`\version`: {
+			usage: `\version`,
+			run:   handleVersionCommand,
+		},
+		`\errverbose`: {
+			usage: `\errverbose`,
+			run:   handleErrVerboseCommand,
+		},
+		`\conninfo`: {
+			usage: `\conninfo`,
+			run: func([]string) error {
+				printConnInfo()
+				return nil
+			},
+		},
+		`\dups`: {
+			usage:   `\dups <table> [col[,col...]]`,
+			maxArgs: -1,
+			run:     handleDupsCommand,
+		},
+		`\blobout`: {
+			usage:   `\blobout <table> <column> <rowid> <file>`,
+			minArgs: 4,
+			maxArgs: 4,
+			run:     handleBlobOutCommand,
+		},
+		`\hexdump`: {
+			usage:   `\hexdump <table> <column> <rowid> [offset [length]]`,
+			minArgs: 3,
+			maxArgs: 5,
+			run:     handleHexdumpCommand,
+		},
+		`\checksum`: {
+			usage:   `\checksum <table> [col[,col...]]`,
+			maxArgs: -1,
+			run:     handleChecksumCommand,
+		},
+		`\sample`: {
+			usage:   `\sample <table> [N]`,
+			maxArgs: -1,
+			run:     handleSampleCommand,
+		},
+		`\browse`: {
+			usage:  `\browse [query | auto [on|off]]`,
+			runRaw: handleBrowseCommand,
+		},
+		`\cols`: {
+			usage:   `\cols [names|reset]`,
+			maxArgs: -1,
+			run:     handleColsCommand,
+		},
+		`\export`: {
+			usage:  `\export <format> <file> [query]`,
+			runRaw: handleExportCommand,
+		},
+		`\alter`: {
+			usage:  `\alter [--run] [-o file] <table> [CREATE TABLE ...]`,
+			runRaw: handleAlterCommand,
+		},
+		`\snapshot`: {
+			usage:   `\snapshot [begin|end]`,
+			maxArgs: 1,
+			run:     handleSnapshotCommand,
+		},
+		`\views`: {
+			usage:   `\views deps|rebuild [table|view]`,
+			maxArgs: -1,
+			run:     handleViewsCommand,
+		},
+		`\trigger`: {
+			usage:   `\trigger [list] | \trigger disable|enable <name ...>`,
+			maxArgs: -1,
+			run:     handleTriggerCommand,
+		},
+		`\session`: {
+			usage:   `\session [start|changeset|stop|apply] ...`,
+			maxArgs: -1,
+			run:     handleSessionCommand,
+		},
+		`\notify`: {
+			usage:   `\notify [on|off]`,
+			maxArgs: 1,
+			run:     handleNotifyCommand,
+		},
+		`\row`: {
+			usage:   `\row <table> <key> [key...]`,
+			maxArgs: -1,
+			run:     handleRowCommand,
+		},
+		`\fixture`: {
+			usage:  `\fixture [-o file] <table> [WHERE <condition>]`,
+			runRaw: handleFixtureCommand,
+		},
+		`\g`: {
+			usage:   `\g [file]`,
+			maxArgs: 1,
+			run:     handleGCommand,
+		},
+		`\undo`: {
+			usage:   `\undo [N]`,
+			maxArgs: 1,
+			run:     handleUndoCommand,
+		},
+		`\compare`: {
+			usage:  `\compare [<query A> ;; <query B>]`,
+			runRaw: handleCompareCommand,
+		},
+		`\results`: {
+			usage:   `\results [n]`,
+			maxArgs: 1,
+			run:     handleResultsCommand,
+		},
+		`\sort`: {
+			usage:   `\sort <column> [asc|desc]`,
+			maxArgs: -1,
+			run:     handleSortCommand,
+		},
+		`\crosstabview`: {
+			usage:   `\crosstabview [colV [colH [colD]]]`,
+			maxArgs: 3,
+			run:     handleCrosstabCommand,
+		},
+		`\copylast`: {
+			usage: `\copylast`,
+			run:   handleCopyLastCommand,
+		},
+		`\template`: {
+			usage:   `\template <name> [placeholder=value ...]`,
+			maxArgs: -1,
+			run:     handleTemplateCommand,
+		},
+		`\migrate`: {
+			usage:   `\migrate [--dry-run] <dir>`,
+			maxArgs: -1,
+			run:     handleMigrateCommand,
+		},
+		`\pset`: {
+			usage:   `\pset [option [value]]`,
+			maxArgs: -1,
+			run:     handlePsetCommand,
+		},
+		`\set`: {
+			usage:   `\set [name [value]]`,
+			maxArgs: -1,
+			run:     handleSetCommand,
+		},
+		`\bind`: {
+			usage:  `\bind [name value | --clear [name]]`,
+			runRaw: handleBindCommand,
+		},
+		`\open`: {
+			usage:   `\open [path]`,
+			maxArgs: 1,
+			run:     handleOpenCommand,
+		},
+		`\import`: {
+			usage:   `\import [options] <file> [table]`,
+			maxArgs: -1,
+			run:     handleImportCommand,
+		},
+		`\jsontable`: {
+			usage:   `\jsontable <file> [table]`,
+			minArgs: 1,
+			maxArgs: 2,
+			run: func(args []string) error {
+				name := ""
+				if len(args) == 2 {
+					name = args[1]
+				}
+				err := loadJSONTable(args[0], name)
+				if err != nil {
+					fmt.Printf("JSON load error: %v\n", err)
+				}
+				return err
+			},
+		},
+	}
+}
+
+// isMetaCommand reports whether the input is a meta-command rather than
+// SQL.
+func isMetaCommand(input string) bool {
+	return strings.HasPrefix(input, `\`) || strings.HasPrefix(input, ".")
+}
+
+// runMetaCommand runs a meta-command. Unknown commands, arguments that don't
+// fit the command and failures of the command are returned as the error.
+func runMetaCommand(input string) error {
+	input = strings.TrimSuffix(strings.TrimSpace(input), ";")
+	name, rest := nextField(input)
+
+	spec, ok := metaCommands[name]
+	if !ok {
+		err := fmt.Errorf("invalid command %s", name)
+		fmt.Printf("Invalid command %s, try \\? for the list of "+
+			"commands.\n", name)
+		return err
+	}
+
+	var err error
+	if spec.runRaw != nil {
+		err = spec.runRaw(rest)
+	} else {
+		var args []string
+		args, err = splitMetaArgs(rest)
+		if err == nil {
+			err = spec.checkArgs(args)
+		}
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			fmt.Printf("Usage: %s\n", spec.usage)
+			return err
+		}
+		err = spec.run(args)
+	}
+
+	// A command that ran a failing statement has recorded the statement
+	// itself, which tells more than the command line.
+	if err != nil && err != lastFailure.err {
+		recordFailure(input, err)
+	}
+	return err
+}
+
+// checkArgs checks the number of arguments and the options given.
+func (s metaCommandSpec) checkArgs(args []string) error {
+	if s.flags != nil {
+		for _, arg := range args {
+			if !strings.HasPrefix(arg, "-") {
+				continue
+			}
+			known := false
+			for _, flag := range s.flags {
+				known = known || arg == flag
+			}
+			if !known {
+				return fmt.Errorf("unknown option %s", arg)
+			}
+		}
+	}
+
+	switch {
+	case len(args) < s.minArgs:
+		return errors.New("missing argument")
+
+	case s.maxArgs >= 0 && len(args) > s.maxArgs:
+		if s.maxArgs == 0 {
+			return errors.New("takes no arguments")
+		}
+		return fmt.Errorf("too many arguments, expected at most %d",
+			s.maxArgs)
+	}
+
+	return nil
+}
+
+// splitMetaArgs splits the arguments of a meta-command into words at
+// whitespace. Quotes, single or double, group words with the spaces in
+// between, like in \d "my table", and are removed if they enclose the whole
+// word. A quote inside a quoted word is doubled, as in SQL.
+func splitMetaArgs(s string) ([]string, error) {
+	var args []string
+	for {
+		s = strings.TrimLeft(s, " \t\n")
+		if s == "" {
+			return args, nil
+		}
+
+		var quote byte
+		end := 0
+		for ; end < len(s); end++ {
+			c := s[end]
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+				continue
+			}
+			if c == ' ' || c == '\t' || c == '\n' {
+				break
+			}
+			if c == '\'' || c == '"' {
+				quote = c
+			}
+		}
+		if quote != 0 {
+			return nil, fmt.Errorf("unterminated quoted string %s", s)
+		}
+
+		args = append(args, unquoteArg(s[:end]))
+		s = s[end:]
+	}
+}
+
+// unquoteArg removes the quotes around a word that is quoted as a whole.
+func unquoteArg(word string) string {
+	if len(word) < 2 || (word[0] != '\'' && word[0] != '"') ||
+		word[len(word)-1] != word[0] {
+
+		return word
+	}
+
+	quote := word[:1]
+	inner := strings.ReplaceAll(word[1:len(word)-1], quote+quote, "")
+	if strings.Contains(inner, quote) {
+		return word
+	}
+	return strings.ReplaceAll(word[1:len(word)-1], quote+quote, quote)
+}
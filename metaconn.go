@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// metaBusyTimeout bounds how long introspection waits for a lock
+	// held by a writer, in milliseconds.
+	metaBusyTimeout = 100
+
+	// completionTimeout bounds the queries run while typing.
+	completionTimeout = 300 * time.Millisecond
+)
+
+// metaConn is a second, read-only connection for completion and the \d
+// family of commands. Being apart from the session connection, it neither
+// sees nor disturbs an open user transaction and isn't queued behind a long
+// statement running there.
+var metaConn *sql.Conn
+
+// hasPrivateDatabase reports whether every connection to the database gets
+// a database of its own, which a second connection can't look into.
+func hasPrivateDatabase(path string) bool {
+	if path == "" || path == ":memory:" {
+		return true
+	}
+	return isDatabaseURI(path) && strings.Contains(path, "mode=memory") &&
+		!strings.Contains(path, "cache=shared")
+}
+
+// openMetaConn takes the metadata connection from the session pool. Remote
+// databases don't lock out readers, so they go without one.
+func openMetaConn(ctx context.Context) {
+	if hasPrivateDatabase(dbPath) || isRemoteDatabase(dbPath) {
+		return
+	}
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return
+	}
+	_, err = c.ExecContext(ctx, "PRAGMA query_only = ON")
+	if err == nil {
+		_, err = c.ExecContext(ctx, fmt.Sprintf(
+			"PRAGMA busy_timeout = %d", metaBusyTimeout,
+		))
+	}
+	if err != nil {
+		c.Close()
+		return
+	}
+
+	metaConn = c
+}
+
+// closeMetaConn returns the metadata connection to its pool, with the
+// settings of the pool's other connections.
+func closeMetaConn() {
+	if metaConn == nil {
+		return
+	}
+
+	ctx := context.Background()
+	metaConn.ExecContext(ctx, "PRAGMA query_only = OFF")
+	metaConn.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d",
+		busyTimeout))
+	metaConn.Close()
+	metaConn = nil
+}
+
+// metadata returns the connection for introspection: the metadata
+// connection, or the session connection if there is none.
+func metadata() *sql.Conn {
+	if metaConn != nil {
+		return metaConn
+	}
+	return conn
+}
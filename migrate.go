@@ -0,0 +1,345 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// migrationFileRe matches migration file names: a version number
+	// followed by an optional description, as in 0003_add_users.sql.
+	migrationFileRe = regexp.MustCompile(`^(\d+)(?:[_.-].*)?\.sql$`)
+
+	// runnerStatementRe matches the statements of a migration that the
+	// runner takes care of itself: transaction control and foreign key
+	// handling, as found in scripts made with \schema diff.
+	runnerStatementRe = regexp.MustCompile(
+		`(?i)^(?:BEGIN|COMMIT|END|PRAGMA\s+foreign_keys\s*=|` +
+			`PRAGMA\s+foreign_key_check)\b`,
+	)
+)
+
+// migrationsTable records the applied migrations.
+const migrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TEXT NOT NULL
+)`
+
+// migration is a numbered .sql file in a migrations directory.
+type migration struct {
+	version int64
+	name    string
+	path    string
+}
+
+// readMigrations lists the migrations in dir ordered by version. Files
+// ending in .down.sql are left out, they are for rolling back by hand.
+func readMigrations(dir string) ([]migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []migration
+	seen := make(map[int64]string)
+	for _, e := range entries {
+		name := e.Name()
+		m := migrationFileRe.FindStringSubmatch(name)
+		if e.IsDir() || m == nil || strings.HasSuffix(name, ".down.sql") {
+			continue
+		}
+
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version: %w", name, err)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("%s and %s have the same version",
+				other, name)
+		}
+		seen[version] = name
+
+		migrations = append(migrations, migration{
+			version: version,
+			name:    name,
+			path:    filepath.Join(dir, name),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations.
+func appliedMigrations(ctx context.Context, c *sql.Conn) (map[int64]bool,
+	error) {
+
+	applied := make(map[int64]bool)
+
+	// A dry run doesn't create the table, so it may not exist yet.
+	var n int
+	err := c.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master
+		WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&n)
+	if err != nil || n == 0 {
+		return applied, err
+	}
+
+	rows, err := c.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// migrationStatements reads the statements of a migration file.
+func migrationStatements(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stmts []string
+	scanner := newStatementScanner(f)
+	for {
+		stmt, err := scanner.next()
+		if errors.Is(err, io.EOF) {
+			return stmts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(stmt, `\`) {
+			return nil, fmt.Errorf("meta-command %s is not supported "+
+				"in migrations", strings.Fields(stmt)[0])
+		}
+		if runnerStatementRe.MatchString(stmt) {
+			continue
+		}
+		stmts = append(stmts, stmt)
+	}
+}
+
+// execMigration runs the statements of a migration in the transaction and
+// records it as applied.
+func execMigration(ctx context.Context, tx *sql.Tx, m migration) error {
+	stmts, err := migrationStatements(m.path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, migrationsTable); err != nil {
+		return err
+	}
+
+	for i, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+
+	// Foreign keys are off while migrating so that tables can be
+	// rebuilt, so check what they would have caught before committing.
+	var table string
+	err = tx.QueryRowContext(ctx, "PRAGMA foreign_key_check").Scan(
+		&table, new(interface{}), new(interface{}), new(interface{}),
+	)
+	switch {
+	case err == nil:
+		return fmt.Errorf("foreign key violations in table %s", table)
+
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations
+		(version, name, applied_at)
+		VALUES (?, ?, strftime('%Y-%m-%dT%H:%M:%SZ', 'now'))`,
+		m.version, m.name)
+
+	return err
+}
+
+// runMigrations applies the pending migrations in dir in order, each in its
+// own transaction, and stops at the first one that fails. A dry run
+// applies them all in one transaction that is rolled back, so that errors
+// show up without changing the database. It returns the number of
+// migrations applied.
+func runMigrations(ctx context.Context, c *sql.Conn, dir string,
+	dryRun bool) (int, error) {
+
+	migrations, err := readMigrations(dir)
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(ctx, c)
+	if err != nil {
+		return 0, err
+	}
+
+	// PRAGMA foreign_keys is a no-op inside a transaction, so it is
+	// turned off around them.
+	var fkOn int
+	if err := c.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(
+		&fkOn); err != nil {
+
+		return 0, err
+	}
+	if fkOn != 0 {
+		if _, err := c.ExecContext(ctx,
+			"PRAGMA foreign_keys = OFF"); err != nil {
+
+			return 0, err
+		}
+		defer c.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	var (
+		tx *sql.Tx
+		n  int
+	)
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		if tx == nil {
+			tx, err = c.BeginTx(ctx, nil)
+			if err != nil {
+				return n, err
+			}
+		}
+		if err := execMigration(ctx, tx, m); err != nil {
+			return n, fmt.Errorf("%s: %w", m.name, err)
+		}
+
+		if dryRun {
+			fmt.Printf("Would apply %s\n", m.name)
+			n++
+			continue
+		}
+
+		err = tx.Commit()
+		tx = nil
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", m.name, err)
+		}
+		fmt.Printf("Applied %s\n", m.name)
+		n++
+	}
+
+	return n, nil
+}
+
+// printMigrationResult reports how many migrations were applied.
+func printMigrationResult(n int, dryRun bool) {
+	switch {
+	case n == 0:
+		fmt.Println("No pending migrations.")
+
+	case dryRun:
+		fmt.Printf("%d migrations would be applied, nothing was "+
+			"changed.\n", n)
+
+	default:
+		fmt.Printf("Applied %d migrations.\n", n)
+	}
+}
+
+// migrateFlags are the options of the migrate subcommand.
+var migrateFlags struct {
+	dryRun bool
+}
+
+// defineMigrateFlags defines the options of the migrate subcommand.
+func defineMigrateFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&migrateFlags.dryRun, "dry-run", false, "check the "+
+		"pending migrations and roll them back")
+}
+
+func runMigrateCommand(args []string) int {
+	fs := newSubcommandFlags("migrate")
+	fs.Parse(args)
+	dryRun := migrateFlags.dryRun
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 1
+	}
+
+	ctx := context.Background()
+
+	migrateDB, err := openDatabase(fs.Arg(0), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate error: %v\n", err)
+		return 1
+	}
+	defer migrateDB.Close()
+
+	c, err := migrateDB.Conn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate error: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	n, err := runMigrations(ctx, c, fs.Arg(1), dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Migrate error: %v\n", err)
+		return 1
+	}
+	printMigrationResult(n, dryRun)
+
+	return 0
+}
+
+// handleMigrateCommand applies migrations to the session database.
+func handleMigrateCommand(args []string) error {
+	dryRun := len(args) > 0 && args[0] == "--dry-run"
+	if dryRun {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Println("Usage: \\migrate [--dry-run] <dir>")
+		return errUsage
+	}
+
+	n, err := runMigrations(context.Background(), conn, args[0], dryRun)
+	if err != nil {
+		fmt.Printf("Migrate error: %v\n", err)
+		return err
+	}
+	printMigrationResult(n, dryRun)
+	return nil
+}
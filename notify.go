@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// notifyInterval is how often \notify checks the database for changes.
+const notifyInterval = time.Second
+
+// sessionMu is held while the executor runs, so that background checks of
+// the session connection only happen while the prompt is idle.
+var sessionMu sync.Mutex
+
+// changeWatcher polls the session connection for commits by other
+// connections. PRAGMA data_version only changes for those, unlike update
+// hooks, which only see changes made on their own connection and so can't
+// tell about other processes.
+type changeWatcher struct {
+	stop chan struct{}
+	done chan struct{}
+
+	// c is the connection the versions were read on, \open replaces
+	// the session connection.
+	c             *sql.Conn
+	dataVersion   int64
+	schemaVersion int64
+}
+
+var (
+	watcher *changeWatcher
+
+	// notices are shown above the prompt by the next read of the
+	// terminal, see keymapParser.
+	notices = make(chan string, 16)
+)
+
+// readVersions reads the data and schema versions of the session
+// connection.
+func readVersions(ctx context.Context) (int64, int64, error) {
+	var dataVersion, schemaVersion int64
+	err := conn.QueryRowContext(ctx, "PRAGMA data_version").
+		Scan(&dataVersion)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = conn.QueryRowContext(ctx, "PRAGMA schema_version").
+		Scan(&schemaVersion)
+
+	return dataVersion, schemaVersion, err
+}
+
+// check compares the versions with the last ones seen and queues a notice
+// if they changed. It is skipped while a statement runs.
+func (w *changeWatcher) check() {
+	if !sessionMu.TryLock() {
+		return
+	}
+	defer sessionMu.Unlock()
+
+	dataVersion, schemaVersion, err := readVersions(context.Background())
+	if err != nil {
+		return
+	}
+
+	changed := w.c == conn && dataVersion != w.dataVersion
+	schemaChanged := w.c == conn && schemaVersion != w.schemaVersion
+	w.c, w.dataVersion, w.schemaVersion = conn, dataVersion, schemaVersion
+	if !changed {
+		return
+	}
+
+	msg := "data"
+	if schemaChanged {
+		dbSchema.invalidate()
+		msg = "schema"
+	}
+
+	notice := fmt.Sprintf("NOTE: another process changed the %s of %s "+
+		"at %s.", msg, redactDatabaseName(dbPath),
+		time.Now().Format("15:04:05"))
+	select {
+	case notices <- notice:
+	default:
+	}
+}
+
+func (w *changeWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(notifyInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// startWatcher starts polling for changes. It is called by the executor,
+// which holds sessionMu.
+func startWatcher() error {
+	dataVersion, schemaVersion, err := readVersions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	watcher = &changeWatcher{
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		c:             conn,
+		dataVersion:   dataVersion,
+		schemaVersion: schemaVersion,
+	}
+	go watcher.run()
+
+	return nil
+}
+
+// stopWatcher stops polling. The executor holds sessionMu, so a check in
+// progress is skipped rather than waited for.
+func stopWatcher() {
+	if watcher == nil {
+		return
+	}
+
+	close(watcher.stop)
+	<-watcher.done
+	watcher = nil
+}
+
+// printNotices shows the queued notices on their own lines, the prompt is
+// drawn again below them.
+func printNotices() {
+	for {
+		select {
+		case notice := <-notices:
+			fmt.Printf("\r\033[K%s\n", notice)
+		default:
+			return
+		}
+	}
+}
+
+func handleNotifyCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		fmt.Printf("Change notices are %s\n", onOff(watcher != nil))
+
+	case len(args) == 1 && args[0] == "on":
+		if watcher == nil {
+			if err := startWatcher(); err != nil {
+				fmt.Printf("Notify error: %v\n", err)
+				return err
+			}
+		}
+		fmt.Println("Change notices are now on")
+
+	case len(args) == 1 && args[0] == "off":
+		stopWatcher()
+		fmt.Println("Change notices are now off")
+
+	default:
+		fmt.Println("Usage: \\notify [on|off]")
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// readOnly opens databases without write access.
+var readOnly bool
+
+// uriPathEscaper escapes the characters that have a meaning in SQLite URI
+// filenames.
+var uriPathEscaper = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+var uriModeRe = regexp.MustCompile(`(^|&)mode=[^&]*`)
+
+// isDatabaseURI reports whether the database name is a "file:" URI.
+func isDatabaseURI(name string) bool {
+	return strings.HasPrefix(name, "file:")
+}
+
+// splitDatabaseURI splits a "file:" URI into its unescaped file path and its
+// query parameters.
+func splitDatabaseURI(uri string) (string, string) {
+	rest := strings.TrimPrefix(uri, "file:")
+	rest, _, _ = strings.Cut(rest, "#")
+	path, query, _ := strings.Cut(rest, "?")
+
+	// An authority, if present, may only be empty or localhost.
+	if after, ok := strings.CutPrefix(path, "//"); ok {
+		if i := strings.IndexByte(after, '/'); i >= 0 {
+			path = after[i:]
+		}
+	}
+
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+
+	return path, query
+}
+
+// databaseFile returns the file a database name refers to.
+func databaseFile(name string) string {
+	if isDatabaseURI(name) {
+		path, _ := splitDatabaseURI(name)
+		return path
+	}
+	return name
+}
+
+// databaseDSN turns a database name given by the user into the name passed
+// to the driver. Plain paths are converted to URIs, since the driver would
+// otherwise cut them at the first "?". URIs are passed through unchanged so
+// that SQLite sees all of their parameters.
+func databaseDSN(name string, readOnly bool) string {
+	if name == "" || name == ":memory:" {
+		return name
+	}
+
+	uri := name
+	if !isDatabaseURI(name) {
+		uri = "file:" + uriPathEscaper.Replace(name)
+	}
+
+	if !readOnly {
+		return uri
+	}
+
+	base, query, _ := strings.Cut(uri, "?")
+	query = uriModeRe.ReplaceAllString(query, "")
+	query = strings.TrimPrefix(query, "&")
+	if query == "" {
+		return base + "?mode=ro"
+	}
+	return base + "?" + query + "&mode=ro"
+}
+
+// driverFor returns the driver that opens the named database: the rqlite or
+// libsql driver for remote URLs and the selected local driver otherwise.
+func driverFor(name string) sqliteDriver {
+	switch {
+	case isRqliteDatabase(name):
+		return rqliteDriver{}
+
+	case isRemoteDatabase(name):
+		return libsqlDriver{}
+
+	default:
+		return activeDriver
+	}
+}
+
+// openDatabase opens the database at path, honoring the session's global
+// options.
+func openDatabase(path string, readOnly bool) (*sql.DB, error) {
+	if isSSHDatabase(path) {
+		local, err := fetchSSHSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		path = local
+	}
+
+	if isRemoteDatabase(path) {
+		if readOnly {
+			return nil, fmt.Errorf("read-only mode is not " +
+				"supported for remote databases")
+		}
+		return driverFor(path).open(path)
+	}
+
+	if readOnly {
+		// SQLite's own error for a missing file is unhelpful.
+		if _, err := os.Stat(databaseFile(path)); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkDatabaseFile(path); err != nil {
+		return nil, err
+	}
+
+	return activeDriver.open(databaseDSN(path, readOnly))
+}
+
+// databaseURIParams returns the query parameters of a database URI as
+// name=value pairs, in the order given.
+func databaseURIParams(name string) []string {
+	if !isDatabaseURI(name) {
+		return nil
+	}
+
+	_, query := splitDatabaseURI(name)
+
+	var params []string
+	for _, p := range strings.Split(query, "&") {
+		if p == "" {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(p); err == nil {
+			p = unescaped
+		}
+		params = append(params, p)
+	}
+
+	return params
+}
+
+// sqliteMagic starts every SQLite database file.
+const sqliteMagic = "SQLite format 3\x00"
+
+// fileMagics are the headers of files mistaken for databases, with what to
+// tell about them. %s is the file name.
+var fileMagics = []struct {
+	magic string
+	what  string
+}{
+	{"\x37\x7f\x06\x82",
+		"%s is a write-ahead log, open the database it belongs to"},
+	{"\x37\x7f\x06\x83",
+		"%s is a write-ahead log, open the database it belongs to"},
+	{"\xd9\xd5\x05\xf9\x20\xa1\x63\xd7",
+		"%s is a rollback journal, not a database"},
+	{"\x28\xb5\x2f\xfd",
+		"%s is zstd-compressed, decompress it first, e.g. with zstd -d"},
+	{"\x1f\x8b", "%s is gzip-compressed, decompress it first, e.g. " +
+		"with gunzip"},
+	{"\xfd7zXZ\x00", "%s is xz-compressed, decompress it first, e.g. " +
+		"with unxz"},
+	{"BZh", "%s is bzip2-compressed, decompress it first, e.g. with " +
+		"bunzip2"},
+	{"PK\x03\x04", "%s is a zip archive, extract the database first"},
+}
+
+// checkDatabaseFile makes sure that a local database file is an SQLite
+// database, or empty so that SQLite makes it one, before the driver gets
+// to it. SQLite only says "file is not a database" on the first query.
+// Databases read through another VFS may look different and aren't
+// checked.
+func checkDatabaseFile(path string) error {
+	if hasPrivateDatabase(path) ||
+		strings.Contains(strings.Join(databaseURIParams(path), "&"),
+			"vfs=") {
+
+		return nil
+	}
+
+	file := databaseFile(path)
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", file)
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	header = header[:n]
+	if n == 0 || bytes.HasPrefix(header, []byte(sqliteMagic)) {
+		return nil
+	}
+
+	for _, m := range fileMagics {
+		if bytes.HasPrefix(header, []byte(m.magic)) {
+			return fmt.Errorf(m.what, file)
+		}
+	}
+
+	// The -wal and -shm files of WAL mode have no header, or one that was
+	// zeroed when the log was reset.
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if db, ok := strings.CutSuffix(file, suffix); ok {
+			return fmt.Errorf("%s is a leftover of the database %s, "+
+				"not a database", file, db)
+		}
+	}
+
+	if looksLikeText(header) {
+		if sqlDumpRe.Match(header) {
+			return fmt.Errorf("%s is an SQL script, not a database, "+
+				"load it with: vsqlite <new.db> < %s", file, file)
+		}
+		return fmt.Errorf("%s is a text file, not a database", file)
+	}
+
+	return fmt.Errorf("%s is not an SQLite database, or an encrypted one",
+		file)
+}
+
+// looksLikeText reports whether the start of a file is UTF-8 text. The last
+// character may be cut off.
+func looksLikeText(b []byte) bool {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			return len(b) < utf8.UTFMax && !utf8.FullRune(b)
+		case r < ' ' && !strings.ContainsRune("\t\n\r\f", r):
+			return false
+		}
+		b = b[size:]
+	}
+	return true
+}
+
+// sqlDumpRe matches the start of an SQL script, like the output of .dump.
+var sqlDumpRe = regexp.MustCompile(
+	`(?is)^\s*(?:--[^\n]*\n\s*)*(?:PRAGMA|BEGIN|CREATE|INSERT)\b`,
+)
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// pagerEnabled has output longer than the terminal shown in a pager, see
+// printPaged.
+var pagerEnabled = true
+
+// pagerCommand returns the pager to run: $PAGER if set, otherwise less,
+// keeping colors and not wrapping lines, or more.
+func pagerCommand() string {
+	if pager := os.Getenv("PAGER"); pager != "" {
+		return pager
+	}
+	if _, err := exec.LookPath("less"); err == nil {
+		return "less -RS"
+	}
+	return "more"
+}
+
+// printPaged prints text, through the pager if it has more lines than fit
+// on the terminal. Output that isn't going to a terminal, or a pager that
+// fails to start, prints as is.
+func printPaged(text string) {
+	if !pagerEnabled || !term.IsTerminal(int(os.Stdin.Fd())) ||
+		!term.IsTerminal(int(os.Stdout.Fd())) {
+
+		fmt.Print(text)
+		return
+	}
+
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 0 || strings.Count(text, "\n") < height-1 {
+		fmt.Print(text)
+		return
+	}
+
+	cmd := exec.Command("sh", "-c", pagerCommand())
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		fmt.Print(text)
+		return
+	}
+	_ = cmd.Wait()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// homeDir returns the home directory, preferring $HOME so that it works for
+// users without a passwd entry, e.g. in containers.
+func homeDir() string {
+	if home, err := os.UserHomeDir(); err == nil {
+		return home
+	}
+	if usr, err := user.Current(); err == nil {
+		return usr.HomeDir
+	}
+	return ""
+}
+
+// pathSuggestions completes the file path typed so far. word is the part
+// of the input the suggestion replaces, the text after the last space, which
+// may start with a quote or be only the end of a path with spaces. A leading
+// ~ is expanded, SQLite and the commands don't expand it themselves.
+func pathSuggestions(typed, word string) []prompt.Suggest {
+	lead, whole := "", strings.HasSuffix(word, typed)
+	if whole {
+		lead = strings.TrimSuffix(word, typed)
+	}
+
+	home := homeDir()
+	if typed == "~" && whole && home != "" {
+		return []prompt.Suggest{{
+			Text: lead + home + "/", Description: "directory",
+		}}
+	}
+
+	dir, base := filepath.Split(typed)
+	readDir := dir
+	switch {
+	case dir == "":
+		readDir = "."
+	case strings.HasPrefix(dir, "~/") && home != "":
+		readDir = filepath.Join(home, dir[2:])
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var suggestions []prompt.Suggest
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) ||
+			strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".") {
+
+			continue
+		}
+
+		text := word + strings.TrimPrefix(name, base)
+		if whole && strings.HasPrefix(typed, "~/") && home != "" {
+			text = lead + home + strings.TrimPrefix(text, lead+"~")
+		}
+
+		// Symlinks to directories are followed like directories.
+		desc := ""
+		if info, err := os.Stat(filepath.Join(readDir, name)); err == nil &&
+			info.IsDir() {
+
+			text += "/"
+			desc = "directory"
+		}
+		suggestions = append(suggestions, prompt.Suggest{
+			Text: text, Description: desc,
+		})
+	}
+
+	return suggestions
+}
+
+// xdgDir returns a directory of the XDG base directory spec for vsqlite,
+// env naming the variable and fallback the default relative to the home
+// directory. Relative values are invalid according to the spec and are
+// ignored.
+func xdgDir(env, fallback string) string {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "vsqlite")
+	}
+	return filepath.Join(homeDir(), fallback, "vsqlite")
+}
+
+// configDir holds the config file, $XDG_CONFIG_HOME/vsqlite by default.
+func configDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// stateDir holds the history and the other files vsqlite keeps between
+// sessions, $XDG_STATE_HOME/vsqlite by default. VSQLITE_STATE_DIR
+// overrides it.
+func stateDir() string {
+	if dir := os.Getenv("VSQLITE_STATE_DIR"); dir != "" {
+		return dir
+	}
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// ensureParentDir creates the directory of a file about to be written.
+func ensureParentDir(path string) error {
+	return os.MkdirAll(filepath.Dir(path), 0700)
+}
+
+// legacyFiles maps the dotfiles of earlier versions in the home directory
+// to the functions returning their current locations.
+var legacyFiles = []struct {
+	name string
+	path func() string
+}{
+	{".vsqlite_config.json", getConfigFilePath},
+	{".vsqlite_history", getHistoryFilePath},
+	{".vsqlite_recent", getRecentFilePath},
+	{".vsqlite_slow.jsonl", getSlowLogFilePath},
+}
+
+// migrateLegacyFiles moves the dotfiles of earlier versions to their
+// current locations, unless a file already exists there.
+func migrateLegacyFiles() {
+	home := homeDir()
+	if home == "" {
+		return
+	}
+
+	for _, f := range legacyFiles {
+		oldPath := filepath.Join(home, f.name)
+		newPath := f.path()
+		if _, err := os.Stat(oldPath); err != nil {
+			continue
+		}
+		if _, err := os.Stat(newPath); err == nil {
+			continue
+		}
+
+		if err := moveFile(oldPath, newPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to move %s to %s: %v\n",
+				oldPath, newPath, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Moved %s to %s\n", oldPath, newPath)
+	}
+}
+
+// moveFile renames a file, copying it if the new location is on another
+// file system.
+func moveFile(oldPath, newPath string) error {
+	if err := ensureParentDir(newPath); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(oldPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(
+		newPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600,
+	)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(newPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(newPath)
+		return err
+	}
+
+	return os.Remove(oldPath)
+}
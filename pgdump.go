@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// pgLengthRe matches the precision and scale of a declared type.
+	pgLengthRe = regexp.MustCompile(`\(\s*\d+\s*(?:,\s*\d+\s*)?\)`)
+
+	// pgDefaults maps SQLite default expressions to PostgreSQL ones, by
+	// their lower case text without spaces.
+	pgDefaults = map[string]string{
+		"datetime('now')":       "CURRENT_TIMESTAMP",
+		"datetime('now','utc')": "CURRENT_TIMESTAMP",
+		"date('now')":           "CURRENT_DATE",
+		"time('now')":           "CURRENT_TIME",
+		"strftime('%s','now')":  "extract(epoch from now())::bigint",
+		"unixepoch()":           "extract(epoch from now())::bigint",
+		"unixepoch('now')":      "extract(epoch from now())::bigint",
+	}
+)
+
+// pgColumnType maps the declared type of a column to a PostgreSQL type.
+// SQLite doesn't enforce lengths, so character types become text, and
+// integers are 64 bits wide. Columns without a type become text, which
+// numbers are converted to on insert.
+func pgColumnType(declType string) string {
+	t := strings.ToUpper(strings.TrimSpace(declType))
+	switch {
+	case strings.Contains(t, "BOOL"):
+		return "boolean"
+
+	case t == "SMALLINT" || t == "TINYINT" || t == "INT2":
+		return "smallint"
+
+	case strings.Contains(t, "INT"):
+		return "bigint"
+
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"),
+		strings.Contains(t, "TEXT"), t == "":
+
+		return "text"
+
+	case strings.Contains(t, "BLOB"):
+		return "bytea"
+
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"),
+		strings.Contains(t, "DOUB"):
+
+		return "double precision"
+
+	case strings.Contains(t, "TIMESTAMP"), strings.Contains(t, "DATETIME"):
+		return "timestamp"
+
+	case strings.Contains(t, "DATE"):
+		return "date"
+
+	case strings.Contains(t, "TIME"):
+		return "time"
+
+	case strings.Contains(t, "JSON"):
+		return "json"
+
+	case strings.Contains(t, "DEC"), strings.Contains(t, "NUMERIC"):
+		return "numeric" + pgLengthRe.FindString(t)
+
+	default:
+		return "numeric"
+	}
+}
+
+// pgLiteral converts a value rendered by SQLite's quote() for a column of
+// the given PostgreSQL type.
+func pgLiteral(pgType, literal string) string {
+	switch {
+	case literal == "NULL":
+		return literal
+
+	// BLOBs are X'...' and bytea takes hex as '\x...'.
+	case strings.HasPrefix(literal, "X'"):
+		return `'\x` + strings.ToLower(literal[2:])
+
+	case literal == "9.0e+999", literal == "1e999":
+		return "'Infinity'"
+
+	case literal == "-9.0e+999", literal == "-1e999":
+		return "'-Infinity'"
+
+	case strings.HasPrefix(literal, "'"):
+		return literal
+
+	// Numbers.
+	case pgType == "boolean":
+		if literal == "0" {
+			return "false"
+		}
+		return "true"
+
+	case pgType == "timestamp":
+		return "to_timestamp(" + literal + ")"
+
+	case pgType == "date":
+		return "to_timestamp(" + literal + ")::date"
+	}
+	return literal
+}
+
+// pgValueLiteral renders a value scanned from a result for PostgreSQL.
+// Without the declared types at hand, only BLOBs, infinities and booleans
+// the driver reports as such are converted.
+func pgValueLiteral(val interface{}) string {
+	if b, ok := val.(bool); ok {
+		return strconv.FormatBool(b)
+	}
+	return pgLiteral("", sqlLiteral(val))
+}
+
+// pgDefault converts the DEFAULT of a column, which SQLite keeps as
+// written, for a column of the given PostgreSQL type.
+func pgDefault(pgType, dflt string) string {
+	key := strings.ToLower(strings.Join(strings.Fields(dflt), ""))
+	if strings.HasPrefix(key, "(") && matchingParen(key, 1) == len(key)-1 {
+		key = key[1 : len(key)-1]
+	}
+	if expr, ok := pgDefaults[key]; ok {
+		return expr
+	}
+	if key == "current_timestamp" || key == "current_date" ||
+		key == "current_time" {
+
+		return strings.ToUpper(key)
+	}
+	return pgLiteral(pgType, dflt)
+}
+
+// isRowidAlias reports whether a table's primary key is a column declared
+// INTEGER PRIMARY KEY, which SQLite numbers automatically.
+func isRowidAlias(t *schemaTable, col schemaColumn) bool {
+	return !t.WithoutRowid && len(t.PrimaryKey) == 1 &&
+		t.PrimaryKey[0] == col.Name && strings.EqualFold(col.Type, "INTEGER")
+}
+
+// pgCreateTable returns the CREATE TABLE of a table for PostgreSQL. Foreign
+// keys are added after the data, see pgForeignKeys, so that the tables can
+// be created and loaded in any order.
+func pgCreateTable(t *schemaTable) string {
+	var defs []string
+	for _, col := range t.Columns {
+		if col.Hidden {
+			continue
+		}
+
+		typ := pgColumnType(col.Type)
+		def := quoteIdent(col.Name) + " " + typ
+		switch {
+		case isRowidAlias(t, col):
+			def += " GENERATED BY DEFAULT AS IDENTITY"
+
+		case col.Generated != "":
+			// PostgreSQL only has stored generated columns.
+			def += " GENERATED ALWAYS AS (" + col.Expression + ") STORED"
+
+		case col.Default != nil:
+			def += " DEFAULT " + pgDefault(typ, *col.Default)
+		}
+		if col.NotNull {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+	}
+
+	if len(t.PrimaryKey) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+quoteIdents(t.PrimaryKey)+")")
+	}
+	for _, idx := range t.Indexes {
+		if idx.Origin == "unique" {
+			defs = append(defs, "UNIQUE ("+quoteIdents(idx.Columns)+")")
+		}
+	}
+	for _, c := range checkConstraints(t.SQL) {
+		def := "CHECK (" + c.Expression + ")"
+		if c.Name != "" {
+			def = "CONSTRAINT " + quoteIdent(c.Name) + " " + def
+		}
+		defs = append(defs, def)
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n    %s\n);\n",
+		quoteIdent(t.Name), strings.Join(defs, ",\n    "))
+}
+
+// quoteIdents quotes names for a column list.
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// pgCreateIndexes returns the CREATE INDEX statements of a table's indexes,
+// or a comment for those on expressions, which are written in SQLite's
+// functions.
+func pgCreateIndexes(ctx context.Context, c *sql.Conn, t *schemaTable,
+	objs []schemaObject) (string, error) {
+
+	var b strings.Builder
+	for _, idx := range t.Indexes {
+		if idx.Origin != "index" {
+			continue
+		}
+		var o schemaObject
+		for _, obj := range objs {
+			if obj.typ == "index" && obj.name == idx.Name {
+				o = obj
+			}
+		}
+
+		cols, err := readIndexColumns(ctx, c, o)
+		if err != nil {
+			return "", err
+		}
+		var terms []string
+		for _, col := range cols {
+			if col.name == "<expression>" ||
+				!contains(idx.Columns, col.name) {
+
+				terms = nil
+				break
+			}
+			term := quoteIdent(col.name)
+			if col.desc {
+				term += " DESC"
+			}
+			terms = append(terms, term)
+		}
+		if len(terms) == 0 {
+			fmt.Fprintf(&b, "-- Skipped index %s on an expression, "+
+				"port it by hand:\n-- %s;\n", idx.Name, idx.SQL)
+			continue
+		}
+
+		unique := ""
+		if idx.Unique {
+			unique = "UNIQUE "
+		}
+		fmt.Fprintf(&b, "CREATE %sINDEX %s ON %s (%s)", unique,
+			quoteIdent(idx.Name), quoteIdent(t.Name),
+			strings.Join(terms, ", "))
+		if idx.Partial {
+			_, tail, _ := tableDefinition(idx.SQL)
+			fmt.Fprintf(&b, " WHERE %s", indexWhereRe.ReplaceAllString(
+				strings.TrimSpace(tail), ""))
+		}
+		b.WriteString(";\n")
+	}
+	return b.String(), nil
+}
+
+// contains reports whether names has name.
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pgForeignKeys returns the statements adding a table's foreign keys.
+func pgForeignKeys(t *schemaTable) string {
+	var b strings.Builder
+	for _, fk := range t.ForeignKeys {
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD FOREIGN KEY (%s) REFERENCES %s",
+			quoteIdent(t.Name), quoteIdents(fk.Columns),
+			quoteIdent(fk.Table))
+		if len(fk.References) > 0 {
+			fmt.Fprintf(&b, " (%s)", quoteIdents(fk.References))
+		}
+		if fk.OnUpdate != "NO ACTION" {
+			fmt.Fprintf(&b, " ON UPDATE %s", fk.OnUpdate)
+		}
+		if fk.OnDelete != "NO ACTION" {
+			fmt.Fprintf(&b, " ON DELETE %s", fk.OnDelete)
+		}
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// dumpPostgres writes the tables and rows opts selects as a script for
+// PostgreSQL, for moving a database off SQLite. Types are mapped by
+// pgColumnType and values converted to match, and identity sequences are
+// moved past the copied keys. Indexes and foreign keys follow the data.
+// Views and CHECK constraints are copied as written, triggers and virtual
+// tables can't be converted and are pointed out in comments.
+func dumpPostgres(ctx context.Context, c *sql.Conn, w io.Writer,
+	objs []schemaObject, opts dumpOptions) error {
+
+	fmt.Fprintln(w, "BEGIN;")
+
+	var tables []*schemaTable
+	var tail strings.Builder
+	for _, o := range objs {
+		if isShadowTable(o.name, objs) || !opts.includes(o.tblName) {
+			continue
+		}
+
+		switch {
+		case o.typ == "view" && !opts.dataOnly:
+			fmt.Fprintf(&tail, "%s;\n", o.sql)
+
+		case o.typ == "trigger" && !opts.dataOnly:
+			fmt.Fprintf(&tail, "-- Skipped trigger %s on %s, PostgreSQL "+
+				"triggers call functions, port it by hand.\n", o.name,
+				o.tblName)
+
+		case o.typ != "table":
+
+		case strings.HasPrefix(strings.ToUpper(o.sql), "CREATE VIRTUAL"):
+			fmt.Fprintf(w, "-- Skipped virtual table %s.\n", o.name)
+
+		default:
+			t, err := readSchemaTable(ctx, c, o)
+			if err != nil {
+				return fmt.Errorf("%s: %w", o.name, err)
+			}
+			tables = append(tables, &t)
+		}
+	}
+
+	converts := make(map[string]func(col, literal string) string)
+	for _, t := range tables {
+		types := make(map[string]string, len(t.Columns))
+		for _, col := range t.Columns {
+			types[col.Name] = pgColumnType(col.Type)
+		}
+		converts[t.Name] = func(col, literal string) string {
+			return pgLiteral(types[col], literal)
+		}
+	}
+
+	var prefetch *dumpPrefetch
+	if opts.jobs > 1 && !opts.schemaOnly {
+		names := make([]string, len(tables))
+		for i, t := range tables {
+			names[i] = t.Name
+		}
+		prefetch = startDumpPrefetch(ctx, opts, names, converts)
+		defer prefetch.close()
+	}
+
+	for _, t := range tables {
+		if !opts.dataOnly {
+			if _, err := io.WriteString(w, pgCreateTable(t)); err != nil {
+				return err
+			}
+		}
+		if opts.schemaOnly {
+			continue
+		}
+
+		err := prefetch.writeRows(ctx, c, w, t.Name, opts.where,
+			converts[t.Name])
+		if err != nil {
+			return err
+		}
+
+		// The identity continues after the copied keys.
+		for _, col := range t.Columns {
+			if !isRowidAlias(t, col) {
+				continue
+			}
+			fmt.Fprintf(w, "SELECT setval(pg_get_serial_sequence(%s, %s), "+
+				"max(%s)) FROM %s HAVING max(%s) IS NOT NULL;\n",
+				quoteString(quoteIdent(t.Name)), quoteString(col.Name),
+				quoteIdent(col.Name), quoteIdent(t.Name),
+				quoteIdent(col.Name))
+		}
+	}
+
+	if !opts.dataOnly {
+		for _, t := range tables {
+			indexes, err := pgCreateIndexes(ctx, c, t, objs)
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.Name, err)
+			}
+			if _, err := io.WriteString(w, indexes); err != nil {
+				return err
+			}
+		}
+		for _, t := range tables {
+			if _, err := io.WriteString(w, pgForeignKeys(t)); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := io.WriteString(w, tail.String()); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, "COMMIT;")
+	return err
+}
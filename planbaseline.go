@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planBaseline is the query plan of a statement saved by \planbaseline
+// save, to be checked against the current plan later.
+type planBaseline struct {
+	Database  string   `json:"database"`
+	Statement string   `json:"statement"`
+	Plan      []string `json:"plan"`
+	Saved     string   `json:"saved"`
+}
+
+// savedTime returns when the baseline was saved in local time.
+func (b planBaseline) savedTime() string {
+	t, err := time.Parse(time.RFC3339, b.Saved)
+	if err != nil {
+		return b.Saved
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+const planBaselineUsage = `Usage: \planbaseline save <name> [query] | ` +
+	`\planbaseline check [name] | \planbaseline list | ` +
+	`\planbaseline drop <name>`
+
+func getPlanBaselineFilePath() string {
+	return filepath.Join(stateDir(), "planbaselines.json")
+}
+
+// readPlanBaselines returns the saved baselines by name.
+func readPlanBaselines() (map[string]planBaseline, error) {
+	baselines := make(map[string]planBaseline)
+
+	data, err := os.ReadFile(getPlanBaselineFilePath())
+	if os.IsNotExist(err) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &baselines); err != nil {
+		return nil, fmt.Errorf("%s: %w", getPlanBaselineFilePath(), err)
+	}
+	return baselines, nil
+}
+
+func writePlanBaselines(baselines map[string]planBaseline) error {
+	path := getPlanBaselineFilePath()
+	if err := ensureParentDir(path); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(baselines, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// diffLines compares two lists of lines, returning all lines of both
+// prefixed with "  " if in both, "- " if only in a and "+ " if only in b.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i, j = i+1, j+1
+
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// savePlanBaseline saves the plan of the query, or of the last query if
+// none is given, under name.
+func savePlanBaseline(name, query string) error {
+	if query == "" {
+		query = lastQuery
+	}
+	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+	if query == "" {
+		return errors.New("no query given and no previous query")
+	}
+
+	plan, err := queryPlan(context.Background(), query)
+	if err != nil {
+		return err
+	}
+
+	baselines, err := readPlanBaselines()
+	if err != nil {
+		return err
+	}
+	_, replaced := baselines[name]
+	baselines[name] = planBaseline{
+		Database:  redactDatabaseName(dbPath),
+		Statement: query,
+		Plan:      plan,
+		Saved:     time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := writePlanBaselines(baselines); err != nil {
+		return err
+	}
+
+	verb := "Saved"
+	if replaced {
+		verb = "Replaced"
+	}
+	fmt.Printf("%s plan baseline %s:\n", verb, name)
+	for _, line := range plan {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
+
+// checkPlanBaselines compares the current plans of the baselines, or of
+// the named one, with the saved ones. It returns an error if any changed or
+// can't be explained anymore, so that a script checking them fails.
+func checkPlanBaselines(name string) error {
+	baselines, err := readPlanBaselines()
+	if err != nil {
+		fmt.Printf("Plan baseline error: %v\n", err)
+		return err
+	}
+
+	names := make([]string, 0, len(baselines))
+	for n := range baselines {
+		if name == "" || n == name {
+			names = append(names, n)
+		}
+	}
+	if len(names) == 0 {
+		if name != "" {
+			err := fmt.Errorf("no plan baseline named %s", name)
+			fmt.Printf("Plan baseline error: %v\n", err)
+			return err
+		}
+		fmt.Println("No plan baselines saved.")
+		return nil
+	}
+	sort.Strings(names)
+
+	var changed []string
+	for _, n := range names {
+		b := baselines[n]
+		plan, err := queryPlan(context.Background(), b.Statement)
+		if err != nil {
+			fmt.Printf("%s: FAILED, %v\n", n, err)
+			changed = append(changed, n)
+			continue
+		}
+
+		if strings.Join(plan, "\n") == strings.Join(b.Plan, "\n") {
+			fmt.Printf("%s: unchanged\n", n)
+			continue
+		}
+		changed = append(changed, n)
+
+		fmt.Printf("%s: CHANGED since %s on %s\n", n, b.savedTime(),
+			b.Database)
+		for _, line := range diffLines(b.Plan, plan) {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+
+	if len(changed) > 0 {
+		return fmt.Errorf("plan changed: %s", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// listPlanBaselines prints the saved baselines with their statements.
+func listPlanBaselines() error {
+	baselines, err := readPlanBaselines()
+	if err != nil {
+		return err
+	}
+	if len(baselines) == 0 {
+		fmt.Println("No plan baselines saved.")
+		return nil
+	}
+
+	names := make([]string, 0, len(baselines))
+	for n := range baselines {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		b := baselines[n]
+		fmt.Printf("%s (%s, %s)\n  %s\n", n, b.Database, b.savedTime(),
+			strings.Join(strings.Split(b.Statement, "\n"), "\n  "))
+	}
+	return nil
+}
+
+func dropPlanBaseline(name string) error {
+	baselines, err := readPlanBaselines()
+	if err != nil {
+		return err
+	}
+	if _, ok := baselines[name]; !ok {
+		return fmt.Errorf("no plan baseline named %s", name)
+	}
+
+	delete(baselines, name)
+	if err := writePlanBaselines(baselines); err != nil {
+		return err
+	}
+	fmt.Printf("Dropped plan baseline %s.\n", name)
+	return nil
+}
+
+// handlePlanBaselineCommand saves the query plans of important statements
+// and checks later whether they changed, e.g. after ANALYZE, bulk deletes
+// or schema changes. A changed plan fails the command, and so a script
+// running it.
+func handlePlanBaselineCommand(args string) error {
+	sub, rest := nextField(args)
+	name, rest := nextField(rest)
+	query := strings.TrimSpace(rest)
+
+	var err error
+	switch {
+	case sub == "save" && name != "":
+		err = savePlanBaseline(name, query)
+
+	case sub == "check" && query == "":
+		return checkPlanBaselines(name)
+
+	case sub == "list" && name == "":
+		err = listPlanBaselines()
+
+	case sub == "drop" && name != "" && query == "":
+		err = dropPlanBaseline(name)
+
+	default:
+		fmt.Println(planBaselineUsage)
+		return errUsage
+	}
+
+	if err != nil {
+		fmt.Printf("Plan baseline error: %v\n", err)
+	}
+	return err
+}
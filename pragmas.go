@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ktr0731/go-fuzzyfinder"
+)
+
+// pragmaInfo describes a pragma shown by the \pragmas browser.
+type pragmaInfo struct {
+	name     string
+	category string
+	desc     string
+
+	// values lists the settings an enum-valued pragma accepts. Pragmas
+	// without values can only be inspected from the browser.
+	values []string
+
+	// numeric is set for enums that SQLite reports as the index into
+	// values rather than by name.
+	numeric bool
+}
+
+var boolValues = []string{"off", "on"}
+
+// pragmaCatalog lists the pragmas worth knowing about, in display order.
+var pragmaCatalog = []pragmaInfo{
+	{
+		name: "journal_mode", category: "Durability",
+		desc:   "rollback journal / WAL mode",
+		values: []string{"delete", "truncate", "persist", "memory", "wal", "off"},
+	},
+	{
+		name: "synchronous", category: "Durability",
+		desc:   "how often data is fsynced",
+		values: []string{"off", "normal", "full", "extra"}, numeric: true,
+	},
+	{
+		name: "locking_mode", category: "Durability",
+		desc:   "release file locks after each transaction",
+		values: []string{"normal", "exclusive"},
+	},
+	{
+		name: "foreign_keys", category: "Integrity",
+		desc:   "enforce foreign key constraints",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "defer_foreign_keys", category: "Integrity",
+		desc:   "check foreign keys at commit time",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "recursive_triggers", category: "Integrity",
+		desc:   "allow triggers to fire recursively",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "ignore_check_constraints", category: "Integrity",
+		desc:   "skip CHECK constraint enforcement",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "cell_size_check", category: "Integrity",
+		desc:   "extra sanity checks on b-tree cells",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "cache_size", category: "Performance",
+		desc: "page cache size (pages, or KiB if negative)",
+	},
+	{
+		name: "mmap_size", category: "Performance",
+		desc: "bytes of the file to memory-map",
+	},
+	{
+		name: "temp_store", category: "Performance",
+		desc:   "where temp tables and indices live",
+		values: []string{"default", "file", "memory"}, numeric: true,
+	},
+	{
+		name: "automatic_index", category: "Performance",
+		desc:   "build transient indexes for joins",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "busy_timeout", category: "Performance",
+		desc: "milliseconds to wait on a locked database",
+	},
+	{
+		name: "threads", category: "Performance",
+		desc: "auxiliary threads for sorting",
+	},
+	{
+		name: "query_only", category: "Safety",
+		desc:   "reject all writes on this connection",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "secure_delete", category: "Safety",
+		desc:   "overwrite deleted content with zeros",
+		values: []string{"off", "on", "fast"}, numeric: true,
+	},
+	{
+		name: "reverse_unordered_selects", category: "Safety",
+		desc:   "reverse unordered results to find order bugs",
+		values: boolValues, numeric: true,
+	},
+	{
+		name: "auto_vacuum", category: "Storage",
+		desc:   "reclaim free pages (needs VACUUM to change)",
+		values: []string{"none", "full", "incremental"}, numeric: true,
+	},
+	{
+		name: "page_size", category: "Storage",
+		desc: "bytes per page (needs VACUUM to change)",
+	},
+	{
+		name: "page_count", category: "Storage",
+		desc: "total pages in the database file",
+	},
+	{
+		name: "freelist_count", category: "Storage",
+		desc: "unused pages in the database file",
+	},
+	{
+		name: "encoding", category: "Storage",
+		desc: "text encoding of the database",
+	},
+	{
+		name: "user_version", category: "Metadata",
+		desc: "application-defined schema version",
+	},
+	{
+		name: "application_id", category: "Metadata",
+		desc: "application-defined file type id",
+	},
+	{
+		name: "schema_version", category: "Metadata",
+		desc: "incremented on every schema change",
+	},
+	{
+		name: "data_version", category: "Metadata",
+		desc: "changes when another connection commits",
+	},
+}
+
+// pragmaValue returns the current value of the pragma, translating numeric
+// enums back to their names.
+func pragmaValue(p pragmaInfo) (string, error) {
+	var val string
+	err := conn.QueryRowContext(
+		context.Background(), "PRAGMA "+p.name,
+	).Scan(&val)
+	if err != nil {
+		return "", err
+	}
+
+	if p.numeric {
+		if i, err := strconv.Atoi(val); err == nil && i >= 0 &&
+			i < len(p.values) {
+
+			return p.values[i], nil
+		}
+	}
+
+	return strings.ToLower(val), nil
+}
+
+func printPragmas() {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Category", "Pragma", "Value", "Description"})
+
+	prevCategory := ""
+	for _, p := range pragmaCatalog {
+		val, err := pragmaValue(p)
+		if err != nil {
+			val = "error: " + err.Error()
+		}
+
+		desc := p.desc
+		if len(p.values) > 0 {
+			desc += " [" + strings.Join(p.values, "|") + "]"
+		}
+
+		category := p.category
+		if category == prevCategory {
+			category = ""
+		} else if prevCategory != "" {
+			t.AppendSeparator()
+		}
+		prevCategory = p.category
+
+		t.AppendRow(table.Row{category, p.name, val, desc})
+	}
+
+	t.Render()
+	fmt.Println(`Use \pragmas edit [name] to change enum-valued pragmas.`)
+}
+
+func findPragma(name string) (pragmaInfo, bool) {
+	for _, p := range pragmaCatalog {
+		if p.name == name {
+			return p, true
+		}
+	}
+	return pragmaInfo{}, false
+}
+
+// editPragma lets the user pick an enum-valued pragma (unless one is given)
+// and then its new value with the fuzzy finder. Cancelling a picker isn't
+// an error.
+func editPragma(name string) error {
+	var editable []pragmaInfo
+	for _, p := range pragmaCatalog {
+		if len(p.values) > 0 {
+			editable = append(editable, p)
+		}
+	}
+
+	var p pragmaInfo
+	if name != "" {
+		var ok bool
+		p, ok = findPragma(name)
+		if !ok || len(p.values) == 0 {
+			err := fmt.Errorf("%s is not an editable pragma", name)
+			fmt.Println(err)
+			return err
+		}
+	} else {
+		idx, err := fuzzyfinder.Find(
+			editable,
+			func(i int) string {
+				val, _ := pragmaValue(editable[i])
+				return fmt.Sprintf("%-26s %s", editable[i].name, val)
+			},
+			fuzzyfinder.WithPromptString("pragma> "),
+		)
+		if err != nil {
+			return nil
+		}
+		p = editable[idx]
+	}
+
+	current, _ := pragmaValue(p)
+	idx, err := fuzzyfinder.Find(
+		p.values,
+		func(i int) string {
+			if p.values[i] == current {
+				return p.values[i] + " (current)"
+			}
+			return p.values[i]
+		},
+		fuzzyfinder.WithPromptString(p.name+"> "),
+	)
+	if err != nil {
+		return nil
+	}
+
+	_, err = conn.ExecContext(
+		context.Background(),
+		fmt.Sprintf("PRAGMA %s = %s", p.name, p.values[idx]),
+	)
+	if err != nil {
+		fmt.Printf("Failed to set %s: %v\n", p.name, err)
+		return err
+	}
+
+	// Some pragmas silently refuse a change, e.g. journal_mode inside a
+	// transaction, so report what actually took effect.
+	val, err := pragmaValue(p)
+	if err != nil {
+		fmt.Printf("Failed to read %s: %v\n", p.name, err)
+		return err
+	}
+	fmt.Printf("%s is now %s\n", p.name, val)
+
+	return nil
+}
+
+func handlePragmasCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		printPragmas()
+
+	case args[0] == "edit" && len(args) <= 2:
+		name := ""
+		if len(args) == 2 {
+			name = args[1]
+		}
+		return editPragma(name)
+
+	default:
+		fmt.Println("Usage: \\pragmas [edit [name]]")
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// resultFormat selects how query results are rendered.
+type resultFormat int
+
+const (
+	formatAligned resultFormat = iota
+	formatJSON
+	formatInserts
+)
+
+var resultFormatNames = map[resultFormat]string{
+	formatAligned: "aligned",
+	formatJSON:    "json",
+	formatInserts: "inserts",
+}
+
+func (f resultFormat) String() string {
+	return resultFormatNames[f]
+}
+
+var (
+	outputFormat = formatAligned
+
+	// insertsTable is the table name used by the inserts format. When
+	// empty, it is derived from the query.
+	insertsTable string
+
+	// tuplesOnly prints just the rows, without headers, footers or
+	// table decorations.
+	tuplesOnly bool
+
+	// columnsOverride replaces the detected terminal width when non-zero.
+	columnsOverride int
+
+	// floatFormat is the printf format for REAL values. When empty, the
+	// shortest representation is used.
+	floatFormat string
+)
+
+// floatFormatRe matches a printf format with a single floating point verb.
+var floatFormatRe = regexp.MustCompile(
+	`^[^%]*%[-+ #0]*\d*(?:\.\d+)?[eEfFgG][^%]*$`,
+)
+
+// option is a setting that can be shown and changed with \pset or \set.
+type option struct {
+	name  string
+	usage string
+	show  func() string
+	set   func(args []string) error
+}
+
+var (
+	// psetOptions lists the \pset options in display order.
+	psetOptions []option
+
+	// setOptions lists the \set options in display order.
+	setOptions []option
+)
+
+func init() {
+	psetOptions = []option{
+		{
+			name:  "format",
+			usage: "aligned|json|inserts [table]",
+			show: func() string {
+				if outputFormat == formatInserts && insertsTable != "" {
+					return outputFormat.String() + " " + insertsTable
+				}
+				return outputFormat.String()
+			},
+			set: setFormatOption,
+		},
+		{
+			name:  "floatformat",
+			usage: "default|<digits>|<printf format, e.g. %.6f>",
+			show: func() string {
+				if floatFormat == "" {
+					return "default"
+				}
+				return floatFormat
+			},
+			set: setFloatFormatOption,
+		},
+		{
+			name:  "blobformat",
+			usage: "auto|base64|hex|raw",
+			show: func() string {
+				return jsonBlobFormat.String()
+			},
+			set: setBlobFormatOption,
+		},
+		{
+			name:  "expanded",
+			usage: "on|off|auto",
+			show:  expandedSetting,
+			set: func(args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("expected on, off or auto")
+				}
+				return setExpanded(args[0])
+			},
+		},
+		{
+			name:  "tuples_only",
+			usage: "on|off",
+			show: func() string {
+				return onOff(tuplesOnly)
+			},
+			set: func(args []string) error {
+				on, err := parseOnOff(args)
+				if err != nil {
+					return err
+				}
+				tuplesOnly = on
+				return nil
+			},
+		},
+		{
+			name:  "wrap",
+			usage: "on|off",
+			show: func() string {
+				return onOff(wrapCells)
+			},
+			set: func(args []string) error {
+				on, err := parseOnOff(args)
+				if err != nil {
+					return err
+				}
+				wrapCells = on
+				return nil
+			},
+		},
+		{
+			name:  "bigcell",
+			usage: "<size, e.g. 1MB>|off, shows larger values by size",
+			show:  bigCellSetting,
+			set:   setBigCellOption,
+		},
+		{
+			name:  "membudget",
+			usage: "<size, e.g. 256MB>|off, spills larger results to disk",
+			show:  memBudgetSetting,
+			set:   setMemBudgetOption,
+		},
+		{
+			name:  "rowlimit",
+			usage: "<rows>|off, asks before printing more",
+			show:  rowLimitSetting,
+			set:   setRowLimitOption,
+		},
+		{
+			name:  "pager",
+			usage: "on|off, pages listings longer than the terminal",
+			show: func() string {
+				return onOff(pagerEnabled)
+			},
+			set: func(args []string) error {
+				on, err := parseOnOff(args)
+				if err != nil {
+					return err
+				}
+				pagerEnabled = on
+				return nil
+			},
+		},
+		{
+			name:  "columns",
+			usage: "<width>, 0 to detect",
+			show: func() string {
+				if columnsOverride == 0 {
+					return fmt.Sprintf("0 (detected %d)",
+						terminalWidth())
+				}
+				return strconv.Itoa(columnsOverride)
+			},
+			set: func(args []string) error {
+				if len(args) != 1 {
+					return fmt.Errorf("expected a width")
+				}
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 0 {
+					return fmt.Errorf("invalid width %q", args[0])
+				}
+				columnsOverride = n
+				return nil
+			},
+		},
+	}
+
+	setOptions = []option{
+		{
+			name:  "timezone",
+			usage: "default|UTC|local|<IANA name>",
+			show: func() string {
+				if displayZone == nil {
+					return "default"
+				}
+				return displayZone.String()
+			},
+			set: setTimezoneOption,
+		},
+		{
+			name:  "busy_timeout",
+			usage: "<milliseconds>",
+			show: func() string {
+				return strconv.Itoa(busyTimeout)
+			},
+			set: setBusyTimeoutOption,
+		},
+		{
+			name:  "busy_retries",
+			usage: "<count>",
+			show: func() string {
+				return strconv.Itoa(busyRetries)
+			},
+			set: setBusyRetriesOption,
+		},
+		{
+			name:  "log_min_duration",
+			usage: "<milliseconds>|off",
+			show:  logMinDurationSetting,
+			set:   setLogMinDurationOption,
+		},
+		{
+			name:  "masking",
+			usage: "on|off",
+			show:  maskingSetting,
+			set:   setMaskingOption,
+		},
+		{
+			name:  "undo",
+			usage: "on|off",
+			show:  undoSetting,
+			set:   setUndoOption,
+		},
+		{
+			name:  "completion",
+			usage: "prefix|fuzzy",
+			show:  completionSetting,
+			set:   setCompletionOption,
+		},
+		{
+			name:  "lint",
+			usage: "on|off",
+			show:  lintSetting,
+			set:   setLintOption,
+		},
+	}
+}
+
+func parseOnOff(args []string) (bool, error) {
+	if len(args) != 1 {
+		return false, fmt.Errorf("expected on or off")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("expected on or off, got %q", args[0])
+	}
+}
+
+// expandedSetting describes the expanded display mode.
+func expandedSetting() string {
+	if expandedAuto {
+		return "auto"
+	}
+	return onOff(expandedMode)
+}
+
+func setExpanded(arg string) error {
+	if strings.EqualFold(arg, "auto") {
+		expandedMode, expandedAuto = false, true
+		return nil
+	}
+
+	on, err := parseOnOff([]string{arg})
+	if err != nil {
+		return fmt.Errorf("expected on, off or auto, got %q", arg)
+	}
+	expandedMode, expandedAuto = on, false
+
+	return nil
+}
+
+// handleExpandedCommand sets expanded display, or toggles it without an
+// argument.
+func handleExpandedCommand(args []string) error {
+	arg := "on"
+	if len(args) == 1 {
+		arg = args[0]
+	} else if expandedMode || expandedAuto {
+		arg = "off"
+	}
+
+	if err := setExpanded(arg); err != nil {
+		fmt.Println("Usage: \\x [on|off|auto]")
+		return errUsage
+	}
+	if expandedMode || expandedAuto {
+		outputFormat = formatAligned
+	}
+	fmt.Printf("Expanded display is now %s\n", expandedSetting())
+	return nil
+}
+
+// handleJSONCommand toggles JSON output.
+func handleJSONCommand([]string) error {
+	jsonMode := outputFormat != formatJSON
+	outputFormat = formatAligned
+	if jsonMode {
+		outputFormat = formatJSON
+		expandedMode = false
+		expandedAuto = false
+	}
+	fmt.Printf("JSON output is now %s\n", onOff(jsonMode))
+	return nil
+}
+
+func setFormatOption(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing format")
+	}
+
+	for f, name := range resultFormatNames {
+		if !strings.EqualFold(args[0], name) {
+			continue
+		}
+
+		if len(args) > 1 && f != formatInserts {
+			return fmt.Errorf("format %s takes no arguments", name)
+		}
+		if len(args) > 2 {
+			return fmt.Errorf("too many arguments")
+		}
+
+		insertsTable = ""
+		if len(args) == 2 {
+			insertsTable = args[1]
+		}
+		outputFormat = f
+
+		// Expanded display only applies to the aligned format.
+		if f != formatAligned {
+			expandedMode = false
+			expandedAuto = false
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown format %q", args[0])
+}
+
+// setFloatFormatOption accepts "default", a number of decimal places or
+// a printf format with one of the e, f or g verbs.
+func setFloatFormatOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single format")
+	}
+	format := args[0]
+
+	switch {
+	case format == "default":
+		floatFormat = ""
+
+	case floatFormatRe.MatchString(format):
+		floatFormat = format
+
+	default:
+		digits, err := strconv.Atoi(format)
+		if err != nil || digits < 0 || digits > 17 {
+			return fmt.Errorf("invalid float format %q", format)
+		}
+		floatFormat = fmt.Sprintf("%%.%df", digits)
+	}
+
+	return nil
+}
+
+func printOptions(opts []option) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Option", "Value", "Accepted Values"})
+	for _, o := range opts {
+		t.AppendRow(table.Row{o.name, o.show(), o.usage})
+	}
+	t.Render()
+}
+
+// handleOptionCommand implements the shared syntax of \pset and \set: list
+// all options, show one or change one.
+func handleOptionCommand(cmd string, opts []option, args []string) error {
+	if len(args) == 0 {
+		printOptions(opts)
+		return nil
+	}
+
+	for _, o := range opts {
+		if o.name != strings.ToLower(args[0]) {
+			continue
+		}
+
+		if len(args) > 1 {
+			if err := o.set(args[1:]); err != nil {
+				fmt.Printf("\\%s %s: %v (usage: \\%s %s %s)\n",
+					cmd, o.name, err, cmd, o.name, o.usage)
+				return err
+			}
+		}
+
+		fmt.Printf("%s is %s\n", o.name, o.show())
+		return nil
+	}
+
+	err := fmt.Errorf("unknown \\%s option %q", cmd, args[0])
+	fmt.Printf("Unknown \\%s option %q\n", cmd, args[0])
+	return err
+}
+
+func handlePsetCommand(args []string) error {
+	return handleOptionCommand("pset", psetOptions, args)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// queryLogEntry is a single line of the JSONL query log.
+type queryLogEntry struct {
+	Time         string  `json:"time"`
+	Database     string  `json:"database"`
+	Statement    string  `json:"statement"`
+	DurationMs   float64 `json:"duration_ms"`
+	Rows         int     `json:"rows"`
+	RowsAffected int64   `json:"rows_affected"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// auditLog appends every executed statement to a JSONL file.
+type auditLog struct {
+	path string
+	f    *os.File
+	enc  *json.Encoder
+}
+
+var (
+	// queryLog is the active query log, nil when logging is off.
+	queryLog *auditLog
+
+	// queryLogPath remembers the last log file so that `\log on` can
+	// resume logging without repeating the path.
+	queryLogPath string
+)
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(
+		path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auditLog{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (l *auditLog) Close() error {
+	return l.f.Close()
+}
+
+// record writes one entry. Failing to log never interrupts the session, but
+// the user is told about it.
+func (l *auditLog) record(stmt string, start time.Time, rows int,
+	affected int64, err error) {
+
+	entry := queryLogEntry{
+		Time:         start.UTC().Format(time.RFC3339Nano),
+		Database:     redactDatabaseName(dbPath),
+		Statement:    stmt,
+		DurationMs:   float64(time.Since(start).Microseconds()) / 1000,
+		Rows:         rows,
+		RowsAffected: affected,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := l.enc.Encode(entry); err != nil {
+		fmt.Printf("Failed to write query log: %v\n", err)
+	}
+}
+
+// enableQueryLog starts logging to path, closing any previous log.
+func enableQueryLog(path string) error {
+	l, err := openAuditLog(path)
+	if err != nil {
+		return err
+	}
+
+	disableQueryLog()
+	queryLog = l
+	queryLogPath = path
+
+	return nil
+}
+
+func disableQueryLog() {
+	if queryLog == nil {
+		return
+	}
+
+	queryLog.Close()
+	queryLog = nil
+}
+
+func handleLogCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		if queryLog == nil {
+			fmt.Println("Query log is off")
+		} else {
+			fmt.Printf("Query log is on (%s)\n", queryLog.path)
+		}
+
+	case args[0] == "on" && len(args) <= 2:
+		path := queryLogPath
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if path == "" {
+			fmt.Println("Usage: \\log on <file>")
+			return errUsage
+		}
+
+		if err := enableQueryLog(path); err != nil {
+			fmt.Printf("Failed to open query log: %v\n", err)
+			return err
+		}
+		fmt.Printf("Query log is now on (%s)\n", path)
+
+	case args[0] == "off" && len(args) == 1:
+		disableQueryLog()
+		fmt.Println("Query log is now off")
+
+	default:
+		fmt.Println("Usage: \\log [on [file]|off]")
+		return errUsage
+	}
+	return nil
+}
+
+// totalChanges returns the number of rows changed on the session connection
+// since it was opened.
+func totalChanges() int64 {
+	var n int64
+	conn.QueryRowContext(
+		context.Background(), "SELECT total_changes()",
+	).Scan(&n)
+
+	return n
+}
+
+// changesSince returns the rows affected by the last statement, given the
+// total change counter from before it ran. changes() alone is not enough as
+// it keeps reporting the last DML statement after e.g. a SELECT.
+func changesSince(before int64) int64 {
+	if totalChanges() == before {
+		return 0
+	}
+
+	var n int64
+	conn.QueryRowContext(
+		context.Background(), "SELECT changes()",
+	).Scan(&n)
+
+	return n
+}
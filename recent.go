@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+	"golang.org/x/term"
+)
+
+// maxRecentDatabases bounds the number of paths kept in the state file.
+const maxRecentDatabases = 20
+
+func getRecentFilePath() string {
+	return filepath.Join(stateDir(), "recent")
+}
+
+// loadRecentDatabases returns the recently opened databases, most recent
+// first.
+func loadRecentDatabases() []string {
+	file, err := os.Open(getRecentFilePath())
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			paths = append(paths, line)
+		}
+	}
+
+	return paths
+}
+
+// recordRecentDatabase moves the path to the top of the recent databases.
+// In-memory and temporary databases aren't worth remembering. URIs are kept
+// as given, parameters included, except for credentials.
+func recordRecentDatabase(path string) {
+	if path == "" || path == ":memory:" {
+		return
+	}
+
+	abs := redactDatabaseName(path)
+	if !isDatabaseURI(path) && !isRemoteDatabase(path) &&
+		!isSSHDatabase(path) {
+		var err error
+		if abs, err = filepath.Abs(path); err != nil {
+			return
+		}
+	}
+
+	paths := []string{abs}
+	for _, p := range loadRecentDatabases() {
+		if p != abs && len(paths) < maxRecentDatabases {
+			paths = append(paths, p)
+		}
+	}
+
+	file := getRecentFilePath()
+	if err := ensureParentDir(file); err != nil {
+		return
+	}
+
+	data := strings.Join(paths, "\n") + "\n"
+	os.WriteFile(file, []byte(data), 0600)
+}
+
+// pickRecentDatabase lets the user choose one of the recently opened
+// databases that still exist.
+func pickRecentDatabase() (string, bool) {
+	var paths []string
+	for _, p := range loadRecentDatabases() {
+		if isRemoteDatabase(p) || isSSHDatabase(p) {
+			paths = append(paths, p)
+			continue
+		}
+		if _, err := os.Stat(databaseFile(p)); err == nil {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return "", false
+	}
+
+	idx, err := fuzzyfinder.Find(
+		paths,
+		func(i int) string {
+			return paths[i]
+		},
+		fuzzyfinder.WithPromptString("database> "),
+	)
+	if err != nil {
+		return "", false
+	}
+
+	return paths[idx], true
+}
+
+// switchDatabase replaces the session database with the one at path. The
+// current database stays open if the new one can't be used.
+func switchDatabase(path string) error {
+	ctx := context.Background()
+
+	newDB, err := openDatabase(path, readOnly)
+	if err != nil {
+		return err
+	}
+
+	newConn, err := newDB.Conn(ctx)
+	if err != nil {
+		newDB.Close()
+		return err
+	}
+
+	// Opening is lazy, so read the schema to catch files that aren't
+	// databases.
+	var n int
+	err = newConn.QueryRowContext(
+		ctx, "SELECT count(*) FROM sqlite_master",
+	).Scan(&n)
+	if err != nil {
+		newConn.Close()
+		newDB.Close()
+		return err
+	}
+
+	// Roll back a transaction the user chose to give up first, restoring
+	// the triggers mustn't be rolled back with it.
+	if activeSnapshot == nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+	}
+
+	closeMetaConn()
+	stopSession()
+	releaseSnapshot()
+	restoreTriggers()
+	conn.Close()
+	db.Close()
+
+	db, conn, dbPath = newDB, newConn, path
+	openMetaConn(ctx)
+	// Results and queries of the old database don't apply to the new one.
+	lastQuery, lastColumns = "", nil
+	lastQueryArgs, lastArgs = nil, nil
+	resultCache = nil
+	refreshFKState()
+	recoverTriggers()
+	recordRecentDatabase(path)
+
+	return nil
+}
+
+// transactionOpen reports whether the user has a transaction open on the
+// session connection, which closing the database would roll back. The
+// snapshot's transaction doesn't count, switching releases it.
+func transactionOpen() bool {
+	return activeSnapshot == nil && inTransaction()
+}
+
+// inTransaction reports whether a transaction is open on the session
+// connection. BEGIN fails inside a transaction, and is rolled back right
+// away otherwise.
+func inTransaction() bool {
+	if isRemoteDatabase(dbPath) {
+		return false
+	}
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "BEGIN"); err != nil {
+		return strings.Contains(err.Error(), "within a transaction")
+	}
+	conn.ExecContext(ctx, "ROLLBACK")
+	return false
+}
+
+func handleOpenCommand(args []string) error {
+	var path string
+	switch len(args) {
+	case 0:
+		var ok bool
+		path, ok = pickRecentDatabase()
+		if !ok {
+			fmt.Println("Usage: \\open <path>")
+			return errUsage
+		}
+
+	case 1:
+		path = args[0]
+
+	default:
+		fmt.Println("Usage: \\open <path>")
+		return errUsage
+	}
+
+	finishUndo()
+	if transactionOpen() {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			err := errors.New("a transaction is open, COMMIT or " +
+				"ROLLBACK it first")
+			fmt.Printf("Open error: %v\n", err)
+			return err
+		}
+		if !confirm("A transaction is open, roll it back and switch?") {
+			return nil
+		}
+	}
+
+	// The history is written at exit, so the history of the database
+	// left has to be saved before loading the next one. Scripts and -c
+	// commands don't keep one.
+	interactive := historyFile != ""
+	if interactive {
+		saveHistory()
+	}
+
+	if err := switchDatabase(path); err != nil {
+		fmt.Printf("Open error: %v\n", err)
+		return err
+	}
+
+	if interactive {
+		historyLines, historySaved = nil, 0
+		loadDatabaseHistory(path)
+	}
+
+	fmt.Printf("Opened %s\n", path)
+	checkWALFiles()
+	return nil
+}
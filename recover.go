@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	// recoverMaxSkips bounds how many unreadable regions of a table we
+	// seek past before giving up on the rest of it. Each skip bisects
+	// the rest of the rowid range for the next readable row, so crosses
+	// a damaged region of any size.
+	recoverMaxSkips = 64
+)
+
+// schemaObject is a row of sqlite_master.
+type schemaObject struct {
+	typ     string
+	name    string
+	tblName string
+	sql     string
+
+	// temp is set for objects of the temp schema, which only the session
+	// connection sees.
+	temp bool
+}
+
+// schema returns the name of the schema the object is in.
+func (o *schemaObject) schema() string {
+	if o.temp {
+		return "temp"
+	}
+	return "main"
+}
+
+// recoverStats describes what could be salvaged from one table.
+type recoverStats struct {
+	table   string
+	rows    int64
+	skipped int
+	err     error
+
+	// abandoned is set when the rows after abandonedAfter up to
+	// abandonedTo were given up on.
+	abandoned                   bool
+	abandonedAfter, abandonedTo int64
+}
+
+// readSchemaObjects returns the user objects of the database, tables first so
+// that indexes, views and triggers can be created once the data is in place.
+func readSchemaObjects(ctx context.Context, c *sql.Conn) ([]schemaObject,
+	error) {
+
+	return querySchemaObjects(ctx, c, "main", "")
+}
+
+// querySchemaObjects is readSchemaObjects for the main or temp schema, with
+// filter appended to the WHERE clause, e.g. internalTablesFilter.
+func querySchemaObjects(ctx context.Context, c *sql.Conn, schema,
+	filter string) ([]schemaObject, error) {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT type, name, tbl_name, sql
+		FROM `+schema+`.sqlite_master
+		WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'`+filter+`
+		ORDER BY CASE type
+			WHEN 'table' THEN 0
+			WHEN 'index' THEN 1
+			WHEN 'view' THEN 2
+			ELSE 3
+		END, rowid
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objs []schemaObject
+	for rows.Next() {
+		o := schemaObject{temp: schema == "temp"}
+		if err := rows.Scan(&o.typ, &o.name, &o.tblName, &o.sql); err != nil {
+			return nil, err
+		}
+		objs = append(objs, o)
+	}
+
+	return objs, rows.Err()
+}
+
+// isShadowTable reports whether the table belongs to one of the virtual
+// tables, e.g. the %_data and %_idx tables of FTS5. These are recreated by
+// the virtual table itself and must not be copied separately.
+func isShadowTable(name string, objs []schemaObject) bool {
+	for _, o := range objs {
+		if o.typ != "table" || o.name == name {
+			continue
+		}
+
+		isVirtual := strings.HasPrefix(
+			strings.ToUpper(o.sql), "CREATE VIRTUAL TABLE",
+		)
+		if isVirtual && strings.HasPrefix(name, o.name+"_") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tableColumns returns the insertable columns of a table.
+func tableColumns(ctx context.Context, c *sql.Conn, tbl string) ([]string,
+	error) {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT cid, name, type, "notnull", dflt_value, pk
+		FROM pragma_table_info(?)`, tbl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, ctype string
+		var dflt sql.NullString
+		err := rows.Scan(&cid, &name, &ctype, &notnull, &dflt, &pk)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, name)
+	}
+
+	return cols, rows.Err()
+}
+
+// copyRows runs the query on src and feeds every row to the prepared insert
+// statement. If trackRowid is set, the first column is the rowid and the last
+// one copied is returned so the caller can resume after a read error. Errors
+// inserting into the destination are reported through writeErr, since
+// skipping ahead won't help with those.
+func copyRows(ctx context.Context, src *sql.Conn, insert *sql.Stmt,
+	query string, args []interface{}, nCols int,
+	trackRowid bool) (last, n int64, readErr, writeErr error) {
+
+	if len(args) > 0 {
+		last, _ = args[0].(int64)
+	}
+
+	rows, err := src.QueryContext(ctx, query, args...)
+	if err != nil {
+		return last, 0, err, nil
+	}
+	defer rows.Close()
+
+	vals := make([]interface{}, nCols)
+	valPtrs := make([]interface{}, nCols)
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(valPtrs...); err != nil {
+			return last, n, err, nil
+		}
+
+		if _, err := insert.ExecContext(ctx, vals...); err != nil {
+			return last, n, nil, err
+		}
+
+		if rowid, ok := vals[0].(int64); ok && trackRowid {
+			last = rowid
+		}
+		n++
+	}
+
+	return last, n, rows.Err(), nil
+}
+
+// readableRowid bisects the rowids after from, where reading fails, up to
+// to for the first point after which rows can be read again. It reports
+// false if there is none.
+func readableRowid(ctx context.Context, src *sql.Conn, probe string,
+	nCols int, from, to int64) (int64, bool) {
+
+	vals := make([]interface{}, nCols)
+	valPtrs := make([]interface{}, nCols)
+	for i := range vals {
+		valPtrs[i] = &vals[i]
+	}
+	readable := func(after int64) bool {
+		err := src.QueryRowContext(ctx, probe, after).Scan(valPtrs...)
+		return err == nil || errors.Is(err, sql.ErrNoRows)
+	}
+
+	// Reading after bad fails, and after good there are no rows left.
+	// Differences are unsigned, as the range may exceed int64.
+	bad, good := from, to
+	for uint64(good)-uint64(bad) > 1 {
+		mid := int64(uint64(bad) + (uint64(good)-uint64(bad))/2)
+		if readable(mid) {
+			good = mid
+		} else {
+			bad = mid
+		}
+	}
+	return good, good != to
+}
+
+// recoverTable salvages as many rows of the table as possible. Rowid tables
+// are read in rowid order; whenever the scan hits an unreadable region we
+// bisect the rest of the rowid range for where rows can be read again and
+// carry on from there. WITHOUT ROWID tables have no rowid to resume from,
+// so we can only copy what precedes the first damaged page.
+func recoverTable(ctx context.Context, src *sql.Conn, dst *sql.Tx,
+	tbl string, withoutRowid bool) recoverStats {
+
+	stats := recoverStats{table: tbl}
+
+	cols, err := tableColumns(ctx, src, tbl)
+	if err != nil {
+		stats.err = err
+		return stats
+	}
+
+	quoted := make([]string, 0, len(cols)+1)
+	if !withoutRowid {
+		quoted = append(quoted, "rowid")
+	}
+	for _, col := range cols {
+		quoted = append(quoted, quoteIdent(col))
+	}
+	colList := strings.Join(quoted, ", ")
+	placeholders := strings.TrimSuffix(
+		strings.Repeat("?, ", len(quoted)), ", ",
+	)
+
+	insert, err := dst.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)", quoteIdent(tbl), colList,
+		placeholders,
+	))
+	if err != nil {
+		stats.err = err
+		return stats
+	}
+	defer insert.Close()
+
+	if withoutRowid {
+		query := fmt.Sprintf("SELECT %s FROM %s", colList,
+			quoteIdent(tbl))
+
+		var readErr, writeErr error
+		_, stats.rows, readErr, writeErr = copyRows(
+			ctx, src, insert, query, nil, len(quoted), false,
+		)
+		stats.err = errors.Join(readErr, writeErr)
+
+		return stats
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE rowid > ? ORDER BY rowid", colList,
+		quoteIdent(tbl),
+	)
+
+	probe := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE rowid > ? ORDER BY rowid LIMIT 1",
+		colList, quoteIdent(tbl),
+	)
+
+	// The ends of the rowid range are usually readable even when pages
+	// in between are not, and bound the search for readable rows.
+	after, maxID := int64(math.MinInt64), int64(math.MaxInt64)
+	var minRowid, maxRowid sql.NullInt64
+	err = src.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT min(rowid), max(rowid) FROM %s", quoteIdent(tbl),
+	)).Scan(&minRowid, &maxRowid)
+	if err == nil && minRowid.Valid {
+		if minRowid.Int64 > math.MinInt64 {
+			after = minRowid.Int64 - 1
+		}
+		maxID = maxRowid.Int64
+	}
+
+	for {
+		last, n, readErr, writeErr := copyRows(
+			ctx, src, insert, query, []interface{}{after},
+			len(quoted), true,
+		)
+		stats.rows += n
+
+		switch {
+		case writeErr != nil:
+			stats.err = writeErr
+			return stats
+
+		case readErr == nil:
+			return stats
+
+		case stats.err == nil:
+			stats.err = readErr
+		}
+
+		next, ok := last, false
+		if stats.skipped < recoverMaxSkips {
+			next, ok = readableRowid(ctx, src, probe, len(quoted),
+				last, maxID)
+		}
+		if !ok {
+			stats.abandoned = true
+			stats.abandonedAfter, stats.abandonedTo = last, maxID
+			return stats
+		}
+
+		stats.skipped++
+		after = next
+	}
+}
+
+func handleRecoverCommand(out string) error {
+	if _, err := os.Stat(out); err == nil {
+		err := fmt.Errorf("%s already exists", out)
+		fmt.Printf("Recover error: %v\n", err)
+		return err
+	}
+
+	ctx := context.Background()
+
+	objs, err := readSchemaObjects(ctx, conn)
+	if err != nil {
+		fmt.Printf("Recover error: schema is unreadable: %v\n", err)
+		return err
+	}
+
+	outDB, err := openDatabase(out, false)
+	if err != nil {
+		fmt.Printf("Recover error: %v\n", err)
+		return err
+	}
+	defer outDB.Close()
+
+	tx, err := outDB.BeginTx(ctx, nil)
+	if err != nil {
+		fmt.Printf("Recover error: %v\n", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	stop := startSpinner("Recovering data")
+
+	var results []recoverStats
+	var schemaErrs []string
+	for _, o := range objs {
+		if o.typ != "table" || isShadowTable(o.name, objs) {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, o.sql); err != nil {
+			schemaErrs = append(schemaErrs,
+				fmt.Sprintf("%s %s: %v", o.typ, o.name, err))
+			continue
+		}
+
+		withoutRowid := strings.Contains(
+			strings.ToUpper(o.sql), "WITHOUT ROWID",
+		)
+		results = append(
+			results, recoverTable(ctx, conn, tx, o.name, withoutRowid),
+		)
+	}
+
+	// Indexes, views and triggers are created last. Indexes may fail if
+	// the salvaged data no longer satisfies a UNIQUE constraint.
+	for _, o := range objs {
+		if o.typ == "table" {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, o.sql); err != nil {
+			schemaErrs = append(schemaErrs,
+				fmt.Sprintf("%s %s: %v", o.typ, o.name, err))
+		}
+	}
+
+	err = tx.Commit()
+	stop()
+	if err != nil {
+		fmt.Printf("Recover error: %v\n", err)
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Table", "Rows", "Skips", "First Error"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 2, Align: text.AlignRight},
+		{Number: 3, Align: text.AlignRight},
+	})
+
+	var total int64
+	for _, r := range results {
+		errStr := ""
+		if r.err != nil {
+			errStr = r.err.Error()
+		}
+		t.AppendRow(table.Row{r.table, r.rows, r.skipped, errStr})
+		total += r.rows
+	}
+	t.Render()
+
+	for _, r := range results {
+		if !r.abandoned {
+			continue
+		}
+		fmt.Printf("WARNING: gave up on %s after %d skips, %d rowids "+
+			"after %d were not read\n", r.table, r.skipped,
+			uint64(r.abandonedTo)-uint64(r.abandonedAfter),
+			r.abandonedAfter)
+	}
+	for _, e := range schemaErrs {
+		fmt.Printf("Could not recreate %s\n", e)
+	}
+
+	fmt.Printf("Recovered %d rows from %d tables into %s\n", total,
+		len(results), out)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+// relationSize is how many rows a table has and how much space its b-tree
+// takes on disk, overflow pages included.
+type relationSize struct {
+	rows  int64
+	bytes int64
+}
+
+// readRelationSizes returns the sizes of the tables and indexes of the main
+// and temp schemas, keyed by schema and name. They are counted from the
+// pages of the dbstat virtual table, which isn't available everywhere, and
+// rows are the cells of the leaf pages, which are the rows of a table.
+func readRelationSizes(ctx context.Context) (map[string]relationSize,
+	error) {
+
+	sizes := make(map[string]relationSize)
+	if err := queryRelationSizes(ctx, metadata(), "main", sizes); err != nil {
+		return nil, err
+	}
+	if hasTempSchema() {
+		if err := queryRelationSizes(ctx, conn, "temp", sizes); err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
+
+func queryRelationSizes(ctx context.Context, c *sql.Conn, schema string,
+	sizes map[string]relationSize) error {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT name,
+		       sum(CASE WHEN pagetype = 'leaf' THEN ncell ELSE 0 END),
+		       sum(pgsize)
+		FROM dbstat(?)
+		GROUP BY name`, schema)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var size relationSize
+		if err := rows.Scan(&name, &size.rows, &size.bytes); err != nil {
+			return err
+		}
+		sizes[schema+"."+name] = size
+	}
+	return rows.Err()
+}
@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxCachedResults is the number of recent results kept for commands
+	// like \g and \sort.
+	maxCachedResults = 10
+
+	// resultCacheBudget bounds the estimated memory held by cached
+	// results, as does memBudget if lower. Results larger than this are
+	// printed but not kept.
+	resultCacheBudget = 64 << 20
+)
+
+// resultRows is what the printers read results from: either live rows from
+// the database or a cached result.
+type resultRows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+
+	// declTypes returns the declared types of the columns, empty for
+	// expressions.
+	declTypes() []string
+}
+
+// resultSet is a result held in memory.
+type resultSet struct {
+	query string
+	args  []interface{}
+	cols  []string
+	types []string
+	rows  [][]interface{}
+
+	// size is the estimated memory used by the rows.
+	size int
+
+	// bigCells is set if values over bigCellLimit were left out.
+	bigCells bool
+}
+
+// valueSize estimates the memory held by a scanned value.
+func valueSize(val interface{}) int {
+	switch v := val.(type) {
+	case string:
+		return 16 + len(v)
+	case []byte:
+		return 24 + len(v)
+	default:
+		return 16
+	}
+}
+
+// cursor returns a fresh iterator over the result.
+func (s *resultSet) cursor() *resultCursor {
+	return &resultCursor{set: s}
+}
+
+// resultCursor iterates over a resultSet like *sql.Rows does.
+type resultCursor struct {
+	set *resultSet
+	row int
+}
+
+func (c *resultCursor) Columns() ([]string, error) {
+	return c.set.cols, nil
+}
+
+func (c *resultCursor) declTypes() []string {
+	return c.set.types
+}
+
+func (c *resultCursor) Next() bool {
+	if c.row >= len(c.set.rows) {
+		return false
+	}
+	c.row++
+	return true
+}
+
+// Scan copies the values of the current row. Like the printers, it only
+// scans into *interface{}.
+func (c *resultCursor) Scan(dest ...interface{}) error {
+	if c.row == 0 {
+		return fmt.Errorf("Scan called without calling Next")
+	}
+
+	row := c.set.rows[c.row-1]
+	if len(dest) != len(row) {
+		return fmt.Errorf("expected %d destination arguments in Scan, "+
+			"not %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		p, ok := d.(*interface{})
+		if !ok {
+			return fmt.Errorf("unsupported Scan destination %T", d)
+		}
+		*p = row[i]
+	}
+
+	return nil
+}
+
+func (c *resultCursor) Err() error {
+	return nil
+}
+
+// liveRows reads rows from the database, keeping a copy of the result as
+// long as it fits the cache budget.
+type liveRows struct {
+	*sql.Rows
+
+	// cols and colsErr are what Columns returned when the rows were
+	// opened.
+	cols    []string
+	colsErr error
+	types   []string
+
+	// set collects the scanned rows. It is dropped once the result
+	// outgrows the budget.
+	set  *resultSet
+	done bool
+
+	// fetched is set when fetchFirst has moved to the first row and Next
+	// hasn't returned it yet, more whether there was one.
+	fetched, more bool
+}
+
+func newLiveRows(rows *sql.Rows, query string) *liveRows {
+	r := &liveRows{Rows: rows}
+
+	cols, err := rows.Columns()
+	r.cols, r.colsErr = cols, err
+	if err != nil {
+		return r
+	}
+	r.types = make([]string, len(cols))
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range types {
+			r.types[i] = ct.DatabaseTypeName()
+		}
+	}
+
+	if len(cols) > 0 {
+		r.set = &resultSet{query: query, cols: cols, types: r.types}
+	}
+
+	return r
+}
+
+// Columns returns the column names, which *sql.Rows no longer does once
+// fetchFirst found no rows and closed them.
+func (r *liveRows) Columns() ([]string, error) {
+	return r.cols, r.colsErr
+}
+
+func (r *liveRows) declTypes() []string {
+	return r.types
+}
+
+// setDeclTypes replaces the declared types of the columns, for a query
+// rewritten by bigCellQuery.
+func (r *liveRows) setDeclTypes(types []string) {
+	r.types = types
+	if r.set != nil {
+		r.set.types = types
+	}
+}
+
+// fetchFirst moves to the first row ahead of Next. Some drivers only run
+// the statement then, so it fails before anything is printed.
+func (r *liveRows) fetchFirst() error {
+	r.more = r.Next()
+	r.fetched = true
+	return r.Err()
+}
+
+func (r *liveRows) Next() bool {
+	if r.fetched {
+		r.fetched = false
+		return r.more
+	}
+	if r.Rows.Next() {
+		return true
+	}
+	r.done = true
+	return false
+}
+
+// Scan scans like *sql.Rows and records the values. Scanning a []byte
+// into *interface{} makes a copy, so the values may be kept.
+func (r *liveRows) Scan(dest ...interface{}) error {
+	if err := r.Rows.Scan(dest...); err != nil {
+		return err
+	}
+	if r.set == nil {
+		return nil
+	}
+
+	row := make([]interface{}, len(dest))
+	size := 24
+	for i, d := range dest {
+		p, ok := d.(*interface{})
+		if !ok {
+			r.set = nil
+			return nil
+		}
+		row[i] = *p
+		size += valueSize(*p)
+	}
+
+	r.set.rows = append(r.set.rows, row)
+	r.set.size += size
+	if r.set.size > resultCacheBudget ||
+		memBudget > 0 && int64(r.set.size) > memBudget {
+
+		r.set = nil
+	}
+
+	return nil
+}
+
+// result returns the recorded result if all of it was read and kept.
+func (r *liveRows) result() (*resultSet, bool) {
+	if !r.done || r.Rows.Err() != nil || r.set == nil {
+		return nil, false
+	}
+	return r.set, true
+}
+
+// resultCache holds the most recent results, oldest first.
+var resultCache []*resultSet
+
+// cacheResult adds a result, evicting the oldest ones to stay within the
+// count and memory limits.
+func cacheResult(set *resultSet) {
+	resultCache = append(resultCache, set)
+
+	total := 0
+	for _, s := range resultCache {
+		total += s.size
+	}
+	for len(resultCache) > maxCachedResults || total > resultCacheBudget {
+		total -= resultCache[0].size
+		resultCache = resultCache[1:]
+	}
+}
+
+// lastResult returns the most recent cached result.
+func lastResult() (*resultSet, bool) {
+	if len(resultCache) == 0 {
+		fmt.Println("No result to work with, run a query first.")
+		return nil, false
+	}
+	return resultCache[len(resultCache)-1], true
+}
+
+// cachedResult returns the most recent cached result of the query.
+func cachedResult(query string) (*resultSet, bool) {
+	for i := len(resultCache) - 1; i >= 0; i-- {
+		if resultCache[i].query == query {
+			return resultCache[i], true
+		}
+	}
+	return nil, false
+}
+
+// printResult prints a cached result in the current format.
+func printResult(set *resultSet) {
+	if _, err := printResultRows(set); err != nil {
+		fmt.Printf("Print error: %v\n", err)
+	}
+}
+
+// printResultRows prints a cached result in the current format. Values left
+// out of it for their size are fetched again, unless it is shown as a table
+// on the terminal.
+func printResultRows(set *resultSet) (int, error) {
+	if !set.bigCells || showBigCells() {
+		return printRows(set.cursor(), set.query)
+	}
+
+	rows, err := conn.QueryContext(context.Background(), set.query,
+		set.args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// The result is cached already.
+	live := newLiveRows(rows, set.query)
+	live.set = nil
+	return printRows(live, set.query)
+}
+
+// columnIndex finds a column of the result by name or 1-based position.
+func (s *resultSet) columnIndex(name string) (int, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > len(s.cols) {
+			return 0, fmt.Errorf("column %d out of range", n)
+		}
+		return n - 1, nil
+	}
+
+	for i, col := range s.cols {
+		if strings.EqualFold(col, name) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no column %q in the result", name)
+}
+
+// handleGCommand prints the last result again, to a file if one is given.
+func handleGCommand(args []string) error {
+	if len(args) > 1 {
+		fmt.Println("Usage: \\g [file]")
+		return errUsage
+	}
+
+	set, ok := lastResult()
+	if !ok {
+		return nil
+	}
+	if len(args) == 0 {
+		printResult(set)
+		return nil
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		fmt.Printf("Output error: %v\n", err)
+		return err
+	}
+
+	// The printers write to stdout, so point it at the file meanwhile.
+	stdout := os.Stdout
+	os.Stdout = f
+	n, err := printResultRows(set)
+	os.Stdout = stdout
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf("Output error: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Wrote %d rows to %s\n", n, args[0])
+	return nil
+}
+
+// handleResultsCommand lists the cached results, or prints one of them.
+func handleResultsCommand(args []string) error {
+	if len(args) > 1 {
+		fmt.Println("Usage: \\results [n]")
+		return errUsage
+	}
+
+	if len(resultCache) == 0 {
+		fmt.Println("No cached results.")
+		return nil
+	}
+
+	// Results are numbered from the most recent one.
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(resultCache) {
+			fmt.Printf("Invalid result number %q, expected 1 to %d\n",
+				args[0], len(resultCache))
+			return fmt.Errorf("invalid result number %q", args[0])
+		}
+
+		// Make it the last result, for \g, \sort and friends.
+		i := len(resultCache) - n
+		set := resultCache[i]
+		resultCache = append(resultCache[:i], resultCache[i+1:]...)
+		resultCache = append(resultCache, set)
+
+		printResult(set)
+		return nil
+	}
+
+	for n := 1; n <= len(resultCache); n++ {
+		set := resultCache[len(resultCache)-n]
+		query := strings.Join(strings.Fields(set.query), " ")
+		if displayWidth(query) > 60 {
+			query = truncateWidth(query, 60)
+		}
+		fmt.Printf("%3d  %6d rows  %s\n", n, len(set.rows), query)
+	}
+	return nil
+}
+
+// storageClassRank orders values like SQLite does across storage classes:
+// NULL, then numbers, then text, then BLOBs.
+func storageClassRank(val interface{}) int {
+	switch val.(type) {
+	case nil:
+		return 0
+	case int64, float64, bool:
+		return 1
+	case string, time.Time:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// numericValue returns a number as float64 for comparisons.
+func numericValue(val interface{}) float64 {
+	switch v := val.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// compareValues compares two values in SQLite's sort order, with text
+// compared by bytes like the BINARY collation.
+func compareValues(a, b interface{}) int {
+	ra, rb := storageClassRank(a), storageClassRank(b)
+	if ra != rb {
+		return cmp.Compare(ra, rb)
+	}
+
+	switch ra {
+	case 1:
+		ia, aInt := a.(int64)
+		ib, bInt := b.(int64)
+		if aInt && bInt {
+			return cmp.Compare(ia, ib)
+		}
+		return cmp.Compare(numericValue(a), numericValue(b))
+
+	case 2:
+		sa, aText := a.(string)
+		sb, bText := b.(string)
+		if !aText || !bText {
+			sa, sb = formatValue(a), formatValue(b)
+		}
+		return strings.Compare(sa, sb)
+
+	case 3:
+		ba, _ := a.([]byte)
+		bb, _ := b.([]byte)
+		return bytes.Compare(ba, bb)
+	}
+
+	return 0
+}
+
+// handleSortCommand reorders the last result by a column and prints it,
+// without running the query again.
+func handleSortCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Println("Usage: \\sort <column> [asc|desc]")
+		return errUsage
+	}
+
+	desc := false
+	if len(args) == 2 {
+		switch strings.ToLower(args[1]) {
+		case "asc":
+		case "desc":
+			desc = true
+		default:
+			fmt.Printf("Invalid sort order %q, expected asc or desc\n",
+				args[1])
+			return fmt.Errorf("invalid sort order %q", args[1])
+		}
+	}
+
+	set, ok := lastResult()
+	if !ok {
+		return nil
+	}
+	col, err := set.columnIndex(args[0])
+	if err != nil {
+		fmt.Printf("Sort error: %v\n", err)
+		return err
+	}
+
+	slices.SortStableFunc(set.rows, func(a, b []interface{}) int {
+		if desc {
+			return compareValues(b[col], a[col])
+		}
+		return compareValues(a[col], b[col])
+	})
+
+	printResult(set)
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// reverseSearch is a readline style incremental history search on the
+// input line. Keys are read on go-prompt's input goroutine while the buffer
+// and prefix are updated on the main one, hence the lock.
+type reverseSearch struct {
+	mu sync.Mutex
+
+	active bool
+	query  string
+
+	// index is the history entry matching the query, len(historyLines)
+	// before anything matched.
+	index  int
+	failed bool
+
+	// original is the input from before the search, restored when it is
+	// cancelled.
+	original string
+	restore  bool
+}
+
+var revSearch reverseSearch
+
+// find moves to the most recent entry at or before from that contains the
+// query, ignoring case as SQL mostly does. The match is kept and the search
+// marked failed if there is none.
+func (s *reverseSearch) find(from int) {
+	if s.query == "" {
+		s.failed = false
+		return
+	}
+
+	query := strings.ToLower(s.query)
+	for i := min(from, len(historyLines)-1); i >= 0; i-- {
+		if strings.Contains(strings.ToLower(historyLines[i]), query) {
+			s.index, s.failed = i, false
+			return
+		}
+	}
+	s.failed = true
+}
+
+// feed handles a key read from the terminal. It returns the sequence to
+// hand to the prompt instead, or false if the key should be handled as
+// usual. Keys that don't edit the search end it, keeping the match, and
+// then take effect, so that Enter runs the match.
+func (s *reverseSearch) feed(b []byte, searchKey bool) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		if !searchKey {
+			return nil, false
+		}
+
+		s.active, s.query, s.failed = true, "", false
+		s.index, s.restore = len(historyLines), false
+		return actionSequence("reverse-search"), true
+	}
+
+	update := actionSequence("search-update")
+	switch {
+	case searchKey:
+		s.find(s.index - 1)
+
+	case len(b) == 1 && (b[0] == 0x07 || b[0] == 0x03):
+		// Ctrl+G and Ctrl+C cancel.
+		s.active, s.restore = false, true
+
+	case len(b) == 1 && (b[0] == 0x7f || b[0] == 0x08):
+		if _, size := utf8.DecodeLastRuneInString(s.query); size > 0 {
+			s.query = s.query[:len(s.query)-size]
+		}
+		s.find(len(historyLines) - 1)
+
+	case len(b) == 1 && b[0] == 0x1b:
+		s.active = false
+
+	case isTextInput(b):
+		s.query += string(b)
+		s.find(s.index)
+
+	default:
+		s.active = false
+		return nil, false
+	}
+
+	return update, true
+}
+
+// isTextInput reports whether the input is typed or pasted text rather
+// than a control key or escape sequence.
+func isTextInput(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// startReverseSearch remembers the input when a search starts.
+func startReverseSearch(buf *prompt.Buffer) {
+	revSearch.mu.Lock()
+	defer revSearch.mu.Unlock()
+
+	revSearch.original = buf.Text()
+}
+
+// updateReverseSearch shows the current match, or the original input when
+// nothing matched yet or the search was cancelled.
+func updateReverseSearch(buf *prompt.Buffer) {
+	s := &revSearch
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.restore:
+		replaceBuffer(buf, s.original)
+		s.restore = false
+
+	case s.index < len(historyLines):
+		replaceBuffer(buf, historyLines[s.index])
+
+	default:
+		replaceBuffer(buf, s.original)
+	}
+}
+
+// reverseSearchPrefix replaces the prompt while a search is active.
+func reverseSearchPrefix() (string, bool) {
+	s := &revSearch
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return "", false
+	}
+	if s.failed {
+		return "(failed reverse-i-search)`" + s.query + "': ", true
+	}
+	return "(reverse-i-search)`" + s.query + "': ", true
+}
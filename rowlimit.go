@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-bata/go-prompt"
+	"golang.org/x/term"
+)
+
+// countTimeout bounds the query counting the rows of a large result.
+const countTimeout = 2 * time.Second
+
+var (
+	// rowLimit is the number of rows a result may have before asking
+	// whether to print it, 0 to never ask. See \pset rowlimit.
+	rowLimit int
+
+	// atPrompt is set while a statement typed at the prompt runs. Only
+	// those ask about large results, scripts and -c commands never do.
+	atPrompt bool
+)
+
+func rowLimitSetting() string {
+	if rowLimit == 0 {
+		return "off"
+	}
+	return strconv.Itoa(rowLimit)
+}
+
+func setRowLimitOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a number of rows or off")
+	}
+	if strings.EqualFold(args[0], "off") {
+		rowLimit = 0
+		return nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid row limit %q", args[0])
+	}
+	rowLimit = n
+	return nil
+}
+
+// prefetchedRows replays the rows read ahead to see whether a result is
+// over the row limit, then goes on with the rest of the result. It stops
+// after max rows if max is set.
+type prefetchedRows struct {
+	*liveRows
+
+	// cols are kept, the rows are closed once read to the end.
+	cols []string
+
+	buf  [][]interface{}
+	pos  int
+	read int
+
+	// max is the number of rows to stop after, stopped is set once it
+	// did.
+	max     int
+	stopped bool
+
+	// size describes the size of the whole result, for the note printed
+	// when only max rows are.
+	size string
+
+	// err is the error reading ahead, returned by Err once the rows read
+	// before it are replayed.
+	err error
+}
+
+func (p *prefetchedRows) Columns() ([]string, error) {
+	return p.cols, nil
+}
+
+func (p *prefetchedRows) Next() bool {
+	if p.max > 0 && p.read >= p.max {
+		p.stopped = true
+		return false
+	}
+	p.read++
+
+	if p.pos < len(p.buf) {
+		p.pos++
+		return true
+	}
+	p.pos = len(p.buf) + 1
+	if p.err != nil {
+		return false
+	}
+	return p.liveRows.Next()
+}
+
+func (p *prefetchedRows) Err() error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.liveRows.Err()
+}
+
+func (p *prefetchedRows) Scan(dest ...interface{}) error {
+	if p.pos > len(p.buf) {
+		return p.liveRows.Scan(dest...)
+	}
+
+	row := p.buf[p.pos-1]
+	for i, d := range dest {
+		if v, ok := d.(*interface{}); ok && i < len(row) {
+			*v = row[i]
+		}
+	}
+	return nil
+}
+
+// limitRows reads up to rowLimit+1 rows of the result and, if there are
+// more than rowLimit, asks whether to print all of them, none or only
+// some. It returns the rows to print, or false if printing was canceled.
+func limitRows(live *liveRows, query string) (resultRows, bool) {
+	if rowLimit == 0 || !atPrompt ||
+		!term.IsTerminal(int(os.Stdin.Fd())) ||
+		!term.IsTerminal(int(os.Stdout.Fd())) {
+
+		return live, true
+	}
+
+	cols, err := live.Columns()
+	if err != nil || len(cols) == 0 {
+		return live, true
+	}
+
+	p := &prefetchedRows{liveRows: live, cols: cols}
+	for len(p.buf) <= rowLimit && live.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := live.Scan(ptrs...); err != nil {
+			p.err = err
+			return p, true
+		}
+		p.buf = append(p.buf, vals)
+	}
+	if len(p.buf) <= rowLimit {
+		return p, true
+	}
+
+	size := fmt.Sprintf("more than %d rows", rowLimit)
+	if n, ok := countRows(query); ok {
+		size = "~" + formatRowCount(n) + " rows"
+	}
+
+	for {
+		answer := strings.ToLower(strings.TrimSpace(prompt.Input(
+			fmt.Sprintf("Query returns %s, continue? [y/N/limit] ", size),
+			func(prompt.Document) []prompt.Suggest { return nil },
+		)))
+
+		switch answer {
+		case "y", "yes":
+			return p, true
+
+		case "", "n", "no":
+			fmt.Println("Output canceled.")
+			return nil, false
+		}
+
+		if n, err := strconv.Atoi(answer); err == nil && n > 0 {
+			p.max, p.size = n, size
+			return p, true
+		}
+		fmt.Println("Answer y, n or the number of rows to print.")
+	}
+}
+
+// printLimitNote tells that only part of the result was printed.
+func printLimitNote(rows resultRows) {
+	p, ok := rows.(*prefetchedRows)
+	if !ok || !p.stopped {
+		return
+	}
+
+	// Stopping right at the end of the result printed all of it.
+	if p.pos < len(p.buf) || p.liveRows.Next() {
+		fmt.Printf("Printed the first %d rows, the query returns %s.\n",
+			p.max, p.size)
+	}
+}
+
+// countRows counts the rows of a query on the metadata connection, which
+// doesn't disturb the result being read. Counting runs the query again, so
+// it is given up on if it takes long, and only done for plain reads.
+func countRows(query string) (int64, bool) {
+	keyword, _ := nextField(query)
+	if metaConn == nil || !isReadQuery(query) ||
+		strings.EqualFold(keyword, "EXPLAIN") {
+
+		return 0, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+	defer cancel()
+
+	var n int64
+	err := metaConn.QueryRowContext(ctx, "SELECT count(*) FROM ("+
+		strings.TrimSuffix(strings.TrimSpace(query), ";")+")").Scan(&n)
+	return n, err == nil
+}
+
+// formatRowCount formats a row count with a decimal unit, e.g. 2.4M.
+func formatRowCount(n int64) string {
+	switch {
+	case n >= 1_000_000_000:
+		return fmt.Sprintf("%.1fG", float64(n)/1e9)
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1e6)
+	case n >= 10_000:
+		return fmt.Sprintf("%.1fK", float64(n)/1e3)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
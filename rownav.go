@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	"github.com/jedib0t/go-pretty/v6/table"
+	"golang.org/x/term"
+)
+
+// rowNavLimit bounds the child rows listed by \row.
+const rowNavLimit = 20
+
+// rowTarget names the rows of a table whose columns equal the values, a
+// single row when the columns are its key.
+type rowTarget struct {
+	table string
+	cols  []string
+	vals  []interface{}
+}
+
+// where returns the condition selecting the target rows, with the values
+// as arguments. IS matches NULLs too, which parent keys never are.
+func (t rowTarget) where() string {
+	conds := make([]string, len(t.cols))
+	for i, col := range t.cols {
+		conds[i] = quoteIdent(col) + " IS ?"
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// describe returns e.g. orders(customer_id=7).
+func (t rowTarget) describe() string {
+	pairs := make([]string, len(t.cols))
+	for i, col := range t.cols {
+		pairs[i] = col + "=" + formatValue(t.vals[i])
+	}
+	return t.table + "(" + strings.Join(pairs, ", ") + ")"
+}
+
+// rowLink is a numbered way on from the shown row or rows.
+type rowLink struct {
+	target rowTarget
+
+	// single is set for links to one row, otherwise the target rows
+	// are listed.
+	single bool
+}
+
+// rowNavigator walks the foreign key graph starting at one row.
+type rowNavigator struct {
+	ctx context.Context
+	f   *fixture
+}
+
+// keyColumns returns the columns identifying a row of the table: its
+// primary key, or the rowid if it has none.
+func (n *rowNavigator) keyColumns(tbl string) ([]string, error) {
+	pk, err := primaryKeyColumns(n.ctx, conn, tbl)
+	if err != nil || len(pk) > 0 {
+		return pk, err
+	}
+	return []string{"rowid"}, nil
+}
+
+// fetch returns the columns and values of up to limit target rows, and the
+// key of each.
+func (n *rowNavigator) fetch(t rowTarget, limit int) ([]string,
+	[][]interface{}, []rowTarget, error) {
+
+	key, err := n.keyColumns(t.table)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyExprs := make([]string, len(key))
+	for i, col := range key {
+		keyExprs[i] = quoteIdent(col)
+	}
+
+	query := fmt.Sprintf("SELECT %s, * FROM %s WHERE %s ORDER BY %s "+
+		"LIMIT %d", strings.Join(keyExprs, ", "), quoteIdent(t.table),
+		t.where(), strings.Join(keyExprs, ", "), limit)
+	rows, err := conn.QueryContext(n.ctx, query, t.vals...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var (
+		data [][]interface{}
+		keys []rowTarget
+	)
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, nil, nil, err
+		}
+
+		data = append(data, vals[len(key):])
+		keys = append(keys, rowTarget{
+			table: t.table,
+			cols:  key,
+			vals:  vals[:len(key)],
+		})
+	}
+
+	return cols[len(key):], data, keys, rows.Err()
+}
+
+// children returns the foreign keys of other tables, or the table itself,
+// that reference the table.
+func (n *rowNavigator) children(tbl string) ([]string,
+	[]fixtureForeignKey, error) {
+
+	names, err := queryStrings(n.ctx, conn, `SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		tables []string
+		fks    []fixtureForeignKey
+	)
+	for _, name := range names {
+		child, err := n.f.table(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, fk := range child.fks {
+			if strings.EqualFold(fk.parent, tbl) && fk.to[0] != "" {
+				tables = append(tables, child.name)
+				fks = append(fks, fk)
+			}
+		}
+	}
+
+	return tables, fks, nil
+}
+
+// rowSummary formats a row on one line as col=value pairs.
+func rowSummary(cols []string, vals []interface{}, width int) string {
+	pairs := make([]string, len(cols))
+	for i, col := range cols {
+		pairs[i] = col + "=" + formatValue(vals[i])
+	}
+	return truncateWidth(strings.Join(pairs, ", "), width)
+}
+
+// showRow prints a row expanded, followed by the rows it references and
+// the number of rows referencing it.
+func (n *rowNavigator) showRow(t rowTarget) ([]rowLink, error) {
+	cols, data, _, err := n.fetch(t, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no row %s", t.describe())
+	}
+	row := data[0]
+
+	strs := make([]string, len(row))
+	for i, v := range row {
+		strs[i] = formatValue(v)
+	}
+	fmt.Printf("\n%s\n", t.describe())
+	printExpandedData(cols, memRows(cols, [][]string{strs}))
+
+	values := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		values[strings.ToLower(col)] = row[i]
+	}
+
+	self, err := n.f.table(t.table)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a terminal, keep the summaries to a usual width.
+	width := terminalWidth()
+	if width == 0 {
+		width = 80
+	}
+	width = max(width-7, 20)
+
+	var links []rowLink
+
+	if len(self.fks) > 0 {
+		fmt.Println("References:")
+	}
+	for _, fk := range self.fks {
+		if fk.to[0] == "" {
+			// The parent key couldn't be resolved.
+			continue
+		}
+
+		parent := rowTarget{table: fk.parent, cols: fk.to}
+		isNull := false
+		for _, col := range fk.from {
+			v := values[strings.ToLower(col)]
+			parent.vals = append(parent.vals, v)
+			isNull = isNull || v == nil
+		}
+
+		from := strings.Join(fk.from, ", ")
+		if isNull {
+			fmt.Printf("       %s → %s: NULL\n", from, fk.parent)
+			continue
+		}
+
+		pcols, pdata, _, err := n.fetch(parent, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(pdata) == 0 {
+			fmt.Printf("       %s → %s: missing row\n", from,
+				parent.describe())
+			continue
+		}
+
+		links = append(links, rowLink{target: parent, single: true})
+		fmt.Printf("  [%d]  %s → %s\n       %s\n", len(links), from,
+			parent.describe(), rowSummary(pcols, pdata[0], width))
+	}
+
+	tables, fks, err := n.children(t.table)
+	if err != nil {
+		return nil, err
+	}
+	if len(fks) > 0 {
+		if len(self.fks) > 0 {
+			fmt.Println()
+		}
+		fmt.Println("Referenced by:")
+	}
+	for i, fk := range fks {
+		child := rowTarget{table: tables[i], cols: fk.from}
+		for _, col := range fk.to {
+			child.vals = append(child.vals,
+				values[strings.ToLower(col)])
+		}
+
+		var count int64
+		err := conn.QueryRowContext(n.ctx, fmt.Sprintf(
+			"SELECT count(*) FROM %s WHERE %s",
+			quoteIdent(child.table), child.where(),
+		), child.vals...).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+
+		if count == 0 {
+			fmt.Printf("       %s: no rows\n", child.describe())
+			continue
+		}
+		links = append(links, rowLink{target: child})
+		fmt.Printf("  [%d]  %s: %d %s\n", len(links), child.describe(),
+			count, plural(count, "row", "rows"))
+	}
+
+	return links, nil
+}
+
+// showRows lists the first target rows, each linking to itself.
+func (n *rowNavigator) showRows(t rowTarget) ([]rowLink, error) {
+	cols, data, keys, err := n.fetch(t, rowNavLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("\n%s\n", t.describe())
+
+	tw := table.NewWriter()
+	tw.SetOutputMirror(os.Stdout)
+	tw.SetStyle(psqlStyle)
+	header := table.Row{"#"}
+	for _, col := range cols {
+		header = append(header, col)
+	}
+	tw.AppendHeader(header)
+
+	links := make([]rowLink, len(data))
+	for i, row := range data {
+		r := table.Row{fmt.Sprintf("[%d]", i+1)}
+		for _, v := range row {
+			r = append(r, truncateWidth(formatValue(v),
+				browseMaxColWidth))
+		}
+		tw.AppendRow(r)
+		links[i] = rowLink{target: keys[i], single: true}
+	}
+	tw.Render()
+
+	if len(data) == rowNavLimit {
+		fmt.Printf("Showing the first %d rows.\n", rowNavLimit)
+	}
+	return links, nil
+}
+
+// plural picks the word form for a count.
+func plural(n int64, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// handleRowCommand shows a row with its foreign key neighbours. In a
+// terminal the numbered links can be followed, b goes back and q or an
+// empty line quits.
+func handleRowCommand(args []string) error {
+	if len(args) < 2 {
+		fmt.Println("Usage: \\row <table> <key> [key...]")
+		return errUsage
+	}
+
+	ctx := context.Background()
+	n := &rowNavigator{
+		ctx: ctx,
+		f: &fixture{
+			ctx:    ctx,
+			c:      conn,
+			tables: make(map[string]*fixtureTable),
+		},
+	}
+
+	t, err := n.f.table(args[0])
+	if err != nil {
+		fmt.Printf("Row error: %v\n", err)
+		return err
+	}
+	key, err := n.keyColumns(t.name)
+	if err != nil {
+		fmt.Printf("Row error: %v\n", err)
+		return err
+	}
+	if len(args)-1 != len(key) {
+		err := fmt.Errorf("%s is keyed by %s, expected %d %s", t.name,
+			strings.Join(key, ", "), len(key),
+			plural(int64(len(key)), "value", "values"))
+		fmt.Printf("Row error: %v\n", err)
+		return err
+	}
+
+	start := rowLink{
+		target: rowTarget{table: t.name, cols: key},
+		single: true,
+	}
+	for i, arg := range args[1:] {
+		var v interface{} = arg
+		if key[i] == "rowid" {
+			v = rowidValue(arg)
+		}
+		start.target.vals = append(start.target.vals, v)
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	stack := []rowLink{start}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+
+		var links []rowLink
+		if cur.single {
+			links, err = n.showRow(cur.target)
+		} else {
+			links, err = n.showRows(cur.target)
+		}
+		if err != nil {
+			fmt.Printf("Row error: %v\n", err)
+			if len(stack) == 1 {
+				return err
+			}
+		}
+		if !interactive {
+			return nil
+		}
+
+		for {
+			answer := strings.TrimSpace(prompt.Input(
+				"row [number, b=back, q=quit]> ",
+				func(prompt.Document) []prompt.Suggest {
+					return nil
+				},
+			))
+
+			if answer == "" || answer == "q" {
+				return nil
+			}
+			if answer == "b" {
+				stack = stack[:len(stack)-1]
+				break
+			}
+
+			i, err := strconv.Atoi(answer)
+			if err != nil || i < 1 || i > len(links) {
+				fmt.Printf("Pick a link from 1 to %d, b or q.\n",
+					len(links))
+				continue
+			}
+			stack = append(stack, links[i-1])
+			break
+		}
+	}
+	return nil
+}
+
+// rowidValue converts a rowid given on the command line to an integer, the
+// rowid has no column affinity converting text when comparing. Key columns
+// do and get the text.
+func rowidValue(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	return s
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultSampleSize = 10
+
+	// sampleAttemptsFactor bounds the number of random probes relative
+	// to the sample size, so sparse rowid ranges can't loop forever.
+	sampleAttemptsFactor = 4
+)
+
+// sampleRowids picks up to n distinct rowids by probing random points of the
+// rowid range and taking the next existing row. This only touches O(n)
+// b-tree pages, unlike ORDER BY random() which scans and sorts the table.
+// Rows following large rowid gaps are somewhat more likely to be picked.
+func sampleRowids(ctx context.Context, tableName string, n int) ([]int64,
+	bool, error) {
+
+	var minID, maxID sql.NullInt64
+	err := conn.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT min(rowid), max(rowid) FROM %s", quoteIdent(tableName),
+	)).Scan(&minID, &maxID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The distance between the ends overflows int64 when the rowids
+	// span more than half of its range, but always fits uint64.
+	diff := uint64(maxID.Int64) - uint64(minID.Int64)
+
+	// Empty table, or small enough to simply show all of it.
+	if !minID.Valid || diff < uint64(n) {
+		return nil, true, nil
+	}
+
+	probe := fmt.Sprintf(
+		"SELECT rowid FROM %s WHERE rowid >= ? ORDER BY rowid LIMIT 1",
+		quoteIdent(tableName),
+	)
+
+	seen := make(map[int64]bool)
+	var ids []int64
+	for i := 0; i < n*sampleAttemptsFactor && len(ids) < n; i++ {
+		offset := rand.Uint64()
+		if diff < math.MaxUint64 {
+			offset = rand.Uint64N(diff + 1)
+		}
+		target := int64(uint64(minID.Int64) + offset)
+
+		var id int64
+		if err := conn.QueryRowContext(ctx, probe, target).Scan(&id); err != nil {
+			return nil, false, err
+		}
+
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, false, nil
+}
+
+func handleSampleCommand(args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Println("Usage: \\sample <table> [N]")
+		return errUsage
+	}
+
+	tableName := args[0]
+	n := defaultSampleSize
+	if len(args) == 2 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			fmt.Printf("Invalid sample size %q\n", args[1])
+			return fmt.Errorf("invalid sample size %q", args[1])
+		}
+	}
+
+	ctx := context.Background()
+	ids, all, err := sampleRowids(ctx, tableName, n)
+
+	var query string
+	switch {
+	// WITHOUT ROWID tables have no rowid to sample on, so fall back to
+	// the slow but general approach.
+	case err != nil && strings.Contains(err.Error(), "no such column: rowid"):
+		query = fmt.Sprintf(
+			"SELECT * FROM %s ORDER BY random() LIMIT %d",
+			quoteIdent(tableName), n,
+		)
+
+	case err != nil:
+		fmt.Printf("Sample error: %v\n", err)
+		return err
+
+	case all:
+		query = fmt.Sprintf("SELECT * FROM %s", quoteIdent(tableName))
+
+	default:
+		idList := make([]string, len(ids))
+		for i, id := range ids {
+			idList[i] = strconv.FormatInt(id, 10)
+		}
+		query = fmt.Sprintf(
+			"SELECT * FROM %s WHERE rowid IN (%s) ORDER BY rowid",
+			quoteIdent(tableName), strings.Join(idList, ", "),
+		)
+	}
+
+	_, err = runQuery(query)
+	return err
+}
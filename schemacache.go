@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaCheckInterval is how often the cached schema is checked against the
+// database while no input marks it stale.
+const schemaCheckInterval = time.Second
+
+// schemaCache holds the schema of the session database for completion, the
+// \d commands and \alter, which would otherwise query sqlite_master on every
+// key press and command. The main schema is read through the metadata
+// connection, the temp schema through the session connection, which is the
+// only one seeing it. The cache is tagged with the schema_version of both,
+// which is checked again after every input, which may have run DDL, and
+// otherwise every schemaCheckInterval to catch other processes; the cache is
+// dropped when it changed.
+type schemaCache struct {
+	sync.Mutex
+
+	// c is the connection the schema was read from, switching databases
+	// starts over.
+	c                    *sql.Conn
+	version, tempVersion int64
+	checked              time.Time
+	stale                bool
+
+	// objects are the rows of sqlite_master, see readSchemaObjects, the
+	// main schema's first, and tables what the pragmas report about the
+	// tables and views, read the first time one is asked for and keyed by
+	// schema and lower case name.
+	objects []schemaObject
+	loaded  bool
+	tables  map[string]*schemaTable
+}
+
+// dbSchema is the schema cache of the session database.
+var dbSchema schemaCache
+
+// errNoSuchTable is returned for tables and views not in the schema.
+var errNoSuchTable = errors.New("no such table")
+
+// invalidate has the schema version checked on next use.
+func (s *schemaCache) invalidate() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.stale = true
+}
+
+// validate drops the cache if the database was switched or its schema
+// changed since it was read. A version that can't be read counts as a
+// change.
+func (s *schemaCache) validate(ctx context.Context) {
+	c := metadata()
+	if s.c == c && !s.stale && time.Since(s.checked) < schemaCheckInterval {
+		return
+	}
+
+	var version, tempVersion int64
+	err := c.QueryRowContext(ctx, "PRAGMA schema_version").Scan(&version)
+	if err == nil && hasTempSchema() {
+		err = conn.QueryRowContext(ctx, "PRAGMA temp.schema_version").
+			Scan(&tempVersion)
+	}
+	if err != nil || s.c != c || version != s.version ||
+		tempVersion != s.tempVersion {
+
+		s.objects, s.loaded, s.tables = nil, false, nil
+	}
+	s.c, s.checked, s.stale = c, time.Now(), false
+	s.version, s.tempVersion = version, tempVersion
+}
+
+// hasTempSchema reports whether the session connection has a temp schema
+// of its own. Remote databases don't keep a connection between statements.
+func hasTempSchema() bool {
+	return !isRemoteDatabase(dbPath)
+}
+
+// splitSchemaName splits a table name qualified with main. or temp. into
+// the schema and the name, the schema is empty for other names.
+func splitSchemaName(name string) (string, string) {
+	schema, rest, ok := strings.Cut(name, ".")
+	schema = strings.ToLower(unquoteName(schema))
+	if !ok || (schema != "main" && schema != "temp") {
+		return "", name
+	}
+	return schema, unquoteName(rest)
+}
+
+// load reads the schema objects unless they are cached.
+func (s *schemaCache) load(ctx context.Context) error {
+	s.validate(ctx)
+	if s.loaded {
+		return nil
+	}
+
+	objs, err := querySchemaObjects(ctx, s.c, "main", internalTablesFilter)
+	if err != nil {
+		return err
+	}
+	if hasTempSchema() {
+		temp, err := querySchemaObjects(ctx, conn, "temp", "")
+		if err != nil {
+			return err
+		}
+		objs = append(objs, temp...)
+	}
+	s.objects, s.loaded = objs, true
+	s.tables = make(map[string]*schemaTable)
+	return nil
+}
+
+// schemaObjects returns the objects of the given types, or all of them, in
+// the order readSchemaObjects returns them.
+func (s *schemaCache) schemaObjects(ctx context.Context,
+	types ...string) ([]schemaObject, error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	var objs []schemaObject
+	for _, o := range s.objects {
+		match := len(types) == 0
+		for _, typ := range types {
+			match = match || o.typ == typ
+		}
+		if match {
+			objs = append(objs, o)
+		}
+	}
+	return objs, nil
+}
+
+// userObjects returns the objects of the main schema without the shadow
+// tables of virtual tables, like userSchemaObjects.
+func (s *schemaCache) userObjects(ctx context.Context) ([]schemaObject,
+	error) {
+
+	objs, err := s.schemaObjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var user []schemaObject
+	for _, o := range objs {
+		if o.temp || o.typ == "table" && isShadowTable(o.name, objs) {
+			continue
+		}
+		user = append(user, o)
+	}
+	return user, nil
+}
+
+// table returns the columns, indexes and foreign keys of a table or view,
+// which is looked up case-insensitively. The name may be qualified with
+// main. or temp., otherwise temp objects shadow main ones like in SQLite.
+func (s *schemaCache) table(ctx context.Context, name string) (*schemaTable,
+	error) {
+
+	s.Lock()
+	defer s.Unlock()
+
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+
+	// A name like main.t may also be a table with a dot in its name.
+	type lookup struct{ schema, bare string }
+	lookups := []lookup{{"temp", name}, {"main", name}}
+	if schema, bare := splitSchemaName(name); schema != "" {
+		lookups = append([]lookup{{schema, bare}}, lookups...)
+	}
+
+	for _, l := range lookups {
+		schema, bare := l.schema, l.bare
+		key := schema + "." + strings.ToLower(bare)
+		if t, ok := s.tables[key]; ok {
+			return t, nil
+		}
+
+		for _, o := range s.objects {
+			if o.schema() != schema ||
+				(o.typ != "table" && o.typ != "view") ||
+				!strings.EqualFold(o.name, bare) {
+
+				continue
+			}
+
+			// Only the session connection sees the temp schema.
+			c := s.c
+			if o.temp {
+				c = conn
+			}
+			t, err := readSchemaTable(ctx, c, o)
+			if err != nil {
+				return nil, err
+			}
+			s.tables[key] = &t
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", errNoSuchTable, name)
+}
@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// schemaFormatVersion is bumped when the JSON schema export changes in a
+// way that breaks its readers.
+const schemaFormatVersion = 1
+
+// schemaDocument is the schema of a database as exported by \schema export.
+// Objects are sorted by name and empty lists omitted, so that exports of the
+// same schema are identical and diff cleanly.
+type schemaDocument struct {
+	FormatVersion int             `json:"format_version"`
+	Database      string          `json:"database"`
+	Tables        []schemaTable   `json:"tables"`
+	Views         []schemaView    `json:"views,omitempty"`
+	Triggers      []schemaTrigger `json:"triggers,omitempty"`
+}
+
+type schemaTable struct {
+	Name         string             `json:"name"`
+	Virtual      bool               `json:"virtual,omitempty"`
+	WithoutRowid bool               `json:"without_rowid,omitempty"`
+	Strict       bool               `json:"strict,omitempty"`
+	Columns      []schemaColumn     `json:"columns"`
+	PrimaryKey   []string           `json:"primary_key,omitempty"`
+	ForeignKeys  []schemaForeignKey `json:"foreign_keys,omitempty"`
+	Checks       []string           `json:"checks,omitempty"`
+	Indexes      []schemaIndex      `json:"indexes,omitempty"`
+	SQL          string             `json:"sql"`
+}
+
+type schemaColumn struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	NotNull bool    `json:"not_null"`
+	Default *string `json:"default"`
+
+	// Generated is "virtual" or "stored" for generated columns, and
+	// Expression what they are generated from.
+	Generated  string `json:"generated,omitempty"`
+	Expression string `json:"expression,omitempty"`
+	Collation  string `json:"collation,omitempty"`
+	Hidden     bool   `json:"hidden,omitempty"`
+
+	// Checks are the expressions of the CHECK constraints in the column
+	// definition. Table level constraints are in schemaTable.Checks.
+	Checks []string `json:"checks,omitempty"`
+}
+
+type schemaForeignKey struct {
+	Columns    []string `json:"columns"`
+	Table      string   `json:"table"`
+	References []string `json:"references"`
+	OnUpdate   string   `json:"on_update"`
+	OnDelete   string   `json:"on_delete"`
+}
+
+type schemaIndex struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Partial bool     `json:"partial,omitempty"`
+	Columns []string `json:"columns"`
+
+	// Origin is "index" for CREATE INDEX, and "unique" or "primary_key"
+	// for indexes SQLite creates for constraints, which have no SQL.
+	Origin string `json:"origin"`
+	SQL    string `json:"sql,omitempty"`
+}
+
+type schemaView struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	SQL     string   `json:"sql"`
+}
+
+type schemaTrigger struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	SQL   string `json:"sql"`
+}
+
+var (
+	// checkConstraintRe matches a CHECK with its constraint name in a
+	// definition whose strings and parentheses are blanked out.
+	checkConstraintRe = regexp.MustCompile(`(?i)(?:\bCONSTRAINT\s+(` +
+		identPattern + `)\s+)?\bCHECK\s*\(`)
+
+	// createTableRe matches the start of a CREATE TABLE statement, which
+	// views and virtual tables don't have.
+	createTableRe = regexp.MustCompile(
+		`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TABLE\b`,
+	)
+
+	// columnNameRe matches the name a column definition starts with.
+	columnNameRe = regexp.MustCompile(`^\s*("(?:[^"]|"")*"|\[[^\]]*\]|` +
+		"`[^`]*`" + `|[^\s(]+)`)
+	tableOptionRe = regexp.MustCompile(`(?i)\b(WITHOUT\s+ROWID|STRICT)\b`)
+
+	// columnCollateRe and columnGeneratedRe match the COLLATE and the
+	// AS ( of a column definition, whose strings and parentheses are
+	// blanked out.
+	columnCollateRe = regexp.MustCompile(
+		`(?i)\bCOLLATE\s+("(?:[^"]|"")*"|[A-Za-z_]\w*)`,
+	)
+	columnGeneratedRe = regexp.MustCompile(`(?i)\bAS\s*\(`)
+)
+
+// checkConstraint is a CHECK constraint of a table, or of one of its
+// columns if Column is set.
+type checkConstraint struct {
+	Name       string
+	Column     string
+	Expression string
+}
+
+// matchingParen returns the index of the parenthesis closing the one
+// before start, or -1. Strings must be blanked out.
+func matchingParen(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkConstraints returns the CHECK constraints of a CREATE TABLE
+// statement in the order they are defined, which the pragmas don't report.
+func checkConstraints(create string) []checkConstraint {
+	if !createTableRe.MatchString(create) {
+		return nil
+	}
+	defs, _, ok := tableDefinition(create)
+	if !ok {
+		return nil
+	}
+
+	var checks []checkConstraint
+	for _, def := range defs {
+		var column string
+		if isColumnDefinition(def) {
+			if m := columnNameRe.FindStringSubmatch(def); m != nil {
+				column = unquoteName(strings.Trim(m[1], "[]`"))
+			}
+		}
+
+		blank := blankLiterals(def)
+		top := blankParens(blank)
+		for _, m := range checkConstraintRe.FindAllStringSubmatchIndex(
+			top, -1,
+		) {
+
+			end := matchingParen(blank, m[1])
+			if end < 0 {
+				continue
+			}
+			c := checkConstraint{
+				Column:     column,
+				Expression: strings.TrimSpace(def[m[1]:end]),
+			}
+			if m[2] >= 0 {
+				c.Name = unquoteName(def[m[2]:m[3]])
+			}
+			checks = append(checks, c)
+		}
+	}
+	return checks
+}
+
+// tableChecks returns the expressions of the table level CHECK constraints
+// of a CREATE TABLE statement.
+func tableChecks(create string) []string {
+	var checks []string
+	for _, c := range checkConstraints(create) {
+		if c.Column == "" {
+			checks = append(checks, c.Expression)
+		}
+	}
+	return checks
+}
+
+// columnDefinitionDetails returns what the pragmas don't tell about a
+// column from its definition in CREATE TABLE: the collation, and the
+// expression of a generated column, as written.
+func columnDefinitionDetails(def string) (collation, expr string) {
+	blank := blankLiterals(def)
+	top := blankParens(blank)
+
+	if m := columnCollateRe.FindStringSubmatchIndex(top); m != nil {
+		collation = unquoteName(def[m[2]:m[3]])
+	}
+
+	if m := columnGeneratedRe.FindStringIndex(top); m != nil {
+		if end := matchingParen(blank, m[1]); end >= 0 {
+			expr = strings.TrimSpace(def[m[1]:end])
+		}
+	}
+	return collation, expr
+}
+
+// readSchemaTable collects what the pragmas know about a table.
+func readSchemaTable(ctx context.Context, c *sql.Conn,
+	o schemaObject) (schemaTable, error) {
+
+	t := schemaTable{
+		Name:    o.name,
+		Virtual: isVirtualTable(&o),
+		Columns: []schemaColumn{},
+		SQL:     o.sql,
+	}
+
+	if _, tail, ok := tableDefinition(o.sql); ok {
+		for _, m := range tableOptionRe.FindAllString(tail, -1) {
+			if strings.EqualFold(m, "STRICT") {
+				t.Strict = true
+			} else {
+				t.WithoutRowid = true
+			}
+		}
+	}
+	t.Checks = tableChecks(o.sql)
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT name, type, "notnull", dflt_value, pk, hidden
+		FROM pragma_table_xinfo(?, ?)
+		ORDER BY cid`, o.name, o.schema())
+	if err != nil {
+		return t, err
+	}
+	defer rows.Close()
+
+	pk := make(map[int]string)
+	for rows.Next() {
+		var (
+			col         schemaColumn
+			dflt        sql.NullString
+			pos, hidden int
+		)
+		err := rows.Scan(&col.Name, &col.Type, &col.NotNull, &dflt,
+			&pos, &hidden)
+		if err != nil {
+			return t, err
+		}
+
+		if dflt.Valid {
+			col.Default = &dflt.String
+		}
+		switch hidden {
+		case 1:
+			col.Hidden = true
+		case 2:
+			col.Generated = "virtual"
+		case 3:
+			col.Generated = "stored"
+		}
+		if pos > 0 {
+			pk[pos] = col.Name
+		}
+
+		t.Columns = append(t.Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return t, err
+	}
+
+	// The column definitions are in the order of the columns, unless the
+	// table is virtual and its module declares them.
+	if defs, _, ok := tableDefinition(o.sql); ok && o.typ == "table" &&
+		!t.Virtual {
+
+		var colDefs []string
+		for _, def := range defs {
+			if isColumnDefinition(def) {
+				colDefs = append(colDefs, def)
+			}
+		}
+		if len(colDefs) == len(t.Columns) {
+			for i, def := range colDefs {
+				t.Columns[i].Collation, t.Columns[i].Expression =
+					columnDefinitionDetails(def)
+			}
+		}
+	}
+
+	for i := 1; i <= len(pk); i++ {
+		t.PrimaryKey = append(t.PrimaryKey, pk[i])
+	}
+
+	for _, check := range checkConstraints(o.sql) {
+		for i := range t.Columns {
+			if check.Column != "" &&
+				strings.EqualFold(t.Columns[i].Name, check.Column) {
+
+				t.Columns[i].Checks = append(t.Columns[i].Checks,
+					check.Expression)
+			}
+		}
+	}
+
+	t.ForeignKeys, err = readSchemaForeignKeys(ctx, c, o.schema(), o.name)
+	if err != nil {
+		return t, err
+	}
+	t.Indexes, err = readSchemaIndexes(ctx, c, o.schema(), o.name)
+
+	return t, err
+}
+
+// readSchemaForeignKeys returns the foreign keys of a table, grouping the
+// columns of composite keys.
+func readSchemaForeignKeys(ctx context.Context, c *sql.Conn, schema,
+	table string) ([]schemaForeignKey, error) {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT id, "table", "from", "to", on_update, on_delete
+		FROM pragma_foreign_key_list(?, ?)
+		ORDER BY id, seq`, table, schema)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fks []schemaForeignKey
+	lastID := -1
+	for rows.Next() {
+		var (
+			id             int
+			refTable, from string
+			to             sql.NullString
+			onUpd, onDel   string
+		)
+		err := rows.Scan(&id, &refTable, &from, &to, &onUpd, &onDel)
+		if err != nil {
+			return nil, err
+		}
+
+		if id != lastID {
+			fks = append(fks, schemaForeignKey{
+				Columns:    []string{},
+				Table:      refTable,
+				References: []string{},
+				OnUpdate:   onUpd,
+				OnDelete:   onDel,
+			})
+			lastID = id
+		}
+
+		// The referenced columns are left out for references to the
+		// primary key.
+		fk := &fks[len(fks)-1]
+		fk.Columns = append(fk.Columns, from)
+		if to.Valid {
+			fk.References = append(fk.References, to.String)
+		}
+	}
+
+	return fks, rows.Err()
+}
+
+// readSchemaIndexes returns the indexes of a table, including the ones
+// SQLite creates for UNIQUE and PRIMARY KEY constraints.
+func readSchemaIndexes(ctx context.Context, c *sql.Conn, schema,
+	table string) ([]schemaIndex, error) {
+
+	rows, err := c.QueryContext(ctx, `
+		SELECT il.name, il."unique", il.origin, il.partial,
+		       coalesce(m.sql, '')
+		FROM pragma_index_list(?, ?) AS il
+		LEFT JOIN `+schema+`.sqlite_master AS m
+		  ON m.type = 'index' AND m.name = il.name
+		ORDER BY il.name`, table, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []schemaIndex
+	for rows.Next() {
+		var idx schemaIndex
+		err := rows.Scan(&idx.Name, &idx.Unique, &idx.Origin,
+			&idx.Partial, &idx.SQL)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		switch idx.Origin {
+		case "c":
+			idx.Origin = "index"
+		case "u":
+			idx.Origin = "unique"
+		case "pk":
+			idx.Origin = "primary_key"
+		}
+		indexes = append(indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Expressions have no column name, their SQL tells what they are.
+	for i := range indexes {
+		cols, err := queryStrings(ctx, c, `
+			SELECT coalesce(name, '<expression>')
+			FROM pragma_index_info(?, ?)
+			ORDER BY seqno`, indexes[i].Name, schema)
+		if err != nil {
+			return nil, err
+		}
+		indexes[i].Columns = append([]string{}, cols...)
+	}
+
+	return indexes, nil
+}
+
+// readSchemaDocument collects the schema of the session database, or of a
+// single table or view if name is set.
+func readSchemaDocument(ctx context.Context, name string) (schemaDocument,
+	error) {
+
+	doc := schemaDocument{
+		FormatVersion: schemaFormatVersion,
+		Database:      redactDatabaseName(dbPath),
+		Tables:        []schemaTable{},
+	}
+
+	objs, err := userSchemaObjects(ctx, conn)
+	if err != nil {
+		return doc, err
+	}
+	sort.SliceStable(objs, func(i, j int) bool {
+		return objs[i].name < objs[j].name
+	})
+
+	found := false
+	for _, o := range objs {
+		if name != "" && o.name != name && o.tblName != name {
+			continue
+		}
+		found = found || o.name == name
+
+		switch o.typ {
+		case "table":
+			t, err := readSchemaTable(ctx, conn, o)
+			if err != nil {
+				return doc, fmt.Errorf("%s: %w", o.name, err)
+			}
+			doc.Tables = append(doc.Tables, t)
+
+		case "view":
+			cols, err := queryStrings(ctx, conn, `
+				SELECT name FROM pragma_table_info(?)
+				ORDER BY cid`, o.name)
+			if err != nil {
+				return doc, fmt.Errorf("%s: %w", o.name, err)
+			}
+			doc.Views = append(doc.Views, schemaView{
+				Name:    o.name,
+				Columns: append([]string{}, cols...),
+				SQL:     o.sql,
+			})
+
+		case "trigger":
+			doc.Triggers = append(doc.Triggers, schemaTrigger{
+				Name:  o.name,
+				Table: o.tblName,
+				SQL:   o.sql,
+			})
+		}
+	}
+
+	if name != "" && !found {
+		return doc, fmt.Errorf("no table or view named %q", name)
+	}
+	return doc, nil
+}
+
+// writeSchemaJSON writes the schema as indented JSON to path, or stdout if
+// path is empty.
+func writeSchemaJSON(ctx context.Context, name, path string) error {
+	doc, err := readSchemaDocument(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	// SQL is full of < and >, which are escaped by default.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+
+	if path == "" {
+		_, err = os.Stdout.Write(b.Bytes())
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0o644)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// memorySchema is a throwaway in-memory database used to load schema
+// snapshots and to try out DDL.
+type memorySchema struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func newMemorySchema(ctx context.Context) (*memorySchema, error) {
+	memDB, err := activeDriver.open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection has its own in-memory database, so stick to one.
+	c, err := memDB.Conn(ctx)
+	if err != nil {
+		memDB.Close()
+		return nil, err
+	}
+
+	return &memorySchema{db: memDB, conn: c}, nil
+}
+
+func (m *memorySchema) Close() {
+	m.conn.Close()
+	m.db.Close()
+}
+
+// userSchemaObjects returns the schema objects without the shadow tables of
+// virtual tables, which are created along with their virtual table.
+func userSchemaObjects(ctx context.Context, c *sql.Conn) ([]schemaObject,
+	error) {
+
+	objs, err := readSchemaObjects(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var user []schemaObject
+	for _, o := range objs {
+		if o.typ == "table" && isShadowTable(o.name, objs) {
+			continue
+		}
+		user = append(user, o)
+	}
+
+	return user, nil
+}
+
+// writeSchemaSnapshot writes the schema of the session database to path as
+// an SQL script.
+func writeSchemaSnapshot(ctx context.Context, path string) (int, error) {
+	objs, err := userSchemaObjects(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- vsqlite schema snapshot of %s\n-- taken %s\n\n",
+		redactDatabaseName(dbPath), time.Now().Format(time.RFC3339))
+	for _, o := range objs {
+		fmt.Fprintf(&b, "%s;\n\n", o.sql)
+	}
+
+	return len(objs), os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+// readSchemaSnapshot loads a snapshot written by \schema snapshot, or any
+// other schema script, by running it in an in-memory database.
+func readSchemaSnapshot(ctx context.Context, path string) ([]schemaObject,
+	error) {
+
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mem, err := newMemorySchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	if _, err := mem.conn.ExecContext(ctx, string(script)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return userSchemaObjects(ctx, mem.conn)
+}
+
+// tableDefinition splits a CREATE TABLE statement into its column and
+// constraint definitions and the table options after them.
+func tableDefinition(create string) (defs []string, tail string, ok bool) {
+
+	depth, start := 0, -1
+	var quote rune
+	for i, r := range create {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+
+		case r == '[':
+			quote = ']'
+
+		case r == '(':
+			depth++
+			if depth == 1 {
+				start = i + 1
+			}
+
+		case r == ',' && depth == 1:
+			defs = append(defs, strings.TrimSpace(create[start:i]))
+			start = i + 1
+
+		case r == ')':
+			depth--
+			if depth == 0 && start >= 0 {
+				defs = append(defs,
+					strings.TrimSpace(create[start:i]))
+				return defs, create[i+1:], true
+			}
+		}
+	}
+
+	return nil, "", false
+}
+
+// isColumnDefinition reports whether an item of a table definition defines
+// a column rather than a table constraint.
+func isColumnDefinition(def string) bool {
+	keyword, _ := nextField(def)
+	switch strings.ToUpper(keyword) {
+	case "CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN":
+		return false
+	default:
+		return true
+	}
+}
+
+// addedColumns returns the definitions of the columns appended to a table,
+// if that is the only change between the two CREATE TABLE statements and
+// ALTER TABLE ADD COLUMN accepts them.
+func addedColumns(ctx context.Context, table, oldSQL,
+	newSQL string) ([]string, bool) {
+
+	oldDefs, oldTail, ok := tableDefinition(oldSQL)
+	if !ok {
+		return nil, false
+	}
+	newDefs, newTail, ok := tableDefinition(newSQL)
+	if !ok || len(newDefs) <= len(oldDefs) ||
+		normalizeSQL(oldTail) != normalizeSQL(newTail) {
+
+		return nil, false
+	}
+
+	for i, def := range oldDefs {
+		if normalizeSQL(def) != normalizeSQL(newDefs[i]) {
+			return nil, false
+		}
+	}
+
+	added := newDefs[len(oldDefs):]
+	for _, def := range added {
+		if !isColumnDefinition(def) {
+			return nil, false
+		}
+	}
+
+	// ADD COLUMN refuses a few kinds of columns, e.g. with a PRIMARY KEY
+	// or a non-constant default, so try it out first.
+	mem, err := newMemorySchema(ctx)
+	if err != nil {
+		return nil, false
+	}
+	defer mem.Close()
+
+	if _, err := mem.conn.ExecContext(ctx, oldSQL); err != nil {
+		return nil, false
+	}
+	for _, def := range added {
+		_, err := mem.conn.ExecContext(ctx, fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s", quoteIdent(table), def,
+		))
+		if err != nil {
+			return nil, false
+		}
+	}
+
+	return added, true
+}
+
+// createTableColumns returns the columns a CREATE TABLE statement defines.
+func createTableColumns(ctx context.Context, table,
+	create string) ([]string, error) {
+
+	mem, err := newMemorySchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+
+	if _, err := mem.conn.ExecContext(ctx, create); err != nil {
+		return nil, err
+	}
+	return tableColumns(ctx, mem.conn, table)
+}
+
+// rebuildTable returns the statements that recreate a table with a new
+// definition, keeping the data of the columns both versions have. This is
+// the procedure the SQLite documentation recommends for changes ALTER TABLE
+// can't make.
+func rebuildTable(ctx context.Context, table, oldSQL,
+	newSQL string) ([]string, error) {
+
+	defs, tail, ok := tableDefinition(newSQL)
+	if !ok {
+		return nil, fmt.Errorf("can't parse the definition of %s", table)
+	}
+
+	oldCols, err := createTableColumns(ctx, table, oldSQL)
+	if err != nil {
+		return nil, err
+	}
+	newCols, err := createTableColumns(ctx, table, newSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := make(map[string]bool, len(newCols))
+	for _, col := range newCols {
+		keep[strings.ToLower(col)] = true
+	}
+	var common []string
+	for _, col := range oldCols {
+		if keep[strings.ToLower(col)] {
+			common = append(common, quoteIdent(col))
+		}
+	}
+
+	tmp := quoteIdent(table + "_new")
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE %s (\n  %s\n)%s", tmp,
+			strings.Join(defs, ",\n  "), tail),
+	}
+	if len(common) > 0 {
+		cols := strings.Join(common, ", ")
+		stmts = append(stmts, fmt.Sprintf(
+			"INSERT INTO %s (%s) SELECT %s FROM %s", tmp, cols, cols,
+			quoteIdent(table),
+		))
+	}
+	stmts = append(stmts,
+		fmt.Sprintf("DROP TABLE %s", quoteIdent(table)),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", tmp, quoteIdent(table)),
+	)
+
+	return stmts, nil
+}
+
+func isVirtualTable(o *schemaObject) bool {
+	return strings.HasPrefix(strings.ToUpper(normalizeSQL(o.sql)),
+		"CREATE VIRTUAL TABLE")
+}
+
+// migrationScript returns the DDL that turns a database with the old schema
+// into one with the new schema. Dropping and rebuilding tables runs with
+// foreign key enforcement off, which is then set back the way the session
+// has it.
+func migrationScript(ctx context.Context, oldObjs,
+	newObjs []schemaObject) (string, error) {
+
+	changes := diffSchemas(oldObjs, newObjs)
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	var b strings.Builder
+	stmt := func(s string) {
+		fmt.Fprintf(&b, "%s;\n", s)
+	}
+
+	// blank separates a block of statements with a single empty line.
+	blank := func() {
+		if !strings.HasSuffix(b.String(), "\n\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	// Dropping a table deletes its rows first, which enforced foreign
+	// keys may refuse, so that is done with them off.
+	fkOff := false
+
+	b.WriteString("BEGIN;\n\n")
+
+	// Indexes, views and triggers that go away or change are dropped
+	// first, so they don't get in the way of the table changes.
+	for _, c := range changes {
+		if c.old != nil && c.old.typ != "table" {
+			stmt(fmt.Sprintf("DROP %s IF EXISTS %s",
+				strings.ToUpper(c.old.typ), quoteIdent(c.old.name)))
+		}
+	}
+
+	// Rebuilding a table drops its indexes and triggers, which then
+	// have to be created again even if they didn't change.
+	rebuilt := make(map[string]bool)
+	for _, c := range changes {
+		switch {
+		case c.new != nil && c.new.typ != "table",
+			c.old != nil && c.old.typ != "table":
+			continue
+
+		case c.old == nil:
+			stmt(c.new.sql)
+
+		case c.new == nil:
+			stmt(fmt.Sprintf("DROP TABLE %s", quoteIdent(c.old.name)))
+			fkOff = true
+
+		case isVirtualTable(c.old) || isVirtualTable(c.new):
+			b.WriteString("-- Recreating a virtual table loses its " +
+				"data.\n")
+			stmt(fmt.Sprintf("DROP TABLE %s", quoteIdent(c.old.name)))
+			stmt(c.new.sql)
+			fkOff = true
+
+		default:
+			if cols, ok := addedColumns(ctx, c.new.name, c.old.sql,
+				c.new.sql); ok {
+
+				for _, col := range cols {
+					stmt(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s",
+						quoteIdent(c.new.name), col))
+				}
+				continue
+			}
+
+			stmts, err := rebuildTable(ctx, c.new.name, c.old.sql,
+				c.new.sql)
+			if err != nil {
+				return "", err
+			}
+			blank()
+			fmt.Fprintf(&b, "-- Rebuild %s, which ALTER TABLE can't "+
+				"change in place.\n", c.new.name)
+			for _, s := range stmts {
+				stmt(s)
+			}
+			blank()
+			rebuilt[strings.ToLower(c.new.name)] = true
+			fkOff = true
+		}
+	}
+
+	changed := make(map[*schemaObject]bool)
+	for _, c := range changes {
+		if c.new != nil {
+			changed[c.new] = true
+		}
+	}
+	for i := range newObjs {
+		o := &newObjs[i]
+		if o.typ == "table" {
+			continue
+		}
+		if changed[o] || (o.typ != "view" &&
+			rebuilt[strings.ToLower(o.tblName)]) {
+
+			stmt(o.sql)
+		}
+	}
+
+	blank()
+	if fkOff {
+		b.WriteString("PRAGMA foreign_key_check;\n")
+	}
+	b.WriteString("COMMIT;\n")
+
+	// PRAGMA foreign_keys has no effect inside a transaction.
+	script := b.String()
+	if fkOff {
+		script = "PRAGMA foreign_keys = OFF;\n" + script
+		if fkEnabled {
+			script += "PRAGMA foreign_keys = ON;\n"
+		}
+	}
+	return script, nil
+}
+
+// handleSchemaSnapshotCommand implements \schema snapshot, \schema diff and
+// \schema export. The diff is the DDL from the snapshot to the live schema,
+// or back with --reverse, written to a file if one is given. The export is
+// the schema as JSON.
+func handleSchemaSnapshotCommand(args []string) error {
+	ctx := context.Background()
+
+	switch {
+	case len(args) == 2 && args[0] == "snapshot":
+		n, err := writeSchemaSnapshot(ctx, args[1])
+		if err != nil {
+			fmt.Printf("Snapshot error: %v\n", err)
+			return err
+		}
+		fmt.Printf("Wrote %d schema objects to %s\n", n, args[1])
+
+	case len(args) <= 2 && args[0] == "export":
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		if err := writeSchemaJSON(ctx, "", path); err != nil {
+			fmt.Printf("Export error: %v\n", err)
+			return err
+		}
+		if path != "" {
+			fmt.Printf("Wrote schema to %s\n", path)
+		}
+
+	case len(args) >= 2 && args[0] == "diff":
+		args = args[1:]
+		reverse := args[0] == "--reverse"
+		if reverse {
+			args = args[1:]
+		}
+		if len(args) == 0 || len(args) > 2 {
+			fmt.Println("Usage: \\schema diff [--reverse] <snapshot> " +
+				"[output.sql]")
+			return errUsage
+		}
+
+		snapshot, err := readSchemaSnapshot(ctx, args[0])
+		if err != nil {
+			fmt.Printf("Snapshot error: %v\n", err)
+			return err
+		}
+		live, err := userSchemaObjects(ctx, conn)
+		if err != nil {
+			fmt.Printf("Schema error: %v\n", err)
+			return err
+		}
+
+		from, to := snapshot, live
+		if reverse {
+			from, to = live, snapshot
+		}
+		script, err := migrationScript(ctx, from, to)
+		if err != nil {
+			fmt.Printf("Diff error: %v\n", err)
+			return err
+		}
+
+		switch {
+		case script == "":
+			fmt.Println("Schemas are identical.")
+
+		case len(args) == 2:
+			if err := os.WriteFile(args[1], []byte(script), 0o644); err != nil {
+				fmt.Printf("Diff error: %v\n", err)
+				return err
+			}
+			fmt.Printf("Wrote migration to %s\n", args[1])
+
+		default:
+			fmt.Print(script)
+		}
+
+	default:
+		fmt.Println("Usage: \\schema snapshot <file>")
+		fmt.Println("       \\schema diff [--reverse] <snapshot> " +
+			"[output.sql]")
+		fmt.Println("       \\schema export [file.json]")
+		return errUsage
+	}
+	return nil
+}
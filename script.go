@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// echoQueries prints each statement of a script before its results.
+	echoQueries bool
+
+	// echoErrors prints the statements of a script that failed.
+	echoErrors bool
+)
+
+var (
+	createTriggerRe = regexp.MustCompile(
+		`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TRIGGER\b`,
+	)
+	triggerEndRe = regexp.MustCompile(`(?i)\bEND\s*$`)
+)
+
+// statementScanner splits a script into SQL statements and meta-commands.
+// Statements end with a semicolon outside of quotes, comments and trigger
+// bodies. Meta-commands start with a backslash and end at the line end.
+type statementScanner struct {
+	r    *bufio.Reader
+	stmt strings.Builder
+}
+
+func newStatementScanner(r io.Reader) *statementScanner {
+	return &statementScanner{r: bufio.NewReader(r)}
+}
+
+// readUntil copies input up to and including the terminator.
+func (s *statementScanner) readUntil(term string, keep bool) error {
+	var tail []rune
+	for {
+		r, _, err := s.r.ReadRune()
+		if err != nil {
+			return err
+		}
+		if keep {
+			s.stmt.WriteRune(r)
+		}
+
+		tail = append(tail, r)
+		if len(tail) > len(term) {
+			tail = tail[1:]
+		}
+		if string(tail) == term {
+			return nil
+		}
+	}
+}
+
+// next returns the next statement, or io.EOF when the input is exhausted.
+func (s *statementScanner) next() (string, error) {
+	s.stmt.Reset()
+
+	for {
+		r, _, err := s.r.ReadRune()
+		if errors.Is(err, io.EOF) {
+			if stmt := strings.TrimSpace(s.stmt.String()); stmt != "" {
+				return stmt, nil
+			}
+			return "", io.EOF
+		}
+		if err != nil {
+			return "", err
+		}
+
+		blank := strings.TrimSpace(s.stmt.String()) == ""
+
+		switch {
+		case r == '\\' && blank:
+			line, err := s.r.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return "", err
+			}
+			return strings.TrimSpace(`\` + line), nil
+
+		case r == '\'' || r == '"' || r == '`':
+			s.stmt.WriteRune(r)
+			err = s.readUntil(string(r), true)
+
+		case r == '[':
+			s.stmt.WriteRune(r)
+			err = s.readUntil("]", true)
+
+		case r == '-' || r == '/':
+			next, _, perr := s.r.ReadRune()
+			switch {
+			case perr != nil:
+				s.stmt.WriteRune(r)
+
+			// Comments before a statement are dropped so that
+			// a meta-command can follow them.
+			case r == '-' && next == '-':
+				if !blank {
+					s.stmt.WriteString("--")
+				}
+				err = s.readUntil("\n", !blank)
+
+			case r == '/' && next == '*':
+				if !blank {
+					s.stmt.WriteString("/*")
+				}
+				err = s.readUntil("*/", !blank)
+
+			default:
+				s.stmt.WriteRune(r)
+				s.r.UnreadRune()
+			}
+
+		case r == ';':
+			s.stmt.WriteRune(r)
+			stmt := strings.TrimSpace(s.stmt.String())
+
+			// Trigger bodies contain semicolons, so only END;
+			// finishes a CREATE TRIGGER.
+			body := strings.TrimSuffix(stmt, ";")
+			if createTriggerRe.MatchString(stmt) &&
+				!triggerEndRe.MatchString(body) {
+
+				continue
+			}
+
+			if stmt == ";" {
+				s.stmt.Reset()
+				continue
+			}
+			return stmt, nil
+
+		default:
+			s.stmt.WriteRune(r)
+		}
+
+		// Unterminated quotes and comments run to the end of the
+		// input, which is returned as the last statement.
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+	}
+}
+
+// runScript executes the statements read from r and stops at the first
+// failing one. It returns the exit status.
+func runScript(r io.Reader) int {
+	// Scripts run from the prompt with \i don't stop to ask either.
+	defer func(prompt bool) { atPrompt = prompt }(atPrompt)
+	atPrompt = false
+
+	scanner := newStatementScanner(r)
+	for {
+		stmt, err := scanner.next()
+		if errors.Is(err, io.EOF) {
+			return 0
+		}
+		if err != nil {
+			fmt.Printf("Failed to read script: %v\n", err)
+			return 1
+		}
+
+		if echoQueries {
+			fmt.Println(stmt)
+		}
+
+		executor(stmt)
+
+		if lastError != nil {
+			if echoErrors && !echoQueries {
+				fmt.Printf("STATEMENT: %s\n", stmt)
+			}
+			return 1
+		}
+		if exitRequested {
+			return 0
+		}
+	}
+}
+
+// runScriptFile executes a script file, "-" meaning stdin.
+func runScriptFile(path string) int {
+	if path == "-" {
+		return runScript(os.Stdin)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Failed to open script: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	return runScript(f)
+}
+
+// promptExecutor runs the input of the prompt. Input holding several
+// statements, e.g. picked from the history together, runs them one after
+// the other until one fails.
+func promptExecutor(input string) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	atPrompt = true
+	defer func() { atPrompt = false }()
+
+	var stmts []string
+	scanner := newStatementScanner(strings.NewReader(input))
+	for {
+		stmt, err := scanner.next()
+		if err != nil {
+			break
+		}
+		stmts = append(stmts, stmt)
+	}
+
+	if len(stmts) < 2 {
+		executor(input)
+		return
+	}
+
+	for _, stmt := range stmts {
+		executor(stmt)
+		if lastError != nil || exitRequested {
+			return
+		}
+	}
+}
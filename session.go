@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// changeSession records the changes made on a connection, see
+// changesetDriver.
+type changeSession interface {
+	// changeset returns the changes recorded so far.
+	changeset() ([]byte, error)
+
+	close() error
+}
+
+// changesetConflicts counts the changes of an applied changeset that
+// conflicted with the database, by conflict type.
+type changesetConflicts map[string]int
+
+// runningSession is a session started by \session start.
+type runningSession struct {
+	s       changeSession
+	tables  []string
+	started time.Time
+}
+
+// activeSession is the running session, nil if none.
+var activeSession *runningSession
+
+// sessionDriver returns the driver of the session database if it exposes
+// the session extension.
+func sessionDriver() (changesetDriver, error) {
+	d := driverFor(dbPath)
+	cd, ok := d.(changesetDriver)
+	if !ok {
+		return nil, fmt.Errorf("the %s driver doesn't expose SQLite's "+
+			"session extension, use --driver modernc", d.name())
+	}
+	return cd, nil
+}
+
+// stopSession discards the active session. It must be called before the
+// session connection is closed.
+func stopSession() {
+	if activeSession == nil {
+		return
+	}
+
+	activeSession.s.close()
+	activeSession = nil
+}
+
+func handleSessionStart(tables []string) error {
+	if activeSession != nil {
+		err := errors.New("a session is already running, \\session " +
+			"stop it first")
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	d, err := sessionDriver()
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	s, err := d.startSession(conn, tables)
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	activeSession = &runningSession{
+		s:       s,
+		tables:  tables,
+		started: time.Now(),
+	}
+
+	// Changes to tables without a primary key aren't recorded.
+	for _, t := range tables {
+		pk, err := primaryKeyColumns(context.Background(), conn, t)
+		if err == nil && len(pk) == 0 {
+			fmt.Printf("WARNING: %s has no PRIMARY KEY, its changes "+
+				"are not recorded.\n", t)
+		}
+	}
+
+	fmt.Printf("Recording changes to %s\n", sessionTables(tables))
+	return nil
+}
+
+// sessionTables describes the tables of a session.
+func sessionTables(tables []string) string {
+	if len(tables) == 0 {
+		return "all tables"
+	}
+	return strings.Join(tables, ", ")
+}
+
+func handleSessionChangeset(path string) error {
+	if activeSession == nil {
+		err := errors.New("no session, \\session start one")
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	data, err := activeSession.s.changeset()
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Wrote %d bytes of changes to %s\n", len(data), path)
+	return nil
+}
+
+func handleSessionApply(args []string) error {
+	replace := len(args) > 0 && args[0] == "--replace"
+	if replace {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		fmt.Println("Usage: \\session apply [--replace] <file>")
+		return errUsage
+	}
+
+	d, err := sessionDriver()
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	conflicts, err := d.applyChangeset(conn, data, replace)
+	if err != nil {
+		fmt.Printf("Session error: %v\n", err)
+		return err
+	}
+
+	fmt.Printf("Applied %s\n", args[0])
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	kinds := make([]string, 0, len(conflicts))
+	for kind, n := range conflicts {
+		kinds = append(kinds, fmt.Sprintf("%d %s", n, kind))
+	}
+	sort.Strings(kinds)
+
+	action := "skipped"
+	if replace {
+		action = "skipped, DATA and CONFLICT replaced"
+	}
+	fmt.Printf("Conflicts: %s (%s)\n", strings.Join(kinds, ", "), action)
+	return nil
+}
+
+// handleSessionCommand records changes with SQLite's session extension and
+// replays them, e.g. on another copy of the database.
+func handleSessionCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		if activeSession == nil {
+			fmt.Println("No session is running")
+			return nil
+		}
+		fmt.Printf("Recording changes to %s since %s\n",
+			sessionTables(activeSession.tables),
+			activeSession.started.Format("15:04:05"))
+
+	case args[0] == "start":
+		return handleSessionStart(args[1:])
+
+	case args[0] == "changeset" && len(args) == 2:
+		return handleSessionChangeset(args[1])
+
+	case args[0] == "stop" && len(args) == 1:
+		if activeSession == nil {
+			fmt.Println("No session is running")
+			return nil
+		}
+		stopSession()
+		fmt.Println("Stopped the session")
+
+	case args[0] == "apply":
+		return handleSessionApply(args[1:])
+
+	default:
+		fmt.Println("Usage: \\session start [table ...]")
+		fmt.Println("       \\session changeset <file>")
+		fmt.Println("       \\session stop")
+		fmt.Println("       \\session apply [--replace] <file>")
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSlowLogEntries is the number of entries \slowlog shows.
+const defaultSlowLogEntries = 20
+
+// slowLogEntry is a single line of the JSONL slow query file.
+type slowLogEntry struct {
+	Time       string   `json:"time"`
+	Database   string   `json:"database"`
+	Statement  string   `json:"statement"`
+	DurationMs float64  `json:"duration_ms"`
+	Plan       []string `json:"plan,omitempty"`
+}
+
+// logMinDuration is the threshold above which statements are recorded in
+// the slow query file, negative when slow query capture is off.
+var logMinDuration = time.Duration(-1)
+
+func getSlowLogFilePath() string {
+	return filepath.Join(stateDir(), "slow.jsonl")
+}
+
+// queryPlan returns the lines of EXPLAIN QUERY PLAN for a statement,
+// indented by depth as the sqlite3 shell does.
+func queryPlan(ctx context.Context, query string) ([]string, error) {
+	rows, err := conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		plan  []string
+		depth = make(map[int64]int)
+	)
+	for rows.Next() {
+		var (
+			id, parent, notUsed int64
+			detail              string
+		)
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return nil, err
+		}
+
+		depth[id] = depth[parent] + 1
+		plan = append(plan, strings.Repeat("  ", depth[id]-1)+detail)
+	}
+
+	return plan, rows.Err()
+}
+
+// recordSlowQuery appends the statement to the slow query file if it took
+// longer than the threshold. The plan is looked up afterwards, which only
+// explains the statement and doesn't run it again.
+func recordSlowQuery(query string, elapsed time.Duration) {
+	if logMinDuration < 0 || elapsed < logMinDuration {
+		return
+	}
+
+	entry := slowLogEntry{
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Database:   redactDatabaseName(dbPath),
+		Statement:  query,
+		DurationMs: float64(elapsed.Microseconds()) / 1000,
+	}
+
+	// Scripts of several statements have no single plan.
+	plan, err := queryPlan(context.Background(), query)
+	if err == nil {
+		entry.Plan = plan
+	}
+
+	path := getSlowLogFilePath()
+	err = ensureParentDir(path)
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(
+			path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600,
+		)
+	}
+	if err == nil {
+		err = json.NewEncoder(f).Encode(entry)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to write slow query log: %v\n", err)
+	}
+}
+
+// readSlowLog returns the entries of the slow query file, oldest first.
+// Lines that don't parse are skipped.
+func readSlowLog() ([]slowLogEntry, error) {
+	f, err := os.Open(getSlowLogFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []slowLogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e slowLogEntry
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+func setLogMinDuration(ms int) error {
+	if ms < -1 {
+		return fmt.Errorf("expected a duration of 0 or more " +
+			"milliseconds, or -1 to turn capture off")
+	}
+	logMinDuration = time.Duration(ms) * time.Millisecond
+	return nil
+}
+
+func setLogMinDurationOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected milliseconds or off")
+	}
+	if strings.EqualFold(args[0], "off") {
+		return setLogMinDuration(-1)
+	}
+
+	ms, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("expected milliseconds or off, got %q",
+			args[0])
+	}
+	return setLogMinDuration(ms)
+}
+
+// logMinDurationSetting describes the slow query threshold.
+func logMinDurationSetting() string {
+	if logMinDuration < 0 {
+		return "off"
+	}
+	return strconv.FormatInt(logMinDuration.Milliseconds(), 10)
+}
+
+// handleSlowLogCommand shows the most recent slow queries, the slowest
+// ones with `top`, or empties the file with `clear`.
+func handleSlowLogCommand(args []string) error {
+	usage := "Usage: \\slowlog [top] [N] | \\slowlog clear"
+
+	if len(args) == 1 && args[0] == "clear" {
+		err := os.Remove(getSlowLogFilePath())
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Slow log error: %v\n", err)
+			return err
+		}
+		fmt.Println("Slow query log cleared.")
+		return nil
+	}
+
+	top := len(args) > 0 && args[0] == "top"
+	if top {
+		args = args[1:]
+	}
+	limit := defaultSlowLogEntries
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			fmt.Println(usage)
+			return errUsage
+		}
+		limit = n
+	} else if len(args) > 1 {
+		fmt.Println(usage)
+		return errUsage
+	}
+
+	entries, err := readSlowLog()
+	if err != nil {
+		fmt.Printf("Slow log error: %v\n", err)
+		return err
+	}
+	if len(entries) == 0 {
+		if logMinDuration < 0 {
+			fmt.Println("No slow queries recorded, capture is off " +
+				"(\\set log_min_duration <ms>).")
+		} else {
+			fmt.Println("No slow queries recorded.")
+		}
+		return nil
+	}
+
+	// Most recent or slowest first.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if top {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].DurationMs > entries[j].DurationMs
+		})
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	for i, e := range entries {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		when := e.Time
+		if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+			when = formatTime(t)
+		}
+		fmt.Printf("%s  %.1f ms  %s\n", when, e.DurationMs, e.Database)
+		fmt.Printf("  %s\n", strings.Join(
+			strings.Split(strings.TrimSpace(e.Statement), "\n"), "\n  ",
+		))
+		for _, line := range e.Plan {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// readSnapshot is a read transaction held open by \snapshot begin, so that
+// a series of queries sees one state of the database.
+type readSnapshot struct {
+	started time.Time
+
+	// queryOnly is the query_only setting to restore, the snapshot
+	// turns it on to keep writes from ending it.
+	queryOnly bool
+}
+
+// activeSnapshot is the open snapshot, nil if none.
+var activeSnapshot *readSnapshot
+
+// beginSnapshot opens the read transaction. BEGIN alone defers taking the
+// read lock to the first query, so one is run right away.
+func beginSnapshot(ctx context.Context) error {
+	if isRemoteDatabase(dbPath) {
+		return fmt.Errorf("the %s driver can't hold a transaction open "+
+			"between queries", driverFor(dbPath).name())
+	}
+
+	var queryOnly bool
+	err := conn.QueryRowContext(ctx, "PRAGMA query_only").Scan(&queryOnly)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "BEGIN DEFERRED")
+	if err != nil && strings.Contains(err.Error(), "within a transaction") {
+		return fmt.Errorf("a transaction is open, COMMIT or ROLLBACK " +
+			"it first")
+	}
+	if err != nil {
+		return err
+	}
+	var n int
+	err = conn.QueryRowContext(ctx, "SELECT count(*) FROM sqlite_master").
+		Scan(&n)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "PRAGMA query_only = ON")
+	}
+	if err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+
+	activeSnapshot = &readSnapshot{started: time.Now(), queryOnly: queryOnly}
+	return nil
+}
+
+// endSnapshot releases the read transaction. Ending it with COMMIT or
+// ROLLBACK in between is reported, the queries since then may have seen
+// newer data.
+func endSnapshot(ctx context.Context) error {
+	s := activeSnapshot
+	activeSnapshot = nil
+
+	if !s.queryOnly {
+		conn.ExecContext(ctx, "PRAGMA query_only = OFF")
+	}
+
+	_, err := conn.ExecContext(ctx, "COMMIT")
+	if err != nil && strings.Contains(err.Error(), "no transaction") {
+		return fmt.Errorf("the snapshot's transaction was ended before " +
+			"\\snapshot end, later queries saw the current data")
+	}
+	return err
+}
+
+// releaseSnapshot ends the snapshot before the session database is closed
+// or replaced.
+func releaseSnapshot() {
+	if activeSnapshot != nil {
+		endSnapshot(context.Background())
+	}
+}
+
+// handleSnapshotCommand holds a read transaction open for consistent
+// reporting across queries while other processes write.
+func handleSnapshotCommand(args []string) error {
+	ctx := context.Background()
+
+	switch {
+	case len(args) == 0:
+		if activeSnapshot == nil {
+			fmt.Println("No snapshot is open")
+			return nil
+		}
+		fmt.Printf("Queries see the database as of %s\n",
+			activeSnapshot.started.Format("15:04:05"))
+
+	case len(args) == 1 && args[0] == "begin":
+		if activeSnapshot != nil {
+			err := errors.New("a snapshot is already open, \\snapshot " +
+				"end it first")
+			fmt.Printf("Snapshot error: %v\n", err)
+			return err
+		}
+		if err := beginSnapshot(ctx); err != nil {
+			fmt.Printf("Snapshot error: %v\n", err)
+			return err
+		}
+
+		fmt.Printf("Queries see the database as of %s until "+
+			"\\snapshot end; writes are refused meanwhile.\n",
+			activeSnapshot.started.Format("15:04:05"))
+
+		var journalMode string
+		conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode)
+		if !strings.EqualFold(journalMode, "wal") {
+			fmt.Printf("NOTE: in %s journal mode other processes can't "+
+				"commit while the snapshot is open.\n", journalMode)
+		}
+
+	case len(args) == 1 && args[0] == "end":
+		if activeSnapshot == nil {
+			fmt.Println("No snapshot is open")
+			return nil
+		}
+		started := activeSnapshot.started
+		if err := endSnapshot(ctx); err != nil {
+			fmt.Printf("Snapshot error: %v\n", err)
+			return err
+		}
+		fmt.Printf("Released the snapshot after %s\n",
+			time.Since(started).Round(time.Second))
+
+	default:
+		fmt.Println("Usage: \\snapshot [begin|end]")
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// memBudget bounds the memory the aligned and expanded formats hold a
+// result in while reading it, 0 for no bound. Rows past it are spilled to
+// a temporary file, see rowBuffer and \pset membudget.
+var memBudget int64 = 256 << 20
+
+func memBudgetSetting() string {
+	if memBudget == 0 {
+		return "off"
+	}
+	return formatByteSize(memBudget)
+}
+
+func setMemBudgetOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a size, e.g. 256MB, or off")
+	}
+	if strings.EqualFold(args[0], "off") {
+		memBudget = 0
+		return nil
+	}
+
+	n, err := parseByteSize(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("the size must be positive, or off")
+	}
+	memBudget = n
+	return nil
+}
+
+// rowBuffer holds formatted rows until they are printed. Rows are kept in
+// memory up to memBudget, the ones after are written to a temporary file
+// and read back one at a time when printed. The widths of the columns are
+// tracked as rows are added, so spilled rows needn't be read to lay out the
+// table.
+type rowBuffer struct {
+	mem  [][]string
+	size int64
+	n    int
+
+	// widths are the display widths of the widest line of each column,
+	// headers included.
+	widths []int
+
+	file *os.File
+	w    *bufio.Writer
+	enc  *gob.Encoder
+}
+
+// newRowBuffer returns an empty buffer for rows with the columns.
+func newRowBuffer(cols []string) *rowBuffer {
+	b := &rowBuffer{widths: make([]int, len(cols))}
+	for i, col := range cols {
+		b.widths[i] = displayWidth(col)
+	}
+	return b
+}
+
+// memRows returns a buffer over rows already in memory.
+func memRows(cols []string, rows [][]string) *rowBuffer {
+	b := newRowBuffer(cols)
+	for _, row := range rows {
+		b.track(row)
+	}
+	b.mem, b.n = rows, len(rows)
+	return b
+}
+
+// track widens the columns to fit a row.
+func (b *rowBuffer) track(row []string) {
+	for i, cell := range row {
+		for _, line := range strings.Split(cell, "\n") {
+			b.widths[i] = max(b.widths[i], displayWidth(line))
+		}
+	}
+}
+
+// add appends a row, spilling it to disk once the budget is used up.
+func (b *rowBuffer) add(row []string) error {
+	b.track(row)
+	b.n++
+
+	if b.file == nil {
+		size := int64(24)
+		for _, cell := range row {
+			size += 16 + int64(len(cell))
+		}
+		if memBudget == 0 || b.size+size <= memBudget {
+			b.mem = append(b.mem, row)
+			b.size += size
+			return nil
+		}
+
+		f, err := os.CreateTemp("", "vsqlite-rows-*")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("NOTE: the result is over the memory budget of %s, "+
+			"spilling rows to %s.\n", formatByteSize(memBudget),
+			f.Name())
+		b.file = f
+		b.w = bufio.NewWriter(f)
+		b.enc = gob.NewEncoder(b.w)
+	}
+
+	return b.enc.Encode(row)
+}
+
+// len returns the number of rows.
+func (b *rowBuffer) len() int {
+	return b.n
+}
+
+// spilled reports whether some rows are on disk.
+func (b *rowBuffer) spilled() bool {
+	return b.file != nil
+}
+
+// each calls f with the rows in order until it returns false.
+func (b *rowBuffer) each(f func(i int, row []string) bool) error {
+	for i, row := range b.mem {
+		if !f(i, row) {
+			return nil
+		}
+	}
+	if b.file == nil {
+		return nil
+	}
+
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(bufio.NewReader(b.file))
+	for i := len(b.mem); i < b.n; i++ {
+		var row []string
+		if err := dec.Decode(&row); err != nil {
+			return err
+		}
+		if !f(i, row) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// close removes the spill file.
+func (b *rowBuffer) close() {
+	if b.file != nil {
+		b.file.Close()
+		os.Remove(b.file.Name())
+		b.file = nil
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	// spinnerDelay is how long an operation may run before we start
+	// showing a spinner, so that fast operations stay quiet.
+	spinnerDelay = 300 * time.Millisecond
+
+	spinnerInterval = 100 * time.Millisecond
+)
+
+var spinnerFrames = []rune{'⠋', '⠙', '⠹', '⠸', '⠼', '⠴', '⠦', '⠧', '⠇', '⠏'}
+
+// startSpinner shows an animated spinner with the given message on stderr
+// once the operation has been running for spinnerDelay. The returned
+// function stops the spinner and clears its line. Nothing is shown when
+// stderr isn't a terminal, so that logs don't fill up with frames.
+func startSpinner(msg string) func() {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	start := time.Now()
+
+	go func() {
+		defer close(stopped)
+
+		select {
+		case <-done:
+			return
+		case <-time.After(spinnerDelay):
+		}
+
+		ticker := time.NewTicker(spinnerInterval)
+		defer ticker.Stop()
+
+		for i := 0; ; i++ {
+			frame := spinnerFrames[i%len(spinnerFrames)]
+			elapsed := time.Since(start).Truncate(time.Second)
+			fmt.Fprintf(os.Stderr, "\r%c %s (%s)", frame, msg, elapsed)
+
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
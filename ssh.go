@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// sshSnapshotScript runs on the remote host with the database path in $1.
+// VACUUM INTO makes a consistent copy even while the database is being
+// written to. Without the sqlite3 shell the file is copied as is, which
+// misses changes still in the WAL and may catch a write half done.
+const sshSnapshotScript = `set -e
+if [ ! -f "$1" ]; then
+	echo "vsqlite: $1: no such file" >&2
+	exit 1
+fi
+if command -v sqlite3 >/dev/null 2>&1; then
+	tmp=$(mktemp)
+	rm -f "$tmp"
+	trap 'rm -f "$tmp"' EXIT
+	sqlite3 "$1" "VACUUM INTO '$tmp'" >&2
+	cat "$tmp"
+else
+	echo "vsqlite: sqlite3 not found on the remote host," \
+		"copying the file as is" >&2
+	cat "$1"
+fi`
+
+// sshSnapshots maps the ssh:// databases fetched in this session to their
+// local copies, so reopening one doesn't fetch it again.
+var sshSnapshots = make(map[string]string)
+
+// isSSHDatabase reports whether the database name refers to a file on
+// another host, e.g. ssh://user@host/var/lib/app.db.
+func isSSHDatabase(name string) bool {
+	return strings.HasPrefix(name, "ssh://")
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sshCommand returns the ssh invocation that writes a snapshot of the
+// database named by the ssh:// URL to stdout.
+func sshCommand(name string) (*exec.Cmd, error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if u.Hostname() == "" || u.Path == "" || u.Path == "/" {
+		return nil, fmt.Errorf("expected ssh://[user@]host[:port]/path, "+
+			"got %q", name)
+	}
+
+	// ssh://host/~/app.db is relative to the remote home directory.
+	path := shellQuote(u.Path)
+	if strings.HasPrefix(u.Path, "/~/") {
+		path = `"$HOME"/` + shellQuote(strings.TrimPrefix(u.Path, "/~/"))
+	}
+
+	args := []string{"-C"}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	host := u.Hostname()
+	if u.User != nil {
+		host = u.User.Username() + "@" + host
+	}
+
+	// The remote login shell may not be POSIX, so the script is handed
+	// to sh explicitly.
+	remote := "sh -c " + shellQuote(sshSnapshotScript) + " vsqlite " + path
+	args = append(args, "--", host, remote)
+
+	return exec.Command("ssh", args...), nil
+}
+
+// fetchSSHSnapshot copies a consistent snapshot of the remote database to a
+// local temporary file and returns its path.
+func fetchSSHSnapshot(name string) (string, error) {
+	if path, ok := sshSnapshots[name]; ok {
+		return path, nil
+	}
+
+	cmd, err := sshCommand(name)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp("", "vsqlite-ssh-*.db")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if !quietMode {
+		fmt.Printf("Fetching a snapshot of %s...\n", name)
+	}
+
+	// Leave stdin and stderr to ssh for password prompts and errors.
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = f
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("ssh: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if info.Size() == 0 {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("ssh: empty snapshot of %s", name)
+	}
+
+	if !quietMode {
+		fmt.Printf("Fetched %d bytes, changes made in this session "+
+			"stay local.\n", info.Size())
+	}
+
+	sshSnapshots[name] = f.Name()
+	return f.Name(), nil
+}
+
+// removeSSHSnapshots deletes the local copies of remote databases.
+func removeSSHSnapshots() {
+	for name, path := range sshSnapshots {
+		os.Remove(path)
+		delete(sshSnapshots, name)
+	}
+}
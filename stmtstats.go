@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// stmtStats are the status counters SQLite keeps for a statement.
+type stmtStats struct {
+	// fullScanSteps counts the steps through tables and indexes without
+	// a usable index constraint.
+	fullScanSteps int64
+
+	// sorts counts the sort operations, e.g. for ORDER BY without a
+	// suitable index.
+	sorts int64
+
+	// autoIndexes counts the rows inserted into transient indexes
+	// SQLite built because no permanent one fit a join.
+	autoIndexes int64
+
+	// vmSteps counts the virtual machine operations, a measure of the
+	// total work done.
+	vmSteps int64
+}
+
+func (s *stmtStats) add(o stmtStats) {
+	s.fullScanSteps += o.fullScanSteps
+	s.sorts += o.sorts
+	s.autoIndexes += o.autoIndexes
+	s.vmSteps += o.vmSteps
+}
+
+var (
+	// timingEnabled is toggled with \timing.
+	timingEnabled bool
+
+	// statsMu guards the statement counters, which drivers report from
+	// wherever a statement finishes.
+	statsMu sync.Mutex
+
+	// statsQueries are the input whose statements are being counted and
+	// the statements vsqlite rewrote it into, empty when nothing is.
+	statsQueries []string
+
+	// statsTotal adds up the counters of the statements of statsQueries,
+	// statsSeen tells whether any were reported.
+	statsTotal stmtStats
+	statsSeen  bool
+)
+
+// recordStmtStats is called by drivers that can read the status counters
+// when a statement finishes. Only the statements of the input being timed
+// count, not the lookups vsqlite runs around it.
+func recordStmtStats(sqlText string, s stmtStats) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	sqlText = strings.TrimSpace(sqlText)
+	if sqlText == "" {
+		return
+	}
+	for _, query := range statsQueries {
+		if strings.Contains(query, sqlText) {
+			statsTotal.add(s)
+			statsSeen = true
+			return
+		}
+	}
+}
+
+// beginStmtStats starts counting the statements of the input.
+func beginStmtStats(query string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	statsQueries, statsTotal, statsSeen = []string{query}, stmtStats{},
+		false
+}
+
+// countStmtStats counts the statements of query too, while the input is
+// being counted. It is for the statements the input is rewritten into.
+func countStmtStats(query string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	if statsQueries != nil {
+		statsQueries = append(statsQueries, query)
+	}
+}
+
+// endStmtStats stops counting and returns the totals, or false if the
+// driver reported none.
+func endStmtStats() (stmtStats, bool) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+
+	statsQueries = nil
+	return statsTotal, statsSeen
+}
+
+// colorize wraps text in an SGR sequence when stdout is a terminal.
+func colorize(text, sgr string) string {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return text
+	}
+	return "\033[" + sgr + "m" + text + "\033[0m"
+}
+
+// printTiming prints how long the input took and, if the driver reports
+// them, its statement counters. Full scans are flagged in red and
+// automatic indexes in yellow, both hint at a missing index.
+func printTiming(elapsed time.Duration, stats stmtStats, ok bool) {
+	fmt.Printf("Time: %.3f ms\n", float64(elapsed.Microseconds())/1000)
+	if !ok {
+		return
+	}
+
+	scans := fmt.Sprintf("full scan steps %d", stats.fullScanSteps)
+	if stats.fullScanSteps > 0 {
+		scans = colorize(scans, "1;31")
+	}
+	autoIndexes := fmt.Sprintf("autoindex rows %d", stats.autoIndexes)
+	if stats.autoIndexes > 0 {
+		autoIndexes = colorize(autoIndexes, "1;33")
+	}
+
+	fmt.Printf("Stats: %s, sorts %d, %s, VM steps %d\n", scans,
+		stats.sorts, autoIndexes, stats.vmSteps)
+}
+
+func handleTimingCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		timingEnabled = !timingEnabled
+
+	case len(args) == 1:
+		on, err := parseOnOff(args)
+		if err != nil {
+			fmt.Println("Usage: \\timing [on|off]")
+			return errUsage
+		}
+		timingEnabled = on
+
+	default:
+		fmt.Println("Usage: \\timing [on|off]")
+		return errUsage
+	}
+
+	fmt.Printf("Timing is %s.\n", onOff(timingEnabled))
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// fuzzyCompletion matches the names to complete by subsequence rather than
+// by prefix, so that pmthash finds payment_hash. See \set completion.
+var fuzzyCompletion bool
+
+func completionSetting() string {
+	if fuzzyCompletion {
+		return "fuzzy"
+	}
+	return "prefix"
+}
+
+func setCompletionOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected prefix or fuzzy")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "prefix":
+		fuzzyCompletion = false
+	case "fuzzy":
+		fuzzyCompletion = true
+	default:
+		return fmt.Errorf("expected prefix or fuzzy, got %q", args[0])
+	}
+	return nil
+}
+
+const (
+	// identPattern matches a complete identifier, quoted or not.
+	identPattern = `(?:"(?:[^"]|"")*"|\w+)`
+
+	// partialIdentPattern captures the identifier being typed: the start
+	// of a quoted one, which may hold spaces, or a word. Dashes are taken
+	// too, for names that need quoting to be typed without the quotes.
+	partialIdentPattern = `("(?:[^"]|"")*|[\w-]*)`
+)
+
+// unquotePartialIdent returns the name an identifier being typed starts
+// with, without its opening quote.
+func unquotePartialIdent(typed string) string {
+	if !strings.HasPrefix(typed, `"`) {
+		return typed
+	}
+	return strings.ReplaceAll(typed[1:], `""`, `"`)
+}
+
+// identMatches reports whether the name matches the identifier being
+// typed, ignoring case as SQLite does, and how well. Names starting with it
+// match best, and in fuzzy mode names holding its letters in order match
+// too, better the more of them start words or follow each other.
+func identMatches(name, typed string) (int, bool) {
+	lower := []rune(strings.ToLower(name))
+	pattern := []rune(strings.ToLower(unquotePartialIdent(typed)))
+
+	if strings.HasPrefix(string(lower), string(pattern)) {
+		return 1000, true
+	}
+	if !fuzzyCompletion {
+		return 0, false
+	}
+
+	runes := []rune(name)
+	score, last := 0, -2
+	i := 0
+	for _, r := range pattern {
+		for i < len(lower) && lower[i] != r {
+			i++
+		}
+		if i == len(lower) {
+			return 0, false
+		}
+
+		switch {
+		case i == last+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(runes[i-1]) ||
+			unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i-1]):
+
+			score += 5
+		default:
+			score++
+		}
+		last = i
+		i++
+	}
+	return score, true
+}
+
+// suggestIdents completes the identifier being typed with the names that
+// match it, quoted if they need to be or if the user started with a quote.
+//
+// A suggestion replaces word, the text before the cursor back to the last
+// space. That is usually typed with a lead like "t." or "(", kept as is. A
+// quoted name with spaces reaches back beyond word, so only the rest of the
+// name is added to it.
+func suggestIdents(names []prompt.Suggest, typed,
+	word string) []prompt.Suggest {
+
+	type match struct {
+		prompt.Suggest
+		score int
+	}
+
+	var matches []match
+	for _, s := range names {
+		score, ok := identMatches(s.Text, typed)
+		if !ok {
+			continue
+		}
+
+		quoted := quoteIdentIfNeeded(s.Text)
+		if strings.HasPrefix(typed, `"`) {
+			quoted = quoteIdent(s.Text)
+		}
+
+		text := strings.TrimSuffix(word, typed) + quoted
+		if !strings.HasSuffix(word, typed) {
+			// Only names that start with what's typed can be added to.
+			if score < 1000 || len(quoted) < len(typed) {
+				continue
+			}
+			text = word + quoted[len(typed):]
+		}
+		matches = append(matches, match{prompt.Suggest{
+			Text: text, Description: s.Description,
+		}, score})
+	}
+
+	// The best matches come first, the shorter names among equally good
+	// ones.
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return fuzzyCompletion &&
+			len(matches[i].Text) < len(matches[j].Text)
+	})
+
+	suggestions := make([]prompt.Suggest, len(matches))
+	for i, m := range matches {
+		suggestions[i] = m.Suggest
+	}
+	return suggestions
+}
+
+// tableAliasRe finds the tables of a statement with their aliases, as in
+// FROM invoices i JOIN payments AS p, or FROM a x, b y.
+var tableAliasRe = regexp.MustCompile(`(?i)(?:\bFROM|\bJOIN|\bUPDATE|` +
+	`\bINTO|,)\s+(` + identPattern + `)(?:\s+(?:AS\s+)?(` +
+	identPattern + `))?`)
+
+// aliasStopWords are the keywords that may follow a table name, and so are
+// not its alias.
+var aliasStopWords = map[string]bool{
+	"WHERE": true, "JOIN": true, "LEFT": true, "RIGHT": true,
+	"FULL": true, "INNER": true, "OUTER": true, "CROSS": true,
+	"NATURAL": true, "ON": true, "USING": true, "GROUP": true,
+	"ORDER": true, "LIMIT": true, "HAVING": true, "WINDOW": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "SET": true,
+	"VALUES": true, "DEFAULT": true, "SELECT": true, "FROM": true,
+	"INDEXED": true, "NOT": true, "RETURNING": true, "WITH": true,
+}
+
+// currentStatement returns the statement of the input the cursor is in.
+func currentStatement(d prompt.Document) string {
+	before, after := d.TextBeforeCursor(), d.TextAfterCursor()
+	if i := strings.LastIndexByte(before, ';'); i >= 0 {
+		before = before[i+1:]
+	}
+	if i := strings.IndexByte(after, ';'); i >= 0 {
+		after = after[:i]
+	}
+	return before + after
+}
+
+// statementTables returns the tables a statement reads or writes, in the
+// order they appear.
+func statementTables(stmt string) []string {
+	var tables []string
+	seen := make(map[string]bool)
+	for _, m := range tableAliasRe.FindAllStringSubmatch(stmt, -1) {
+		name := unquoteName(m[1])
+		if aliasStopWords[strings.ToUpper(m[1])] ||
+			seen[strings.ToLower(name)] {
+
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		tables = append(tables, name)
+	}
+	return tables
+}
+
+// resolveTableAlias returns the table a name stands for in the statement:
+// the aliased table if the name is an alias, else the name itself.
+func resolveTableAlias(stmt, name string) string {
+	for _, m := range tableAliasRe.FindAllStringSubmatch(stmt, -1) {
+		alias := unquoteName(m[2])
+		if alias == "" || aliasStopWords[strings.ToUpper(m[2])] {
+			continue
+		}
+		if strings.EqualFold(alias, name) {
+			return unquoteName(m[1])
+		}
+	}
+	return name
+}
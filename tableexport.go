@@ -0,0 +1,481 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// tableProgress shows on one line of stderr how far reading tables in
+// parallel got: the tables done, the rows read and the tables being read.
+type tableProgress struct {
+	total int
+	done  atomic.Int64
+	rows  atomic.Int64
+
+	mu      sync.Mutex
+	running []string
+}
+
+func (p *tableProgress) start(table string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = append(p.running, table)
+}
+
+func (p *tableProgress) finish(table string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, name := range p.running {
+		if name == table {
+			p.running = append(p.running[:i], p.running[i+1:]...)
+			break
+		}
+	}
+	p.done.Add(1)
+}
+
+// show draws the progress until the returned function is called, which
+// clears the line.
+func (p *tableProgress) show() func() {
+	if quietMode || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	start := time.Now()
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(importProgressInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				fmt.Fprint(os.Stderr, "\r\033[K")
+				return
+			case <-ticker.C:
+			}
+
+			p.mu.Lock()
+			running := strings.Join(p.running, ", ")
+			p.mu.Unlock()
+
+			n := p.rows.Load()
+			rate := float64(n) / time.Since(start).Seconds()
+			line := fmt.Sprintf("%d/%d tables  %d rows  %.0f rows/s  "+
+				"reading %s", p.done.Load(), p.total, n, rate, running)
+			if width := terminalWidth(); displayWidth(line) >= width {
+				line = truncateWidth(line, width-1)
+			}
+			fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// rowCountingWriter counts the rows a dump writes, for the progress.
+// dumpTable writes each row with a single Write.
+type rowCountingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (r rowCountingWriter) Write(p []byte) (int, error) {
+	r.n.Add(1)
+	return r.w.Write(p)
+}
+
+// countingRows counts the rows read through it, for the progress.
+type countingRows struct {
+	resultRows
+	n *atomic.Int64
+}
+
+func (r countingRows) Next() bool {
+	if r.resultRows.Next() {
+		r.n.Add(1)
+		return true
+	}
+	return false
+}
+
+// readTablesParallel runs f for each table, in order as connections free
+// up, on up to jobs connections of db at once. Each connection reads in a
+// transaction of its own, so tables are consistent in themselves but not
+// necessarily with each other while the database is written to. The first
+// error cancels the tables being read and is returned.
+func readTablesParallel(ctx context.Context, db *sql.DB, tables []string,
+	jobs int, p *tableProgress,
+	f func(ctx context.Context, c *sql.Conn, table string) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	queue := make(chan string)
+	for range min(jobs, len(tables)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c, err := db.Conn(ctx)
+			if err != nil {
+				fail(err)
+				return
+			}
+			defer c.Close()
+
+			if _, err := c.ExecContext(ctx, "BEGIN"); err != nil {
+				fail(err)
+				return
+			}
+			defer c.ExecContext(context.Background(), "ROLLBACK")
+
+			for table := range queue {
+				p.start(table)
+				err := f(ctx, c, table)
+				p.finish(table)
+				if err != nil {
+					fail(err)
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, table := range tables {
+		select {
+		case queue <- table:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// dumpedTable is the rows of a table a dump read ahead, or why they
+// couldn't be.
+type dumpedTable struct {
+	f   *os.File
+	err error
+}
+
+// dumpPrefetch reads the rows of the tables of a dump ahead, on several
+// connections at once, into temporary files the dump copies out in order.
+type dumpPrefetch struct {
+	tables map[string]chan dumpedTable
+	cancel context.CancelFunc
+	stop   func()
+
+	// done is closed once every table was read or reading stopped on
+	// err.
+	done chan struct{}
+	err  error
+}
+
+// startDumpPrefetch starts reading the rows of the tables matching where,
+// with the values of a table rewritten by converts[table] if set, see
+// dumpTable. A table is read on one of opts.jobs connections.
+func startDumpPrefetch(ctx context.Context, opts dumpOptions,
+	tables []string,
+	converts map[string]func(col, literal string) string) *dumpPrefetch {
+
+	ctx, cancel := context.WithCancel(ctx)
+	p := &dumpPrefetch{
+		tables: make(map[string]chan dumpedTable, len(tables)),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	for _, table := range tables {
+		p.tables[table] = make(chan dumpedTable, 1)
+	}
+
+	progress := &tableProgress{total: len(tables)}
+	p.stop = progress.show()
+
+	go func() {
+		defer close(p.done)
+
+		p.err = readTablesParallel(ctx, opts.db, tables, opts.jobs,
+			progress, func(ctx context.Context, c *sql.Conn,
+				table string) error {
+
+				f, err := os.CreateTemp("", "vsqlite-dump-*")
+				if err == nil {
+					w := rowCountingWriter{w: f, n: &progress.rows}
+					err = dumpTable(ctx, c, w, table, opts.where,
+						converts[table])
+				}
+				if err != nil {
+					err = fmt.Errorf("%s: %w", table, err)
+				}
+				p.tables[table] <- dumpedTable{f: f, err: err}
+				return err
+			})
+	}()
+
+	return p
+}
+
+// writeRows writes the rows of a table for a dump, read on c, or copied
+// from the prefetch if there is one.
+func (p *dumpPrefetch) writeRows(ctx context.Context, c *sql.Conn,
+	w io.Writer, table, where string,
+	convert func(col, literal string) string) error {
+
+	if p == nil {
+		if err := dumpTable(ctx, c, w, table, where, convert); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+		return nil
+	}
+
+	var d dumpedTable
+	select {
+	case d = <-p.tables[table]:
+	case <-p.done:
+		select {
+		case d = <-p.tables[table]:
+		default:
+			d.err = fmt.Errorf("%s: not read", table)
+		}
+	}
+	if d.f != nil {
+		defer os.Remove(d.f.Name())
+		defer d.f.Close()
+	}
+
+	// A table canceled by another's error reports the other's.
+	if errors.Is(d.err, context.Canceled) {
+		<-p.done
+		if p.err != nil {
+			return p.err
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	if _, err := d.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, d.f)
+	return err
+}
+
+// close stops reading and removes the files not copied out.
+func (p *dumpPrefetch) close() {
+	if p == nil {
+		return
+	}
+
+	p.cancel()
+	<-p.done
+	p.stop()
+	for _, ch := range p.tables {
+		select {
+		case d := <-ch:
+			if d.f != nil {
+				d.f.Close()
+				os.Remove(d.f.Name())
+			}
+		default:
+		}
+	}
+}
+
+// defaultJobs is how many tables the export command reads at once unless
+// told otherwise.
+func defaultJobs() int {
+	return min(runtime.NumCPU(), 4)
+}
+
+// exportTable writes the rows of a table to a file of dir in the format,
+// compressed if asked for, and returns the files written, more than one if
+// opts splits them.
+func exportTable(ctx context.Context, c *sql.Conn, dir, format,
+	table string, opts exportOptions,
+	rowsRead *atomic.Int64) ([]exportedFile, error) {
+
+	query := "SELECT * FROM " + quoteIdent(table)
+	rows, err := c.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The rows go straight to the file, there's no point in caching them.
+	live := newLiveRows(rows, query)
+	live.set = nil
+
+	masked, err := maskResult(live, query)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, table+"."+format)
+	return exportRows(format, path,
+		countingRows{resultRows: masked, n: rowsRead}, query, opts)
+}
+
+// exportFlags are the options of the export subcommand.
+var exportFlags struct {
+	format   string
+	dir      string
+	jobs     int
+	compress string
+	noMask   bool
+	patterns []string
+}
+
+// defineExportFlags defines the options of the export subcommand.
+func defineExportFlags(fs *flag.FlagSet) {
+	fs.StringVar(&exportFlags.format, "format", "csv", "the file format, "+
+		strings.ReplaceAll(exportFormats(), "|", ", "))
+	fs.StringVar(&exportFlags.dir, "o", ".", "write the files to this "+
+		"directory")
+	fs.IntVar(&exportFlags.jobs, "jobs", defaultJobs(), "read this many "+
+		"tables at once")
+	fs.StringVar(&exportFlags.compress, "compress", "", "compress the "+
+		"files with gzip or zstd")
+	fs.BoolVar(&exportFlags.noMask, "no-mask", false, "don't apply the "+
+		"masking rules from the config file")
+	fs.Var((*stringList)(&exportFlags.patterns), "table", "export only "+
+		"the tables matching this pattern, e.g. 'log_*', may be repeated")
+}
+
+// runExportCommand writes every table, or the ones matching -table, to a
+// file of its own, reading several tables at once.
+func runExportCommand(args []string) int {
+	fs := newSubcommandFlags("export")
+	fs.Parse(args)
+	format, dir := exportFlags.format, exportFlags.dir
+	jobs, compress := exportFlags.jobs, exportFlags.compress
+	patterns := exportFlags.patterns
+
+	maskingEnabled = !exportFlags.noMask
+
+	if fs.NArg() != 1 || jobs < 1 {
+		fs.Usage()
+		return 1
+	}
+	if _, ok := exporters[format]; !ok {
+		fmt.Fprintf(os.Stderr, "Export error: unknown format %q, "+
+			"expected %s\n", format, exportFormats())
+		return 1
+	}
+	if _, ok := exportCompressions[compress]; compress != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Export error: invalid -compress %q, "+
+			"expected gzip or zstd\n", compress)
+		return 1
+	}
+	if format == "xlsx" && compress != "" {
+		fmt.Fprintln(os.Stderr, "Export error: xlsx files are "+
+			"compressed already")
+		return 1
+	}
+
+	// Every connection to a private database sees a different one.
+	if hasPrivateDatabase(fs.Arg(0)) {
+		jobs = 1
+	}
+	ctx := context.Background()
+	srcDB, err := openDatabase(fs.Arg(0), true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export error: %v\n", err)
+		return 1
+	}
+	defer srcDB.Close()
+
+	c, err := srcDB.Conn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export error: %v\n", err)
+		return 1
+	}
+	objs, err := readSchemaObjects(ctx, c)
+	c.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export error: %v\n", err)
+		return 1
+	}
+
+	opts := dumpOptions{tables: patterns}
+	var tables []string
+	for _, o := range objs {
+		if o.typ == "table" && !isShadowTable(o.name, objs) &&
+			opts.includes(o.name) {
+
+			tables = append(tables, o.name)
+		}
+	}
+	if len(tables) == 0 {
+		fmt.Fprintln(os.Stderr, "Export error: no tables to export")
+		return 1
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Export error: %v\n", err)
+		return 1
+	}
+
+	start := time.Now()
+	progress := &tableProgress{total: len(tables)}
+	stop := progress.show()
+	err = readTablesParallel(ctx, srcDB, tables, jobs, progress,
+		func(ctx context.Context, c *sql.Conn, table string) error {
+			_, err := exportTable(ctx, c, dir, format, table,
+				exportOptions{compression: compress}, &progress.rows)
+			if err != nil {
+				return fmt.Errorf("%s: %w", table, err)
+			}
+			return nil
+		})
+	stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Export error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Exported %d rows from %d tables to %s in %s\n",
+		progress.rows.Load(), len(tables), dir,
+		time.Since(start).Truncate(time.Millisecond))
+	return 0
+}
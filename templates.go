@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+	"golang.org/x/term"
+)
+
+// queryTemplate is a canned query run with \template. Placeholders follow
+// psql's variable syntax: :name is replaced by the value as is, :'name' by
+// the value as a string literal and :"name" by the value as an identifier.
+type queryTemplate struct {
+	desc string
+	sql  string
+}
+
+// templatePlaceholderRe matches the placeholders of a template.
+var templatePlaceholderRe = regexp.MustCompile(
+	`:(?:'([A-Za-z_]\w*)'|"([A-Za-z_]\w*)"|([A-Za-z_]\w*))`,
+)
+
+// builtinTemplates ship with vsqlite. User templates from the config file
+// are added to these and may replace them.
+var builtinTemplates = map[string]queryTemplate{
+	"biggest_tables": {
+		desc: "tables and indexes by size on disk",
+		sql: `SELECT name, count(*) AS pages, sum(pgsize) AS bytes
+FROM dbstat
+GROUP BY name
+ORDER BY bytes DESC
+LIMIT 20`,
+	},
+	"indexes": {
+		desc: "indexes with their columns",
+		sql: `SELECT m.tbl_name AS "table", il.name AS "index",
+       il."unique", il.origin, il.partial,
+       group_concat(ii.name, ', ') AS columns
+FROM sqlite_master m
+JOIN pragma_index_list(m.name) il
+JOIN pragma_index_info(il.name) ii
+WHERE m.type = 'table'
+GROUP BY m.tbl_name, il.name
+ORDER BY m.tbl_name, il.name`,
+	},
+	"unindexed_fks": {
+		desc: "foreign keys without an index on the child column",
+		sql: `SELECT m.name AS "table", fk."from" AS "column",
+       fk."table" AS parent
+FROM sqlite_master m
+JOIN pragma_foreign_key_list(m.name) fk
+WHERE m.type = 'table'
+  AND NOT EXISTS (
+      SELECT 1
+      FROM pragma_index_list(m.name) il
+      JOIN pragma_index_info(il.name) ii
+      WHERE ii.seqno = 0 AND ii.name = fk."from"
+  )
+ORDER BY m.name`,
+	},
+	"columns": {
+		desc: "all columns of all tables",
+		sql: `SELECT m.name AS "table", c.name AS "column", c.type,
+       c."notnull", c.dflt_value AS "default", c.pk
+FROM sqlite_master m
+JOIN pragma_table_info(m.name) c
+WHERE m.type = 'table' AND m.name NOT LIKE 'sqlite_%'
+ORDER BY m.name, c.cid`,
+	},
+	"rows_per_day": {
+		desc: "row counts per day of a date column",
+		sql: `SELECT date(:"datecol") AS day, count(*) AS "rows"
+FROM :"table"
+GROUP BY day
+ORDER BY day`,
+	},
+	"null_ratio": {
+		desc: "share of NULLs in a column",
+		sql: `SELECT count(*) AS "rows",
+       count(*) - count(:"column") AS nulls,
+       round(100.0 * (count(*) - count(:"column")) /
+             max(count(*), 1), 2) AS percent
+FROM :"table"`,
+	},
+	"top_values": {
+		desc: "most frequent values of a column",
+		sql: `SELECT :"column", count(*) AS "count"
+FROM :"table"
+GROUP BY :"column"
+ORDER BY "count" DESC
+LIMIT 20`,
+	},
+}
+
+// templates are the templates available to \template.
+var templates = builtinTemplates
+
+// setTemplates adds the templates from the config file.
+func setTemplates(user map[string]string) {
+	if len(user) == 0 {
+		return
+	}
+
+	templates = make(map[string]queryTemplate, len(builtinTemplates))
+	for name, t := range builtinTemplates {
+		templates[name] = t
+	}
+	for name, sql := range user {
+		templates[name] = queryTemplate{desc: "from config", sql: sql}
+	}
+}
+
+// templatePlaceholders returns the names used in a template in order of
+// first appearance.
+func templatePlaceholders(sql string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range templatePlaceholderRe.FindAllStringSubmatch(sql, -1) {
+		name := m[1] + m[2] + m[3]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// expandTemplate replaces the placeholders of a template with the values.
+func expandTemplate(sql string, values map[string]string) string {
+	return templatePlaceholderRe.ReplaceAllStringFunc(sql, func(p string) string {
+		m := templatePlaceholderRe.FindStringSubmatch(p)
+		switch {
+		case m[1] != "":
+			return quoteString(values[m[1]])
+		case m[2] != "":
+			return quoteIdent(values[m[2]])
+		default:
+			return values[m[3]]
+		}
+	})
+}
+
+// promptPlaceholder asks for the value of a placeholder, completing table
+// names for placeholders that look like they want one.
+func promptPlaceholder(name string) string {
+	complete := func(d prompt.Document) []prompt.Suggest {
+		return nil
+	}
+	if strings.Contains(name, "table") {
+		complete = func(d prompt.Document) []prompt.Suggest {
+			return prompt.FilterHasPrefix(getTableSuggestions(),
+				d.GetWordBeforeCursor(), true)
+		}
+	}
+
+	return strings.TrimSpace(prompt.Input(name+": ", complete))
+}
+
+func printTemplates() {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t := templates[name]
+		desc := t.desc
+		if params := templatePlaceholders(t.sql); len(params) > 0 {
+			desc += " (" + strings.Join(params, ", ") + ")"
+		}
+		fmt.Printf("  %s %s\n", padRight(name, 16), desc)
+	}
+}
+
+// handleTemplateCommand runs a template, taking placeholder values as
+// name=value arguments and prompting for the missing ones.
+func handleTemplateCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: \\template <name> [placeholder=value ...]")
+		printTemplates()
+		return nil
+	}
+
+	t, ok := templates[args[0]]
+	if !ok {
+		fmt.Printf("No template named %q, available templates:\n",
+			args[0])
+		printTemplates()
+		return nil
+	}
+
+	values := make(map[string]string)
+	for _, arg := range args[1:] {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fmt.Printf("Invalid argument %q, expected "+
+				"placeholder=value\n", arg)
+			return fmt.Errorf("invalid argument %q", arg)
+		}
+		values[name] = value
+	}
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	for _, name := range templatePlaceholders(t.sql) {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if !interactive {
+			fmt.Printf("Missing value for %s, pass it as %s=value\n",
+				name, name)
+			return nil
+		}
+		if values[name] = promptPlaceholder(name); values[name] == "" {
+			fmt.Println("Cancelled.")
+			return nil
+		}
+	}
+
+	query := expandTemplate(t.sql, values)
+	if !quietMode {
+		fmt.Println(query)
+	}
+
+	// Run it like a typed statement, which also puts it in the history
+	// for editing.
+	executor(query)
+	return lastError
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// enableInterruptKey can't change the terminal on this platform.
+func enableInterruptKey() func() {
+	return func() {}
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// enableInterruptKey makes ^C raise SIGINT while the prompt is away. The
+// prompt keeps the terminal in raw mode even while a statement runs, which
+// turns ^C into input nobody reads. The returned function restores the
+// terminal.
+func enableInterruptKey() func() {
+	fd := int(os.Stdin.Fd())
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil || old.Lflag&unix.ISIG != 0 {
+		return func() {}
+	}
+
+	t := *old
+	t.Lflag |= unix.ISIG
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &t); err != nil {
+		return func() {}
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, ioctlSetTermios, old)
+	}
+}
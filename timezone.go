@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// displayZone is the time zone datetime values are shown in. When nil,
+// times are shown in whatever zone the driver returned and timestamp text
+// is left alone.
+var displayZone *time.Location
+
+func setTimezoneOption(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected a single time zone")
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "default":
+		displayZone = nil
+
+	case "local":
+		displayZone = time.Local
+
+	case "utc":
+		displayZone = time.UTC
+
+	default:
+		loc, err := time.LoadLocation(args[0])
+		if err != nil {
+			return err
+		}
+		displayZone = loc
+	}
+
+	return nil
+}
+
+// formatTime renders a time for display, converted to the display zone if
+// one is set, and always with its zone so values can't be misread.
+func formatTime(t time.Time) string {
+	if displayZone != nil {
+		t = t.In(displayZone)
+	}
+
+	return formatTimePadded(t) + " " + t.Format("MST")
+}
+
+// formatTimestampText converts text holding an SQLite datetime to the
+// display zone. Text without a zone is taken to be UTC, as produced by
+// SQLite's own date and time functions. Plain dates are left alone.
+func formatTimestampText(s string) (string, bool) {
+	if displayZone == nil || len(s) <= len("2006-01-02") {
+		return "", false
+	}
+
+	t, ok := parseTimestampText(s)
+	if !ok {
+		return "", false
+	}
+
+	return formatTime(t), true
+}
+
+func handleSetCommand(args []string) error {
+	return handleOptionCommand("set", setOptions, args)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// disabledTrigger is a trigger dropped by \trigger disable, kept to be
+// created again.
+type disabledTrigger struct {
+	name     string
+	table    string
+	sql      string
+	disabled time.Time
+}
+
+// disabledTriggers are the triggers of the session database disabled by
+// \trigger disable, in the order they were disabled. SQLite can't switch a
+// trigger off, so they are dropped meanwhile.
+var disabledTriggers []disabledTrigger
+
+// disabledTriggersTable keeps the definitions of the disabled triggers in
+// the database, written together with the drops, so that triggers a session
+// didn't get to restore, e.g. since it was killed, are restored by the next
+// one.
+const disabledTriggersTable = `CREATE TABLE IF NOT EXISTS
+vsqlite_disabled_triggers (
+  name TEXT PRIMARY KEY,
+  tbl_name TEXT NOT NULL,
+  sql TEXT NOT NULL,
+  disabled TEXT NOT NULL
+)`
+
+// findDisabledTrigger returns the index of a disabled trigger, or -1.
+func findDisabledTrigger(name string) int {
+	for i, t := range disabledTriggers {
+		if strings.EqualFold(t.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// inSavepoint runs f in a savepoint, which nests in a transaction the user
+// began, and rolls everything f did back if it fails.
+func inSavepoint(ctx context.Context, f func() error) error {
+	_, err := conn.ExecContext(ctx, "SAVEPOINT vsqlite")
+	if err != nil {
+		return err
+	}
+
+	if err := f(); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK TO vsqlite")
+		conn.ExecContext(ctx, "RELEASE vsqlite")
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "RELEASE vsqlite")
+	return err
+}
+
+// disableTriggers saves and drops the triggers, all or none of them.
+func disableTriggers(ctx context.Context, names []string) ([]disabledTrigger,
+	error) {
+
+	var saved []disabledTrigger
+	err := inSavepoint(ctx, func() error {
+		_, err := conn.ExecContext(ctx, disabledTriggersTable)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range names {
+			t := disabledTrigger{name: name, disabled: time.Now()}
+			err := conn.QueryRowContext(ctx, `SELECT name, tbl_name, sql
+				FROM sqlite_master
+				WHERE type = 'trigger' AND name = ? COLLATE NOCASE`,
+				name).Scan(&t.name, &t.table, &t.sql)
+			if err != nil {
+				return fmt.Errorf("no trigger %s", name)
+			}
+
+			_, err = conn.ExecContext(ctx, `INSERT OR REPLACE INTO
+				vsqlite_disabled_triggers VALUES (?, ?, ?, ?)`,
+				t.name, t.table, t.sql, t.disabled.Format(time.RFC3339))
+			if err == nil {
+				_, err = conn.ExecContext(ctx, "DROP TRIGGER "+
+					quoteIdent(t.name))
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.name, err)
+			}
+			saved = append(saved, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// enableTriggers creates the disabled triggers again, all or none of them.
+// A trigger that exists again, e.g. since the transaction dropping it was
+// rolled back, is left alone.
+func enableTriggers(ctx context.Context, triggers []disabledTrigger) error {
+	return inSavepoint(ctx, func() error {
+		for _, t := range triggers {
+			var n int
+			err := conn.QueryRowContext(ctx, `SELECT count(*)
+				FROM sqlite_master
+				WHERE type = 'trigger' AND name = ? COLLATE NOCASE`,
+				t.name).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				fmt.Printf("NOTE: trigger %s exists again, it is "+
+					"left as it is.\n", t.name)
+			} else if _, err := conn.ExecContext(ctx, t.sql); err != nil {
+				return fmt.Errorf("%s: %w", t.name, err)
+			}
+
+			_, err = conn.ExecContext(ctx, `DELETE FROM
+				vsqlite_disabled_triggers WHERE name = ?`, t.name)
+			if err != nil && !isNoSuchTable(err) {
+				return err
+			}
+		}
+
+		// Leave no trace once no trigger is disabled.
+		var pending int
+		err := conn.QueryRowContext(ctx, `SELECT count(*)
+			FROM vsqlite_disabled_triggers`).Scan(&pending)
+		if err == nil && pending == 0 {
+			_, err = conn.ExecContext(ctx,
+				"DROP TABLE vsqlite_disabled_triggers")
+		}
+		if err != nil && !isNoSuchTable(err) {
+			return err
+		}
+		return nil
+	})
+}
+
+// isNoSuchTable reports whether a statement failed since the table it uses
+// doesn't exist.
+func isNoSuchTable(err error) bool {
+	return strings.Contains(err.Error(), "no such table")
+}
+
+// recoverTriggers restores the triggers a previous session disabled and
+// didn't get to restore, as recorded in vsqlite_disabled_triggers.
+func recoverTriggers() {
+	ctx := context.Background()
+
+	var triggers []disabledTrigger
+	rows, err := conn.QueryContext(ctx, `SELECT name, tbl_name, sql
+		FROM vsqlite_disabled_triggers ORDER BY disabled, rowid`)
+	if err != nil {
+		if !isNoSuchTable(err) {
+			fmt.Fprintf(os.Stderr, "WARNING: could not read the "+
+				"disabled triggers: %v\n", err)
+		}
+		return
+	}
+	for rows.Next() {
+		var t disabledTrigger
+		if err := rows.Scan(&t.name, &t.table, &t.sql); err != nil {
+			break
+		}
+		triggers = append(triggers, t)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: could not read the disabled "+
+			"triggers: %v\n", err)
+		return
+	}
+
+	if err := enableTriggers(ctx, triggers); err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: could not restore the triggers "+
+			"an earlier session disabled: %v\n", err)
+		for _, t := range triggers {
+			fmt.Fprintf(os.Stderr, "%s;\n", t.sql)
+		}
+		return
+	}
+	if len(triggers) > 0 {
+		fmt.Fprintf(os.Stderr, "NOTE: restored %d %s an earlier session "+
+			"disabled.\n", len(triggers), plural(int64(len(triggers)),
+			"trigger", "triggers"))
+	}
+}
+
+// tableTriggers returns the names of the triggers on a table.
+func tableTriggers(ctx context.Context, tbl string) ([]string, error) {
+	return queryStrings(ctx, conn, `SELECT name FROM sqlite_master
+		WHERE type = 'trigger' AND tbl_name = ? COLLATE NOCASE
+		ORDER BY name`, tbl)
+}
+
+// restoreTriggers creates the disabled triggers again before the session
+// database is closed, they would be lost otherwise.
+func restoreTriggers() {
+	if len(disabledTriggers) == 0 {
+		return
+	}
+
+	err := enableTriggers(context.Background(), disabledTriggers)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "WARNING: could not restore the disabled "+
+			"triggers: %v\n", err)
+		for _, t := range disabledTriggers {
+			fmt.Fprintf(os.Stderr, "%s;\n", t.sql)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "NOTE: restored %d disabled %s.\n",
+			len(disabledTriggers), plural(int64(len(disabledTriggers)),
+				"trigger", "triggers"))
+	}
+	disabledTriggers = nil
+}
+
+func printDisabledTriggers() {
+	if len(disabledTriggers) == 0 {
+		fmt.Println("No triggers are disabled")
+		return
+	}
+
+	tw := table.NewWriter()
+	tw.SetOutputMirror(os.Stdout)
+	tw.SetStyle(psqlStyle)
+	tw.AppendHeader(table.Row{"trigger", "table", "disabled at"})
+	for _, t := range disabledTriggers {
+		tw.AppendRow(table.Row{
+			t.name, t.table, t.disabled.Format("15:04:05"),
+		})
+	}
+	tw.Render()
+}
+
+func handleTriggerDisable(args []string) error {
+	ctx := context.Background()
+
+	var names []string
+	if len(args) == 2 && args[0] == "--table" {
+		var err error
+		names, err = tableTriggers(ctx, args[1])
+		if err != nil {
+			fmt.Printf("Trigger error: %v\n", err)
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Printf("Table %s has no triggers\n", args[1])
+			return nil
+		}
+	} else {
+		names = args
+	}
+	if len(names) == 0 {
+		fmt.Println("Usage: \\trigger disable <name ...|--table table>")
+		return errUsage
+	}
+
+	saved, err := disableTriggers(ctx, names)
+	if err != nil {
+		fmt.Printf("Trigger error: %v\n", err)
+		return err
+	}
+	disabledTriggers = append(disabledTriggers, saved...)
+
+	for _, t := range saved {
+		fmt.Printf("Disabled trigger %s on %s\n", t.name, t.table)
+	}
+	fmt.Println("HINT: \\trigger enable all creates them again, which " +
+		"also happens on exit.")
+	return nil
+}
+
+func handleTriggerEnable(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: \\trigger enable <name ...|all>")
+		return errUsage
+	}
+
+	var (
+		picked []disabledTrigger
+		rest   []disabledTrigger
+	)
+	if len(args) == 1 && args[0] == "all" {
+		picked = disabledTriggers
+	} else {
+		idx := make(map[int]bool)
+		for _, name := range args {
+			i := findDisabledTrigger(name)
+			if i < 0 {
+				err := fmt.Errorf("%s is not disabled", name)
+				fmt.Printf("Trigger error: %v\n", err)
+				return err
+			}
+			idx[i] = true
+		}
+		for i, t := range disabledTriggers {
+			if idx[i] {
+				picked = append(picked, t)
+			} else {
+				rest = append(rest, t)
+			}
+		}
+	}
+	if len(picked) == 0 {
+		fmt.Println("No triggers are disabled")
+		return nil
+	}
+
+	if err := enableTriggers(context.Background(), picked); err != nil {
+		fmt.Printf("Trigger error: %v\n", err)
+		return err
+	}
+	disabledTriggers = rest
+
+	for _, t := range picked {
+		fmt.Printf("Enabled trigger %s on %s\n", t.name, t.table)
+	}
+	return nil
+}
+
+// handleTriggerCommand takes triggers out of the way temporarily, e.g. for
+// bulk data fixes, and lists the ones disabled.
+func handleTriggerCommand(args []string) error {
+	switch {
+	case len(args) == 0 || len(args) == 1 && args[0] == "list":
+		printDisabledTriggers()
+
+	case args[0] == "disable":
+		return handleTriggerDisable(args[1:])
+
+	case args[0] == "enable":
+		return handleTriggerEnable(args[1:])
+
+	default:
+		fmt.Println("Usage: \\trigger [list]")
+		fmt.Println("       \\trigger disable <name ...|--table table>")
+		fmt.Println("       \\trigger enable <name ...|all>")
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// undoEntry is a statement run in undo mode, with the savepoint taken
+// before it.
+type undoEntry struct {
+	savepoint string
+	query     string
+	changes   int64
+}
+
+var (
+	// undoMode wraps every data change typed at the prompt in a savepoint
+	// that \undo rolls back to. See \set undo.
+	undoMode bool
+
+	// undoStack holds the statements that can be undone, most recent
+	// last. It empties when the transaction the savepoints opened ends.
+	undoStack []undoEntry
+
+	// undoCounter numbers the savepoints.
+	undoCounter int
+)
+
+func undoSetting() string {
+	if len(undoStack) == 0 {
+		return onOff(undoMode)
+	}
+	return fmt.Sprintf("%s (%d uncommitted statements)", onOff(undoMode),
+		len(undoStack))
+}
+
+func setUndoOption(args []string) error {
+	on, err := parseOnOff(args)
+	if err != nil {
+		return err
+	}
+	if on && batchMode {
+		return errors.New("undo only works at the interactive prompt, " +
+			"scripts can use SAVEPOINT and ROLLBACK TO")
+	}
+	if on && isRemoteDatabase(dbPath) {
+		return fmt.Errorf("the %s driver can't hold a transaction open "+
+			"between statements", driverFor(dbPath).name())
+	}
+
+	if on && !undoMode {
+		fmt.Println("Data changes are now kept in a transaction, " +
+			"COMMIT to keep them or \\undo to roll them back one by " +
+			"one.")
+	}
+	undoMode = on
+	return nil
+}
+
+// beginUndo takes a savepoint before a data change typed at the prompt.
+// Outside of a transaction the first savepoint opens one, which holds the
+// changes until COMMIT.
+func beginUndo(query string) (*undoEntry, bool) {
+	if !undoMode || !atPrompt || dmlTarget(query) == "" {
+		return nil, false
+	}
+
+	undoCounter++
+	e := &undoEntry{
+		savepoint: "vsqlite_undo_" + strconv.Itoa(undoCounter),
+		query:     query,
+	}
+	_, err := conn.ExecContext(context.Background(),
+		"SAVEPOINT "+e.savepoint)
+	if err != nil {
+		fmt.Printf("WARNING: can't take a savepoint, the statement "+
+			"can't be undone: %v\n", err)
+		return nil, false
+	}
+
+	return e, true
+}
+
+// endUndo records a statement run after beginUndo, or drops its savepoint
+// if it failed.
+func endUndo(e *undoEntry, changes int64, err error) {
+	if err != nil {
+		rollbackToSavepoint(e.savepoint)
+		return
+	}
+
+	e.changes = changes
+	undoStack = append(undoStack, *e)
+}
+
+// rollbackToSavepoint undoes the changes since a savepoint and removes it.
+func rollbackToSavepoint(name string) error {
+	ctx := context.Background()
+	_, err := conn.ExecContext(ctx, "ROLLBACK TO "+name)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "RELEASE "+name)
+	}
+	return err
+}
+
+// syncUndoStack forgets the savepoints once their transaction ended, by a
+// COMMIT, a ROLLBACK or by releasing the first savepoint.
+func syncUndoStack() {
+	if len(undoStack) > 0 && !inTransaction() {
+		undoStack = nil
+	}
+}
+
+// finishUndo settles the changes made in undo mode before the database is
+// closed, which would roll them back. It asks whether to commit them, and
+// commits them when it can't ask.
+func finishUndo() {
+	if len(undoStack) == 0 {
+		return
+	}
+	defer func() { undoStack = nil }()
+
+	if term.IsTerminal(int(os.Stdin.Fd())) &&
+		!confirm(fmt.Sprintf("Commit the %d statements made in undo "+
+			"mode?", len(undoStack))) {
+
+		conn.ExecContext(context.Background(), "ROLLBACK")
+		return
+	}
+
+	_, err := conn.ExecContext(context.Background(), "COMMIT")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Undo error: %v\n", err)
+	}
+}
+
+// handleUndoCommand rolls back the last n statements run in undo mode.
+func handleUndoCommand(args []string) error {
+	if len(args) > 1 {
+		fmt.Println("Usage: \\undo [N]")
+		return errUsage
+	}
+
+	n := 1
+	if len(args) == 1 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			fmt.Printf("Invalid count %q\n", args[0])
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+	}
+
+	syncUndoStack()
+	if len(undoStack) == 0 {
+		if !undoMode {
+			fmt.Println("Nothing to undo, turn undo mode on with " +
+				"\\set undo on.")
+			return nil
+		}
+		fmt.Println("Nothing to undo.")
+		return nil
+	}
+
+	for ; n > 0 && len(undoStack) > 0; n-- {
+		e := undoStack[len(undoStack)-1]
+		if err := rollbackToSavepoint(e.savepoint); err != nil {
+			fmt.Printf("Undo error: %v\n", err)
+			return err
+		}
+		undoStack = undoStack[:len(undoStack)-1]
+
+		query := strings.Join(strings.Fields(e.query), " ")
+		if displayWidth(query) > 60 {
+			query = truncateWidth(query, 60)
+		}
+		fmt.Printf("Undid %s (%d rows)\n", query, e.changes)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+)
+
+// moduleVersion returns the version of a dependency compiled into the
+// binary, or "" if the build info doesn't list it.
+func moduleVersion(path string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != path {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Version + " (replaced by " +
+				dep.Replace.Path + ")"
+		}
+		return dep.Version
+	}
+
+	return ""
+}
+
+// handleVersionCommand prints the versions of vsqlite, the driver and the
+// SQLite library, and the options SQLite was compiled with, which decide
+// whether e.g. FTS5 or the JSON functions are available.
+func handleVersionCommand(args []string) error {
+	if len(args) != 0 {
+		fmt.Println("Usage: \\version")
+		return errUsage
+	}
+
+	ctx := context.Background()
+	d := driverFor(dbPath)
+
+	fmt.Printf("vsqlite %s (%s, %s/%s)\n", versionString(),
+		runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	driver := d.name()
+	if mod := d.module(); mod != "" {
+		driver += " (" + mod
+		if v := moduleVersion(mod); v != "" {
+			driver += " " + v
+		}
+		driver += ")"
+	}
+	fmt.Printf("Driver: %s\n", driver)
+
+	var sqliteVersion, sourceID string
+	err := conn.QueryRowContext(
+		ctx, "SELECT sqlite_version(), sqlite_source_id()",
+	).Scan(&sqliteVersion, &sourceID)
+	if err != nil {
+		fmt.Printf("Version error: %v\n", err)
+		return err
+	}
+	fmt.Printf("SQLite: %s (%s)\n", sqliteVersion, sourceID)
+
+	options, err := queryStrings(ctx, conn, "PRAGMA compile_options")
+	if err != nil {
+		fmt.Printf("Version error: %v\n", err)
+		return err
+	}
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Compile option"})
+	for _, opt := range options {
+		t.AppendRow(table.Row{opt})
+	}
+	t.Render()
+	return nil
+}
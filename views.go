@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"golang.org/x/term"
+)
+
+// viewGraph holds which tables and views each view selects from.
+type viewGraph struct {
+	objs []schemaObject
+
+	// views are in the order they were created.
+	views []schemaObject
+
+	// deps maps the lower case name of a view to the names of the
+	// tables and views it refers to.
+	deps map[string][]string
+
+	// kinds maps the lower case names of tables and views to their type.
+	kinds map[string]string
+}
+
+// buildViewGraph works out the dependencies of the views. Like \alter it
+// matches names in the view definitions rather than parsing them, so a
+// name only mentioned in a string counts as well.
+func buildViewGraph(objs []schemaObject) *viewGraph {
+	g := &viewGraph{
+		objs:  objs,
+		deps:  make(map[string][]string),
+		kinds: make(map[string]string),
+	}
+	for _, o := range objs {
+		if o.typ == "table" || o.typ == "view" {
+			g.kinds[strings.ToLower(o.name)] = o.typ
+		}
+		if o.typ == "view" {
+			g.views = append(g.views, o)
+		}
+	}
+
+	for _, v := range g.views {
+		for _, o := range objs {
+			if o.typ != "table" && o.typ != "view" ||
+				strings.EqualFold(o.name, v.name) {
+
+				continue
+			}
+			if refersTo(v.sql, o.name) {
+				key := strings.ToLower(v.name)
+				g.deps[key] = append(g.deps[key], o.name)
+			}
+		}
+	}
+
+	return g
+}
+
+// ordered returns the views so that every view comes after the views it
+// depends on. Views caught in a cycle, which only false matches can make,
+// keep their creation order at the end.
+func (g *viewGraph) ordered(views []schemaObject) []schemaObject {
+	pending := append([]schemaObject(nil), views...)
+	placed := make(map[string]bool, len(views))
+	in := make(map[string]bool, len(views))
+	for _, v := range views {
+		in[strings.ToLower(v.name)] = true
+	}
+
+	var order []schemaObject
+	for len(pending) > 0 {
+		var rest []schemaObject
+		for _, v := range pending {
+			ready := true
+			for _, dep := range g.deps[strings.ToLower(v.name)] {
+				key := strings.ToLower(dep)
+				if in[key] && !placed[key] {
+					ready = false
+				}
+			}
+			if ready {
+				order = append(order, v)
+				placed[strings.ToLower(v.name)] = true
+			} else {
+				rest = append(rest, v)
+			}
+		}
+		if len(rest) == len(pending) {
+			return append(order, rest...)
+		}
+		pending = rest
+	}
+
+	return order
+}
+
+// dependents returns the views depending on a table or view, directly or
+// through other views.
+func (g *viewGraph) dependents(name string) []schemaObject {
+	found := map[string]bool{strings.ToLower(name): true}
+	for changed := true; changed; {
+		changed = false
+		for _, v := range g.views {
+			key := strings.ToLower(v.name)
+			if found[key] {
+				continue
+			}
+			for _, dep := range g.deps[key] {
+				if found[strings.ToLower(dep)] {
+					found[key] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var views []schemaObject
+	for _, v := range g.views {
+		key := strings.ToLower(v.name)
+		if found[key] && !strings.EqualFold(v.name, name) {
+			views = append(views, v)
+		}
+	}
+	return views
+}
+
+// checkView reports why a view can't be queried, nil if it can. SQLite
+// only resolves the names in a view when it is used.
+func checkView(ctx context.Context, name string) error {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf(
+		"SELECT * FROM %s LIMIT 0", quoteIdent(name),
+	))
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// printViewDeps lists every view with what it depends on, or the views
+// depending on one table or view as a tree.
+func printViewDeps(ctx context.Context, g *viewGraph, name string) {
+	if name != "" {
+		kind, ok := g.kinds[strings.ToLower(name)]
+		if !ok {
+			fmt.Printf("Views error: no table or view %s\n", name)
+			return
+		}
+		fmt.Printf("%s (%s)\n", name, kind)
+		if len(g.dependents(name)) == 0 {
+			fmt.Println("  no views depend on it")
+			return
+		}
+		printViewTree(g, name, "  ", map[string]bool{})
+		return
+	}
+
+	if len(g.views) == 0 {
+		fmt.Println("No views")
+		return
+	}
+
+	tw := table.NewWriter()
+	tw.SetOutputMirror(os.Stdout)
+	tw.SetStyle(psqlStyle)
+	tw.AppendHeader(table.Row{"view", "depends on", "status"})
+	for _, v := range g.ordered(g.views) {
+		var deps []string
+		for _, dep := range g.deps[strings.ToLower(v.name)] {
+			deps = append(deps, fmt.Sprintf("%s (%s)", dep,
+				g.kinds[strings.ToLower(dep)]))
+		}
+
+		status := "ok"
+		if err := checkView(ctx, v.name); err != nil {
+			status = "broken: " + err.Error()
+		}
+		tw.AppendRow(table.Row{v.name, strings.Join(deps, ", "), status})
+	}
+	tw.Render()
+}
+
+// printViewTree prints the views depending directly on name, each followed
+// by its own dependents.
+func printViewTree(g *viewGraph, name, indent string, seen map[string]bool) {
+	for _, v := range g.views {
+		key := strings.ToLower(v.name)
+		direct := false
+		for _, dep := range g.deps[key] {
+			direct = direct || strings.EqualFold(dep, name)
+		}
+		if !direct || seen[key] {
+			continue
+		}
+
+		fmt.Printf("%s└─ %s\n", indent, v.name)
+		seen[key] = true
+		printViewTree(g, v.name, indent+"   ", seen)
+		delete(seen, key)
+	}
+}
+
+// viewRebuild drops views and creates them again, with the INSTEAD OF
+// triggers dropped along with them.
+type viewRebuild struct {
+	drop     []string
+	recreate []string
+
+	// views are checked once created.
+	views []string
+}
+
+func planViewRebuild(g *viewGraph, views []schemaObject) *viewRebuild {
+	order := g.ordered(views)
+	p := &viewRebuild{}
+	for i := len(order) - 1; i >= 0; i-- {
+		p.drop = append(p.drop, "DROP VIEW "+quoteIdent(order[i].name))
+	}
+	for _, v := range order {
+		p.recreate = append(p.recreate, v.sql)
+		p.views = append(p.views, v.name)
+	}
+	for _, o := range g.objs {
+		if o.typ != "trigger" {
+			continue
+		}
+		for _, v := range order {
+			if strings.EqualFold(o.tblName, v.name) {
+				p.recreate = append(p.recreate, o.sql)
+			}
+		}
+	}
+	return p
+}
+
+func (p *viewRebuild) script() string {
+	var b strings.Builder
+	b.WriteString("BEGIN;\n\n")
+	for _, stmt := range p.drop {
+		fmt.Fprintf(&b, "%s;\n", stmt)
+	}
+	b.WriteString("\n")
+	for _, stmt := range p.recreate {
+		fmt.Fprintf(&b, "%s;\n", stmt)
+	}
+	b.WriteString("\nCOMMIT;\n")
+	return b.String()
+}
+
+// run rebuilds the views in a savepoint, which is rolled back if any view
+// fails to be created or queried afterwards.
+func (p *viewRebuild) run(ctx context.Context) error {
+	return inSavepoint(ctx, func() error {
+		for _, stmt := range append(p.drop, p.recreate...) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf("%s: %w", normalizeSQL(stmt), err)
+			}
+		}
+		for _, name := range p.views {
+			if err := checkView(ctx, name); err != nil {
+				return fmt.Errorf("view %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// handleViewsRebuild drops and creates again the views depending on a
+// table or view, or all views, in dependency order. The script is printed
+// and run after confirmation or right away with --run.
+func handleViewsRebuild(ctx context.Context, g *viewGraph,
+	args []string) error {
+
+	run := len(args) > 0 && args[0] == "--run"
+	if run {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		fmt.Println("Usage: \\views rebuild [--run] [table|view]")
+		return errUsage
+	}
+
+	views := g.views
+	if len(args) == 1 {
+		name := args[0]
+		kind, ok := g.kinds[strings.ToLower(name)]
+		if !ok {
+			err := fmt.Errorf("no table or view %s", name)
+			fmt.Printf("Views error: %v\n", err)
+			return err
+		}
+		views = g.dependents(name)
+		if kind == "view" {
+			for _, v := range g.views {
+				if strings.EqualFold(v.name, name) {
+					views = append(views, v)
+				}
+			}
+		}
+	}
+	if len(views) == 0 {
+		fmt.Println("No views to rebuild")
+		return nil
+	}
+
+	p := planViewRebuild(g, views)
+	fmt.Print(p.script())
+
+	interactive := term.IsTerminal(int(os.Stdin.Fd()))
+	if !run && !(interactive && confirm("Rebuild the views now?")) {
+		return nil
+	}
+
+	if err := p.run(ctx); err != nil {
+		fmt.Printf("Views error: %v\n", err)
+		fmt.Println("HINT: nothing was changed, fix the view with " +
+			"DROP VIEW and CREATE VIEW.")
+		return err
+	}
+	fmt.Printf("Rebuilt %d %s\n", len(p.views),
+		plural(int64(len(p.views)), "view", "views"))
+	return nil
+}
+
+// handleViewsCommand shows how views depend on tables and each other, and
+// rebuilds chains of views after a table change.
+func handleViewsCommand(args []string) error {
+	ctx := context.Background()
+
+	usage := func() error {
+		fmt.Println("Usage: \\views deps [table|view]")
+		fmt.Println("       \\views rebuild [--run] [table|view]")
+		return errUsage
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	objs, err := userSchemaObjects(ctx, conn)
+	if err != nil {
+		fmt.Printf("Views error: %v\n", err)
+		return err
+	}
+	g := buildViewGraph(objs)
+
+	switch {
+	case args[0] == "deps" && len(args) <= 2:
+		name := ""
+		if len(args) == 2 {
+			name = args[1]
+		}
+		printViewDeps(ctx, g, name)
+
+	case args[0] == "rebuild":
+		return handleViewsRebuild(ctx, g, args[1:])
+
+	default:
+		return usage()
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// formatByteSize formats a file size with a binary unit.
+func formatByteSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// checkWALFiles reports a write-ahead log left next to the database. SQLite
+// removes it when the last connection closes, so one that is still there
+// belongs to a process using the database or one that crashed. Until it is
+// checkpointed, recent changes live only in the log and the database file
+// looks too small, or out of date when copied on its own. If no other
+// process is known to hold the database open, checkpointing is offered
+// unless the session is read-only. SQLite only copies what no other
+// connection still needs, so this is safe even if one was missed.
+func checkWALFiles() {
+	if quietMode || dbPath == ":memory:" || isRemoteDatabase(dbPath) ||
+		isSSHDatabase(dbPath) {
+
+		return
+	}
+
+	file := databaseFile(dbPath)
+	info, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	wal, err := os.Stat(file + "-wal")
+	if err != nil || wal.Size() == 0 {
+		return
+	}
+
+	fmt.Printf("NOTE: %s-wal holds %s of changes not yet checkpointed "+
+		"into the database file (%s).\n", file,
+		formatByteSize(wal.Size()), formatByteSize(info.Size()))
+
+	holders := lockHolders(file)
+	if len(holders) > 0 {
+		fmt.Printf("NOTE: the database is open in %s, which "+
+			"checkpoints on its own; copy the -wal file along with "+
+			"the database until then.\n",
+			strings.Join(holders, ", "))
+		return
+	}
+	if readOnly {
+		fmt.Println("NOTE: unless another process uses the database, " +
+			"the log is left over from one that did not close it; " +
+			"it is checkpointed when the database is next opened " +
+			"for writing and closed.")
+		return
+	}
+
+	if !confirm("Checkpoint it into the database and truncate it?") {
+		return
+	}
+	checkpointWAL()
+}
+
+// checkpointWAL copies the write-ahead log into the database and truncates
+// it, reporting readers or writers that kept it from completing.
+func checkpointWAL() {
+	var busy, logFrames, checkpointed int
+	err := conn.QueryRowContext(
+		context.Background(), "PRAGMA wal_checkpoint(TRUNCATE)",
+	).Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		fmt.Printf("Checkpoint error: %v\n", err)
+		return
+	}
+
+	if busy != 0 {
+		fmt.Printf("Checkpoint incomplete, %d of %d frames copied: "+
+			"another connection is reading or writing the "+
+			"database.\n", checkpointed, logFrames)
+		return
+	}
+	fmt.Println("Checkpointed the write-ahead log into the database.")
+}
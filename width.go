@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/mattn/go-runewidth"
+)
+
+// displayWidth returns the number of terminal cells s occupies, counting
+// wide characters such as CJK and emoji as two cells. Byte or rune counts
+// misalign any output containing them.
+func displayWidth(s string) int {
+	return runewidth.StringWidth(s)
+}
+
+// padRight pads s with spaces to fill width terminal cells.
+func padRight(s string, width int) string {
+	return runewidth.FillRight(s, width)
+}
+
+// truncateWidth shortens s to at most width terminal cells, ending it with
+// an ellipsis if anything was cut.
+func truncateWidth(s string, width int) string {
+	return runewidth.Truncate(s, width, "…")
+}
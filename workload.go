@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// workloadEntry is a single line of a JSONL workload file: a statement as
+// it was run, for replaying it later.
+type workloadEntry struct {
+	Time       string          `json:"time"`
+	Statement  string          `json:"statement"`
+	Params     []workloadParam `json:"params,omitempty"`
+	DurationMs float64         `json:"duration_ms"`
+	Rows       int             `json:"rows"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// workloadParam is a value bound to a parameter of a statement, as an SQL
+// literal, with the parameter's name if it was bound by name.
+type workloadParam struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+}
+
+// workloadRecorder appends the statements run in the session to a workload
+// file, see \workload.
+type workloadRecorder struct {
+	path string
+	f    *os.File
+	enc  *json.Encoder
+	n    int
+}
+
+// workload is the active recording, nil when not recording.
+var workload *workloadRecorder
+
+// record writes one statement. Its duration includes showing the result.
+// Failing to write never interrupts the session, but the user is told about
+// it.
+func (w *workloadRecorder) record(stmt string, args []interface{},
+	start time.Time, rows int, err error) {
+
+	entry := workloadEntry{
+		Time:       start.UTC().Format(time.RFC3339Nano),
+		Statement:  stmt,
+		DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		Rows:       rows,
+	}
+	for _, arg := range args {
+		var p workloadParam
+		if named, ok := arg.(sql.NamedArg); ok {
+			p.Name, arg = named.Name, named.Value
+		}
+		p.Value = sqlLiteral(arg)
+		entry.Params = append(entry.Params, p)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := w.enc.Encode(entry); err != nil {
+		fmt.Printf("Failed to write workload: %v\n", err)
+		return
+	}
+	w.n++
+}
+
+// args returns the values to bind to the parameters of the statement.
+func (e *workloadEntry) args() ([]interface{}, error) {
+	var args []interface{}
+	for _, p := range e.Params {
+		v, err := parseBindValue(p.Value, "")
+		if err != nil {
+			return nil, err
+		}
+		if p.Name != "" {
+			v = sql.Named(p.Name, v)
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+func handleWorkloadCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		if workload == nil {
+			fmt.Println("Not recording a workload")
+		} else {
+			fmt.Printf("Recording the workload to %s, %d statements "+
+				"so far\n", workload.path, workload.n)
+		}
+
+	case args[0] == "record" && len(args) == 2:
+		f, err := os.OpenFile(args[1],
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Printf("Workload error: %v\n", err)
+			return err
+		}
+		stopWorkload()
+		workload = &workloadRecorder{path: args[1], f: f,
+			enc: json.NewEncoder(f)}
+		fmt.Printf("Recording the workload to %s\n", args[1])
+
+	case args[0] == "stop" && len(args) == 1:
+		if workload == nil {
+			fmt.Println("Not recording a workload")
+			return nil
+		}
+		fmt.Printf("Recorded %d statements to %s\n", workload.n,
+			workload.path)
+		stopWorkload()
+
+	default:
+		fmt.Println("Usage: \\workload [record <file>|stop]")
+		return errUsage
+	}
+	return nil
+}
+
+func stopWorkload() {
+	if workload == nil {
+		return
+	}
+
+	workload.f.Close()
+	workload = nil
+}
+
+// readWorkload returns the entries of a workload file in order.
+func readWorkload(path string) ([]workloadEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []workloadEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var e workloadEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// replayStats adds up the runs of one statement.
+type replayStats struct {
+	statement          string
+	runs               int
+	recorded, replayed time.Duration
+
+	// newErrors counts the runs that failed in the replay only, and
+	// lastError is the error of the last failed run.
+	newErrors int
+	lastError error
+}
+
+// change returns the relative change of the replayed time over the
+// recorded one.
+func (s *replayStats) change() float64 {
+	if s.recorded == 0 {
+		return 0
+	}
+	return float64(s.replayed-s.recorded) / float64(s.recorded)
+}
+
+// replayStatement runs a statement and reads all of its rows.
+func replayStatement(ctx context.Context, c *sql.Conn,
+	e *workloadEntry) error {
+
+	args, err := e.args()
+	if err != nil {
+		return err
+	}
+	rows, err := c.QueryContext(ctx, e.Statement, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// printReplayReport compares the replayed statements to their recording:
+// the latency percentiles of all runs, the statements that slowed down
+// most, and the ones that failed only in the replay.
+func printReplayReport(stats []*replayStats, recorded,
+	replayed []time.Duration, top int) {
+
+	sort.Slice(recorded, func(i, j int) bool {
+		return recorded[i] < recorded[j]
+	})
+	sort.Slice(replayed, func(i, j int) bool {
+		return replayed[i] < replayed[j]
+	})
+	var latency []string
+	for _, p := range []float64{50, 95, 99} {
+		latency = append(latency, fmt.Sprintf("p%.0f %s -> %s", p,
+			percentile(recorded, p).Round(time.Microsecond),
+			percentile(replayed, p).Round(time.Microsecond)))
+	}
+	fmt.Printf("Latency %s\n", strings.Join(latency, ", "))
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		di := stats[i].replayed - stats[i].recorded
+		dj := stats[j].replayed - stats[j].recorded
+		return di > dj
+	})
+
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetStyle(psqlStyle)
+	t.AppendHeader(table.Row{"Statement", "Runs", "Recorded", "Replayed",
+		"Change"})
+	t.SetColumnConfigs([]table.ColumnConfig{
+		{Number: 1, WidthMax: 60},
+		{Number: 2, Align: text.AlignRight},
+		{Number: 3, Align: text.AlignRight},
+		{Number: 4, Align: text.AlignRight},
+		{Number: 5, Align: text.AlignRight},
+	})
+	for _, s := range stats[:min(top, len(stats))] {
+		n := time.Duration(s.runs)
+		t.AppendRow(table.Row{
+			strings.Join(strings.Fields(s.statement), " "), s.runs,
+			(s.recorded / n).Round(time.Microsecond),
+			(s.replayed / n).Round(time.Microsecond),
+			fmt.Sprintf("%+.0f%%", 100*s.change()),
+		})
+	}
+	fmt.Println()
+	t.Render()
+
+	for _, s := range stats {
+		if s.newErrors > 0 {
+			fmt.Printf("WARNING: failed %d of %d times, only in the "+
+				"replay: %s\n  %v\n", s.newErrors, s.runs,
+				strings.Join(strings.Fields(s.statement), " "),
+				s.lastError)
+		}
+	}
+	fmt.Println("NOTE: the recorded times include showing the " +
+		"results, the replay only reads them.")
+}
+
+// replayFlags are the options of the replay subcommand.
+var replayFlags struct {
+	pace bool
+	top  int
+}
+
+// defineReplayFlags defines the options of the replay subcommand.
+func defineReplayFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&replayFlags.pace, "pace", false, "wait between the "+
+		"statements as long as when they were recorded")
+	fs.IntVar(&replayFlags.top, "top", 20, "show this many of the "+
+		"statements that slowed down most")
+}
+
+// runReplayCommand runs the statements of a workload file against a
+// database and compares how long they take to the recording, to check that
+// a schema change doesn't slow down real usage. The statements run in
+// order on one connection, right after each other or, with -pace, as far
+// apart as they were recorded. ^C stops the replay and reports on what ran.
+// The exit status is 1 if the replay was stopped, or statements failed that
+// didn't when recorded.
+func runReplayCommand(args []string) int {
+	fs := newSubcommandFlags("replay")
+	fs.Parse(args)
+	pace, top := replayFlags.pace, replayFlags.top
+
+	if fs.NArg() != 2 || top < 0 {
+		fs.Usage()
+		return 1
+	}
+
+	entries, err := readWorkload(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %v\n", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Fprintln(os.Stderr, "Replay error: the workload is empty")
+		return 1
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	db, err := openDatabase(fs.Arg(0), false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %v\n", err)
+		return 1
+	}
+	defer c.Close()
+
+	var (
+		stats              []*replayStats
+		byStatement        = make(map[string]*replayStats)
+		recorded, replayed []time.Duration
+		failed, newFailed  int
+		first              time.Time
+		start              = time.Now()
+	)
+	for i := range entries {
+		e := &entries[i]
+
+		if pace {
+			at, err := time.Parse(time.RFC3339Nano, e.Time)
+			if err == nil && first.IsZero() {
+				first = at
+			}
+			if err == nil {
+				wait := time.NewTimer(time.Until(start.Add(at.Sub(first))))
+				select {
+				case <-wait.C:
+				case <-ctx.Done():
+					wait.Stop()
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		began := time.Now()
+		err := replayStatement(ctx, c, e)
+		elapsed := time.Since(began)
+		if ctx.Err() != nil {
+			break
+		}
+
+		s := byStatement[e.Statement]
+		if s == nil {
+			s = &replayStats{statement: e.Statement}
+			byStatement[e.Statement] = s
+			stats = append(stats, s)
+		}
+		took := time.Duration(e.DurationMs * float64(time.Millisecond))
+		s.runs++
+		s.recorded += took
+		s.replayed += elapsed
+		recorded = append(recorded, took)
+		replayed = append(replayed, elapsed)
+
+		if err != nil {
+			failed++
+			s.lastError = err
+			if e.Error == "" {
+				s.newErrors++
+				newFailed++
+			}
+		}
+	}
+
+	fmt.Printf("Replayed %d of %d statements in %s, %d failed\n",
+		len(replayed), len(entries),
+		time.Since(start).Truncate(time.Millisecond), failed)
+	if len(replayed) > 0 {
+		printReplayReport(stats, recorded, replayed, top)
+	}
+
+	if len(replayed) < len(entries) || newFailed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	// minWrapWidth is the narrowest a column is wrapped to.
+	minWrapWidth = 8
+
+	// wrapMarker ends the lines of a cell that continue on the next one.
+	wrapMarker = "↵"
+)
+
+// wrapCells wraps long cells within their column instead of widening the
+// table past the terminal, see \pset wrap.
+var wrapCells bool
+
+// wrapColumnWidths returns the widths to wrap the columns of a table to so
+// that it fits the terminal, or nil if it fits as it is. natural are the
+// widths of the widest line of each column, see rowBuffer. The widest
+// columns give up space first, down to minWrapWidth or their header's
+// width.
+func wrapColumnWidths(cols []string, natural []int, width int) []int {
+	if width <= 0 || len(cols) == 0 {
+		return nil
+	}
+
+	floor := make([]int, len(cols))
+	for i, col := range cols {
+		floor[i] = max(minWrapWidth, displayWidth(col))
+	}
+
+	// Every column is padded by a space on both sides and separated from
+	// the next by a bar.
+	avail := width - 3*len(cols) + 1
+
+	sum := func(limit int) int {
+		total := 0
+		for i, w := range natural {
+			total += max(min(w, limit), min(w, floor[i]))
+		}
+		return total
+	}
+	widest := 0
+	for _, w := range natural {
+		widest = max(widest, w)
+	}
+	if sum(widest) <= avail {
+		return nil
+	}
+
+	// Find the largest limit that fits, cutting the widest columns down
+	// to it.
+	limit := widest
+	for limit > minWrapWidth && sum(limit) > avail {
+		limit--
+	}
+
+	widths := make([]int, len(cols))
+	for i, w := range natural {
+		widths[i] = max(min(w, limit), min(w, floor[i]))
+	}
+	return widths
+}
+
+// wrapCell breaks the lines of a cell longer than width at word boundaries
+// where possible, marking the lines that were broken.
+func wrapCell(s string, width int) string {
+	if width < 2 || displayWidth(s) <= width &&
+		!strings.Contains(s, "\n") {
+
+		return s
+	}
+
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if displayWidth(line) <= width {
+			out = append(out, line)
+			continue
+		}
+
+		parts := strings.Split(text.WrapSoft(line, width-1), "\n")
+		for i, part := range parts {
+			if i < len(parts)-1 {
+				part = padRight(part, width-1) + wrapMarker
+			}
+			out = append(out, part)
+		}
+	}
+	return strings.Join(out, "\n")
+}
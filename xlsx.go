@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// xlsxMaxExactInt is the largest integer a spreadsheet shows without
+	// losing digits: Excel keeps 15 significant digits, so a 16 digit ID
+	// would end in a zero. Larger integers are written as text.
+	xlsxMaxExactInt = 999_999_999_999_999
+
+	// Cell style indexes into cellXfs of xlsxStyles.
+	xlsxStyleDefault  = 0
+	xlsxStyleHeader   = 1
+	xlsxStyleDateTime = 2
+)
+
+// xlsxEpoch is day zero of the spreadsheet date system. Using Dec 30 rather
+// than Dec 31 accounts for the fictional Feb 29, 1900 of the 1900 system.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxTimestampRe matches text that looks like an SQLite date or datetime,
+// which is how timestamps are usually stored.
+var xlsxTimestampRe = regexp.MustCompile(
+	`^\d{4}-\d{2}-\d{2}(?:[ T]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?` +
+		`(?:Z|[+-]\d{2}:\d{2})?)?$`,
+)
+
+var xlsxTimestampLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Result" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+const xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>
+<sheetData>
+`
+
+const xlsxSheetFooter = `</sheetData>
+</worksheet>`
+
+// xlsxWriter streams a single-sheet workbook. Rows are written straight to
+// the zip archive, so memory use doesn't grow with the result size.
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	zw := zip.NewWriter(w)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet must be the last entry since it stays open for
+	// streaming.
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zw: zw, sheet: sheet}, nil
+}
+
+// xlsxColumnName converts a zero based column index to its letter name, e.g.
+// 0 to A and 27 to AB.
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxEscape escapes text for XML, dropping characters XML can't represent
+// at all.
+func xlsxEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' || r >= ' ' {
+			return r
+		}
+		return -1
+	}, s)
+
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func parseTimestampText(s string) (time.Time, bool) {
+	if !xlsxTimestampRe.MatchString(s) {
+		return time.Time{}, false
+	}
+
+	for _, layout := range xlsxTimestampLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// xlsxSerial converts a time to a spreadsheet serial date, keeping the wall
+// clock of its own time zone since spreadsheets have no notion of zones.
+func xlsxSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(),
+		t.Second(), t.Nanosecond(), time.UTC)
+
+	return wall.Sub(xlsxEpoch).Hours() / 24
+}
+
+// cell renders a single typed cell.
+func (x *xlsxWriter) cell(ref string, val interface{}, style int) string {
+	number := func(v string, s int) string {
+		return fmt.Sprintf(`<c r="%s" s="%d"><v>%s</v></c>`, ref, s, v)
+	}
+	inline := func(v string) string {
+		return fmt.Sprintf(`<c r="%s" s="%d" t="inlineStr">`+
+			`<is><t xml:space="preserve">%s</t></is></c>`,
+			ref, style, xlsxEscape(v))
+	}
+
+	switch v := val.(type) {
+	case nil:
+		return ""
+
+	case int64:
+		if v > xlsxMaxExactInt || v < -xlsxMaxExactInt {
+			return inline(strconv.FormatInt(v, 10))
+		}
+		return number(strconv.FormatInt(v, 10), style)
+
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return inline(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return number(strconv.FormatFloat(v, 'g', -1, 64), style)
+
+	case bool:
+		b := "0"
+		if v {
+			b = "1"
+		}
+		return fmt.Sprintf(`<c r="%s" s="%d" t="b"><v>%s</v></c>`,
+			ref, style, b)
+
+	case time.Time:
+		return number(strconv.FormatFloat(
+			xlsxSerial(v), 'f', -1, 64,
+		), xlsxStyleDateTime)
+
+	case []byte:
+		return inline(`\x` + strings.ToUpper(hex.EncodeToString(v)))
+
+	case string:
+		if style == xlsxStyleHeader {
+			return inline(v)
+		}
+		if t, ok := parseTimestampText(v); ok {
+			return x.cell(ref, t, style)
+		}
+		return inline(v)
+
+	default:
+		return inline(fmt.Sprint(v))
+	}
+}
+
+// writeRow appends a row of values to the sheet.
+func (x *xlsxWriter) writeRow(vals []interface{}, style int) error {
+	x.row++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.row)
+	for i, val := range vals {
+		ref := xlsxColumnName(i) + strconv.Itoa(x.row)
+		b.WriteString(x.cell(ref, val, style))
+	}
+	b.WriteString("</row>\n")
+
+	_, err := x.sheet.WriteString(b.String())
+	return err
+}
+
+func (x *xlsxWriter) writeHeader(cols []string) error {
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		vals[i] = col
+	}
+	return x.writeRow(vals, xlsxStyleHeader)
+}
+
+// Close finishes the sheet and the archive.
+func (x *xlsxWriter) Close() error {
+	if _, err := x.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
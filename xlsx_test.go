@@ -0,0 +1,31 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXLSXIntegerCells(t *testing.T) {
+	tests := []struct {
+		val  int64
+		text bool
+	}{
+		{0, false},
+		{-42, false},
+		{999_999_999_999_999, false},
+		{-999_999_999_999_999, false},
+		{1_000_000_000_000_000, true},
+		{4_111_111_111_111_111, true},
+		{-1_000_000_000_000_000, true},
+		{1 << 53, true},
+	}
+
+	var x xlsxWriter
+	for _, tc := range tests {
+		cell := x.cell("A1", tc.val, xlsxStyleDefault)
+		if text := strings.Contains(cell, `t="inlineStr"`); text != tc.text {
+			t.Errorf("cell(%d) = %s, want text %v", tc.val, cell,
+				tc.text)
+		}
+	}
+}